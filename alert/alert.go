@@ -0,0 +1,80 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"time"
+)
+
+const (
+	// The condition holds but not for the duration yet
+	AlertStatusPending = "pending"
+	AlertStatusFiring  = "firing"
+	// Only in the history when the firing alert no longer holds
+	AlertStatusResolved = "resolved"
+)
+
+// Alert is the state of the rule whose condition holds. It is removed when the condition no longer holds.
+type Alert struct {
+	RuleName string
+	Status   string
+	Value    float64
+	Message  string
+	// When the condition starts to hold
+	ActiveTime    time.Time
+	FiredTime     time.Time
+	EvaluatedTime time.Time
+}
+
+// AlertHistory records the alert fired or resolved
+type AlertHistory struct {
+	RuleName    string
+	Status      string
+	Value       float64
+	Message     string
+	CreatedTime time.Time
+}
+
+// GetAllAlert returns the pending and firing alerts
+func GetAllAlert() ([]Alert, error) {
+	return storage.GetAllAlert(indexAlertStateIndex, typeAlertState)
+}
+
+// SearchAlertHistory returns the history sorted by CreatedTime in descending order. The empty rule name is for all rules.
+func SearchAlertHistory(ruleName string, from *time.Time, to *time.Time, size int, offset int) ([]AlertHistory, error) {
+	if from != nil && to != nil && from.After(*to) {
+		return nil, errors.New("From " + from.String() + " can't be after to " + to.String())
+	}
+	return storage.SearchAlertHistory(indexAlertHistoryIndex, typeAlertHistory, ruleName, from, to, size, offset)
+}
+
+func saveAlertHistory(alertHistory *AlertHistory) error {
+	// The history is saved in the index of its period and searched with the alias
+	index := rollover.GetIndexName(indexAlertHistoryIndex, alertHistory.CreatedTime)
+	id := alertHistory.RuleName + "_" + alertHistory.CreatedTime.UTC().Format(time.RFC3339Nano)
+	return storage.SaveAlertHistory(index, typeAlertHistory, id, alertHistory)
+}
+
+// DeleteExpiredAlertHistoryIndex deletes the alert history indices older than the retention
+func DeleteExpiredAlertHistoryIndex(now time.Time) error {
+	indexSlice, err := storage.GetAllIndex(indexAlertHistoryIndex + rollover.Separator + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return rollover.DeleteExpiredIndex(rollover.KindAlertHistory, indexSlice, now, storage.DeleteIndex)
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/cloudawan/cloudone_analysis/notification"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"strconv"
+	"time"
+)
+
+// EvaluateAllRule evaluates each rule with the metrics in its window ending now. The alert fires after the condition
+// holds for the duration and resolves once the condition doesn't hold. The alert is kept if the metrics can't be searched.
+func EvaluateAllRule(now time.Time) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("EvaluateAllRule Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	ruleSlice, err := storage.GetAllRule(indexAlertRuleIndex, typeAlertRule)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	alertSlice, err := storage.GetAllAlert(indexAlertStateIndex, typeAlertState)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	// rule name -> alert
+	alertMap := make(map[string]*Alert)
+	for i, _ := range alertSlice {
+		alertMap[alertSlice[i].RuleName] = &alertSlice[i]
+	}
+
+	for i, _ := range ruleSlice {
+		rule := &ruleSlice[i]
+		alert := alertMap[rule.Name]
+		delete(alertMap, rule.Name)
+
+		value, ok, err := rule.getValue(now)
+		if err != nil {
+			log.Error("Fail to evaluate the rule %s with error %s", rule.Name, err)
+			continue
+		}
+
+		newAlert, alertHistory := evaluate(rule, alert, value, ok, now)
+		if err := saveEvaluation(rule.Name, newAlert, alertHistory); err != nil {
+			log.Error(err)
+		}
+	}
+
+	// The rules deleted
+	for ruleName, _ := range alertMap {
+		if err := storage.DeleteAlert(indexAlertStateIndex, typeAlertState, ruleName); err != nil {
+			log.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// getValue returns the value in the window ending now and false if there is no data
+func (rule *Rule) getValue(now time.Time) (float64, bool, error) {
+	from := now.Add(-time.Duration(rule.WindowInSecond) * time.Second)
+	switch rule.Kind {
+	case RuleKindEvent:
+		// No matched event is the count 0 instead of no data
+		count, err := countEvent(rule, from, now)
+		return count, err == nil, err
+	default:
+		return monitor.GetMetricWindowValue(rule.getMetricLabels(), rule.Metric, rule.Aggregator, from, now)
+	}
+}
+
+func saveEvaluation(ruleName string, alert *Alert, alertHistory *AlertHistory) error {
+	if alert != nil {
+		if err := storage.SaveAlert(indexAlertStateIndex, typeAlertState, alert); err != nil {
+			log.Error(err)
+			return err
+		}
+	} else {
+		if err := storage.DeleteAlert(indexAlertStateIndex, typeAlertState, ruleName); err != nil &&
+			err.Error() != notFoundErrorMessage {
+			log.Error(err)
+			return err
+		}
+	}
+	if alertHistory != nil {
+		if err := saveAlertHistory(alertHistory); err != nil {
+			log.Error(err)
+			return err
+		}
+		// The failure of the notification doesn't fail the evaluation
+		subject := "Alert " + alertHistory.RuleName + " is " + alertHistory.Status
+		if err := notification.Publish(notification.TopicAlert, subject, alertHistory.Message, alertHistory); err != nil {
+			log.Error(err)
+		}
+	}
+	return nil
+}
+
+// evaluate returns the alert after the evaluation, which is nil if the condition doesn't hold, and the history
+// if the alert fires or resolves. The condition doesn't hold without data.
+func evaluate(rule *Rule, alert *Alert, value float64, ok bool, now time.Time) (*Alert, *AlertHistory) {
+	matched := false
+	if ok {
+		matched, _ = compare(value, rule.Comparison, rule.Threshold)
+	}
+	message := rule.getDescription() + " is " + strconv.FormatFloat(value, 'g', -1, 64)
+	if ok == false {
+		message = rule.getDescription() + " has no data"
+	}
+
+	if matched == false {
+		if alert != nil && alert.Status == AlertStatusFiring {
+			return nil, &AlertHistory{rule.Name, AlertStatusResolved, value, message, now}
+		}
+		return nil, nil
+	}
+
+	if alert == nil {
+		alert = &Alert{rule.Name, AlertStatusPending, value, message, now, time.Time{}, now}
+	}
+	alert.Value = value
+	alert.Message = message
+	alert.EvaluatedTime = now
+
+	if alert.Status == AlertStatusPending && now.Sub(alert.ActiveTime) >= time.Duration(rule.DurationInSecond)*time.Second {
+		alert.Status = AlertStatusFiring
+		alert.FiredTime = now
+		return alert, &AlertHistory{rule.Name, AlertStatusFiring, value, message, now}
+	}
+	return alert, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func createTestRule() *Rule {
+	return &Rule{
+		Name:             "nginx-memory",
+		Metric:           "memoryUsage",
+		Scope:            RuleScopeReplicationController,
+		Namespace:        "default",
+		Target:           "nginx",
+		Aggregator:       "avg",
+		WindowInSecond:   300,
+		Comparison:       ComparisonGreaterThan,
+		Threshold:        100,
+		DurationInSecond: 60,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rule := createTestRule()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Pending before the duration
+	alert, alertHistory := evaluate(rule, nil, 150, true, now)
+	if alert == nil || alert.Status != AlertStatusPending || alertHistory != nil {
+		t.Fatalf("Expect pending without history but get %v %v", alert, alertHistory)
+	}
+	alert, alertHistory = evaluate(rule, alert, 150, true, now.Add(30*time.Second))
+	if alert.Status != AlertStatusPending || alertHistory != nil {
+		t.Errorf("Expect pending without history but get %v %v", alert, alertHistory)
+	}
+
+	// Fire after the duration
+	alert, alertHistory = evaluate(rule, alert, 200, true, now.Add(60*time.Second))
+	if alert.Status != AlertStatusFiring || alert.FiredTime.Equal(now.Add(60*time.Second)) == false {
+		t.Errorf("Expect firing but get %v", alert)
+	}
+	if alertHistory == nil || alertHistory.Status != AlertStatusFiring || alertHistory.Value != 200 {
+		t.Errorf("Expect the firing history but get %v", alertHistory)
+	}
+
+	// Fire only once
+	alert, alertHistory = evaluate(rule, alert, 200, true, now.Add(90*time.Second))
+	if alert.Status != AlertStatusFiring || alertHistory != nil {
+		t.Errorf("Expect firing without history but get %v %v", alert, alertHistory)
+	}
+
+	// Resolve
+	alert, alertHistory = evaluate(rule, alert, 50, true, now.Add(120*time.Second))
+	if alert != nil || alertHistory == nil || alertHistory.Status != AlertStatusResolved {
+		t.Errorf("Expect resolved but get %v %v", alert, alertHistory)
+	}
+
+	// The pending alert is removed without history
+	alert, _ = evaluate(rule, nil, 150, true, now)
+	alert, alertHistory = evaluate(rule, alert, 150, false, now.Add(30*time.Second))
+	if alert != nil || alertHistory != nil {
+		t.Errorf("Expect nothing without data but get %v %v", alert, alertHistory)
+	}
+
+	// Fire immediately without the duration
+	rule.DurationInSecond = 0
+	alert, alertHistory = evaluate(rule, nil, 150, true, now)
+	if alert == nil || alert.Status != AlertStatusFiring || alertHistory == nil {
+		t.Errorf("Expect firing immediately but get %v %v", alert, alertHistory)
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	if err := ValidateRule(createTestRule()); err != nil {
+		t.Error(err)
+	}
+
+	for _, modify := range []func(rule *Rule){
+		func(rule *Rule) { rule.Name = "Nginx_Memory" },
+		func(rule *Rule) { rule.Scope = "cluster" },
+		func(rule *Rule) { rule.Target = "" },
+		func(rule *Rule) { rule.Metric = "unknown" },
+		func(rule *Rule) { rule.Aggregator = "median" },
+		func(rule *Rule) { rule.WindowInSecond = 0 },
+		func(rule *Rule) { rule.Comparison = "=>" },
+		func(rule *Rule) { rule.Scope = RuleScopeNamespace },
+	} {
+		rule := createTestRule()
+		modify(rule)
+		if err := ValidateRule(rule); err == nil {
+			t.Errorf("Expect the error of the invalid rule %v", rule)
+		}
+	}
+}
+
+func TestRule(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	rule := createTestRule()
+	if err := CreateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRule(createTestRule()); err == nil {
+		t.Error("Expect the error of the existing rule")
+	}
+
+	updatedRule := createTestRule()
+	updatedRule.Threshold = 200
+	if err := UpdateRule(updatedRule); err != nil {
+		t.Fatal(err)
+	}
+	savedRule, err := GetRule(rule.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if savedRule.Threshold != 200 || savedRule.CreatedTime.Equal(rule.CreatedTime) == false {
+		t.Errorf("Unexpected rule %v", savedRule)
+	}
+
+	storage.SaveAlert(indexAlertStateIndex, typeAlertState, &Alert{RuleName: rule.Name, Status: AlertStatusFiring})
+	if err := DeleteRule(rule.Name); err != nil {
+		t.Fatal(err)
+	}
+	ruleSlice, _ := GetAllRule()
+	alertSlice, _ := GetAllAlert()
+	if len(ruleSlice) != 0 || len(alertSlice) != 0 {
+		t.Errorf("Expect the rule and its alert deleted but get %v %v", ruleSlice, alertSlice)
+	}
+}
+
+func TestSearchAlertHistory(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	saveAlertHistory(&AlertHistory{"a", AlertStatusFiring, 1, "", now})
+	saveAlertHistory(&AlertHistory{"b", AlertStatusFiring, 1, "", now.Add(time.Minute)})
+	saveAlertHistory(&AlertHistory{"a", AlertStatusResolved, 1, "", now.Add(2 * time.Minute)})
+
+	alertHistorySlice, err := SearchAlertHistory("", nil, nil, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alertHistorySlice) != 3 || alertHistorySlice[0].Status != AlertStatusResolved {
+		t.Errorf("Expect 3 history in descending order but get %v", alertHistorySlice)
+	}
+
+	from := now.Add(time.Second)
+	alertHistorySlice, err = SearchAlertHistory("a", &from, nil, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alertHistorySlice) != 1 || alertHistorySlice[0].Status != AlertStatusResolved {
+		t.Errorf("Expect the resolved history of a but get %v", alertHistorySlice)
+	}
+}
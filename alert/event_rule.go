@@ -0,0 +1,149 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/event"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func validateEventRule(rule *Rule) error {
+	if rule.Metric != "" || rule.Scope != "" || rule.Target != "" || rule.Aggregator != "" {
+		return errors.New("The event rule has no metric, scope, target or aggregator")
+	}
+	for _, pattern := range []string{rule.InvolvedObjectKindPattern, rule.InvolvedObjectNamePattern} {
+		if _, err := compileEventPattern(pattern); err != nil {
+			return errors.New("Invalid pattern " + pattern + " with error " + err.Error())
+		}
+	}
+	return nil
+}
+
+// compileEventPattern compiles the pattern matching the whole value. The empty pattern matches all.
+func compileEventPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return regexp.Compile("")
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// eventMatcher matches the events with the compiled patterns of the rule
+type eventMatcher struct {
+	involvedObjectKindRegexp *regexp.Regexp
+	involvedObjectNameRegexp *regexp.Regexp
+	reasonMap                map[string]bool
+	eventType                string
+}
+
+func createEventMatcher(rule *Rule) (*eventMatcher, error) {
+	involvedObjectKindRegexp, err := compileEventPattern(rule.InvolvedObjectKindPattern)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	involvedObjectNameRegexp, err := compileEventPattern(rule.InvolvedObjectNamePattern)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	reasonMap := make(map[string]bool)
+	for _, reason := range strings.Split(rule.Reason, ",") {
+		reason = strings.TrimSpace(reason)
+		if reason != "" {
+			reasonMap[reason] = true
+		}
+	}
+	return &eventMatcher{
+		involvedObjectKindRegexp,
+		involvedObjectNameRegexp,
+		reasonMap,
+		rule.EventType,
+	}, nil
+}
+
+func (eventMatcher *eventMatcher) match(sourceJsonMap map[string]interface{}) bool {
+	involvedObjectJsonMap, _ := sourceJsonMap["involvedObject"].(map[string]interface{})
+	involvedObjectKind, _ := involvedObjectJsonMap["kind"].(string)
+	involvedObjectName, _ := involvedObjectJsonMap["name"].(string)
+	reason, _ := sourceJsonMap["reason"].(string)
+	eventType, _ := sourceJsonMap["type"].(string)
+	if eventMatcher.involvedObjectKindRegexp.MatchString(involvedObjectKind) == false {
+		return false
+	}
+	if eventMatcher.involvedObjectNameRegexp.MatchString(involvedObjectName) == false {
+		return false
+	}
+	if len(eventMatcher.reasonMap) > 0 && eventMatcher.reasonMap[reason] == false {
+		return false
+	}
+	if eventMatcher.eventType != "" && eventMatcher.eventType != eventType {
+		return false
+	}
+	return true
+}
+
+// countEvent sums up how many times the events matched the rule happened in the window. The acknowledged events
+// are counted too since Kubernetes merges the later occurrences into the same event keeping the acknowledgement.
+func countEvent(rule *Rule, from time.Time, to time.Time) (float64, error) {
+	eventMatcher, err := createEventMatcher(rule)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	namespace := rule.Namespace
+	if namespace == "" {
+		namespace = "*"
+	}
+	sum := 0.0
+	err = event.ScrollEventCountInWindow(namespace, from, to, false, func(jsonSlice []interface{}, countSlice []float64) error {
+		for i, hit := range jsonSlice {
+			sourceJsonMap, _ := hit.(map[string]interface{})["_source"].(map[string]interface{})
+			if eventMatcher.match(sourceJsonMap) {
+				sum += countSlice[i]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	return sum, nil
+}
+
+// getEventDescription describes the condition like Warning BackOff events of Pod nginx-.* in default over 300s >= 5
+func (rule *Rule) getEventDescription() string {
+	description := ""
+	if rule.EventType != "" {
+		description += rule.EventType + " "
+	}
+	if rule.Reason != "" {
+		description += rule.Reason + " "
+	}
+	description += "events"
+	if rule.InvolvedObjectKindPattern != "" || rule.InvolvedObjectNamePattern != "" {
+		description += " of " + strings.TrimSpace(rule.InvolvedObjectKindPattern+" "+rule.InvolvedObjectNamePattern)
+	}
+	if rule.Namespace != "" {
+		description += " in " + rule.Namespace
+	}
+	return description + " over " + strconv.Itoa(rule.WindowInSecond) + "s " + rule.Comparison + " " +
+		strconv.FormatFloat(rule.Threshold, 'g', -1, 64)
+}
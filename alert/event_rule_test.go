@@ -0,0 +1,93 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"testing"
+)
+
+func TestEventMatcher(t *testing.T) {
+	rule := &Rule{
+		Name:                      "crash-loop",
+		Kind:                      RuleKindEvent,
+		Namespace:                 "production",
+		InvolvedObjectKindPattern: "Pod",
+		InvolvedObjectNamePattern: "nginx-.*",
+		Reason:                    "BackOff, CrashLoopBackOff",
+		EventType:                 "Warning",
+		WindowInSecond:            300,
+		Comparison:                ComparisonGreaterThanOrEqual,
+		Threshold:                 5,
+	}
+	if err := ValidateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	eventMatcher, err := createEventMatcher(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createEvent := func(kind string, name string, reason string, eventType string) map[string]interface{} {
+		return map[string]interface{}{
+			"involvedObject": map[string]interface{}{"kind": kind, "name": name},
+			"reason":         reason,
+			"type":           eventType,
+		}
+	}
+	for _, testCase := range []struct {
+		SourceJsonMap map[string]interface{}
+		Expected      bool
+	}{
+		{createEvent("Pod", "nginx-1", "BackOff", "Warning"), true},
+		{createEvent("Pod", "nginx-1", "CrashLoopBackOff", "Warning"), true},
+		{createEvent("Pod", "nginx-1", "Killing", "Warning"), false},
+		{createEvent("Pod", "nginx-1", "BackOff", "Normal"), false},
+		{createEvent("Pod", "redis-1", "BackOff", "Warning"), false},
+		{createEvent("ReplicaSet", "nginx-1", "BackOff", "Warning"), false},
+		// The pattern matches the whole value
+		{createEvent("PodTemplate", "nginx-1", "BackOff", "Warning"), false},
+		{createEvent("Pod", "old-nginx-1", "BackOff", "Warning"), false},
+	} {
+		if matched := eventMatcher.match(testCase.SourceJsonMap); matched != testCase.Expected {
+			t.Errorf("Expect %v but get %v for %v", testCase.Expected, matched, testCase.SourceJsonMap)
+		}
+	}
+
+	// The empty patterns match all
+	eventMatcher, _ = createEventMatcher(&Rule{Kind: RuleKindEvent})
+	if eventMatcher.match(createEvent("Node", "node-1", "NodeNotReady", "Normal")) == false {
+		t.Error("Expect the empty rule to match all events")
+	}
+}
+
+func TestValidateEventRule(t *testing.T) {
+	rule := &Rule{
+		Name:                      "crash-loop",
+		Kind:                      RuleKindEvent,
+		InvolvedObjectNamePattern: "nginx-(",
+		WindowInSecond:            300,
+		Comparison:                ComparisonGreaterThanOrEqual,
+		Threshold:                 5,
+	}
+	if err := ValidateRule(rule); err == nil {
+		t.Error("Expect the error of the invalid pattern")
+	}
+
+	rule.InvolvedObjectNamePattern = ""
+	rule.Metric = "memoryUsage"
+	if err := ValidateRule(rule); err == nil {
+		t.Error("Expect the error of the metric in the event rule")
+	}
+}
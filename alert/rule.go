@@ -0,0 +1,232 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// The metric compared with the threshold
+	RuleKindThreshold = "threshold"
+	// The amount of the matched Kubernetes events compared with the threshold
+	RuleKindEvent = "event"
+)
+
+const (
+	RuleScopeNamespace             = "namespace"
+	RuleScopeReplicationController = "replicationcontroller"
+	RuleScopePod                   = "pod"
+)
+
+const (
+	ComparisonGreaterThan        = ">"
+	ComparisonGreaterThanOrEqual = ">="
+	ComparisonLessThan           = "<"
+	ComparisonLessThanOrEqual    = "<="
+	ComparisonEqual              = "=="
+	ComparisonNotEqual           = "!="
+)
+
+// The rule name is the document id and the path parameter so it is restricted like the Kubernetes name
+var ruleNameRegexp = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+// Rule fires the alert when the value in the window compared with the threshold holds for the duration.
+// The threshold rule uses the metric of the scope aggregated over the window. The target is the replication controller
+// or pod name and is empty for the namespace scope.
+// The event rule uses the count of the events matched in the window. The empty namespace is for all namespaces.
+// The patterns of the involved object are regular expressions matching the whole kind or name, and the reason has
+// the comma separated reasons.
+// The empty pattern, reason or event type matches all.
+type Rule struct {
+	Name                      string
+	Kind                      string
+	Description               string
+	Metric                    string
+	Scope                     string
+	Namespace                 string
+	Target                    string
+	Aggregator                string
+	InvolvedObjectKindPattern string
+	InvolvedObjectNamePattern string
+	Reason                    string
+	EventType                 string
+	WindowInSecond            int
+	Comparison                string
+	Threshold                 float64
+	DurationInSecond          int
+	CreatedTime               time.Time
+}
+
+// ValidateRule checks the rule and fills the default kind threshold
+func ValidateRule(rule *Rule) error {
+	if ruleNameRegexp.MatchString(rule.Name) == false {
+		return errors.New("The rule name " + rule.Name + " must consist of lower case alphanumeric characters or '-'")
+	}
+	if rule.Kind == "" {
+		rule.Kind = RuleKindThreshold
+	}
+	switch rule.Kind {
+	case RuleKindThreshold:
+		if err := validateThresholdRule(rule); err != nil {
+			return err
+		}
+	case RuleKindEvent:
+		if err := validateEventRule(rule); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Unknown rule kind " + rule.Kind)
+	}
+	if rule.WindowInSecond <= 0 {
+		return errors.New("The window must be positive")
+	}
+	if rule.DurationInSecond < 0 {
+		return errors.New("The duration can't be negative")
+	}
+	if _, err := compare(0, rule.Comparison, rule.Threshold); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateThresholdRule(rule *Rule) error {
+	if rule.Namespace == "" {
+		return errors.New("The namespace is required")
+	}
+	switch rule.Scope {
+	case RuleScopeNamespace:
+		if rule.Target != "" {
+			return errors.New("The namespace scope has no target")
+		}
+	case RuleScopeReplicationController, RuleScopePod:
+		if rule.Target == "" {
+			return errors.New("The target is required for the scope " + rule.Scope)
+		}
+	default:
+		return errors.New("Unknown scope " + rule.Scope)
+	}
+	return monitor.ValidateMetricWindow(rule.Metric, rule.Aggregator)
+}
+
+func compare(value float64, comparison string, threshold float64) (bool, error) {
+	switch comparison {
+	case ComparisonGreaterThan:
+		return value > threshold, nil
+	case ComparisonGreaterThanOrEqual:
+		return value >= threshold, nil
+	case ComparisonLessThan:
+		return value < threshold, nil
+	case ComparisonLessThanOrEqual:
+		return value <= threshold, nil
+	case ComparisonEqual:
+		return value == threshold, nil
+	case ComparisonNotEqual:
+		return value != threshold, nil
+	default:
+		return false, errors.New("Unknown comparison " + comparison)
+	}
+}
+
+// getMetricLabels returns the labels of the rule scope for the metric query
+func (rule *Rule) getMetricLabels() monitor.MetricLabels {
+	switch rule.Scope {
+	case RuleScopeReplicationController:
+		return monitor.MetricLabels{
+			Scope:        monitor.MetricScopeWorkload,
+			Namespace:    rule.Namespace,
+			WorkloadKind: monitor.NormalizeWorkloadKind(RuleScopeReplicationController),
+			WorkloadName: rule.Target,
+		}
+	case RuleScopePod:
+		return monitor.MetricLabels{
+			Scope:     monitor.MetricScopePod,
+			Namespace: rule.Namespace,
+			Pod:       rule.Target,
+		}
+	default:
+		return monitor.MetricLabels{
+			Scope:     monitor.MetricScopeNamespace,
+			Namespace: rule.Namespace,
+		}
+	}
+}
+
+// getDescription describes the condition like memoryUsage avg over 300s of pod nginx-1 in default > 1e+09
+func (rule *Rule) getDescription() string {
+	if rule.Kind == RuleKindEvent {
+		return rule.getEventDescription()
+	}
+	scopeDescription := rule.Scope + " " + rule.Namespace
+	if rule.Target != "" {
+		scopeDescription = rule.Scope + " " + rule.Target + " in " + rule.Namespace
+	}
+	return rule.Metric + " " + rule.Aggregator + " over " + strconv.Itoa(rule.WindowInSecond) + "s of " +
+		scopeDescription + " " + rule.Comparison + " " + strconv.FormatFloat(rule.Threshold, 'g', -1, 64)
+}
+
+func CreateRule(rule *Rule) error {
+	if err := ValidateRule(rule); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := storage.GetRule(indexAlertRuleIndex, typeAlertRule, rule.Name); err == nil {
+		return errors.New("The rule " + rule.Name + " already exists")
+	}
+	rule.CreatedTime = time.Now().UTC()
+	return storage.SaveRule(indexAlertRuleIndex, typeAlertRule, rule)
+}
+
+// UpdateRule replaces the rule with the same name. The alert of the rule is evaluated again with the new condition.
+func UpdateRule(rule *Rule) error {
+	if err := ValidateRule(rule); err != nil {
+		log.Error(err)
+		return err
+	}
+	oldRule, err := storage.GetRule(indexAlertRuleIndex, typeAlertRule, rule.Name)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	rule.CreatedTime = oldRule.CreatedTime
+	return storage.SaveRule(indexAlertRuleIndex, typeAlertRule, rule)
+}
+
+func GetRule(name string) (*Rule, error) {
+	return storage.GetRule(indexAlertRuleIndex, typeAlertRule, name)
+}
+
+// GetAllRule returns the rules sorted by name
+func GetAllRule() ([]Rule, error) {
+	return storage.GetAllRule(indexAlertRuleIndex, typeAlertRule)
+}
+
+// DeleteRule deletes the rule and its active alert without the history
+func DeleteRule(name string) error {
+	if err := storage.DeleteRule(indexAlertRuleIndex, typeAlertRule, name); err != nil {
+		log.Error(err)
+		return err
+	}
+	if err := storage.DeleteAlert(indexAlertStateIndex, typeAlertState, name); err != nil &&
+		err.Error() != notFoundErrorMessage {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"time"
+)
+
+// Storage is the backend keeping the rules, the active alerts and the alert history
+type Storage interface {
+	SaveRule(index string, documentType string, rule *Rule) error
+	GetRule(index string, documentType string, name string) (*Rule, error)
+	// Return the rules sorted by name
+	GetAllRule(index string, documentType string) ([]Rule, error)
+	DeleteRule(index string, documentType string, name string) error
+	SaveAlert(index string, documentType string, alert *Alert) error
+	GetAllAlert(index string, documentType string) ([]Alert, error)
+	DeleteAlert(index string, documentType string, ruleName string) error
+	SaveAlertHistory(index string, documentType string, id string, alertHistory *AlertHistory) error
+	// Return the matched history sorted by CreatedTime in descending order. The empty rule name matches all.
+	SearchAlertHistory(index string, documentType string, ruleName string, from *time.Time, to *time.Time,
+		size int, offset int) ([]AlertHistory, error)
+	// Delete the index or all indices of the alias
+	DeleteIndex(index string) error
+	GetAllIndex(indexPattern string) ([]string, error)
+}
+
+var storage Storage
+
+func init() {
+	switch configuration.GetStorageType() {
+	case configuration.StorageTypeLocal:
+		storage = CreateStorageLocal()
+	default:
+		storage = CreateStorageElasticSearch()
+	}
+}
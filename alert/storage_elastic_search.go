@@ -0,0 +1,329 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
+	"strconv"
+	"time"
+)
+
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
+	createIndexTemplate()
+	// Create the indices so they could be searched before the first document
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	connection.CreateIndex(indexAlertRuleIndex)
+	connection.CreateIndex(indexAlertStateIndex)
+	return &StorageElasticSearch{}
+}
+
+func createIndexTemplate() error {
+
+	tempateBody := `
+	{
+		"template": "alert_*",
+		"mappings": {
+			"_default_": {
+				"_all": {
+					"enabled": true
+				},
+				"dynamic_templates": [
+					{
+						"string_fields": {
+							"match": "*",
+							"match_mapping_type": "string",
+							"mapping": {
+								"type": "string",
+								"index": "not_analyzed",
+								"omit_norms": true
+							}
+						}
+					}
+				],
+				"properties": {
+					"Threshold": {
+						"type": "double"
+					},
+					"Value": {
+						"type": "double"
+					},
+					"CreatedTime": {
+						"type": "date",
+						"format": "dateOptionalTime"
+					},
+					"ActiveTime": {
+						"type": "date",
+						"format": "dateOptionalTime"
+					},
+					"FiredTime": {
+						"type": "date",
+						"format": "dateOptionalTime"
+					},
+					"EvaluatedTime": {
+						"type": "date",
+						"format": "dateOptionalTime"
+					}
+				}
+			}
+		}
+	}
+	`
+
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	request, err := connection.NewRequest("PUT", "/_template/template_alert", "")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	request.SetBodyString(tempateBody)
+	statusCode, bodyBytes, err := request.Do(nil)
+	if err != nil {
+		log.Error(err)
+		log.Error("statusCode %d", statusCode)
+		log.Error(string(bodyBytes))
+		return err
+	}
+
+	return nil
+}
+
+// saveDocument indexes the document and refreshes the index so the change is searchable immediately
+func saveDocument(index string, documentType string, id string, data interface{}) error {
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	if _, err := connection.Index(index, documentType, id, nil, data); err != nil {
+		log.Debug(data)
+		log.Error(err)
+		return err
+	}
+	if _, err := connection.Refresh(index); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func deleteDocument(index string, documentType string, id string) error {
+	// Find the concrete index since the document can't be deleted through the alias
+	concreteIndex, _, err := elasticsearch.GetByID(index, documentType, id)
+	if err != nil {
+		return err
+	}
+
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	if _, err := connection.Delete(concreteIndex, documentType, id, nil); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := connection.Refresh(concreteIndex); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// scrollAllSource passes the source of each document sorted by the field to the handle
+func scrollAllSource(index string, documentType string, sortField string, handle func(byteSlice []byte) error) error {
+	query := `
+	{
+		"query": {
+			"match_all": {}
+		},
+		"sort" : [
+			{
+				"` + sortField + `" : "asc"
+			}
+		],
+		"size": ` + strconv.Itoa(elasticsearch.ScrollPageSize) + `
+	}
+	`
+
+	return elasticsearch.Scroll(index, documentType, query, func(hitSlice []interface{}) error {
+		for _, hit := range hitSlice {
+			byteSlice, err := json.Marshal(hit.(map[string]interface{})["_source"])
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			if err := handle(byteSlice); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (storageElasticSearch *StorageElasticSearch) SaveRule(index string, documentType string, rule *Rule) error {
+	return saveDocument(index, documentType, rule.Name, rule)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetRule(index string, documentType string, name string) (*Rule, error) {
+	_, byteSlice, err := elasticsearch.GetByID(index, documentType, name)
+	if err != nil {
+		return nil, err
+	}
+	rule := &Rule{}
+	if err := elasticsearch.DecodeSource(byteSlice, rule); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllRule(index string, documentType string) ([]Rule, error) {
+	ruleSlice := make([]Rule, 0)
+	err := scrollAllSource(index, documentType, "Name", func(byteSlice []byte) error {
+		rule := Rule{}
+		if err := elasticsearch.DecodeSource(byteSlice, &rule); err != nil {
+			log.Error(err)
+			return err
+		}
+		ruleSlice = append(ruleSlice, rule)
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return ruleSlice, nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) DeleteRule(index string, documentType string, name string) error {
+	return deleteDocument(index, documentType, name)
+}
+
+func (storageElasticSearch *StorageElasticSearch) SaveAlert(index string, documentType string, alert *Alert) error {
+	return saveDocument(index, documentType, alert.RuleName, alert)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllAlert(index string, documentType string) ([]Alert, error) {
+	alertSlice := make([]Alert, 0)
+	err := scrollAllSource(index, documentType, "RuleName", func(byteSlice []byte) error {
+		alert := Alert{}
+		if err := elasticsearch.DecodeSource(byteSlice, &alert); err != nil {
+			log.Error(err)
+			return err
+		}
+		alertSlice = append(alertSlice, alert)
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return alertSlice, nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) DeleteAlert(index string, documentType string, ruleName string) error {
+	return deleteDocument(index, documentType, ruleName)
+}
+
+func (storageElasticSearch *StorageElasticSearch) SaveAlertHistory(index string, documentType string, id string,
+	alertHistory *AlertHistory) error {
+	if err := elasticsearch.EnsureIndexWithAlias(index); err != nil {
+		log.Error(err)
+		return err
+	}
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	if _, err := connection.Index(index, documentType, id, nil, alertHistory); err != nil {
+		log.Debug(alertHistory)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) SearchAlertHistory(index string, documentType string, ruleName string,
+	from *time.Time, to *time.Time, size int, offset int) ([]AlertHistory, error) {
+	mustBuffer := bytes.Buffer{}
+	if ruleName != "" {
+		// Escape the value from the caller
+		ruleNameByteSlice, _ := json.Marshal(ruleName)
+		mustBuffer.WriteString(`
+						{ "term": { "RuleName": ` + string(ruleNameByteSlice) + ` } }`)
+	}
+	if from != nil || to != nil {
+		rangeText := `"time_zone": "+0:00"`
+		if from != nil {
+			rangeText += `, "gte": "` + from.UTC().Format(time.RFC3339Nano) + `"`
+		}
+		if to != nil {
+			rangeText += `, "lte": "` + to.UTC().Format(time.RFC3339Nano) + `"`
+		}
+		if mustBuffer.Len() > 0 {
+			mustBuffer.WriteString(",")
+		}
+		mustBuffer.WriteString(`
+						{ "range": { "CreatedTime": { ` + rangeText + ` } } }`)
+	}
+
+	queryField := `
+			"match_all": {}`
+	if mustBuffer.Len() > 0 {
+		queryField = `
+			"bool": {
+				"must": [` + mustBuffer.String() + `
+				]
+			}`
+	}
+
+	query := `
+	{
+		"query": {` + queryField + `
+		},
+		"sort" : [
+			{
+				"CreatedTime" : "desc"
+			}
+		],
+		"size": ` + strconv.Itoa(size) + `,
+		"from": ` + strconv.Itoa(offset) + `
+	}
+	`
+
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	searchResult, err := connection.Search(index, documentType, nil, query)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	alertHistorySlice := make([]AlertHistory, 0)
+	for _, hit := range searchResult.Hits.Hits {
+		if hit.Source == nil {
+			return nil, errors.New("The source of " + hit.Id + " is empty")
+		}
+		alertHistory := AlertHistory{}
+		if err := elasticsearch.DecodeSource([]byte(*hit.Source), &alertHistory); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		alertHistorySlice = append(alertHistorySlice, alertHistory)
+	}
+	return alertHistorySlice, nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) DeleteIndex(index string) error {
+	return elasticsearch.DeleteIndexOrAlias(index)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllIndex(indexPattern string) ([]string, error) {
+	return elasticsearch.GetAllIndex(indexPattern)
+}
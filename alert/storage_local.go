@@ -0,0 +1,174 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"sort"
+	"time"
+)
+
+type StorageLocal struct {
+	documentStore *local.DocumentStore
+}
+
+func CreateStorageLocal() *StorageLocal {
+	return &StorageLocal{local.LocalDocumentStore}
+}
+
+// decodeSource decodes the source with the number kept as json.Number like Elastic Search
+func decodeSource(source map[string]interface{}, target interface{}) error {
+	byteSlice, err := json.Marshal(source)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
+
+func (storageLocal *StorageLocal) SaveRule(index string, documentType string, rule *Rule) error {
+	return storageLocal.documentStore.Index(index, documentType, rule.Name, rule)
+}
+
+func (storageLocal *StorageLocal) GetRule(index string, documentType string, name string) (*Rule, error) {
+	jsonMap, err := storageLocal.documentStore.Get(index, documentType, name)
+	if err != nil {
+		return nil, err
+	}
+	rule := &Rule{}
+	if err := decodeSource(jsonMap, rule); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (storageLocal *StorageLocal) GetAllRule(index string, documentType string) ([]Rule, error) {
+	documentSlice, err := storageLocal.documentStore.Search(index, documentType, nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	ruleSlice := make([]Rule, 0)
+	for _, document := range documentSlice {
+		rule := Rule{}
+		if err := decodeSource(document.Source, &rule); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		ruleSlice = append(ruleSlice, rule)
+	}
+	sort.SliceStable(ruleSlice, func(i int, j int) bool {
+		return ruleSlice[i].Name < ruleSlice[j].Name
+	})
+	return ruleSlice, nil
+}
+
+func (storageLocal *StorageLocal) DeleteRule(index string, documentType string, name string) error {
+	return storageLocal.documentStore.Delete(index, documentType, name)
+}
+
+func (storageLocal *StorageLocal) SaveAlert(index string, documentType string, alert *Alert) error {
+	return storageLocal.documentStore.Index(index, documentType, alert.RuleName, alert)
+}
+
+func (storageLocal *StorageLocal) GetAllAlert(index string, documentType string) ([]Alert, error) {
+	documentSlice, err := storageLocal.documentStore.Search(index, documentType, nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	alertSlice := make([]Alert, 0)
+	for _, document := range documentSlice {
+		alert := Alert{}
+		if err := decodeSource(document.Source, &alert); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		alertSlice = append(alertSlice, alert)
+	}
+	sort.SliceStable(alertSlice, func(i int, j int) bool {
+		return alertSlice[i].RuleName < alertSlice[j].RuleName
+	})
+	return alertSlice, nil
+}
+
+func (storageLocal *StorageLocal) DeleteAlert(index string, documentType string, ruleName string) error {
+	return storageLocal.documentStore.Delete(index, documentType, ruleName)
+}
+
+func (storageLocal *StorageLocal) SaveAlertHistory(index string, documentType string, id string,
+	alertHistory *AlertHistory) error {
+	return storageLocal.documentStore.Index(index, documentType, id, alertHistory)
+}
+
+func getCreatedTime(document *local.Document) time.Time {
+	createdTimeText, _ := document.GetFieldString("CreatedTime")
+	createdTime, _ := time.Parse(time.RFC3339Nano, createdTimeText)
+	return createdTime
+}
+
+func (storageLocal *StorageLocal) SearchAlertHistory(index string, documentType string, ruleName string,
+	from *time.Time, to *time.Time, size int, offset int) ([]AlertHistory, error) {
+	documentSlice, err := storageLocal.documentStore.Search(index, documentType, func(document *local.Document) bool {
+		if ruleName != "" {
+			documentRuleName, _ := document.GetFieldString("RuleName")
+			if documentRuleName != ruleName {
+				return false
+			}
+		}
+		createdTime := getCreatedTime(document)
+		if from != nil && createdTime.Before(*from) {
+			return false
+		}
+		if to != nil && createdTime.After(*to) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	sort.SliceStable(documentSlice, func(i int, j int) bool {
+		return getCreatedTime(&documentSlice[i]).After(getCreatedTime(&documentSlice[j]))
+	})
+
+	alertHistorySlice := make([]AlertHistory, 0)
+	for i := offset; i < len(documentSlice) && i < offset+size; i++ {
+		alertHistory := AlertHistory{}
+		if err := decodeSource(documentSlice[i].Source, &alertHistory); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		alertHistorySlice = append(alertHistorySlice, alertHistory)
+	}
+	return alertHistorySlice, nil
+}
+
+func (storageLocal *StorageLocal) DeleteIndex(index string) error {
+	return storageLocal.documentStore.DeleteIndex(index)
+}
+
+func (storageLocal *StorageLocal) GetAllIndex(indexPattern string) ([]string, error) {
+	return storageLocal.documentStore.GetAllIndex(indexPattern), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"github.com/cloudawan/cloudone_utility/audit"
+	"strings"
+	"time"
+)
+
+// Storage is the backend keeping the audit logs
+type Storage interface {
+	SaveAudit(index string, id string, auditLog *audit.AuditLog, refreshForSearch bool) error
+	// Return the source of the matched audit logs sorted by CreatedTime in descending order
+	SearchAuditLog(index string, userName string, from *time.Time, to *time.Time, size int, offset int) ([]map[string]interface{}, error)
+	// Pass the source of the matched audit logs page by page in the same order as SearchAuditLog to the handle
+	ScrollAuditLog(index string, userName string, from *time.Time, to *time.Time,
+		handle func(sourceJsonMapSlice []map[string]interface{}) error) error
+	// Delete the index or all indices of the alias
+	DeleteAuditLogIndex(index string) error
+	// Move the documents of the legacy indices not named with period into the indices named with period by the first time field found
+	MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error
+	GetAllIndex(indexPattern string) ([]string, error)
+	GetAuditLog(index string, documentType string, id string) (*audit.AuditLog, error)
+}
+
+var storage Storage
+
+func init() {
+	switch configuration.GetStorageType() {
+	case configuration.StorageTypeLocal:
+		storage = CreateStorageLocal()
+	default:
+		storage = CreateStorageElasticSearch()
+	}
+}
+
+func checkFormatForElasticSearchData(auditLog *audit.AuditLog) {
+	if auditLog.PathParameterMap != nil {
+		for key, value := range auditLog.PathParameterMap {
+			if strings.Contains(key, ".") {
+				newKey := strings.Replace(key, ".", "_", -1)
+				auditLog.PathParameterMap[newKey] = value
+				delete(auditLog.PathParameterMap, key)
+			}
+		}
+	}
+	if auditLog.QueryParameterMap != nil {
+		for key, value := range auditLog.QueryParameterMap {
+			if strings.Contains(key, ".") {
+				newKey := strings.Replace(key, ".", "_", -1)
+				auditLog.QueryParameterMap[newKey] = value
+				delete(auditLog.QueryParameterMap, key)
+			}
+		}
+	}
+	if auditLog.RequestHeader != nil {
+		for key, value := range auditLog.RequestHeader {
+			if strings.Contains(key, ".") {
+				newKey := strings.Replace(key, ".", "_", -1)
+				auditLog.RequestHeader[newKey] = value
+				delete(auditLog.RequestHeader, key)
+			}
+		}
+	}
+}
+
+func SaveAudit(auditLog *audit.AuditLog, refreshForSearch bool) error {
+	checkFormatForElasticSearchData(auditLog)
+	id := fmt.Sprintf("%d_%d", auditLog.CreatedTime.Unix(), auditLog.CreatedTime.UnixNano())
+	// The audit log is saved in the index of its period and searched with the alias
+	index := rollover.GetIndexName(indexAuditLogIndex, auditLog.CreatedTime)
+	return storage.SaveAudit(index, id, auditLog, refreshForSearch)
+}
+
+// MigrateLegacyIndex moves the audit log index created before the rollover into the indices named with period
+func MigrateLegacyIndex() error {
+	return storage.MigrateLegacyIndex(indexAuditLogIndex, []string{"CreatedTime"})
+}
+
+// DeleteExpiredAuditLogIndex deletes the audit log indices older than the retention
+func DeleteExpiredAuditLogIndex(now time.Time) error {
+	indexSlice, err := storage.GetAllIndex(indexAuditLogIndex + rollover.Separator + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return rollover.DeleteExpiredIndex(rollover.KindAuditLog, indexSlice, now, storage.DeleteAuditLogIndex)
+}
+
+func DeleteAuditLogIndex(index string) error {
+	return storage.DeleteAuditLogIndex(index)
+}
+
+func GetAuditLog(documentType string, id string) (*audit.AuditLog, error) {
+	return storage.GetAuditLog(indexAuditLogIndex, documentType, id)
+}
@@ -15,24 +15,28 @@
 package audit
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
 	"github.com/cloudawan/cloudone_utility/audit"
-	elasticsearchlib "github.com/cloudawan/cloudone_utility/database/elasticsearch"
-	"strings"
+	"strconv"
+	"time"
 )
 
-func init() {
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
 	createIndexTemplate()
+	return &StorageElasticSearch{}
 }
 
 func createIndexTemplate() error {
 
 	tempateBody := `
 	{
-		"template": "` + indexAuditLogIndex + `",
+		"template": "` + indexAuditLogIndex + rollover.Separator + `*",
 		"mappings": {
 			"_default_": {
 				"_all": {
@@ -129,48 +133,20 @@ func createIndexTemplate() error {
 	return nil
 }
 
-func checkFormatForElasticSearchData(auditLog *audit.AuditLog) {
-	if auditLog.PathParameterMap != nil {
-		for key, value := range auditLog.PathParameterMap {
-			if strings.Contains(key, ".") {
-				newKey := strings.Replace(key, ".", "_", -1)
-				auditLog.PathParameterMap[newKey] = value
-				delete(auditLog.PathParameterMap, key)
-			}
-		}
-	}
-	if auditLog.QueryParameterMap != nil {
-		for key, value := range auditLog.QueryParameterMap {
-			if strings.Contains(key, ".") {
-				newKey := strings.Replace(key, ".", "_", -1)
-				auditLog.QueryParameterMap[newKey] = value
-				delete(auditLog.QueryParameterMap, key)
-			}
-		}
-	}
-	if auditLog.RequestHeader != nil {
-		for key, value := range auditLog.RequestHeader {
-			if strings.Contains(key, ".") {
-				newKey := strings.Replace(key, ".", "_", -1)
-				auditLog.RequestHeader[newKey] = value
-				delete(auditLog.RequestHeader, key)
-			}
-		}
+func (storageElasticSearch *StorageElasticSearch) SaveAudit(index string, id string, auditLog *audit.AuditLog, refreshForSearch bool) error {
+	if err := elasticsearch.EnsureIndexWithAlias(index); err != nil {
+		log.Error(err)
+		return err
 	}
-}
-
-func SaveAudit(auditLog *audit.AuditLog, refreshForSearch bool) error {
-	checkFormatForElasticSearchData(auditLog)
-	id := fmt.Sprintf("%d_%d", auditLog.CreatedTime.Unix(), auditLog.CreatedTime.UnixNano())
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.Index(indexAuditLogIndex, auditLog.UserName, id, nil, auditLog)
+	_, err := connection.Index(index, auditLog.UserName, id, nil, auditLog)
 	if err != nil {
 		log.Debug(auditLog)
 		log.Error(err)
 		return err
 	} else {
 		if refreshForSearch {
-			if _, err := connection.Refresh(indexAuditLogIndex); err != nil {
+			if _, err := connection.Refresh(index); err != nil {
 				log.Error(err)
 				return err
 			} else {
@@ -182,46 +158,148 @@ func SaveAudit(auditLog *audit.AuditLog, refreshForSearch bool) error {
 	}
 }
 
-// Bulk Process
-const (
-	maxConnection = 5
-)
+// getAuditLogQuery returns the query and sort fields of the search body
+func getAuditLogQuery(from *time.Time, to *time.Time) string {
+	var queryField string
+	if from == nil && to != nil {
+		lte := to.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"CreatedTime" : {
+					"lte": "` + lte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    },`
+	} else if from != nil && to == nil {
+		gte := from.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"CreatedTime" : {
+					"gte": "` + gte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    },`
+	} else if from != nil && to != nil {
+		lte := to.UTC().Format(time.RFC3339Nano)
+		gte := from.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"CreatedTime" : {
+					"lte": "` + lte + `",
+					"gte": "` + gte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    }`
+	} else {
+		queryField = ``
+	}
 
-func createBulkProcessor() *elasticsearchlib.BulkProcessor {
-	return elasticsearch.ElasticSearchClient.CreateBulkProcessor(maxConnection)
+	return `
+		"query": {
+			"filtered": {
+				` + queryField + `
+			}
+		},
+		"sort" : [
+	 		{ 
+				"CreatedTime" : "desc"
+			}
+    		]`
 }
 
-func searchAuditLogRawJson(index string, _type string, query interface{}) ([]byte, error) {
-	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	searchResult, err := connection.Search(index, _type, nil, query)
+func (storageElasticSearch *StorageElasticSearch) SearchAuditLog(index string, userName string, from *time.Time,
+	to *time.Time, size int, offset int) ([]map[string]interface{}, error) {
+	query := `
+	{
+		` + getAuditLogQuery(from, to) + `,
+		"size": ` + strconv.Itoa(size) + `,
+		"from": ` + strconv.Itoa(offset) + `
+	}
+	`
+
+	byteSlice, err := searchAuditLogRawJson(index, userName, query)
 	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return getSourceJsonMapSliceFromSearchResult(byteSlice)
+}
+
+func getSourceJsonMapSliceFromSearchResult(byteSlice []byte) ([]map[string]interface{}, error) {
+	jsonMap := make(map[string]interface{})
+	if err := json.Unmarshal(byteSlice, &jsonMap); err != nil {
+		log.Error(err)
 		return nil, err
+	}
+
+	resultSlice, ok := jsonMap["hits"].(map[string]interface{})["hits"].([]interface{})
+	if ok {
+		return getSourceJsonMapSlice(resultSlice), nil
 	} else {
-		return searchResult.RawJSON, nil
+		log.Error("Fail to get with byteSlice %s", string(byteSlice))
+		return nil, errors.New("Fail to get with byteSlice " + string(byteSlice))
+	}
+}
+
+func getSourceJsonMapSlice(resultSlice []interface{}) []map[string]interface{} {
+	sourceJsonMapSlice := make([]map[string]interface{}, 0)
+	for _, result := range resultSlice {
+		resultJsonMap, _ := result.(map[string]interface{})
+		sourceJsonMap, _ := resultJsonMap["_source"].(map[string]interface{})
+		sourceJsonMapSlice = append(sourceJsonMapSlice, sourceJsonMap)
 	}
+	return sourceJsonMapSlice
 }
 
-func DeleteAuditLogIndex(index string) error {
+func (storageElasticSearch *StorageElasticSearch) ScrollAuditLog(index string, userName string, from *time.Time,
+	to *time.Time, handle func(sourceJsonMapSlice []map[string]interface{}) error) error {
+	query := `
+	{
+		` + getAuditLogQuery(from, to) + `,
+		"size": ` + strconv.Itoa(elasticsearch.ScrollPageSize) + `
+	}
+	`
+
+	return elasticsearch.Scroll(index, userName, query, func(hitSlice []interface{}) error {
+		return handle(getSourceJsonMapSlice(hitSlice))
+	})
+}
+
+func searchAuditLogRawJson(index string, _type string, query interface{}) ([]byte, error) {
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.DeleteIndex(index)
+	searchResult, err := connection.Search(index, _type, nil, query)
 	if err != nil {
-		return err
+		return nil, err
 	} else {
-		return nil
+		return searchResult.RawJSON, nil
 	}
 }
 
-func GetAuditLog(documentType string, id string) (*audit.AuditLog, error) {
-	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	baseResponse, err := connection.Get(indexAuditLogIndex, documentType, id, nil)
+func (storageElasticSearch *StorageElasticSearch) DeleteAuditLogIndex(index string) error {
+	return elasticsearch.DeleteIndexOrAlias(index)
+}
+
+func (storageElasticSearch *StorageElasticSearch) MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	return elasticsearch.MigrateLegacyIndex(indexPattern, timeFieldSlice)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllIndex(indexPattern string) ([]string, error) {
+	return elasticsearch.GetAllIndex(indexPattern)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAuditLog(index string, documentType string, id string) (*audit.AuditLog, error) {
+	// The index could be an alias with multiple indices so search by id instead of get
+	_, byteSlice, err := elasticsearch.GetByID(index, documentType, id)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	} else {
 		audit := &audit.AuditLog{}
-		decoder := json.NewDecoder(bytes.NewReader(*baseResponse.Source))
-		decoder.UseNumber()
-		err := decoder.Decode(&audit)
+		err := elasticsearch.DecodeSource(byteSlice, &audit)
 		if err != nil {
 			log.Error(err)
 			return nil, err
@@ -0,0 +1,153 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"github.com/cloudawan/cloudone_utility/audit"
+	"sort"
+	"time"
+)
+
+const (
+	localScrollPageSize = 500
+)
+
+type StorageLocal struct {
+	documentStore *local.DocumentStore
+}
+
+func CreateStorageLocal() *StorageLocal {
+	return &StorageLocal{local.LocalDocumentStore}
+}
+
+func (storageLocal *StorageLocal) SaveAudit(index string, id string, auditLog *audit.AuditLog, refreshForSearch bool) error {
+	// Local storage is searchable immediately so refreshForSearch is not needed
+	if err := storageLocal.documentStore.Index(index, auditLog.UserName, id, auditLog); err != nil {
+		log.Debug(auditLog)
+		log.Error(err)
+		return err
+	} else {
+		return nil
+	}
+}
+
+func getCreatedTime(document *local.Document) time.Time {
+	createdTimeText, _ := document.GetFieldString("CreatedTime")
+	createdTime, _ := time.Parse(time.RFC3339Nano, createdTimeText)
+	return createdTime
+}
+
+// searchAuditLogDocument returns the matched documents sorted by CreatedTime in descending order
+func (storageLocal *StorageLocal) searchAuditLogDocument(index string, userName string, from *time.Time,
+	to *time.Time) ([]local.Document, error) {
+	documentSlice, err := storageLocal.documentStore.Search(index, userName, func(document *local.Document) bool {
+		createdTime := getCreatedTime(document)
+		if from != nil && createdTime.Before(*from) {
+			return false
+		}
+		if to != nil && createdTime.After(*to) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	sort.SliceStable(documentSlice, func(i int, j int) bool {
+		return getCreatedTime(&documentSlice[i]).After(getCreatedTime(&documentSlice[j]))
+	})
+
+	return documentSlice, nil
+}
+
+func (storageLocal *StorageLocal) SearchAuditLog(index string, userName string, from *time.Time,
+	to *time.Time, size int, offset int) ([]map[string]interface{}, error) {
+	documentSlice, err := storageLocal.searchAuditLogDocument(index, userName, from, to)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	sourceJsonMapSlice := make([]map[string]interface{}, 0)
+	for i := offset; i < len(documentSlice) && i < offset+size; i++ {
+		sourceJsonMapSlice = append(sourceJsonMapSlice, documentSlice[i].Source)
+	}
+
+	return sourceJsonMapSlice, nil
+}
+
+func (storageLocal *StorageLocal) ScrollAuditLog(index string, userName string, from *time.Time,
+	to *time.Time, handle func(sourceJsonMapSlice []map[string]interface{}) error) error {
+	documentSlice, err := storageLocal.searchAuditLogDocument(index, userName, from, to)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for start := 0; start < len(documentSlice); start += localScrollPageSize {
+		sourceJsonMapSlice := make([]map[string]interface{}, 0)
+		for i := start; i < len(documentSlice) && i < start+localScrollPageSize; i++ {
+			sourceJsonMapSlice = append(sourceJsonMapSlice, documentSlice[i].Source)
+		}
+		if err := handle(sourceJsonMapSlice); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storageLocal *StorageLocal) MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	// The memory is never kept from the version before the rollover
+	return nil
+}
+
+func (storageLocal *StorageLocal) GetAllIndex(indexPattern string) ([]string, error) {
+	return storageLocal.documentStore.GetAllIndex(indexPattern), nil
+}
+
+func (storageLocal *StorageLocal) DeleteAuditLogIndex(index string) error {
+	return storageLocal.documentStore.DeleteIndex(index)
+}
+
+func (storageLocal *StorageLocal) GetAuditLog(index string, documentType string, id string) (*audit.AuditLog, error) {
+	jsonMap, err := storageLocal.documentStore.Get(index, documentType, id)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	byteSlice, err := json.Marshal(jsonMap)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	auditLog := &audit.AuditLog{}
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	err = decoder.Decode(&auditLog)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	} else {
+		return auditLog, nil
+	}
+}
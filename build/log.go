@@ -15,11 +15,9 @@
 package build
 
 import (
-	"encoding/json"
 	"errors"
 	"github.com/cloudawan/cloudone_utility/build"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"strconv"
 	"time"
 )
 
@@ -38,104 +36,62 @@ func SearchBuildLog(imageInformation string, from *time.Time, to *time.Time, siz
 		return nil, errors.New("From " + from.String() + " can't be after to " + to.String())
 	}
 
-	var queryField string
-	if from == nil && to != nil {
-		lte := to.UTC().Format(time.RFC3339Nano)
-		queryField = `"query": {		
-			"range" : {
-				"CreatedTime" : {
-					"lte": "` + lte + `",
-					"time_zone": "+0:00"
-				}
-			}
-	    },`
-	} else if from != nil && to == nil {
-		gte := from.UTC().Format(time.RFC3339Nano)
-		queryField = `"query": {		
-			"range" : {
-				"CreatedTime" : {
-					"gte": "` + gte + `",
-					"time_zone": "+0:00"
-				}
-			}
-	    },`
-	} else if from != nil && to != nil {
-		lte := to.UTC().Format(time.RFC3339Nano)
-		gte := from.UTC().Format(time.RFC3339Nano)
-		queryField = `"query": {		
-			"range" : {
-				"CreatedTime" : {
-					"lte": "` + lte + `",
-					"gte": "` + gte + `",
-					"time_zone": "+0:00"
-				}
-			}
-	    }`
-	} else {
-		queryField = ``
-	}
-
-	query := `
-	{
-		"query": {
-			"filtered": {
-				` + queryField + `
-			}
-		},
-		"sort" : [
-	 		{ 
-				"CreatedTime" : "desc"
-			}
-    		],
-		"size": ` + strconv.Itoa(size) + `,
-		"from": ` + strconv.Itoa(offset) + `
-	}
-	`
-
-	byteSlice, err := searchBuildLogRawJson(getIndexName(imageInformation), indexBuildLogType, query)
+	sourceJsonMapSlice, err := storage.SearchBuildLog(getIndexName(imageInformation), indexBuildLogType, from, to, size, offset)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
 
-	jsonMap := make(map[string]interface{})
-	if err := json.Unmarshal(byteSlice, &jsonMap); err != nil {
-		log.Error(err)
-		return nil, err
+	buildLogSlice := make([]build.BuildLog, 0)
+	for _, sourceJsonMap := range sourceJsonMapSlice {
+		buildLogSlice = append(buildLogSlice, convertToBuildLog(sourceJsonMap))
 	}
+	return buildLogSlice, nil
+}
 
-	resultSlice, ok := jsonMap["hits"].(map[string]interface{})["hits"].([]interface{})
-	if ok {
+// ExportBuildLog passes all matched build logs page by page to the handle in the same order as SearchBuildLog
+func ExportBuildLog(imageInformation string, from *time.Time, to *time.Time,
+	handle func(buildLogSlice []build.BuildLog) error) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("ExportBuildLog Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	if from != nil && to != nil && from.After(*to) {
+		return errors.New("From " + from.String() + " can't be after to " + to.String())
+	}
+
+	return storage.ScrollBuildLog(getIndexName(imageInformation), indexBuildLogType, from, to, func(sourceJsonMapSlice []map[string]interface{}) error {
 		buildLogSlice := make([]build.BuildLog, 0)
-		for _, result := range resultSlice {
-			resultJsonMap, _ := result.(map[string]interface{})
-			sourceJsonMap := resultJsonMap["_source"].(map[string]interface{})
+		for _, sourceJsonMap := range sourceJsonMapSlice {
+			buildLogSlice = append(buildLogSlice, convertToBuildLog(sourceJsonMap))
+		}
+		return handle(buildLogSlice)
+	})
+}
 
-			imageInformation, _ := sourceJsonMap["ImageInformation"].(string)
-			version, _ := sourceJsonMap["Version"].(string)
+func convertToBuildLog(sourceJsonMap map[string]interface{}) build.BuildLog {
+	imageInformation, _ := sourceJsonMap["ImageInformation"].(string)
+	version, _ := sourceJsonMap["Version"].(string)
 
-			versionInfoJsonMap, _ := sourceJsonMap["VersionInfo"].(map[string]interface{})
-			versionInfoMap := make(map[string]string)
-			for key, value := range versionInfoJsonMap {
-				versionInfoMap[key], _ = value.(string)
-			}
+	versionInfoJsonMap, _ := sourceJsonMap["VersionInfo"].(map[string]interface{})
+	versionInfoMap := make(map[string]string)
+	for key, value := range versionInfoJsonMap {
+		versionInfoMap[key], _ = value.(string)
+	}
 
-			createdTimeText, _ := sourceJsonMap["CreatedTime"].(string)
-			createdTime, _ := time.Parse(time.RFC3339Nano, createdTimeText)
-			content, _ := sourceJsonMap["Content"].(string)
+	createdTimeText, _ := sourceJsonMap["CreatedTime"].(string)
+	createdTime, _ := time.Parse(time.RFC3339Nano, createdTimeText)
+	content, _ := sourceJsonMap["Content"].(string)
 
-			buildLog := build.BuildLog{
-				imageInformation,
-				version,
-				versionInfoMap,
-				createdTime,
-				content,
-			}
-			buildLogSlice = append(buildLogSlice, buildLog)
-		}
-		return buildLogSlice, nil
-	} else {
-		log.Error("Fail to get with byteSlice %s", string(byteSlice))
-		return nil, errors.New("Fail to get with byteSlice " + string(byteSlice))
+	return build.BuildLog{
+		ImageInformation: imageInformation,
+		Version:          version,
+		VersionInfo:      versionInfoMap,
+		CreatedTime:      createdTime,
+		Content:          content,
 	}
 }
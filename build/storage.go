@@ -0,0 +1,101 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"github.com/cloudawan/cloudone_utility/build"
+	"strings"
+	"time"
+)
+
+// Storage is the backend keeping the build logs
+type Storage interface {
+	SaveBuildLog(index string, documentType string, buildLog *build.BuildLog, refreshForSearch bool) error
+	// Return the source of the matched build logs sorted by CreatedTime in descending order
+	SearchBuildLog(index string, documentType string, from *time.Time, to *time.Time, size int, offset int) ([]map[string]interface{}, error)
+	// Pass the source of the matched build logs page by page in the same order as SearchBuildLog to the handle
+	ScrollBuildLog(index string, documentType string, from *time.Time, to *time.Time,
+		handle func(sourceJsonMapSlice []map[string]interface{}) error) error
+	// Delete the index or all indices of the alias
+	DeleteIndex(index string) error
+	// Move the documents of the legacy indices not named with period into the indices named with period by the first time field found
+	MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error
+	GetAllIndex(indexPattern string) ([]string, error)
+	DeleteBuildLog(index string, documentType string, version string) error
+	GetBuildLog(index string, documentType string, version string) (*build.BuildLog, error)
+}
+
+var storage Storage
+
+func init() {
+	switch configuration.GetStorageType() {
+	case configuration.StorageTypeLocal:
+		storage = CreateStorageLocal()
+	default:
+		storage = CreateStorageElasticSearch()
+	}
+}
+
+func checkFormatForElasticSearchData(buildLog *build.BuildLog) {
+	if buildLog.VersionInfo != nil {
+		for key, value := range buildLog.VersionInfo {
+			if strings.Contains(key, ".") {
+				newKey := strings.Replace(key, ".", "_", -1)
+				buildLog.VersionInfo[newKey] = value
+				delete(buildLog.VersionInfo, key)
+			}
+		}
+	}
+}
+
+func getIndexName(imageInformation string) string {
+	return indexBuildLogIndexPrefix + strings.ToLower(imageInformation)
+}
+
+func SaveBuildLog(buildLog *build.BuildLog, refreshForSearch bool) error {
+	checkFormatForElasticSearchData(buildLog)
+	// The build log is saved in the index of its period and searched with the alias
+	index := rollover.GetIndexName(getIndexName(buildLog.ImageInformation), buildLog.CreatedTime)
+	return storage.SaveBuildLog(index, indexBuildLogType, buildLog, refreshForSearch)
+}
+
+// MigrateLegacyIndex moves the build log indices created before the rollover into the indices named with period
+func MigrateLegacyIndex() error {
+	return storage.MigrateLegacyIndex(indexBuildLogIndexPrefix+"*", []string{"CreatedTime"})
+}
+
+// DeleteExpiredBuildLogIndex deletes the build log indices older than the retention
+func DeleteExpiredBuildLogIndex(now time.Time) error {
+	indexSlice, err := storage.GetAllIndex(indexBuildLogIndexPrefix + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return rollover.DeleteExpiredIndex(rollover.KindBuildLog, indexSlice, now, storage.DeleteIndex)
+}
+
+func DeleteBuildLogBelongingToImageInformation(imageInformation string) error {
+	return storage.DeleteIndex(getIndexName(imageInformation))
+}
+
+func DeleteBuildLog(imageInformation string, version string) error {
+	return storage.DeleteBuildLog(getIndexName(imageInformation), indexBuildLogType, version)
+}
+
+func GetBuildLog(imageInformation string, version string) (*build.BuildLog, error) {
+	return storage.GetBuildLog(getIndexName(imageInformation), indexBuildLogType, version)
+}
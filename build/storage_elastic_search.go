@@ -15,16 +15,20 @@
 package build
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
 	"github.com/cloudawan/cloudone_utility/build"
-	elasticsearchlib "github.com/cloudawan/cloudone_utility/database/elasticsearch"
-	"strings"
+	"strconv"
+	"time"
 )
 
-func init() {
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
 	createIndexTemplate()
+	return &StorageElasticSearch{}
 }
 
 func createIndexTemplate() error {
@@ -95,33 +99,20 @@ func createIndexTemplate() error {
 	return nil
 }
 
-func checkFormatForElasticSearchData(buildLog *build.BuildLog) {
-	if buildLog.VersionInfo != nil {
-		for key, value := range buildLog.VersionInfo {
-			if strings.Contains(key, ".") {
-				newKey := strings.Replace(key, ".", "_", -1)
-				buildLog.VersionInfo[newKey] = value
-				delete(buildLog.VersionInfo, key)
-			}
-		}
+func (storageElasticSearch *StorageElasticSearch) SaveBuildLog(index string, documentType string, buildLog *build.BuildLog, refreshForSearch bool) error {
+	if err := elasticsearch.EnsureIndexWithAlias(index); err != nil {
+		log.Error(err)
+		return err
 	}
-}
-
-func getIndexName(imageInformation string) string {
-	return indexBuildLogIndexPrefix + strings.ToLower(imageInformation)
-}
-
-func SaveBuildLog(buildLog *build.BuildLog, refreshForSearch bool) error {
-	checkFormatForElasticSearchData(buildLog)
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.Index(getIndexName(buildLog.ImageInformation), indexBuildLogType, buildLog.Version, nil, buildLog)
+	_, err := connection.Index(index, documentType, buildLog.Version, nil, buildLog)
 	if err != nil {
 		log.Debug(buildLog)
 		log.Error(err)
 		return err
 	} else {
 		if refreshForSearch {
-			if _, err := connection.Refresh(getIndexName(buildLog.ImageInformation)); err != nil {
+			if _, err := connection.Refresh(index); err != nil {
 				log.Error(err)
 				return err
 			} else {
@@ -133,13 +124,111 @@ func SaveBuildLog(buildLog *build.BuildLog, refreshForSearch bool) error {
 	}
 }
 
-// Bulk Process
-const (
-	maxConnection = 5
-)
+// getBuildLogQuery returns the query and sort fields of the search body
+func getBuildLogQuery(from *time.Time, to *time.Time) string {
+	var queryField string
+	if from == nil && to != nil {
+		lte := to.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"CreatedTime" : {
+					"lte": "` + lte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    },`
+	} else if from != nil && to == nil {
+		gte := from.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"CreatedTime" : {
+					"gte": "` + gte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    },`
+	} else if from != nil && to != nil {
+		lte := to.UTC().Format(time.RFC3339Nano)
+		gte := from.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"CreatedTime" : {
+					"lte": "` + lte + `",
+					"gte": "` + gte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    }`
+	} else {
+		queryField = ``
+	}
+
+	return `
+		"query": {
+			"filtered": {
+				` + queryField + `
+			}
+		},
+		"sort" : [
+	 		{ 
+				"CreatedTime" : "desc"
+			}
+    		]`
+}
+
+func (storageElasticSearch *StorageElasticSearch) SearchBuildLog(index string, documentType string, from *time.Time,
+	to *time.Time, size int, offset int) ([]map[string]interface{}, error) {
+	query := `
+	{
+		` + getBuildLogQuery(from, to) + `,
+		"size": ` + strconv.Itoa(size) + `,
+		"from": ` + strconv.Itoa(offset) + `
+	}
+	`
+
+	byteSlice, err := searchBuildLogRawJson(index, documentType, query)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonMap := make(map[string]interface{})
+	if err := json.Unmarshal(byteSlice, &jsonMap); err != nil {
+		log.Error(err)
+		return nil, err
+	}
 
-func createBulkProcessor() *elasticsearchlib.BulkProcessor {
-	return elasticsearch.ElasticSearchClient.CreateBulkProcessor(maxConnection)
+	resultSlice, ok := jsonMap["hits"].(map[string]interface{})["hits"].([]interface{})
+	if ok {
+		return getSourceJsonMapSlice(resultSlice), nil
+	} else {
+		log.Error("Fail to get with byteSlice %s", string(byteSlice))
+		return nil, errors.New("Fail to get with byteSlice " + string(byteSlice))
+	}
+}
+
+func getSourceJsonMapSlice(resultSlice []interface{}) []map[string]interface{} {
+	sourceJsonMapSlice := make([]map[string]interface{}, 0)
+	for _, result := range resultSlice {
+		resultJsonMap, _ := result.(map[string]interface{})
+		sourceJsonMap, _ := resultJsonMap["_source"].(map[string]interface{})
+		sourceJsonMapSlice = append(sourceJsonMapSlice, sourceJsonMap)
+	}
+	return sourceJsonMapSlice
+}
+
+func (storageElasticSearch *StorageElasticSearch) ScrollBuildLog(index string, documentType string, from *time.Time,
+	to *time.Time, handle func(sourceJsonMapSlice []map[string]interface{}) error) error {
+	query := `
+	{
+		` + getBuildLogQuery(from, to) + `,
+		"size": ` + strconv.Itoa(elasticsearch.ScrollPageSize) + `
+	}
+	`
+
+	return elasticsearch.Scroll(index, documentType, query, func(hitSlice []interface{}) error {
+		return handle(getSourceJsonMapSlice(hitSlice))
+	})
 }
 
 func searchBuildLogRawJson(index string, _type string, query interface{}) ([]byte, error) {
@@ -152,19 +241,27 @@ func searchBuildLogRawJson(index string, _type string, query interface{}) ([]byt
 	}
 }
 
-func DeleteBuildLogBelongingToImageInformation(imageInformation string) error {
-	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.DeleteIndex(getIndexName(imageInformation))
+func (storageElasticSearch *StorageElasticSearch) DeleteIndex(index string) error {
+	return elasticsearch.DeleteIndexOrAlias(index)
+}
+
+func (storageElasticSearch *StorageElasticSearch) MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	return elasticsearch.MigrateLegacyIndex(indexPattern, timeFieldSlice)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllIndex(indexPattern string) ([]string, error) {
+	return elasticsearch.GetAllIndex(indexPattern)
+}
+
+func (storageElasticSearch *StorageElasticSearch) DeleteBuildLog(index string, documentType string, version string) error {
+	// Find the concrete index since the document can't be deleted through the alias
+	concreteIndex, _, err := elasticsearch.GetByID(index, documentType, version)
 	if err != nil {
 		return err
-	} else {
-		return nil
 	}
-}
 
-func DeleteBuildLog(imageInformation string, version string) error {
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.Delete(getIndexName(imageInformation), indexBuildLogType, version, nil)
+	_, err = connection.Delete(concreteIndex, documentType, version, nil)
 	if err != nil {
 		return err
 	} else {
@@ -172,17 +269,15 @@ func DeleteBuildLog(imageInformation string, version string) error {
 	}
 }
 
-func GetBuildLog(imageInformation string, version string) (*build.BuildLog, error) {
-	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	baseResponse, err := connection.Get(getIndexName(imageInformation), indexBuildLogType, version, nil)
+func (storageElasticSearch *StorageElasticSearch) GetBuildLog(index string, documentType string, version string) (*build.BuildLog, error) {
+	// The index could be an alias with multiple indices so search by id instead of get
+	_, byteSlice, err := elasticsearch.GetByID(index, documentType, version)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	} else {
 		buildLog := &build.BuildLog{}
-		decoder := json.NewDecoder(bytes.NewReader(*baseResponse.Source))
-		decoder.UseNumber()
-		err := decoder.Decode(&buildLog)
+		err := elasticsearch.DecodeSource(byteSlice, &buildLog)
 		if err != nil {
 			log.Error(err)
 			return nil, err
@@ -15,8 +15,9 @@
 package control
 
 import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 )
 
 func GetAllEvent(kubeApiServerEndPoint string, kubeApiServerToken string) (returnedEventSlice []map[string]interface{}, returnedError error) {
@@ -32,7 +33,7 @@ func GetAllEvent(kubeApiServerEndPoint string, kubeApiServerToken string) (retur
 	headerMap := make(map[string]string)
 	headerMap["Authorization"] = kubeApiServerToken
 
-	jsonMap, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/events/", headerMap, true)
+	jsonMap, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+"/api/v1/events/", headerMap)
 	if err != nil {
 		log.Error("Fail to get all event with endpoint: %s, token: %s, error: %s", kubeApiServerEndPoint, kubeApiServerToken, err.Error())
 		return nil, err
@@ -61,7 +62,7 @@ func DeleteEvent(kubeApiServerEndPoint string, kubeApiServerToken string, selfLi
 	headerMap := make(map[string]string)
 	headerMap["Authorization"] = kubeApiServerToken
 
-	_, err := restclient.RequestDelete(kubeApiServerEndPoint+selfLink, nil, headerMap, true)
+	_, err := httpclient.RequestDelete(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+selfLink, headerMap)
 	if err != nil {
 		log.Error("Fail to delete event selfLink %s with endpoint: %s, token: %s, error: %s", selfLink, kubeApiServerEndPoint, kubeApiServerToken, err.Error())
 		return err
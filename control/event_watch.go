@@ -0,0 +1,148 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	WatchEventTypeAdded    = "ADDED"
+	WatchEventTypeModified = "MODIFIED"
+	WatchEventTypeDeleted  = "DELETED"
+	WatchEventTypeBookmark = "BOOKMARK"
+	WatchEventTypeError    = "ERROR"
+)
+
+// The resource version is too old to watch so the caller needs to list again
+var ErrorResourceVersionExpired = errors.New("The resource version is expired")
+
+type WatchEvent struct {
+	Type   string                 `json:"type"`
+	Object map[string]interface{} `json:"object"`
+}
+
+// GetAllEventWithResourceVersion lists all events with the resource version of the list used to start watching
+func GetAllEventWithResourceVersion(kubeApiServerEndPoint string, kubeApiServerToken string) (returnedEventSlice []map[string]interface{}, returnedResourceVersion string, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetAllEventWithResourceVersion Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedEventSlice = nil
+			returnedResourceVersion = ""
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	jsonMap, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+"/api/v1/events/", headerMap)
+	if err != nil {
+		log.Error("Fail to get all event with endpoint: %s, error: %s", kubeApiServerEndPoint, err.Error())
+		return nil, "", err
+	}
+
+	resourceVersion, _ := jsonMap.(map[string]interface{})["metadata"].(map[string]interface{})["resourceVersion"].(string)
+
+	eventSlice := make([]map[string]interface{}, 0)
+	for _, data := range jsonMap.(map[string]interface{})["items"].([]interface{}) {
+		value, ok := data.(map[string]interface{})
+		if ok {
+			eventSlice = append(eventSlice, value)
+		}
+	}
+
+	return eventSlice, resourceVersion, nil
+}
+
+// WatchAllEvent watches the events after the resource version until the server closes the watch at the timeout.
+// The handler is called for each watch event in order and the watch stops if the handler returns error.
+func WatchAllEvent(kubeApiServerEndPoint string, kubeApiServerToken string, resourceVersion string,
+	timeoutInSecond int, handler func(watchEvent *WatchEvent) error) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("WatchAllEvent Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	valueMap := url.Values{}
+	valueMap.Set("watch", "true")
+	valueMap.Set("resourceVersion", resourceVersion)
+	valueMap.Set("timeoutSeconds", strconv.Itoa(timeoutInSecond))
+	valueMap.Set("allowWatchBookmarks", "true")
+
+	// Leave the time for the server to close the watch
+	client := httpclient.CreateHTTPClient(configuration.GetKubeApiServerTLSConfig(), time.Duration(timeoutInSecond)*time.Second+30*time.Second)
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+	response, err := httpclient.Do(client, "GET", kubeApiServerEndPoint+"/api/v1/events?"+valueMap.Encode(), headerMap)
+	if err != nil {
+		log.Error("Fail to watch event with endpoint: %s, error: %s", kubeApiServerEndPoint, err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusGone {
+		return ErrorResourceVersionExpired
+	}
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		log.Error("Fail to watch event with endpoint: %s, status code: %d, body: %s", kubeApiServerEndPoint, response.StatusCode, string(body))
+		return errors.New("Fail to watch event with status code " + strconv.Itoa(response.StatusCode) + " body " + string(body))
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	decoder.UseNumber()
+	for {
+		watchEvent := &WatchEvent{}
+		if err := decoder.Decode(watchEvent); err != nil {
+			if err == io.EOF {
+				// The server closes the watch at the timeout
+				return nil
+			}
+			log.Error(err)
+			return err
+		}
+
+		if watchEvent.Type == WatchEventTypeError {
+			// The object is a Status
+			code, _ := watchEvent.Object["code"].(json.Number)
+			if code.String() == strconv.Itoa(http.StatusGone) {
+				return ErrorResourceVersionExpired
+			}
+			message, _ := watchEvent.Object["message"].(string)
+			log.Error("Watch event error %v", watchEvent.Object)
+			return errors.New("Watch event error " + message)
+		}
+
+		if err := handler(watchEvent); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWatchAllEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("resourceVersion") != "100" {
+			t.Errorf("Expect resource version 100 but get %s", request.URL.RawQuery)
+		}
+		responseWriter.Write([]byte(`{"type":"ADDED","object":{"metadata":{"name":"a","resourceVersion":"101"}}}`))
+		responseWriter.Write([]byte(`{"type":"MODIFIED","object":{"metadata":{"name":"a","resourceVersion":"102"}}}`))
+		responseWriter.Write([]byte(`{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old"}}`))
+	}))
+	defer server.Close()
+
+	resourceVersionSlice := make([]string, 0)
+	err := WatchAllEvent(server.URL, "Bearer token", "100", 1, func(watchEvent *WatchEvent) error {
+		resourceVersionSlice = append(resourceVersionSlice, watchEvent.Object["metadata"].(map[string]interface{})["resourceVersion"].(string))
+		return nil
+	})
+	if err != ErrorResourceVersionExpired {
+		t.Errorf("Expect expired resource version but get %v", err)
+	}
+	if len(resourceVersionSlice) != 2 || resourceVersionSlice[1] != "102" {
+		t.Errorf("Expect 101 and 102 but get %v", resourceVersionSlice)
+	}
+}
@@ -15,8 +15,9 @@
 package control
 
 import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 )
 
 func GetAllNamespaceName(kubeApiServerEndPoint string, kubeApiServerToken string) (returnedNameSlice []string, returnedError error) {
@@ -32,7 +33,7 @@ func GetAllNamespaceName(kubeApiServerEndPoint string, kubeApiServerToken string
 	headerMap := make(map[string]string)
 	headerMap["Authorization"] = kubeApiServerToken
 
-	jsonMap, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/", headerMap, true)
+	jsonMap, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+"/api/v1/namespaces/", headerMap)
 	if err != nil {
 		log.Error("Fail to get all namespace name with endpoint: %s, token: %s, error: %s", kubeApiServerEndPoint, kubeApiServerToken, err.Error())
 		return nil, err
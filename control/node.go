@@ -0,0 +1,114 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
+	"github.com/cloudawan/cloudone_utility/logger"
+)
+
+const (
+	NodeAddressTypeInternalIP = "InternalIP"
+)
+
+// Node is the status of the node. The quantity is in the Kubernetes format like 4 or 16Gi and
+// the condition status is True, False or Unknown.
+type Node struct {
+	Name           string
+	Address        string
+	Unschedulable  bool
+	CapacityMap    map[string]string
+	AllocatableMap map[string]string
+	// Condition type like Ready or MemoryPressure -> status
+	ConditionMap map[string]string
+}
+
+func GetAllNode(kubeApiServerEndPoint string, kubeApiServerToken string) (returnedNodeSlice []Node, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetAllNode Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedNodeSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	jsonMap, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+"/api/v1/nodes/", headerMap)
+	if err != nil {
+		log.Error("Fail to get all node with endpoint: %s, error: %s", kubeApiServerEndPoint, err.Error())
+		return nil, err
+	}
+
+	nodeSlice := make([]Node, 0)
+	for _, item := range jsonMap.(map[string]interface{})["items"].([]interface{}) {
+		nodeSlice = append(nodeSlice, convertToNode(item.(map[string]interface{})))
+	}
+
+	return nodeSlice, nil
+}
+
+func convertToNode(jsonMap map[string]interface{}) Node {
+	metadataJsonMap, _ := jsonMap["metadata"].(map[string]interface{})
+	specJsonMap, _ := jsonMap["spec"].(map[string]interface{})
+	statusJsonMap, _ := jsonMap["status"].(map[string]interface{})
+
+	node := Node{}
+	node.Name, _ = metadataJsonMap["name"].(string)
+	node.Unschedulable, _ = specJsonMap["unschedulable"].(bool)
+	node.CapacityMap = convertToStringMap(statusJsonMap["capacity"])
+	node.AllocatableMap = convertToStringMap(statusJsonMap["allocatable"])
+
+	// Use the internal IP if it exists
+	addressSlice, _ := statusJsonMap["addresses"].([]interface{})
+	for _, address := range addressSlice {
+		addressJsonMap, _ := address.(map[string]interface{})
+		addressType, _ := addressJsonMap["type"].(string)
+		addressText, _ := addressJsonMap["address"].(string)
+		if node.Address == "" || addressType == NodeAddressTypeInternalIP {
+			node.Address = addressText
+		}
+		if addressType == NodeAddressTypeInternalIP {
+			break
+		}
+	}
+
+	node.ConditionMap = make(map[string]string)
+	conditionSlice, _ := statusJsonMap["conditions"].([]interface{})
+	for _, condition := range conditionSlice {
+		conditionJsonMap, _ := condition.(map[string]interface{})
+		conditionType, _ := conditionJsonMap["type"].(string)
+		conditionStatus, _ := conditionJsonMap["status"].(string)
+		if conditionType != "" {
+			node.ConditionMap[conditionType] = conditionStatus
+		}
+	}
+
+	return node
+}
+
+func convertToStringMap(value interface{}) map[string]string {
+	stringMap := make(map[string]string)
+	jsonMap, _ := value.(map[string]interface{})
+	for key, value := range jsonMap {
+		if text, ok := value.(string); ok {
+			stringMap[key] = text
+		}
+	}
+	return stringMap
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"testing"
+)
+
+func TestConvertToNode(t *testing.T) {
+	jsonMap := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "node-1"},
+		"spec":     map[string]interface{}{"unschedulable": true},
+		"status": map[string]interface{}{
+			"capacity":    map[string]interface{}{"cpu": "4", "memory": "16Gi"},
+			"allocatable": map[string]interface{}{"cpu": "3800m", "memory": "15Gi"},
+			"addresses": []interface{}{
+				map[string]interface{}{"type": "Hostname", "address": "node-1"},
+				map[string]interface{}{"type": "InternalIP", "address": "10.0.0.1"},
+			},
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+				map[string]interface{}{"type": "MemoryPressure", "status": "False"},
+			},
+		},
+	}
+
+	node := convertToNode(jsonMap)
+	if node.Name != "node-1" || node.Address != "10.0.0.1" || node.Unschedulable == false {
+		t.Errorf("Unexpected node %v", node)
+	}
+	if node.AllocatableMap["cpu"] != "3800m" || node.CapacityMap["memory"] != "16Gi" {
+		t.Errorf("Unexpected capacity %v allocatable %v", node.CapacityMap, node.AllocatableMap)
+	}
+	if node.ConditionMap["Ready"] != "True" || node.ConditionMap["MemoryPressure"] != "False" {
+		t.Errorf("Unexpected condition %v", node.ConditionMap)
+	}
+}
@@ -15,8 +15,9 @@
 package control
 
 import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 )
 
 func GetAllPodNameBelongToReplicationController(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, replicationControllerName string) (returnedNameSlice []string, returnedError error) {
@@ -32,7 +33,7 @@ func GetAllPodNameBelongToReplicationController(kubeApiServerEndPoint string, ku
 	headerMap := make(map[string]string)
 	headerMap["Authorization"] = kubeApiServerToken
 
-	jsonMap, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/", headerMap, true)
+	jsonMap, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/", headerMap)
 	if err != nil {
 		log.Error("Fail to get replication controller inofrmation with endpoint %s, token: %s, namespace: %s, replication controller name: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, replicationControllerName, err.Error())
 		return nil, err
@@ -15,8 +15,9 @@
 package control
 
 import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 )
 
 func GetAllReplicationControllerName(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string) (returnedNameSlice []string, returnedError error) {
@@ -34,7 +35,7 @@ func GetAllReplicationControllerName(kubeApiServerEndPoint string, kubeApiServer
 	headerMap := make(map[string]string)
 	headerMap["Authorization"] = kubeApiServerToken
 
-	jsonMap, err := restclient.RequestGet(url, headerMap, true)
+	jsonMap, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), url, headerMap)
 	if err != nil {
 		log.Error(err)
 		return nil, err
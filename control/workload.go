@@ -0,0 +1,204 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"sort"
+	"strings"
+)
+
+const (
+	WorkloadKindReplicationController = "ReplicationController"
+	WorkloadKindReplicaSet            = "ReplicaSet"
+	WorkloadKindDeployment            = "Deployment"
+	WorkloadKindStatefulSet           = "StatefulSet"
+	WorkloadKindDaemonSet             = "DaemonSet"
+	WorkloadKindJob                   = "Job"
+	WorkloadKindCronJob               = "CronJob"
+	// The pod without controller is a workload by itself
+	WorkloadKindPod = "Pod"
+
+	// Stop following the owner references in case of a loop
+	maximumOwnerReferenceDepth = 10
+)
+
+type Workload struct {
+	Kind         string
+	Name         string
+	PodNameSlice []string
+}
+
+type ownerReference struct {
+	apiVersion string
+	kind       string
+	name       string
+}
+
+// GetAllWorkload groups the pods in the namespace by the top-level controller found by following ownerReferences.
+// The pod created by a replication controller of the old Kubernetes without ownerReferences is matched by generateName.
+func GetAllWorkload(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string) (returnedWorkloadSlice []Workload, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("GetAllWorkload Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedWorkloadSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	jsonMap, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/", headerMap)
+	if err != nil {
+		log.Error("Fail to get all pod with endpoint %s, namespace: %s, error %s", kubeApiServerEndPoint, namespace, err.Error())
+		return nil, err
+	}
+
+	replicationControllerNameSlice, err := GetAllReplicationControllerName(kubeApiServerEndPoint, kubeApiServerToken, namespace)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// kind/name -> top-level owner
+	topOwnerMap := make(map[string]ownerReference)
+	// kind/name -> workload
+	workloadMap := make(map[string]*Workload)
+	for _, data := range jsonMap.(map[string]interface{})["items"].([]interface{}) {
+		metadataJsonMap, _ := data.(map[string]interface{})["metadata"].(map[string]interface{})
+		podName, ok := metadataJsonMap["name"].(string)
+		if ok == false {
+			continue
+		}
+
+		var top ownerReference
+		if owner := getControllerOwnerReference(metadataJsonMap); owner != nil {
+			top = getTopOwnerReference(kubeApiServerEndPoint, kubeApiServerToken, namespace, *owner, topOwnerMap)
+		} else {
+			top = ownerReference{"v1", WorkloadKindPod, podName}
+			generateName, _ := metadataJsonMap["generateName"].(string)
+			for _, replicationControllerName := range replicationControllerNameSlice {
+				if generateName == replicationControllerName+"-" {
+					top = ownerReference{"v1", WorkloadKindReplicationController, replicationControllerName}
+					break
+				}
+			}
+		}
+
+		key := top.kind + "/" + top.name
+		workload, ok := workloadMap[key]
+		if ok == false {
+			workload = &Workload{top.kind, top.name, make([]string, 0)}
+			workloadMap[key] = workload
+		}
+		workload.PodNameSlice = append(workload.PodNameSlice, podName)
+	}
+
+	keySlice := make([]string, 0)
+	for key, _ := range workloadMap {
+		keySlice = append(keySlice, key)
+	}
+	sort.Strings(keySlice)
+
+	workloadSlice := make([]Workload, 0)
+	for _, key := range keySlice {
+		workloadSlice = append(workloadSlice, *workloadMap[key])
+	}
+
+	return workloadSlice, nil
+}
+
+// getTopOwnerReference follows the owner references. The owner which can't be read is taken as the top.
+func getTopOwnerReference(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string,
+	owner ownerReference, topOwnerMap map[string]ownerReference) ownerReference {
+	visitedKeySlice := make([]string, 0)
+	current := owner
+	for i := 0; i < maximumOwnerReferenceDepth; i++ {
+		key := current.kind + "/" + current.name
+		if top, ok := topOwnerMap[key]; ok {
+			current = top
+			break
+		}
+		visitedKeySlice = append(visitedKeySlice, key)
+
+		metadataJsonMap, err := getOwnerMetadata(kubeApiServerEndPoint, kubeApiServerToken, namespace, current)
+		if err != nil {
+			log.Error("Fail to get owner %s in namespace %s with error %s", key, namespace, err)
+			break
+		}
+		next := getControllerOwnerReference(metadataJsonMap)
+		if next == nil {
+			break
+		}
+		current = *next
+	}
+
+	for _, key := range visitedKeySlice {
+		topOwnerMap[key] = current
+	}
+	return current
+}
+
+func getOwnerMetadata(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, owner ownerReference) (map[string]interface{}, error) {
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	result, err := httpclient.RequestGet(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+getOwnerPath(namespace, owner), headerMap)
+	if err != nil {
+		return nil, err
+	}
+	metadataJsonMap, _ := result.(map[string]interface{})["metadata"].(map[string]interface{})
+	return metadataJsonMap, nil
+}
+
+// getOwnerPath builds the resource path with the plural of the kind like /apis/apps/v1/namespaces/default/deployments/nginx
+func getOwnerPath(namespace string, owner ownerReference) string {
+	var groupVersionPath string
+	if strings.Contains(owner.apiVersion, "/") {
+		groupVersionPath = "/apis/" + owner.apiVersion
+	} else {
+		groupVersionPath = "/api/" + owner.apiVersion
+	}
+	return groupVersionPath + "/namespaces/" + namespace + "/" + strings.ToLower(owner.kind) + "s/" + owner.name
+}
+
+// getControllerOwnerReference returns the owner reference marked as the controller or the first one if none is marked
+func getControllerOwnerReference(metadataJsonMap map[string]interface{}) *ownerReference {
+	ownerReferenceSlice, _ := metadataJsonMap["ownerReferences"].([]interface{})
+	var found *ownerReference = nil
+	for _, data := range ownerReferenceSlice {
+		jsonMap, ok := data.(map[string]interface{})
+		if ok == false {
+			continue
+		}
+		apiVersion, _ := jsonMap["apiVersion"].(string)
+		kind, _ := jsonMap["kind"].(string)
+		name, _ := jsonMap["name"].(string)
+		if kind == "" || name == "" {
+			continue
+		}
+		if controller, _ := jsonMap["controller"].(bool); controller {
+			return &ownerReference{apiVersion, kind, name}
+		}
+		if found == nil {
+			found = &ownerReference{apiVersion, kind, name}
+		}
+	}
+	return found
+}
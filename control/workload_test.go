@@ -0,0 +1,42 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"testing"
+)
+
+func TestGetControllerOwnerReference(t *testing.T) {
+	metadataJsonMap := map[string]interface{}{
+		"ownerReferences": []interface{}{
+			map[string]interface{}{"apiVersion": "v1", "kind": "Node", "name": "node-1"},
+			map[string]interface{}{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "nginx-5d8f", "controller": true},
+		},
+	}
+	owner := getControllerOwnerReference(metadataJsonMap)
+	if owner == nil || owner.kind != WorkloadKindReplicaSet {
+		t.Fatalf("Expect the controller ReplicaSet but get %v", owner)
+	}
+	if path := getOwnerPath("default", *owner); path != "/apis/apps/v1/namespaces/default/replicasets/nginx-5d8f" {
+		t.Errorf("Unexpected path %s", path)
+	}
+	if path := getOwnerPath("default", ownerReference{"v1", WorkloadKindReplicationController, "nginx"}); path != "/api/v1/namespaces/default/replicationcontrollers/nginx" {
+		t.Errorf("Unexpected path %s", path)
+	}
+
+	if owner := getControllerOwnerReference(map[string]interface{}{}); owner != nil {
+		t.Errorf("Expect no owner but get %v", owner)
+	}
+}
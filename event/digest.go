@@ -0,0 +1,210 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/notification"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	eventTypeWarning = "Warning"
+)
+
+// publishNotification is replaced in the test
+var publishNotification = notification.Publish
+
+// EventDigest summarizes the unacknowledged Warning events last seen in the period
+type EventDigest struct {
+	From                      time.Time
+	To                        time.Time
+	NamespaceEventDigestSlice []NamespaceEventDigest
+}
+
+type NamespaceEventDigest struct {
+	Namespace   string
+	EventAmount int
+	// The sum of the occurrences in the period since Kubernetes merges the repeated events into one
+	OccurrenceAmount int
+	// The occurrence amount of each reason
+	ReasonCountMap map[string]int
+}
+
+// GetEventCount returns how many times the event happened. Kubernetes merges the repeated events into one with the count.
+func GetEventCount(sourceJsonMap map[string]interface{}) float64 {
+	switch count := sourceJsonMap["count"].(type) {
+	case json.Number:
+		if value, err := count.Float64(); err == nil && value > 0 {
+			return value
+		}
+	case float64:
+		if count > 0 {
+			return count
+		}
+	}
+	return 1
+}
+
+// SummarizeUnacknowledgedWarningEvent finds the events with the same criteria as SearchHistoricalEvent with
+// acknowledge false in all namespaces and summarizes the Warning ones by namespace sorted by name. Only the
+// occurrences in the period are counted, not the ones before it merged into the same event.
+func SummarizeUnacknowledgedWarningEvent(from time.Time, to time.Time) (*EventDigest, error) {
+	namespaceEventDigestMap := make(map[string]*NamespaceEventDigest)
+	err := ScrollEventCountInWindow("*", from, to, true, func(jsonSlice []interface{}, countSlice []float64) error {
+		for i, hit := range jsonSlice {
+			hitJsonMap, _ := hit.(map[string]interface{})
+			sourceJsonMap, _ := hitJsonMap["_source"].(map[string]interface{})
+			eventType, _ := sourceJsonMap["type"].(string)
+			if eventType != eventTypeWarning {
+				continue
+			}
+			// The namespace is used as the document type
+			namespace, _ := hitJsonMap["_type"].(string)
+			reason, _ := sourceJsonMap["reason"].(string)
+			count := int(countSlice[i])
+
+			namespaceEventDigest, ok := namespaceEventDigestMap[namespace]
+			if ok == false {
+				namespaceEventDigest = &NamespaceEventDigest{namespace, 0, 0, make(map[string]int)}
+				namespaceEventDigestMap[namespace] = namespaceEventDigest
+			}
+			namespaceEventDigest.EventAmount++
+			namespaceEventDigest.OccurrenceAmount += count
+			namespaceEventDigest.ReasonCountMap[reason] += count
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	namespaceEventDigestSlice := make([]NamespaceEventDigest, 0)
+	for _, namespaceEventDigest := range namespaceEventDigestMap {
+		namespaceEventDigestSlice = append(namespaceEventDigestSlice, *namespaceEventDigest)
+	}
+	sort.SliceStable(namespaceEventDigestSlice, func(i int, j int) bool {
+		return namespaceEventDigestSlice[i].Namespace < namespaceEventDigestSlice[j].Namespace
+	})
+	return &EventDigest{from, to, namespaceEventDigestSlice}, nil
+}
+
+// formatEventDigest returns the subject and the message listing the reasons of each namespace by the occurrence amount
+func formatEventDigest(eventDigest *EventDigest) (string, string) {
+	eventAmount := 0
+	buffer := bytes.Buffer{}
+	buffer.WriteString("Unacknowledged Warning events from " + eventDigest.From.UTC().Format(time.RFC3339) +
+		" to " + eventDigest.To.UTC().Format(time.RFC3339) + "\n")
+	for _, namespaceEventDigest := range eventDigest.NamespaceEventDigestSlice {
+		eventAmount += namespaceEventDigest.EventAmount
+		buffer.WriteString("\n" + namespaceEventDigest.Namespace + ": " + strconv.Itoa(namespaceEventDigest.EventAmount) +
+			" events, " + strconv.Itoa(namespaceEventDigest.OccurrenceAmount) + " occurrences\n")
+
+		reasonSlice := make([]string, 0)
+		for reason, _ := range namespaceEventDigest.ReasonCountMap {
+			reasonSlice = append(reasonSlice, reason)
+		}
+		sort.SliceStable(reasonSlice, func(i int, j int) bool {
+			iCount := namespaceEventDigest.ReasonCountMap[reasonSlice[i]]
+			jCount := namespaceEventDigest.ReasonCountMap[reasonSlice[j]]
+			if iCount != jCount {
+				return iCount > jCount
+			}
+			return reasonSlice[i] < reasonSlice[j]
+		})
+		for _, reason := range reasonSlice {
+			buffer.WriteString("  " + reason + ": " + strconv.Itoa(namespaceEventDigest.ReasonCountMap[reason]) + "\n")
+		}
+	}
+	if eventAmount == 0 {
+		buffer.WriteString("\nNo unacknowledged Warning event\n")
+	}
+
+	subject := "Daily digest: " + strconv.Itoa(eventAmount) + " unacknowledged Warning events in " +
+		strconv.Itoa(len(eventDigest.NamespaceEventDigestSlice)) + " namespaces"
+	return subject, buffer.String()
+}
+
+// getDigestPeriodEnd returns the latest time at the hour in UTC not after now
+func getDigestPeriodEnd(now time.Time, hour int) time.Time {
+	now = now.UTC()
+	periodEnd := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if periodEnd.After(now) {
+		periodEnd = periodEnd.AddDate(0, 0, -1)
+	}
+	return periodEnd
+}
+
+// SendDailyDigest publishes the digest of the day ending at the hour in UTC once. The watermark is saved
+// so the digest is not sent again after restart or by another instance becoming active. If the digest fails
+// to be published, the watermark is not saved and the digest is published again in the next run.
+func SendDailyDigest(now time.Time, hour int) error {
+	periodEnd := getDigestPeriodEnd(now, hour)
+	watermark, err := loadDigestWatermark()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if watermark != nil && watermark.Before(periodEnd) == false {
+		return nil
+	}
+
+	eventDigest, err := SummarizeUnacknowledgedWarningEvent(periodEnd.AddDate(0, 0, -1), periodEnd)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	subject, message := formatEventDigest(eventDigest)
+	if err := publishNotification(notification.TopicDigest, subject, message, eventDigest); err != nil {
+		log.Error(err)
+		return err
+	}
+	// The watermark is saved after the deliveries are created. A failed channel doesn't send the digest
+	// again to the other channels since its delivery is retried or kept as dead by the notification.
+	if err := saveDigestWatermark(periodEnd); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// loadDigestWatermark returns nil if no digest is sent yet
+func loadDigestWatermark() (*time.Time, error) {
+	jsonMap, err := GetEvent(indexKubernetesEventBookmarkIndex, typeKubernetesEventDigestWatermark, idKubernetesEventDigestWatermark)
+	if err != nil {
+		if err.Error() == notFoundErrorMessage {
+			return nil, nil
+		}
+		log.Error(err)
+		return nil, err
+	}
+	timestampText, _ := jsonMap["timestamp"].(string)
+	timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return &timestamp, nil
+}
+
+func saveDigestWatermark(timestamp time.Time) error {
+	jsonMap := make(map[string]interface{})
+	jsonMap["timestamp"] = timestamp.UTC().Format(time.RFC3339Nano)
+	return saveKubernetesEvent(indexKubernetesEventBookmarkIndex, typeKubernetesEventDigestWatermark, idKubernetesEventDigestWatermark, jsonMap, true)
+}
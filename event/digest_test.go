@@ -0,0 +1,156 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"strings"
+	"testing"
+	"time"
+)
+
+func saveTestEvent(t *testing.T, namespace string, name string, eventType string, reason string, count int,
+	lastTimestamp time.Time, acknowledge bool) {
+	jsonMap := map[string]interface{}{
+		"metadata":      map[string]interface{}{"namespace": namespace, "name": name},
+		"type":          eventType,
+		"reason":        reason,
+		"count":         count,
+		"lastTimestamp": lastTimestamp.Format(time.RFC3339Nano),
+		"searchMetaData": map[string]interface{}{
+			"acknowledge": acknowledge,
+		},
+	}
+	if err := saveKubernetesEvent(indexKubernetesEventIndex, namespace, name, jsonMap, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSummarizeUnacknowledgedWarningEvent(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	to := time.Date(2016, 1, 2, 8, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -1)
+	saveTestEvent(t, "default", "nginx.1", "Warning", "BackOff", 5, to.Add(-time.Hour), false)
+	saveTestEvent(t, "default", "nginx.2", "Warning", "FailedScheduling", 2, to.Add(-2*time.Hour), false)
+	saveTestEvent(t, "default", "nginx.3", "Warning", "BackOff", 3, to.Add(-3*time.Hour), false)
+	saveTestEvent(t, "kube-system", "dns.1", "Warning", "Unhealthy", 1, to.Add(-time.Hour), false)
+	// Excluded by the type, acknowledgement and time
+	saveTestEvent(t, "default", "nginx.4", "Normal", "Pulled", 1, to.Add(-time.Hour), false)
+	saveTestEvent(t, "default", "nginx.5", "Warning", "BackOff", 1, to.Add(-time.Hour), true)
+	saveTestEvent(t, "default", "nginx.6", "Warning", "BackOff", 1, from.Add(-time.Hour), false)
+	// Only the occurrence in the period is counted for the event merged before it
+	jsonMap := map[string]interface{}{
+		"metadata":       map[string]interface{}{"namespace": "default", "name": "nginx.7"},
+		"type":           "Warning",
+		"reason":         "BackOff",
+		"count":          20,
+		"firstTimestamp": from.Add(-time.Hour).Format(time.RFC3339Nano),
+		"lastTimestamp":  to.Add(-time.Hour).Format(time.RFC3339Nano),
+		"searchMetaData": map[string]interface{}{"acknowledge": false},
+	}
+	if err := saveKubernetesEvent(indexKubernetesEventIndex, "default", "nginx.7", jsonMap, true); err != nil {
+		t.Fatal(err)
+	}
+
+	eventDigest, err := SummarizeUnacknowledgedWarningEvent(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eventDigest.NamespaceEventDigestSlice) != 2 {
+		t.Fatalf("Expect 2 namespaces but get %v", eventDigest.NamespaceEventDigestSlice)
+	}
+	namespaceEventDigest := eventDigest.NamespaceEventDigestSlice[0]
+	if namespaceEventDigest.Namespace != "default" || namespaceEventDigest.EventAmount != 4 ||
+		namespaceEventDigest.OccurrenceAmount != 11 || namespaceEventDigest.ReasonCountMap["BackOff"] != 9 {
+		t.Errorf("Unexpected digest %v", namespaceEventDigest)
+	}
+
+	subject, message := formatEventDigest(eventDigest)
+	if subject != "Daily digest: 5 unacknowledged Warning events in 2 namespaces" {
+		t.Errorf("Unexpected subject %s", subject)
+	}
+	if strings.Contains(message, "default: 4 events, 11 occurrences\n  BackOff: 9\n  FailedScheduling: 2\n") == false {
+		t.Errorf("Unexpected message %s", message)
+	}
+}
+
+func TestSendDailyDigest(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	originalPublishNotification := publishNotification
+	defer func() {
+		publishNotification = originalPublishNotification
+	}()
+
+	now := time.Date(2016, 1, 2, 9, 0, 0, 0, time.UTC)
+	periodEnd := time.Date(2016, 1, 2, 8, 0, 0, 0, time.UTC)
+	publishCount := 0
+	var publishError error
+	publishNotification = func(topic string, subject string, message string, data interface{}) error {
+		publishCount++
+		return publishError
+	}
+
+	// The digest isn't lost if it fails to be published before any delivery is created
+	publishError = errors.New("Channels are unavailable")
+	if err := SendDailyDigest(now, 8); err == nil {
+		t.Error("Expect the publish error")
+	}
+	if watermark, err := loadDigestWatermark(); err != nil || watermark != nil {
+		t.Errorf("Expect no watermark but get %v error %v", watermark, err)
+	}
+
+	// Published again in the next run
+	publishError = nil
+	if err := SendDailyDigest(now.Add(time.Minute), 8); err != nil {
+		t.Fatal(err)
+	}
+	if watermark, err := loadDigestWatermark(); err != nil || watermark == nil || watermark.Equal(periodEnd) == false {
+		t.Errorf("Expect the watermark %v but get %v error %v", periodEnd, watermark, err)
+	}
+	if publishCount != 2 {
+		t.Errorf("Expect 2 publishes but get %d", publishCount)
+	}
+
+	// Published only once for the day
+	if err := SendDailyDigest(now.Add(2*time.Minute), 8); err != nil {
+		t.Fatal(err)
+	}
+	if publishCount != 2 {
+		t.Errorf("Expect no more publish but get %d", publishCount)
+	}
+}
+
+func TestGetDigestPeriodEnd(t *testing.T) {
+	now := time.Date(2016, 1, 2, 7, 59, 0, 0, time.UTC)
+	if periodEnd := getDigestPeriodEnd(now, 8); periodEnd.Equal(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC)) == false {
+		t.Errorf("Expect the previous day but get %v", periodEnd)
+	}
+	now = time.Date(2016, 1, 2, 8, 0, 0, 0, time.UTC)
+	if periodEnd := getDigestPeriodEnd(now, 8); periodEnd.Equal(now) == false {
+		t.Errorf("Expect the same day but get %v", periodEnd)
+	}
+}
+
+func TestGetEventCount(t *testing.T) {
+	if count := GetEventCount(map[string]interface{}{"count": json.Number("7")}); count != 7 {
+		t.Errorf("Expect 7 but get %v", count)
+	}
+	if count := GetEventCount(map[string]interface{}{}); count != 1 {
+		t.Errorf("Expect 1 without count but get %v", count)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"strconv"
+	"time"
+)
+
+// convertToEventCountBulkItem returns the bulk item recording the count of the event at its lastTimestamp.
+// False is returned if the event has no lastTimestamp.
+func convertToEventCountBulkItem(eventBulkItem bulk.BulkItem, jsonMap map[string]interface{}) (bulk.BulkItem, bool) {
+	lastTimestampText, _ := jsonMap["lastTimestamp"].(string)
+	lastTimestamp, err := time.Parse(time.RFC3339Nano, lastTimestampText)
+	if err != nil {
+		return bulk.BulkItem{}, false
+	}
+	count := GetEventCount(jsonMap)
+
+	countJsonMap := make(map[string]interface{})
+	countJsonMap["eventID"] = eventBulkItem.ID
+	countJsonMap["count"] = count
+	countJsonMap["lastTimestamp"] = lastTimestampText
+	return bulk.BulkItem{
+		Index:    rollover.GetIndexName(indexKubernetesEventCountIndex, lastTimestamp),
+		Type:     eventBulkItem.Type,
+		ID:       eventBulkItem.ID + "_" + strconv.FormatFloat(count, 'f', -1, 64),
+		Document: countJsonMap,
+	}, true
+}
+
+// addEventToBulkProcessor adds the bulk item of the event and the one recording its count
+func addEventToBulkProcessor(bulkProcessor *bulk.BulkProcessor, bulkItem bulk.BulkItem, jsonMap map[string]interface{}) {
+	bulkProcessor.Add(bulkItem)
+	if countBulkItem, ok := convertToEventCountBulkItem(bulkItem, jsonMap); ok {
+		bulkProcessor.Add(countBulkItem)
+	}
+}
+
+// ScrollEventCountInWindow passes the events last seen in the window, only the unacknowledged ones if unacknowledgedOnly,
+// page by page with how many times each happened in the window. Kubernetes merges the repeated events into one with the cumulative count so the count
+// recorded at or before the window start is subtracted. The event happening before the window without any count
+// recorded then, like the one recorded by the older version, is counted once for its last occurrence.
+func ScrollEventCountInWindow(namespace string, from time.Time, to time.Time, unacknowledgedOnly bool,
+	handle func(jsonSlice []interface{}, countSlice []float64) error) error {
+	var acknowledge *bool = nil
+	if unacknowledgedOnly {
+		unacknowledged := false
+		acknowledge = &unacknowledged
+	}
+	return storage.ScrollKubernetesEvent(indexKubernetesEventIndex, namespace, &from, &to, acknowledge, func(jsonSlice []interface{}) error {
+		idSlice := make([]string, 0, len(jsonSlice))
+		for _, hit := range jsonSlice {
+			id, _ := hit.(map[string]interface{})["_id"].(string)
+			idSlice = append(idSlice, id)
+		}
+		countMap, err := storage.GetKubernetesEventCountAt(indexKubernetesEventCountIndex, idSlice, from)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+
+		countSlice := make([]float64, len(jsonSlice))
+		for i, hit := range jsonSlice {
+			sourceJsonMap, _ := hit.(map[string]interface{})["_source"].(map[string]interface{})
+			count := GetEventCount(sourceJsonMap)
+			if countAtFrom, ok := countMap[idSlice[i]]; ok {
+				count -= countAtFrom
+			} else if isEventFirstSeenBefore(sourceJsonMap, from) {
+				count = 1
+			}
+			if count < 0 {
+				count = 0
+			}
+			countSlice[i] = count
+		}
+		return handle(jsonSlice, countSlice)
+	})
+}
+
+func isEventFirstSeenBefore(sourceJsonMap map[string]interface{}, timestamp time.Time) bool {
+	firstTimestampText, _ := sourceJsonMap["firstTimestamp"].(string)
+	firstTimestamp, err := time.Parse(time.RFC3339Nano, firstTimestampText)
+	if err != nil {
+		return false
+	}
+	return firstTimestamp.Before(timestamp)
+}
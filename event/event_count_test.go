@@ -0,0 +1,125 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func createTestCountedEvent(name string, firstTimestamp time.Time, lastTimestamp time.Time, count int) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"namespace": "default",
+			"name":      name,
+		},
+		"type":           "Warning",
+		"reason":         "BackOff",
+		"firstTimestamp": firstTimestamp.Format(time.RFC3339Nano),
+		"lastTimestamp":  lastTimestamp.Format(time.RFC3339Nano),
+		"count":          float64(count),
+	}
+}
+
+func TestScrollEventCountInWindow(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(10 * time.Minute)
+	bulkProcessor := bulk.CreateBulkProcessor(0, 0, storage.BulkSaveKubernetesEvent)
+	for _, jsonMap := range []map[string]interface{}{
+		// 3 times before the window and 4 more times in the window
+		createTestCountedEvent("nginx.1", from.Add(-time.Hour), from.Add(-30*time.Minute), 3),
+		createTestCountedEvent("nginx.1", from.Add(-time.Hour), from.Add(5*time.Minute), 7),
+		// All in the window
+		createTestCountedEvent("redis.1", from.Add(time.Minute), from.Add(2*time.Minute), 2),
+	} {
+		bulkItem, _ := convertToEventBulkItem(jsonMap)
+		addEventToBulkProcessor(bulkProcessor, bulkItem, jsonMap)
+	}
+	// Recorded without the count before the window so only the last occurrence is known in the window
+	bulkItem, _ := convertToEventBulkItem(createTestCountedEvent("mysql.1", from.Add(-time.Hour), from.Add(3*time.Minute), 10))
+	bulkProcessor.Add(bulkItem)
+	if err := bulk.ConvertToError(bulkProcessor.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	countMap := make(map[string]float64)
+	err := ScrollEventCountInWindow("*", from, to, false, func(jsonSlice []interface{}, countSlice []float64) error {
+		for i, hit := range jsonSlice {
+			name := hit.(map[string]interface{})["_source"].(map[string]interface{})["metadata"].(map[string]interface{})["name"].(string)
+			countMap[name] = countSlice[i]
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(countMap) != 3 || countMap["nginx.1"] != 4 || countMap["redis.1"] != 2 || countMap["mysql.1"] != 1 {
+		t.Errorf("Unexpected count %v", countMap)
+	}
+}
+
+func TestScrollEventCountInWindowAcknowledged(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(10 * time.Minute)
+	record := func(jsonMap map[string]interface{}) string {
+		bulkProcessor := bulk.CreateBulkProcessor(0, 0, storage.BulkSaveKubernetesEvent)
+		bulkItem, _ := convertToEventBulkItem(jsonMap)
+		addEventToBulkProcessor(bulkProcessor, bulkItem, jsonMap)
+		if err := bulk.ConvertToError(bulkProcessor.Close()); err != nil {
+			t.Fatal(err)
+		}
+		return bulkItem.ID
+	}
+	id := record(createTestCountedEvent("nginx.1", from.Add(-time.Hour), from.Add(-30*time.Minute), 3))
+
+	// Acknowledged before the window
+	jsonMap, err := GetEvent(indexKubernetesEventIndex, "default", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonMap["searchMetaData"].(map[string]interface{})["acknowledge"] = true
+	index, _ := jsonMap["searchMetaData"].(map[string]interface{})["index"].(string)
+	if err := saveKubernetesEvent(index, "default", id, jsonMap, true); err != nil {
+		t.Fatal(err)
+	}
+	// Happens 4 more times in the window while the acknowledgement is kept
+	record(createTestCountedEvent("nginx.1", from.Add(-time.Hour), from.Add(5*time.Minute), 7))
+
+	for _, unacknowledgedOnly := range []bool{false, true} {
+		countMap := make(map[string]float64)
+		err := ScrollEventCountInWindow("*", from, to, unacknowledgedOnly, func(jsonSlice []interface{}, countSlice []float64) error {
+			for i, hit := range jsonSlice {
+				name := hit.(map[string]interface{})["_source"].(map[string]interface{})["metadata"].(map[string]interface{})["name"].(string)
+				countMap[name] = countSlice[i]
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unacknowledgedOnly && len(countMap) != 0 {
+			t.Errorf("Expect the acknowledged event excluded but get %v", countMap)
+		}
+		if unacknowledgedOnly == false && (len(countMap) != 1 || countMap["nginx.1"] != 4) {
+			t.Errorf("Expect the acknowledged event counted 4 times but get %v", countMap)
+		}
+	}
+}
@@ -16,43 +16,85 @@ package event
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/notification"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	eventDeleteAfterRecordDefault = false
+)
+
+// id -> resourceVersion of the events recorded by polling without deletion
+var polledEventResourceVersionMap = make(map[string]string)
+
+// IsEventDeleteAfterRecord returns whether the events are deleted from Kubernetes after being recorded
+func IsEventDeleteAfterRecord() bool {
+	deleteAfterRecord, ok := configuration.LocalConfiguration.GetNative("eventDeleteAfterRecord").(bool)
+	if ok == false {
+		return eventDeleteAfterRecordDefault
+	}
+	return deleteAfterRecord
+}
+
+// RecordHistoricalEvent polls all events. The events are deleted from Kubernetes after being recorded only if
+// eventDeleteAfterRecord is enabled. Otherwise, the events unchanged since the last poll are skipped.
 func RecordHistoricalEvent(kubeApiServerEndPoint string, kubeApiServerToken string) (returnedError error) {
 	jsonMapSlice, err := control.GetAllEvent(kubeApiServerEndPoint, kubeApiServerToken)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	deleteAfterRecord := IsEventDeleteAfterRecord()
 	hasError := false
 	erroerMessageBuffer := bytes.Buffer{}
+	bulkProcessor := createKubernetesEventBulkProcessor()
+	// id -> selfLink
+	selfLinkMap := make(map[string]string)
+	// id -> resourceVersion
+	resourceVersionMap := make(map[string]string)
 	for _, jsonMap := range jsonMapSlice {
-		namespace, _ := jsonMap["metadata"].(map[string]interface{})["namespace"].(string)
-		selfLink, _ := jsonMap["metadata"].(map[string]interface{})["selfLink"].(string)
+		bulkItem, selfLink := convertToEventBulkItem(jsonMap)
+		resourceVersion, _ := jsonMap["metadata"].(map[string]interface{})["resourceVersion"].(string)
+		resourceVersionMap[bulkItem.ID] = resourceVersion
+		if deleteAfterRecord == false && resourceVersion != "" && polledEventResourceVersionMap[bulkItem.ID] == resourceVersion {
+			continue
+		}
 
-		jsonMap["searchMetaData"] = make(map[string]interface{})
-		jsonMap["searchMetaData"].(map[string]interface{})["acknowledge"] = false
+		selfLinkMap[bulkItem.ID] = selfLink
+		addEventToBulkProcessor(bulkProcessor, bulkItem, jsonMap)
+	}
 
-		if err := saveKubernetesEvent(indexKubernetesEventIndex, namespace, getEventID(selfLink), jsonMap, false); err != nil {
-			log.Error(err)
-			erroerMessageBuffer.WriteString(err.Error())
-			hasError = true
-		} else {
-			// Remove after saving in Elastic Search
+	bulkItemErrorSlice := bulkProcessor.Close()
+	for _, bulkItemError := range bulkItemErrorSlice {
+		log.Error("Save error %s", bulkItemError.String())
+		erroerMessageBuffer.WriteString(bulkItemError.String())
+		hasError = true
+		// Keep the failed one in Kubernetes so it is saved in the next run
+		delete(selfLinkMap, bulkItemError.ID)
+		delete(resourceVersionMap, bulkItemError.ID)
+	}
+
+	if deleteAfterRecord {
+		// Remove after saving in the storage
+		for _, selfLink := range selfLinkMap {
 			if err := control.DeleteEvent(kubeApiServerEndPoint, kubeApiServerToken, selfLink); err != nil {
 				log.Error(err)
 				erroerMessageBuffer.WriteString(err.Error())
 				hasError = true
 			}
 		}
+	} else {
+		// The events no longer in Kubernetes are dropped from the map
+		polledEventResourceVersionMap = resourceVersionMap
 	}
+
 	if hasError {
 		return errors.New(erroerMessageBuffer.String())
 	} else {
@@ -60,6 +102,60 @@ func RecordHistoricalEvent(kubeApiServerEndPoint string, kubeApiServerToken stri
 	}
 }
 
+// convertToEventBulkItem adds the search meta data to the event and returns the bulk item with the selfLink.
+// The acknowledgement is only set when the event is recorded first so recording the update of the event
+// again keeps the acknowledgement made by the user.
+func convertToEventBulkItem(jsonMap map[string]interface{}) (bulk.BulkItem, string) {
+	metadataJsonMap, _ := jsonMap["metadata"].(map[string]interface{})
+	namespace, _ := metadataJsonMap["namespace"].(string)
+	name, _ := metadataJsonMap["name"].(string)
+	selfLink, _ := metadataJsonMap["selfLink"].(string)
+	if selfLink == "" {
+		// The selfLink is not filled by the newer Kubernetes
+		selfLink = "/api/v1/namespaces/" + namespace + "/events/" + name
+	}
+
+	index := getEventIndex(jsonMap)
+
+	jsonMap["searchMetaData"] = make(map[string]interface{})
+	jsonMap["searchMetaData"].(map[string]interface{})["index"] = index
+	// The time of saving, instead of the time of the event, is used to find the events newly recorded
+	jsonMap["searchMetaData"].(map[string]interface{})["recordedTimestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	upsertJsonMap := make(map[string]interface{})
+	for key, value := range jsonMap {
+		upsertJsonMap[key] = value
+	}
+	upsertSearchMetaDataJsonMap := make(map[string]interface{})
+	for key, value := range jsonMap["searchMetaData"].(map[string]interface{}) {
+		upsertSearchMetaDataJsonMap[key] = value
+	}
+	upsertSearchMetaDataJsonMap["acknowledge"] = false
+	upsertJsonMap["searchMetaData"] = upsertSearchMetaDataJsonMap
+
+	return bulk.BulkItem{
+		Index:    index,
+		Type:     namespace,
+		ID:       getEventID(selfLink),
+		Document: jsonMap,
+		Upsert:   upsertJsonMap,
+	}, selfLink
+}
+
+// getEventIndex returns the index of the period when the event happens first so
+// the later updates of the same event overwrite the same document
+func getEventIndex(jsonMap map[string]interface{}) string {
+	timestampText, _ := jsonMap["firstTimestamp"].(string)
+	if timestampText == "" {
+		timestampText, _ = jsonMap["metadata"].(map[string]interface{})["creationTimestamp"].(string)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+	if err != nil {
+		timestamp = time.Now()
+	}
+	return rollover.GetIndexName(indexKubernetesEventIndex, timestamp)
+}
+
 func SearchHistoricalEvent(namespace string, from *time.Time,
 	to *time.Time, acknowledge bool, size int, offset int) (returnedJsonSlice []interface{}, returnedError error) {
 	defer func() {
@@ -75,92 +171,25 @@ func SearchHistoricalEvent(namespace string, from *time.Time,
 		return nil, errors.New("From " + from.String() + " can't be after to " + to.String())
 	}
 
-	var acknowledgeText string
-	if acknowledge {
-		acknowledgeText = "true"
-	} else {
-		acknowledgeText = "false"
-	}
-
-	var queryField string
-	if from == nil && to != nil {
-		lte := to.UTC().Format(time.RFC3339Nano)
-		queryField = `"query": {		
-			"range" : {
-				"lastTimestamp" : {
-					"lte": "` + lte + `",
-					"time_zone": "+0:00"
-				}
-			}
-	    },`
-	} else if from != nil && to == nil {
-		gte := from.UTC().Format(time.RFC3339Nano)
-		queryField = `"query": {		
-			"range" : {
-				"lastTimestamp" : {
-					"gte": "` + gte + `",
-					"time_zone": "+0:00"
-				}
-			}
-	    },`
-	} else if from != nil && to != nil {
-		lte := to.UTC().Format(time.RFC3339Nano)
-		gte := from.UTC().Format(time.RFC3339Nano)
-		queryField = `"query": {		
-			"range" : {
-				"lastTimestamp" : {
-					"lte": "` + lte + `",
-					"gte": "` + gte + `",
-					"time_zone": "+0:00"
-				}
-			}
-	    },`
-	} else {
-		queryField = ``
-	}
-
-	query := `
-	{
-		"query": {
-			"filtered": {
-				` + queryField + `
-				"filter": {
-					"term": { 
-						"searchMetaData.acknowledge": ` + acknowledgeText + `
-					}
-				}
-			}
-		},
-		"sort" : [
-	 		{ 
-				"lastTimestamp" : "desc"
-			}
-    	],
-		"size": ` + strconv.Itoa(size) + `,
-		"from": ` + strconv.Itoa(offset) + `
-	}
-	`
+	return storage.SearchKubernetesEvent(indexKubernetesEventIndex, namespace, from, to, acknowledge, size, offset)
+}
 
-	byteSlice, err := searchKubernetesEventRawJson(indexKubernetesEventIndex, namespace, query)
-	if err != nil {
-		log.Error(err)
-		return nil, err
-	}
+// ExportHistoricalEvent passes all matched events page by page to the handle in the same format as SearchHistoricalEvent
+func ExportHistoricalEvent(namespace string, from *time.Time, to *time.Time, acknowledge bool,
+	handle func(jsonSlice []interface{}) error) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("ExportHistoricalEvent Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
 
-	jsonMap := make(map[string]interface{})
-	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
-	decoder.UseNumber()
-	if err := decoder.Decode(&jsonMap); err != nil {
-		log.Error(err)
-		return nil, err
+	if from != nil && to != nil && from.After(*to) {
+		return errors.New("From " + from.String() + " can't be after to " + to.String())
 	}
 
-	jsonSlice, ok := jsonMap["hits"].(map[string]interface{})["hits"].([]interface{})
-	if ok {
-		return jsonSlice, nil
-	} else {
-		return nil, errors.New("Fail to get with byteSlice " + string(byteSlice))
-	}
+	return storage.ScrollKubernetesEvent(indexKubernetesEventIndex, namespace, from, to, &acknowledge, handle)
 }
 
 func getEventID(selfLink string) string {
@@ -174,11 +203,35 @@ func Acknowledge(namespace string, id string, acknowledge bool) error {
 		return err
 	} else {
 		jsonMap["searchMetaData"].(map[string]interface{})["acknowledge"] = acknowledge
-		if err := saveKubernetesEvent(indexKubernetesEventIndex, namespace, id, jsonMap, true); err != nil {
+		// Save back to the index where the event is
+		index, ok := jsonMap["searchMetaData"].(map[string]interface{})["index"].(string)
+		if ok == false {
+			index = indexKubernetesEventIndex
+		}
+		if err := saveKubernetesEvent(index, namespace, id, jsonMap, true); err != nil {
 			log.Error(err)
 			return err
 		} else {
+			publishAcknowledge(namespace, id, acknowledge, jsonMap)
 			return nil
 		}
 	}
 }
+
+// The failure of the notification doesn't fail the acknowledgement
+func publishAcknowledge(namespace string, id string, acknowledge bool, jsonMap map[string]interface{}) {
+	subject := "Event acknowledged"
+	if acknowledge == false {
+		subject = "Event unacknowledged"
+	}
+	message := "Event " + id + " in the namespace " + namespace
+	if reason, ok := jsonMap["reason"].(string); ok {
+		message += " with the reason " + reason
+	}
+	if eventMessage, ok := jsonMap["message"].(string); ok {
+		message += ": " + eventMessage
+	}
+	if err := notification.Publish(notification.TopicEvent, subject, message, jsonMap); err != nil {
+		log.Error(err)
+	}
+}
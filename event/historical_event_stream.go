@@ -0,0 +1,109 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/stream"
+	"sync"
+	"time"
+)
+
+// The events are saved in the bulk and become searchable after the refresh so the stream looks back
+// the overlap from the latest recorded time seen to catch the late ones
+const eventStreamOverlap = 30 * time.Second
+
+type eventStreamSeen struct {
+	resourceVersion   string
+	recordedTimestamp time.Time
+}
+
+// eventStreamSource polls the events recorded since the cursor. The events seen are skipped unless they are
+// updated with a new resource version.
+type eventStreamSource struct {
+	lock    sync.Mutex
+	cursor  time.Time
+	seenMap map[string]eventStreamSeen
+}
+
+var eventStreamTail = stream.CreateTail(
+	(&eventStreamSource{seenMap: make(map[string]eventStreamSeen)}).poll, stream.GetPollInterval())
+
+// SubscribeHistoricalEvent receives the events newly recorded in the same format as SearchHistoricalEvent
+func SubscribeHistoricalEvent() *stream.Subscriber {
+	return eventStreamTail.Subscribe(stream.DefaultBufferSize)
+}
+
+func UnsubscribeHistoricalEvent(subscriber *stream.Subscriber) {
+	eventStreamTail.Unsubscribe(subscriber)
+}
+
+func (source *eventStreamSource) poll(initial bool) ([]interface{}, error) {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+
+	now := time.Now()
+	if initial {
+		// Start from now instead of sending the history
+		source.cursor = now
+		source.seenMap = make(map[string]eventStreamSeen)
+	}
+
+	jsonSlice := make([]interface{}, 0)
+	err := storage.ScrollRecordedKubernetesEvent(indexKubernetesEventIndex, source.cursor.Add(-eventStreamOverlap),
+		func(hitSlice []interface{}) error {
+			for _, hit := range hitSlice {
+				if source.isNew(hit) && initial == false {
+					jsonSlice = append(jsonSlice, hit)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// The events recorded before the overlap are never searched again
+	for id, seen := range source.seenMap {
+		if seen.recordedTimestamp.Before(source.cursor.Add(-eventStreamOverlap)) {
+			delete(source.seenMap, id)
+		}
+	}
+
+	return jsonSlice, nil
+}
+
+// isNew remembers the event and moves the cursor to the latest recorded time
+func (source *eventStreamSource) isNew(hit interface{}) bool {
+	hitJsonMap, _ := hit.(map[string]interface{})
+	id, _ := hitJsonMap["_id"].(string)
+	sourceJsonMap, _ := hitJsonMap["_source"].(map[string]interface{})
+	metadataJsonMap, _ := sourceJsonMap["metadata"].(map[string]interface{})
+	resourceVersion, _ := metadataJsonMap["resourceVersion"].(string)
+	searchMetaDataJsonMap, _ := sourceJsonMap["searchMetaData"].(map[string]interface{})
+	recordedTimestampText, _ := searchMetaDataJsonMap["recordedTimestamp"].(string)
+	recordedTimestamp, err := time.Parse(time.RFC3339Nano, recordedTimestampText)
+	if id == "" || err != nil {
+		return false
+	}
+
+	if recordedTimestamp.After(source.cursor) {
+		source.cursor = recordedTimestamp
+	}
+
+	seen, ok := source.seenMap[id]
+	source.seenMap[id] = eventStreamSeen{resourceVersion, recordedTimestamp}
+	return ok == false || seen.resourceVersion != resourceVersion
+}
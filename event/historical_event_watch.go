@@ -0,0 +1,185 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"time"
+)
+
+const (
+	notFoundErrorMessage = "record not found"
+	// Save the bookmark at most once in the interval during watching
+	eventBookmarkCheckpointInterval = 5 * time.Second
+)
+
+// WatchHistoricalEvent records the events with one watch session lasting at most timeoutInSecond.
+// The resource version of the last recorded event is persisted as the bookmark after the events are saved
+// so the next session, even in another instance, resumes from it. The events are saved with the id derived from
+// the selfLink so the events delivered again after a failure overwrite the same documents instead of duplicating.
+func WatchHistoricalEvent(kubeApiServerEndPoint string, kubeApiServerToken string, timeoutInSecond int) error {
+	resourceVersion, err := loadEventBookmark()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if resourceVersion == "" {
+		// No bookmark so list to record the current events and to get the resource version to watch from
+		resourceVersion, err = recordAllEventFromList(kubeApiServerEndPoint, kubeApiServerToken)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	eventWatcher := &eventWatcher{
+		resourceVersion,
+		resourceVersion,
+		createKubernetesEventBulkProcessor(),
+		time.Now(),
+		nil,
+	}
+	watchErr := control.WatchAllEvent(kubeApiServerEndPoint, kubeApiServerToken, resourceVersion, timeoutInSecond, eventWatcher.handle)
+	// Keep what is received even if the watch is broken. The bookmark is kept if any event failed in the session
+	// even if the bookmark is expired so the failure is reported before listing again.
+	if err := eventWatcher.checkpoint(false); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if watchErr == control.ErrorResourceVersionExpired {
+		// The events between the bookmark and the new list are compacted by Kubernetes already
+		log.Info("The event bookmark %s is expired so list again", eventWatcher.savedResourceVersion)
+		return saveEventBookmark("")
+	} else if watchErr != nil {
+		log.Error(watchErr)
+		return watchErr
+	} else {
+		return nil
+	}
+}
+
+func recordAllEventFromList(kubeApiServerEndPoint string, kubeApiServerToken string) (string, error) {
+	jsonMapSlice, resourceVersion, err := control.GetAllEventWithResourceVersion(kubeApiServerEndPoint, kubeApiServerToken)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	bulkProcessor := createKubernetesEventBulkProcessor()
+	for _, jsonMap := range jsonMapSlice {
+		bulkItem, _ := convertToEventBulkItem(jsonMap)
+		addEventToBulkProcessor(bulkProcessor, bulkItem, jsonMap)
+	}
+	if err := bulk.ConvertToError(bulkProcessor.Close()); err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	if err := saveEventBookmark(resourceVersion); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return resourceVersion, nil
+}
+
+type eventWatcher struct {
+	// The resource version of the last received watch event
+	resourceVersion string
+	// The resource version persisted in the bookmark
+	savedResourceVersion string
+	bulkProcessor        *bulk.BulkProcessor
+	lastCheckpointTime   time.Time
+	// The first failure of saving the events. The bookmark is not moved any more in the session once it is set.
+	failedError error
+}
+
+func (eventWatcher *eventWatcher) handle(watchEvent *control.WatchEvent) error {
+	switch watchEvent.Type {
+	case control.WatchEventTypeAdded, control.WatchEventTypeModified:
+		bulkItem, _ := convertToEventBulkItem(watchEvent.Object)
+		addEventToBulkProcessor(eventWatcher.bulkProcessor, bulkItem, watchEvent.Object)
+	case control.WatchEventTypeDeleted:
+		// The event expires in Kubernetes but is kept in the history
+	case control.WatchEventTypeBookmark:
+		// Only the resource version is carried
+	default:
+		log.Info("Unknown watch event type %s", watchEvent.Type)
+	}
+
+	if metadataJsonMap, ok := watchEvent.Object["metadata"].(map[string]interface{}); ok {
+		if resourceVersion, ok := metadataJsonMap["resourceVersion"].(string); ok && resourceVersion != "" {
+			eventWatcher.resourceVersion = resourceVersion
+		}
+	}
+
+	if time.Now().Sub(eventWatcher.lastCheckpointTime) >= eventBookmarkCheckpointInterval {
+		return eventWatcher.checkpoint(true)
+	} else {
+		return nil
+	}
+}
+
+// checkpoint saves the buffered events and then the bookmark. The bookmark is not moved once any event fails
+// in the session so the failed events are delivered again in the next session.
+func (eventWatcher *eventWatcher) checkpoint(continueWatching bool) error {
+	bulkItemErrorSlice := eventWatcher.bulkProcessor.Close()
+	if continueWatching {
+		eventWatcher.bulkProcessor = createKubernetesEventBulkProcessor()
+	}
+	eventWatcher.lastCheckpointTime = time.Now()
+	if err := bulk.ConvertToError(bulkItemErrorSlice); err != nil {
+		log.Error(err)
+		if eventWatcher.failedError == nil {
+			eventWatcher.failedError = err
+		}
+	}
+	if eventWatcher.failedError != nil {
+		return eventWatcher.failedError
+	}
+
+	if eventWatcher.resourceVersion == eventWatcher.savedResourceVersion {
+		return nil
+	}
+	if err := saveEventBookmark(eventWatcher.resourceVersion); err != nil {
+		log.Error(err)
+		return err
+	}
+	eventWatcher.savedResourceVersion = eventWatcher.resourceVersion
+	return nil
+}
+
+// loadEventBookmark returns the empty resource version if there is no bookmark
+func loadEventBookmark() (string, error) {
+	jsonMap, err := GetEvent(indexKubernetesEventBookmarkIndex, typeKubernetesEventBookmark, idKubernetesEventBookmark)
+	if err != nil {
+		if err.Error() == notFoundErrorMessage {
+			return "", nil
+		}
+		log.Error(err)
+		return "", err
+	}
+	resourceVersion, _ := jsonMap["resourceVersion"].(string)
+	return resourceVersion, nil
+}
+
+func saveEventBookmark(resourceVersion string) error {
+	jsonMap := make(map[string]interface{})
+	jsonMap["resourceVersion"] = resourceVersion
+	jsonMap["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+	return saveKubernetesEvent(indexKubernetesEventBookmarkIndex, typeKubernetesEventBookmark, idKubernetesEventBookmark, jsonMap, true)
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func createTestWatchEvent(name string, resourceVersion string) *control.WatchEvent {
+	return &control.WatchEvent{
+		Type: control.WatchEventTypeAdded,
+		Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"namespace":       "default",
+				"name":            name,
+				"resourceVersion": resourceVersion,
+			},
+			"firstTimestamp": "2016-01-01T00:00:00Z",
+		},
+	}
+}
+
+func TestCheckpointNotMovingBookmarkAfterFailure(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	if err := saveEventBookmark("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	failingBulkProcessor := bulk.CreateBulkProcessor(0, 0, func(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+		return []bulk.BulkItemError{
+			bulk.BulkItemError{
+				Index:        bulkItemSlice[0].Index,
+				Type:         bulkItemSlice[0].Type,
+				ID:           bulkItemSlice[0].ID,
+				Status:       500,
+				ErrorMessage: "failure for test",
+			},
+		}
+	})
+	eventWatcher := &eventWatcher{"1", "1", failingBulkProcessor, time.Now(), nil}
+
+	eventWatcher.handle(createTestWatchEvent("nginx.1", "2"))
+	if err := eventWatcher.checkpoint(true); err == nil {
+		t.Fatal("Expect the failure of the bulk")
+	}
+
+	// The later events are saved but the bookmark stays before the failed one
+	eventWatcher.handle(createTestWatchEvent("nginx.2", "3"))
+	if err := eventWatcher.checkpoint(false); err == nil {
+		t.Error("Expect the failure to be kept in the session")
+	}
+	resourceVersion, err := loadEventBookmark()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resourceVersion != "1" {
+		t.Errorf("Expect the bookmark 1 but get %s", resourceVersion)
+	}
+}
+
+func TestRecordingKeepsAcknowledgement(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	bulkItem, _ := convertToEventBulkItem(createTestWatchEvent("nginx.1", "2").Object)
+	if bulk.ConvertToError(storage.BulkSaveKubernetesEvent([]bulk.BulkItem{bulkItem})) != nil {
+		t.Fatal("Fail to record the event")
+	}
+	if err := Acknowledge("default", bulkItem.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The update of the same event is recorded again
+	bulkItem, _ = convertToEventBulkItem(createTestWatchEvent("nginx.1", "3").Object)
+	if bulk.ConvertToError(storage.BulkSaveKubernetesEvent([]bulk.BulkItem{bulkItem})) != nil {
+		t.Fatal("Fail to record the event")
+	}
+	jsonMap, err := GetEvent(indexKubernetesEventIndex, "default", bulkItem.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchMetaDataJsonMap := jsonMap["searchMetaData"].(map[string]interface{})
+	if searchMetaDataJsonMap["acknowledge"] != true {
+		t.Errorf("Expect the acknowledgement to be kept but get %v", searchMetaDataJsonMap)
+	}
+	if jsonMap["metadata"].(map[string]interface{})["resourceVersion"] != "3" {
+		t.Errorf("Expect the event to be updated but get %v", jsonMap)
+	}
+}
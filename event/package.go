@@ -23,4 +23,13 @@ var log = logger.GetLogManager().GetLogger("event")
 const (
 	// No Captial is allowed in index name
 	indexKubernetesEventIndex = "kubernetes_event"
+	// The count of the event at each update so the count at any time could be found
+	indexKubernetesEventCountIndex = "kubernetes_event_count"
+	// The resource version to resume watching from
+	indexKubernetesEventBookmarkIndex = "kubernetes_event_bookmark"
+	typeKubernetesEventBookmark       = "bookmark"
+	idKubernetesEventBookmark         = "resourceVersion"
+	// The end of the last period summarized by the daily digest
+	typeKubernetesEventDigestWatermark = "digest"
+	idKubernetesEventDigestWatermark   = "daily"
 )
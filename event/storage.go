@@ -0,0 +1,97 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"time"
+)
+
+// Storage is the backend keeping the Kubernetes events. The namespace is used as the document type.
+type Storage interface {
+	SaveKubernetesEvent(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error
+	BulkSaveKubernetesEvent(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError
+	// Return the events in the same format as the hits of Elastic Search sorted by lastTimestamp descendingly
+	SearchKubernetesEvent(index string, namespace string, from *time.Time, to *time.Time,
+		acknowledge bool, size int, offset int) ([]interface{}, error)
+	// Pass the matched events page by page in the same format and order as SearchKubernetesEvent to the handle
+	ScrollKubernetesEvent(index string, namespace string, from *time.Time, to *time.Time,
+		acknowledge *bool, handle func(jsonSlice []interface{}) error) error
+	// Return the maximum count of the count records of each event at or before the time by event id
+	GetKubernetesEventCountAt(index string, idSlice []string, timestamp time.Time) (map[string]float64, error)
+	// Pass the events recorded at or after the time page by page in the recorded order to the handle
+	ScrollRecordedKubernetesEvent(index string, recordedFrom time.Time, handle func(jsonSlice []interface{}) error) error
+	// Delete the index or all indices of the alias
+	DeleteKubernetesEventIndex(index string) error
+	// Move the documents of the legacy indices not named with period into the indices named with period by the first time field found
+	MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error
+	GetAllIndex(indexPattern string) ([]string, error)
+	GetAllDocumentTypeForIndex(index string) ([]string, error)
+	GetEvent(index string, documentType string, id string) (map[string]interface{}, error)
+}
+
+var storage Storage
+
+func init() {
+	switch configuration.GetStorageType() {
+	case configuration.StorageTypeLocal:
+		storage = CreateStorageLocal()
+	default:
+		storage = CreateStorageElasticSearch()
+	}
+}
+
+func saveKubernetesEvent(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
+	return storage.SaveKubernetesEvent(index, documentType, id, jsonMap, refreshForSearch)
+}
+
+func createKubernetesEventBulkProcessor() *bulk.BulkProcessor {
+	return bulk.CreateBulkProcessorWithConfiguration(storage.BulkSaveKubernetesEvent)
+}
+
+func DeleteKubernetesEventIndex(index string) error {
+	return storage.DeleteKubernetesEventIndex(index)
+}
+
+// MigrateLegacyIndex moves the event index created before the rollover into the indices named with period
+func MigrateLegacyIndex() error {
+	return storage.MigrateLegacyIndex(indexKubernetesEventIndex, []string{"firstTimestamp", "metadata.creationTimestamp"})
+}
+
+// DeleteExpiredKubernetesEventIndex deletes the event and event count indices older than the retention
+func DeleteExpiredKubernetesEventIndex(now time.Time) error {
+	for _, alias := range []string{indexKubernetesEventIndex, indexKubernetesEventCountIndex} {
+		indexSlice, err := storage.GetAllIndex(alias + rollover.Separator + "*")
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		if err := rollover.DeleteExpiredIndex(rollover.KindEvent, indexSlice, now, storage.DeleteKubernetesEventIndex); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func GetAllNamespaces(namespace string) ([]string, error) {
+	return storage.GetAllDocumentTypeForIndex(indexKubernetesEventIndex)
+}
+
+func GetEvent(index string, documentType string, id string) (map[string]interface{}, error) {
+	return storage.GetEvent(index, documentType, id)
+}
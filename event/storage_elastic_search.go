@@ -17,19 +17,31 @@ package event
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
 	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
-	elasticsearchlib "github.com/cloudawan/cloudone_utility/database/elasticsearch"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"strconv"
+	"time"
 )
 
-func init() {
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
 	createIndexTemplate()
+	createCountIndexTemplate()
+	// Create the bookmark index so loading the absent bookmark returns not found
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	connection.CreateIndex(indexKubernetesEventBookmarkIndex)
+	return &StorageElasticSearch{}
 }
 
 func createIndexTemplate() error {
 
 	tempateBody := `
 	{
-		"template": "` + indexKubernetesEventIndex + `",
+		"template": "` + indexKubernetesEventIndex + rollover.Separator + `*",
 		"mappings": {
 			"_default_": {
 				"_all": {
@@ -137,6 +149,14 @@ func createIndexTemplate() error {
 					},
 					"count": {
 						"type": "long"
+					},
+					"searchMetaData": {
+						"properties": {
+							"recordedTimestamp": {
+								"type": "date",
+								"format": "dateOptionalTime"
+							}
+						}
 					}
 				}
 			}
@@ -165,7 +185,54 @@ func createIndexTemplate() error {
 	return nil
 }
 
-func saveKubernetesEvent(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
+func createCountIndexTemplate() error {
+
+	tempateBody := `
+	{
+		"template": "` + indexKubernetesEventCountIndex + rollover.Separator + `*",
+		"mappings": {
+			"_default_": {
+				"properties": {
+					"eventID": {
+						"type": "string",
+						"index": "not_analyzed"
+					},
+					"count": {
+						"type": "long"
+					},
+					"lastTimestamp": {
+						"type": "date",
+						"format": "dateOptionalTime"
+					}
+				}
+			}
+		}
+	}
+	`
+
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	request, err := connection.NewRequest("PUT", "/_template/template_"+indexKubernetesEventCountIndex, "")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	request.SetBodyString(tempateBody)
+	statusCode, bodyBytes, err := request.Do(nil)
+	if err != nil {
+		log.Error(err)
+		log.Error("statusCode %d", statusCode)
+		log.Error(string(bodyBytes))
+		return err
+	}
+
+	return nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) SaveKubernetesEvent(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
+	if err := elasticsearch.EnsureIndexWithAlias(index); err != nil {
+		log.Error(err)
+		return err
+	}
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
 	_, err := connection.Index(index, documentType, id, nil, jsonMap)
 	if err != nil {
@@ -185,50 +252,263 @@ func saveKubernetesEvent(index string, documentType string, id string, jsonMap m
 	}
 }
 
-// Bulk Process
-const (
-	maxConnection = 5
-)
+func (storageElasticSearch *StorageElasticSearch) BulkSaveKubernetesEvent(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+	return elasticsearch.BulkIndex(bulkItemSlice)
+}
+
+// getKubernetesEventQuery returns the query and sort fields of the search body
+// getKubernetesEventQuery filters by the acknowledgement unless it is nil
+func getKubernetesEventQuery(from *time.Time, to *time.Time, acknowledge *bool) string {
+	acknowledgeFilter := `"match_all": {}`
+	if acknowledge != nil {
+		acknowledgeFilter = `"term": { 
+						"searchMetaData.acknowledge": ` + strconv.FormatBool(*acknowledge) + `
+					}`
+	}
 
-func createBulkProcessor() *elasticsearchlib.BulkProcessor {
-	return elasticsearch.ElasticSearchClient.CreateBulkProcessor(maxConnection)
+	var queryField string
+	if from == nil && to != nil {
+		lte := to.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"lastTimestamp" : {
+					"lte": "` + lte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    },`
+	} else if from != nil && to == nil {
+		gte := from.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"lastTimestamp" : {
+					"gte": "` + gte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    },`
+	} else if from != nil && to != nil {
+		lte := to.UTC().Format(time.RFC3339Nano)
+		gte := from.UTC().Format(time.RFC3339Nano)
+		queryField = `"query": {		
+			"range" : {
+				"lastTimestamp" : {
+					"lte": "` + lte + `",
+					"gte": "` + gte + `",
+					"time_zone": "+0:00"
+				}
+			}
+	    },`
+	} else {
+		queryField = ``
+	}
+
+	return `
+		"query": {
+			"filtered": {
+				` + queryField + `
+				"filter": {
+					` + acknowledgeFilter + `
+				}
+			}
+		},
+		"sort" : [
+	 		{ 
+				"lastTimestamp" : "desc"
+			}
+    	]`
 }
 
-func searchKubernetesEventRawJson(index string, _type string, query interface{}) ([]byte, error) {
-	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	searchResult, err := connection.Search(index, _type, nil, query)
+func (storageElasticSearch *StorageElasticSearch) SearchKubernetesEvent(index string, namespace string, from *time.Time,
+	to *time.Time, acknowledge bool, size int, offset int) ([]interface{}, error) {
+	query := `
+	{
+		` + getKubernetesEventQuery(from, to, &acknowledge) + `,
+		"size": ` + strconv.Itoa(size) + `,
+		"from": ` + strconv.Itoa(offset) + `
+	}
+	`
+
+	byteSlice, err := searchKubernetesEventRawJson(index, namespace, query)
 	if err != nil {
+		log.Error(err)
 		return nil, err
+	}
+
+	jsonMap := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	if err := decoder.Decode(&jsonMap); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonSlice, ok := jsonMap["hits"].(map[string]interface{})["hits"].([]interface{})
+	if ok {
+		return jsonSlice, nil
 	} else {
-		return searchResult.RawJSON, nil
+		return nil, errors.New("Fail to get with byteSlice " + string(byteSlice))
+	}
+}
+
+func (storageElasticSearch *StorageElasticSearch) ScrollKubernetesEvent(index string, namespace string, from *time.Time,
+	to *time.Time, acknowledge *bool, handle func(jsonSlice []interface{}) error) error {
+	query := `
+	{
+		` + getKubernetesEventQuery(from, to, acknowledge) + `,
+		"size": ` + strconv.Itoa(elasticsearch.ScrollPageSize) + `
+	}
+	`
+
+	return elasticsearch.Scroll(index, namespace, query, handle)
+}
+
+func (storageElasticSearch *StorageElasticSearch) ScrollRecordedKubernetesEvent(index string, recordedFrom time.Time,
+	handle func(jsonSlice []interface{}) error) error {
+	gte := recordedFrom.UTC().Format(time.RFC3339Nano)
+	// The index created before recordedTimestamp has no mapping for it so the unmapped type is needed to sort
+	query := `
+	{
+		"query": {
+			"range" : {
+				"searchMetaData.recordedTimestamp" : {
+					"gte": "` + gte + `",
+					"time_zone": "+0:00"
+				}
+			}
+		},
+		"sort" : [
+			{
+				"searchMetaData.recordedTimestamp" : {
+					"order": "asc",
+					"unmapped_type": "date"
+				}
+			}
+		],
+		"size": ` + strconv.Itoa(elasticsearch.ScrollPageSize) + `
 	}
+	`
+
+	return elasticsearch.Scroll(index, "", query, handle)
 }
 
-func DeleteKubernetesEventIndex(index string) error {
+func (storageElasticSearch *StorageElasticSearch) GetKubernetesEventCountAt(index string, idSlice []string,
+	timestamp time.Time) (map[string]float64, error) {
+	countMap := make(map[string]float64)
+	if len(idSlice) == 0 {
+		return countMap, nil
+	}
+
+	query := make(map[string]interface{})
+	query["query"] = map[string]interface{}{
+		"filtered": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must": []interface{}{
+						map[string]interface{}{
+							"terms": map[string]interface{}{
+								"eventID": idSlice,
+							},
+						},
+						map[string]interface{}{
+							"range": map[string]interface{}{
+								"lastTimestamp": map[string]interface{}{
+									"lte":       timestamp.UTC().Format(time.RFC3339Nano),
+									"time_zone": "+0:00",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	query["size"] = 0
+	query["aggs"] = map[string]interface{}{
+		"eventID": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"field": "eventID",
+				"size":  len(idSlice),
+			},
+			"aggs": map[string]interface{}{
+				"count": map[string]interface{}{
+					"max": map[string]interface{}{
+						"field": "count",
+					},
+				},
+			},
+		},
+	}
+
+	byteSlice, err := searchKubernetesEventRawJson(index, "", query)
+	if err != nil {
+		// No event is counted before the first count index is created
+		if err.Error() == notFoundErrorMessage {
+			return countMap, nil
+		}
+		log.Error(err)
+		return nil, err
+	}
+
+	result := struct {
+		Aggregations struct {
+			EventID struct {
+				Buckets []struct {
+					Key   string
+					Count struct {
+						Value *float64
+					}
+				}
+			}
+		}
+	}{}
+	if err := json.Unmarshal(byteSlice, &result); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	for _, bucket := range result.Aggregations.EventID.Buckets {
+		if bucket.Count.Value != nil {
+			countMap[bucket.Key] = *bucket.Count.Value
+		}
+	}
+	return countMap, nil
+}
+
+func searchKubernetesEventRawJson(index string, _type string, query interface{}) ([]byte, error) {
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.DeleteIndex(index)
+	searchResult, err := connection.Search(index, _type, nil, query)
 	if err != nil {
-		return err
+		return nil, err
 	} else {
-		return nil
+		return searchResult.RawJSON, nil
 	}
 }
 
-func GetAllNamespaces(namespace string) ([]string, error) {
-	return elasticsearch.ElasticSearchClient.GetAllTypeForIndex(indexKubernetesEventIndex)
+func (storageElasticSearch *StorageElasticSearch) DeleteKubernetesEventIndex(index string) error {
+	return elasticsearch.DeleteIndexOrAlias(index)
 }
 
-func GetEvent(index string, documentType string, id string) (map[string]interface{}, error) {
-	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	baseResponse, err := connection.Get(index, documentType, id, nil)
+func (storageElasticSearch *StorageElasticSearch) MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	return elasticsearch.MigrateLegacyIndex(indexPattern, timeFieldSlice)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllIndex(indexPattern string) ([]string, error) {
+	return elasticsearch.GetAllIndex(indexPattern)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllDocumentTypeForIndex(index string) ([]string, error) {
+	return elasticsearch.GetAllTypeForIndex(index)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetEvent(index string, documentType string, id string) (map[string]interface{}, error) {
+	// The index could be an alias with multiple indices so search by id instead of get
+	_, byteSlice, err := elasticsearch.GetByID(index, documentType, id)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	} else {
 		jsonMap := make(map[string]interface{})
-		decoder := json.NewDecoder(bytes.NewReader(*baseResponse.Source))
-		decoder.UseNumber()
-		err := decoder.Decode(&jsonMap)
+		err := elasticsearch.DecodeSource(byteSlice, &jsonMap)
 		if err != nil {
 			log.Error(err)
 			return nil, err
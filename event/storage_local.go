@@ -0,0 +1,210 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"sort"
+	"time"
+)
+
+const (
+	localScrollPageSize = 500
+)
+
+type StorageLocal struct {
+	documentStore *local.DocumentStore
+}
+
+func CreateStorageLocal() *StorageLocal {
+	return &StorageLocal{local.LocalDocumentStore}
+}
+
+func (storageLocal *StorageLocal) SaveKubernetesEvent(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
+	// Local storage is searchable immediately so refreshForSearch is not needed
+	if err := storageLocal.documentStore.Index(index, documentType, id, jsonMap); err != nil {
+		log.Error(err)
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (storageLocal *StorageLocal) BulkSaveKubernetesEvent(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+	return storageLocal.documentStore.BulkIndex(bulkItemSlice)
+}
+
+func getEventLastTimestamp(document *local.Document) time.Time {
+	lastTimestampText, _ := document.GetFieldString("lastTimestamp")
+	lastTimestamp, _ := time.Parse(time.RFC3339Nano, lastTimestampText)
+	return lastTimestamp
+}
+
+// searchKubernetesEventDocument returns the matched documents sorted by lastTimestamp descendingly
+func (storageLocal *StorageLocal) searchKubernetesEventDocument(index string, namespace string, from *time.Time,
+	to *time.Time, acknowledge *bool) ([]local.Document, error) {
+	documentSlice, err := storageLocal.documentStore.Search(index, namespace, func(document *local.Document) bool {
+		acknowledgeField, _ := document.GetField("searchMetaData.acknowledge")
+		if acknowledge != nil && acknowledgeField != *acknowledge {
+			return false
+		}
+		lastTimestamp := getEventLastTimestamp(document)
+		if from != nil && lastTimestamp.Before(*from) {
+			return false
+		}
+		if to != nil && lastTimestamp.After(*to) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	sort.SliceStable(documentSlice, func(i int, j int) bool {
+		return getEventLastTimestamp(&documentSlice[i]).After(getEventLastTimestamp(&documentSlice[j]))
+	})
+
+	return documentSlice, nil
+}
+
+func (storageLocal *StorageLocal) SearchKubernetesEvent(index string, namespace string, from *time.Time,
+	to *time.Time, acknowledge bool, size int, offset int) ([]interface{}, error) {
+	documentSlice, err := storageLocal.searchKubernetesEventDocument(index, namespace, from, to, &acknowledge)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonSlice := make([]interface{}, 0)
+	for i := offset; i < len(documentSlice) && i < offset+size; i++ {
+		jsonSlice = append(jsonSlice, documentSlice[i].ConvertToSearchHit())
+	}
+
+	return jsonSlice, nil
+}
+
+func (storageLocal *StorageLocal) ScrollKubernetesEvent(index string, namespace string, from *time.Time,
+	to *time.Time, acknowledge *bool, handle func(jsonSlice []interface{}) error) error {
+	documentSlice, err := storageLocal.searchKubernetesEventDocument(index, namespace, from, to, acknowledge)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// The documents are in the memory already so only the converted hits of each page are kept at a time
+	for start := 0; start < len(documentSlice); start += localScrollPageSize {
+		jsonSlice := make([]interface{}, 0)
+		for i := start; i < len(documentSlice) && i < start+localScrollPageSize; i++ {
+			jsonSlice = append(jsonSlice, documentSlice[i].ConvertToSearchHit())
+		}
+		if err := handle(jsonSlice); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storageLocal *StorageLocal) GetKubernetesEventCountAt(index string, idSlice []string,
+	timestamp time.Time) (map[string]float64, error) {
+	idMap := make(map[string]bool)
+	for _, id := range idSlice {
+		idMap[id] = true
+	}
+	documentSlice, err := storageLocal.documentStore.Search(index, "*", func(document *local.Document) bool {
+		id, _ := document.GetFieldString("eventID")
+		return idMap[id] && getEventLastTimestamp(document).After(timestamp) == false
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	countMap := make(map[string]float64)
+	for i, _ := range documentSlice {
+		id, _ := documentSlice[i].GetFieldString("eventID")
+		count, ok := documentSlice[i].GetFieldFloat64("count")
+		if ok == false {
+			continue
+		}
+		if maximum, ok := countMap[id]; ok == false || count > maximum {
+			countMap[id] = count
+		}
+	}
+	return countMap, nil
+}
+
+func getEventRecordedTimestamp(document *local.Document) time.Time {
+	recordedTimestampText, _ := document.GetFieldString("searchMetaData.recordedTimestamp")
+	recordedTimestamp, _ := time.Parse(time.RFC3339Nano, recordedTimestampText)
+	return recordedTimestamp
+}
+
+func (storageLocal *StorageLocal) ScrollRecordedKubernetesEvent(index string, recordedFrom time.Time,
+	handle func(jsonSlice []interface{}) error) error {
+	documentSlice, err := storageLocal.documentStore.Search(index, "*", func(document *local.Document) bool {
+		return getEventRecordedTimestamp(document).Before(recordedFrom) == false
+	})
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	sort.SliceStable(documentSlice, func(i int, j int) bool {
+		return getEventRecordedTimestamp(&documentSlice[i]).Before(getEventRecordedTimestamp(&documentSlice[j]))
+	})
+
+	for start := 0; start < len(documentSlice); start += localScrollPageSize {
+		jsonSlice := make([]interface{}, 0)
+		for i := start; i < len(documentSlice) && i < start+localScrollPageSize; i++ {
+			jsonSlice = append(jsonSlice, documentSlice[i].ConvertToSearchHit())
+		}
+		if err := handle(jsonSlice); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storageLocal *StorageLocal) DeleteKubernetesEventIndex(index string) error {
+	return storageLocal.documentStore.DeleteIndex(index)
+}
+
+func (storageLocal *StorageLocal) MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	// The memory is never kept from the version before the rollover
+	return nil
+}
+
+func (storageLocal *StorageLocal) GetAllIndex(indexPattern string) ([]string, error) {
+	return storageLocal.documentStore.GetAllIndex(indexPattern), nil
+}
+
+func (storageLocal *StorageLocal) GetAllDocumentTypeForIndex(index string) ([]string, error) {
+	return storageLocal.documentStore.GetAllTypeForIndex(index)
+}
+
+func (storageLocal *StorageLocal) GetEvent(index string, documentType string, id string) (map[string]interface{}, error) {
+	jsonMap, err := storageLocal.documentStore.Get(index, documentType, id)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	} else {
+		return jsonMap, nil
+	}
+}
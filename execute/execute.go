@@ -25,9 +25,29 @@ func Close() {
 }
 
 func init() {
-	//loop(50*time.Second, loopHistoricalRecordContainerMetrics)
+	// The legacy indices are moved by the active instance before the jobs run
+	loop(1*time.Second, loopMigration)
+	if isContainerMetricsCollectionEnabled() {
+		loop(getContainerMetricsCollectionInterval(), loopHistoricalRecordContainerMetrics)
+	} else {
+		log.Info("Container metrics collection is disabled")
+	}
+	if isNodeMetricsCollectionEnabled() {
+		loop(getNodeMetricsCollectionInterval(), loopHistoricalRecordNodeMetrics)
+	} else {
+		log.Info("Node metrics collection is disabled")
+	}
 	loop(1*time.Second, loopHistoricalRecordEvent)
 	loop(1*time.Second, loopSingleton)
+	loop(1*time.Hour, loopRetention)
+	loop(1*time.Minute, loopRollup)
+	loop(getAlertEvaluationInterval(), loopAlert)
+	loop(1*time.Minute, loopDelivery)
+	if isEventDigestEnabled() {
+		loop(1*time.Minute, loopDigest)
+	} else {
+		log.Info("Event digest is disabled")
+	}
 }
 
 type functionLoop func(ticker *time.Ticker, checkingInterval time.Duration)
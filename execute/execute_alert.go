@@ -0,0 +1,63 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone_analysis/alert"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"time"
+)
+
+const (
+	alertEvaluationIntervalInSecondDefault = 30
+)
+
+func getAlertEvaluationInterval() time.Duration {
+	intervalInSecond, ok := configuration.LocalConfiguration.GetInt("alertEvaluationIntervalInSecond")
+	if ok == false || intervalInSecond <= 0 {
+		intervalInSecond = alertEvaluationIntervalInSecondDefault
+	}
+	return time.Duration(intervalInSecond) * time.Second
+}
+
+func loopAlert(ticker *time.Ticker, checkingInterval time.Duration) {
+	for {
+		select {
+		case <-ticker.C:
+			// Only the active one evaluates the rules so an alert fires once
+			if active && isMigrated() {
+				periodicalRunAlert()
+			}
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop alert quit")
+			return
+		}
+	}
+}
+
+func periodicalRunAlert() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("periodicalRunAlert Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	if err := alert.EvaluateAllRule(time.Now()); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone_analysis/notification"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"time"
+)
+
+func loopDelivery(ticker *time.Ticker, checkingInterval time.Duration) {
+	for {
+		select {
+		case <-ticker.C:
+			// Only the active one resumes the pending deliveries so they are sent once
+			if active && isMigrated() {
+				periodicalRunDelivery()
+			}
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop delivery quit")
+			return
+		}
+	}
+}
+
+func periodicalRunDelivery() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("periodicalRunDelivery Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	if err := notification.ResumePendingDelivery(time.Now()); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone_analysis/event"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"time"
+)
+
+const (
+	eventDigestEnabledDefault   = true
+	eventDigestHourInUTCDefault = 8
+)
+
+func isEventDigestEnabled() bool {
+	enabled, ok := configuration.LocalConfiguration.GetNative("eventDigestEnabled").(bool)
+	if ok == false {
+		return eventDigestEnabledDefault
+	}
+	return enabled
+}
+
+func getEventDigestHourInUTC() int {
+	hour, ok := configuration.LocalConfiguration.GetInt("eventDigestHourInUTC")
+	if ok == false || hour < 0 || hour > 23 {
+		return eventDigestHourInUTCDefault
+	}
+	return hour
+}
+
+func loopDigest(ticker *time.Ticker, checkingInterval time.Duration) {
+	for {
+		select {
+		case <-ticker.C:
+			// Only the active one sends the digest so it is sent once
+			if active && isMigrated() {
+				periodicalRunDigest()
+			}
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop digest quit")
+			return
+		}
+	}
+}
+
+func periodicalRunDigest() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("periodicalRunDigest Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	if err := event.SendDailyDigest(time.Now(), getEventDigestHourInUTC()); err != nil {
+		log.Error(err)
+	}
+}
@@ -21,12 +21,43 @@ import (
 	"time"
 )
 
+const (
+	containerMetricsCollectionEnabledDefault          = true
+	containerMetricsCollectionIntervalInSecondDefault = 50
+	containerMetricsCollectionTimeoutInSecondDefault  = 45
+)
+
+func isContainerMetricsCollectionEnabled() bool {
+	enabled, ok := configuration.LocalConfiguration.GetNative("containerMetricsCollectionEnabled").(bool)
+	if ok == false {
+		return containerMetricsCollectionEnabledDefault
+	}
+	return enabled
+}
+
+func getContainerMetricsCollectionInterval() time.Duration {
+	intervalInSecond, ok := configuration.LocalConfiguration.GetInt("containerMetricsCollectionIntervalInSecond")
+	if ok == false || intervalInSecond <= 0 {
+		intervalInSecond = containerMetricsCollectionIntervalInSecondDefault
+	}
+	return time.Duration(intervalInSecond) * time.Second
+}
+
+func getContainerMetricsCollectionTimeout() time.Duration {
+	timeoutInSecond, ok := configuration.LocalConfiguration.GetInt("containerMetricsCollectionTimeoutInSecond")
+	if ok == false || timeoutInSecond <= 0 {
+		timeoutInSecond = containerMetricsCollectionTimeoutInSecondDefault
+	}
+	return time.Duration(timeoutInSecond) * time.Second
+}
+
 func loopHistoricalRecordContainerMetrics(ticker *time.Ticker, checkingInterval time.Duration) {
 	for {
 		select {
 		case <-ticker.C:
-			// Historical record
-			if active {
+			// Historical record. The sweep runs in this goroutine so the next one never starts before
+			// it completes. The ticks during the sweep are dropped by the ticker.
+			if active && isMigrated() {
 				periodicalRunHistoricalRecordContainerMetrics()
 			}
 		case <-quitChannel:
@@ -40,7 +71,7 @@ func loopHistoricalRecordContainerMetrics(ticker *time.Ticker, checkingInterval
 func periodicalRunHistoricalRecordContainerMetrics() {
 	defer func() {
 		if err := recover(); err != nil {
-			log.Error("periodicalRunHistoricalRecordEvent Error: %s", err)
+			log.Error("periodicalRunHistoricalRecordContainerMetrics Error: %s", err)
 			log.Error(logger.GetStackTrace(4096, false))
 		}
 	}()
@@ -51,7 +82,8 @@ func periodicalRunHistoricalRecordContainerMetrics() {
 		return
 	}
 
-	if err := monitor.RecordHistoricalAllNamespace(kubeApiServerEndPoint, kubeApiServerToken); err != nil {
+	deadline := time.Now().Add(getContainerMetricsCollectionTimeout())
+	if err := monitor.RecordHistoricalAllNamespace(kubeApiServerEndPoint, kubeApiServerToken, deadline); err != nil {
 		log.Error(err)
 		return
 	}
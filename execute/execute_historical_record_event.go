@@ -21,12 +21,36 @@ import (
 	"time"
 )
 
+const (
+	eventIngestionModeWatch          = "watch"
+	eventIngestionModePoll           = "poll"
+	eventIngestionModeDefault        = eventIngestionModeWatch
+	eventWatchTimeoutInSecondDefault = 60
+)
+
+func getEventIngestionMode() string {
+	mode, ok := configuration.LocalConfiguration.GetString("eventIngestionMode")
+	if ok == false || (mode != eventIngestionModeWatch && mode != eventIngestionModePoll) {
+		return eventIngestionModeDefault
+	}
+	return mode
+}
+
+func getEventWatchTimeoutInSecond() int {
+	timeoutInSecond, ok := configuration.LocalConfiguration.GetInt("eventWatchTimeoutInSecond")
+	if ok == false || timeoutInSecond <= 0 {
+		return eventWatchTimeoutInSecondDefault
+	}
+	return timeoutInSecond
+}
+
 func loopHistoricalRecordEvent(ticker *time.Ticker, checkingInterval time.Duration) {
 	for {
 		select {
 		case <-ticker.C:
-			// Historical record
-			if active {
+			// Historical record. A watch session runs in this goroutine until it times out so
+			// the instance losing the leadership stops watching after the current session.
+			if active && isMigrated() {
 				periodicalRunHistoricalRecordEvent()
 			}
 		case <-quitChannel:
@@ -51,8 +75,15 @@ func periodicalRunHistoricalRecordEvent() {
 		return
 	}
 
-	if err := event.RecordHistoricalEvent(kubeApiServerEndPoint, kubeApiServerToken); err != nil {
-		log.Error(err)
-		return
+	if getEventIngestionMode() == eventIngestionModePoll {
+		if err := event.RecordHistoricalEvent(kubeApiServerEndPoint, kubeApiServerToken); err != nil {
+			log.Error(err)
+			return
+		}
+	} else {
+		if err := event.WatchHistoricalEvent(kubeApiServerEndPoint, kubeApiServerToken, getEventWatchTimeoutInSecond()); err != nil {
+			log.Error(err)
+			return
+		}
 	}
 }
@@ -0,0 +1,79 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"time"
+)
+
+const (
+	nodeMetricsCollectionEnabledDefault          = true
+	nodeMetricsCollectionIntervalInSecondDefault = 60
+)
+
+func isNodeMetricsCollectionEnabled() bool {
+	enabled, ok := configuration.LocalConfiguration.GetNative("nodeMetricsCollectionEnabled").(bool)
+	if ok == false {
+		return nodeMetricsCollectionEnabledDefault
+	}
+	return enabled
+}
+
+func getNodeMetricsCollectionInterval() time.Duration {
+	intervalInSecond, ok := configuration.LocalConfiguration.GetInt("nodeMetricsCollectionIntervalInSecond")
+	if ok == false || intervalInSecond <= 0 {
+		intervalInSecond = nodeMetricsCollectionIntervalInSecondDefault
+	}
+	return time.Duration(intervalInSecond) * time.Second
+}
+
+func loopHistoricalRecordNodeMetrics(ticker *time.Ticker, checkingInterval time.Duration) {
+	for {
+		select {
+		case <-ticker.C:
+			// Historical record
+			if active && isMigrated() {
+				periodicalRunHistoricalRecordNodeMetrics()
+			}
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop historical record node metrics quit")
+			return
+		}
+	}
+}
+
+func periodicalRunHistoricalRecordNodeMetrics() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("periodicalRunHistoricalRecordNodeMetrics Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	kubeApiServerEndPoint, kubeApiServerToken, err := configuration.GetAvailablekubeApiServerEndPoint()
+	if err != nil {
+		log.Error("Fail to get configuration endpoint and token with error %s", err)
+		return
+	}
+
+	if err := monitor.RecordHistoricalAllNode(kubeApiServerEndPoint, kubeApiServerToken); err != nil {
+		log.Error(err)
+		return
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone_analysis/audit"
+	"github.com/cloudawan/cloudone_analysis/build"
+	"github.com/cloudawan/cloudone_analysis/event"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"time"
+)
+
+const (
+	migrationRetryInitialDelay = 5 * time.Second
+	migrationRetryMaximumDelay = 5 * time.Minute
+)
+
+// Closed once the legacy indices are migrated by this instance
+var migrationDone = make(chan struct{})
+
+// isMigrated tells whether the jobs writing to the aliases could run
+func isMigrated() bool {
+	select {
+	case <-migrationDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// loopMigration migrates the legacy indices once this instance is active so only one instance copies and deletes
+// them. The failure like the elasticsearch not reachable yet is retried with the doubled delay.
+func loopMigration(ticker *time.Ticker, checkingInterval time.Duration) {
+	retryDelay := migrationRetryInitialDelay
+	nextAttempt := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if active == false || time.Now().Before(nextAttempt) {
+				continue
+			}
+			if err := migrateLegacyIndex(); err != nil {
+				log.Error("Fail to migrate the legacy index and retry in %s with error %s", retryDelay, err)
+				nextAttempt = time.Now().Add(retryDelay)
+				retryDelay *= 2
+				if retryDelay > migrationRetryMaximumDelay {
+					retryDelay = migrationRetryMaximumDelay
+				}
+				continue
+			}
+			close(migrationDone)
+			ticker.Stop()
+			log.Info("Loop migration completes")
+			return
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop migration quit")
+			return
+		}
+	}
+}
+
+// migrateLegacyIndex moves the indices created before the rollover, which use the same names as the aliases now,
+// into the indices named with period. The migration is done again from the start after the failure.
+func migrateLegacyIndex() (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("migrateLegacyIndex Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	migrationMap := map[string]func() error{
+		"event":             event.MigrateLegacyIndex,
+		"audit log":         audit.MigrateLegacyIndex,
+		"container metrics": monitor.MigrateLegacyIndex,
+		"build log":         build.MigrateLegacyIndex,
+	}
+	for kind, migrate := range migrationMap {
+		if err := migrate(); err != nil {
+			log.Error("Can't migrate the legacy %s index with error %s", kind, err)
+			return err
+		}
+	}
+	return nil
+}
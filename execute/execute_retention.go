@@ -0,0 +1,74 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execute
+
+import (
+	"github.com/cloudawan/cloudone_analysis/alert"
+	"github.com/cloudawan/cloudone_analysis/audit"
+	"github.com/cloudawan/cloudone_analysis/build"
+	"github.com/cloudawan/cloudone_analysis/event"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/cloudawan/cloudone_analysis/notification"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"time"
+)
+
+func loopRetention(ticker *time.Ticker, checkingInterval time.Duration) {
+	for {
+		select {
+		case <-ticker.C:
+			// Only the active one enforces the retention
+			if active && isMigrated() {
+				periodicalRunRetention()
+			}
+		case <-quitChannel:
+			ticker.Stop()
+			log.Info("Loop retention quit")
+			return
+		}
+	}
+}
+
+func periodicalRunRetention() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("periodicalRunRetention Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	now := time.Now()
+	if err := monitor.DeleteExpiredContainerRecordIndex(now); err != nil {
+		log.Error(err)
+	}
+	if err := monitor.DeleteExpiredNodeRecordIndex(now); err != nil {
+		log.Error(err)
+	}
+	if err := event.DeleteExpiredKubernetesEventIndex(now); err != nil {
+		log.Error(err)
+	}
+	if err := audit.DeleteExpiredAuditLogIndex(now); err != nil {
+		log.Error(err)
+	}
+	if err := build.DeleteExpiredBuildLogIndex(now); err != nil {
+		log.Error(err)
+	}
+	if err := alert.DeleteExpiredAlertHistoryIndex(now); err != nil {
+		log.Error(err)
+	}
+	if err := notification.DeleteExpiredDeliveryIndex(now); err != nil {
+		log.Error(err)
+	}
+}
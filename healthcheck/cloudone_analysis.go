@@ -16,6 +16,7 @@ package healthcheck
 
 import (
 	"errors"
+	"github.com/cloudawan/cloudone_analysis/monitor"
 	"github.com/cloudawan/cloudone_analysis/utility/configuration"
 	"github.com/cloudawan/cloudone_utility/restclient"
 	"strconv"
@@ -50,7 +51,7 @@ func (cloudoneAnalysisControl *CloudoneAnalysisControl) testRestAPI() bool {
 	return result
 }
 
-func (cloudoneAnalysisControl *CloudoneAnalysisControl) testStorageElasticSearch() bool {
+func (cloudoneAnalysisControl *CloudoneAnalysisControl) testStorage() bool {
 	jsonMap := make(map[string]interface{})
 	jsonMap["updatedTime"] = time.Now().Format(time.RFC3339Nano)
 	if err := saveTest("test", "test", "test", jsonMap); err != nil {
@@ -64,6 +65,7 @@ func (cloudoneAnalysisControl *CloudoneAnalysisControl) testStorageElasticSearch
 func (cloudoneAnalysisControl *CloudoneAnalysisControl) GetStatus() map[string]interface{} {
 	jsonMap := make(map[string]interface{})
 	jsonMap["restapi"] = cloudoneAnalysisControl.testRestAPI()
-	jsonMap["elasticsearch"] = cloudoneAnalysisControl.testStorageElasticSearch()
+	jsonMap[configuration.GetStorageType()] = cloudoneAnalysisControl.testStorage()
+	jsonMap["containerMetricsCollection"] = monitor.GetContainerMetricsSweepStatus()
 	return jsonMap
 }
@@ -18,7 +18,14 @@ import (
 	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
 )
 
-func saveTest(index string, documentType string, id string, jsonMap map[string]interface{}) error {
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
+	return &StorageElasticSearch{}
+}
+
+func (storageElasticSearch *StorageElasticSearch) SaveTest(index string, documentType string, id string, jsonMap map[string]interface{}) error {
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
 	_, err := connection.Index(index, documentType, id, nil, jsonMap)
 	if err != nil {
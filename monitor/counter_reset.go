@@ -0,0 +1,363 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	counterStateExpiration = 1 * time.Hour
+	counterOffsetName      = "counterOffset"
+)
+
+// The state of the counters of a container. The offset is the sum of the values before the resets
+// and is added to the raw value so the saved counter keeps increasing across the container restarts.
+type counterState struct {
+	CreationTime  string
+	LastTimestamp time.Time
+	// The field of the counter like stats.cpu.usage.total -> value
+	LastValueMap map[string]int64
+	OffsetMap    map[string]int64
+}
+
+// The state stitched in the sweep waiting for the records and itself to be saved
+type pendingCounterState struct {
+	namespace     string
+	podName       string
+	containerName string
+	state         *counterState
+}
+
+var counterStateLock sync.Mutex
+
+// namespace/podName/containerName -> state
+var counterStateMap = make(map[string]*counterState)
+
+// namespace/podName/containerName -> the state not saved yet
+var pendingCounterStateMap = make(map[string]pendingCounterState)
+
+func getCounterStateKey(namespace string, podName string, containerName string) string {
+	return namespace + "/" + podName + "/" + containerName
+}
+
+func copyCounterState(state *counterState) *counterState {
+	copiedState := &counterState{
+		state.CreationTime,
+		state.LastTimestamp,
+		make(map[string]int64),
+		make(map[string]int64),
+	}
+	for field, value := range state.LastValueMap {
+		copiedState.LastValueMap[field] = value
+	}
+	for field, offset := range state.OffsetMap {
+		copiedState.OffsetMap[field] = offset
+	}
+	return copiedState
+}
+
+// The fields of the cumulative counters
+func getCounterFieldSlice() []string {
+	fieldSlice := make([]string, 0)
+	for _, rateMetric := range rateMetricSlice {
+		fieldSlice = append(fieldSlice, rateMetric.Field)
+	}
+	return fieldSlice
+}
+
+func isCounterField(field string) bool {
+	for _, counterField := range getCounterFieldSlice() {
+		if field == counterField {
+			return true
+		}
+	}
+	return false
+}
+
+// stitchCounterReset detects the counter reset of the container by the change of spec.creation_time or the decrease
+// of the value and adds the offset to the counters of the records. The records already handled before are dropped
+// since the source like cAdvisor returns the overlapped samples. The stitched state is pending until it is saved
+// with the records by addPendingCounterStateToBulkProcessor and completePendingCounterState so the offset and
+// the last sample are kept after this process restarts.
+func stitchCounterReset(namespace string, podName string, containerName string,
+	containerJsonMap map[string]interface{}, containerRecordSlice []map[string]interface{}) []map[string]interface{} {
+	creationTime := ""
+	if specJsonMap, ok := containerJsonMap["spec"].(map[string]interface{}); ok {
+		creationTime, _ = specJsonMap["creation_time"].(string)
+	}
+
+	sort.SliceStable(containerRecordSlice, func(i int, j int) bool {
+		return getContainerRecordTimestamp(containerRecordSlice[i]).Before(getContainerRecordTimestamp(containerRecordSlice[j]))
+	})
+
+	counterStateLock.Lock()
+	defer counterStateLock.Unlock()
+
+	key := getCounterStateKey(namespace, podName, containerName)
+	savedState, ok := counterStateMap[key]
+	if ok == false {
+		// Drop the containers which are gone
+		for existingKey, existingState := range counterStateMap {
+			if time.Since(existingState.LastTimestamp) > counterStateExpiration {
+				delete(counterStateMap, existingKey)
+			}
+		}
+		savedState = loadCounterState(namespace, podName, containerName)
+		counterStateMap[key] = savedState
+	}
+	// The saved state is kept if the records fail to be saved so they are stitched again in the next sweep
+	state := copyCounterState(savedState)
+
+	stitchedContainerRecordSlice := make([]map[string]interface{}, 0)
+	for _, containerRecord := range containerRecordSlice {
+		timestamp := getContainerRecordTimestamp(containerRecord)
+		if timestamp.After(state.LastTimestamp) == false {
+			continue
+		}
+
+		reset := false
+		if creationTime != "" && state.CreationTime != "" && creationTime != state.CreationTime {
+			reset = true
+		}
+		valueMap := make(map[string]int64)
+		for _, field := range getCounterFieldSlice() {
+			value, ok := getJsonMapInt64(containerRecord, field)
+			if ok == false {
+				continue
+			}
+			valueMap[field] = value
+			if lastValue, ok := state.LastValueMap[field]; ok && value < lastValue {
+				reset = true
+			}
+		}
+
+		if reset {
+			log.Info("Counter of container %s is reset at %s", key, timestamp)
+			for field, lastValue := range state.LastValueMap {
+				state.OffsetMap[field] += lastValue
+			}
+			state.LastValueMap = make(map[string]int64)
+		}
+
+		for field, value := range valueMap {
+			state.LastValueMap[field] = value
+			if offset := state.OffsetMap[field]; offset != 0 {
+				addJsonMapOffset(containerRecord, field, offset)
+			}
+		}
+		if len(state.OffsetMap) > 0 {
+			offsetJsonMap := make(map[string]interface{})
+			for field, offset := range state.OffsetMap {
+				offsetJsonMap[getRollupKey(field)] = offset
+			}
+			containerRecord[counterOffsetName] = offsetJsonMap
+		}
+		if creationTime != "" {
+			state.CreationTime = creationTime
+		}
+		state.LastTimestamp = timestamp
+
+		stitchedContainerRecordSlice = append(stitchedContainerRecordSlice, containerRecord)
+	}
+
+	if len(stitchedContainerRecordSlice) > 0 {
+		pendingCounterStateMap[key] = pendingCounterState{namespace, podName, containerName, state}
+	}
+
+	return stitchedContainerRecordSlice
+}
+
+func getCounterStateID(namespace string, podName string, containerName string) string {
+	return strings.ToLower(namespace) + "_" + podName + "_" + containerName
+}
+
+func loadCounterState(namespace string, podName string, containerName string) *counterState {
+	state := &counterState{
+		"",
+		time.Time{},
+		make(map[string]int64),
+		make(map[string]int64),
+	}
+
+	jsonMap, err := storage.GetContainerRecord(indexContainerMetricsCounterStateIndex, typeContainerMetricsCounterState,
+		getCounterStateID(namespace, podName, containerName))
+	if err != nil {
+		if err.Error() != "record not found" {
+			log.Error(err)
+		}
+		return state
+	}
+
+	state.CreationTime, _ = jsonMap["creationTime"].(string)
+	timestampText, _ := jsonMap["timestamp"].(string)
+	if timestamp, err := time.Parse(time.RFC3339Nano, timestampText); err == nil {
+		state.LastTimestamp = timestamp
+	}
+	for _, name := range []string{"lastValue", "offset"} {
+		fieldJsonMap, _ := jsonMap[name].(map[string]interface{})
+		for _, field := range getCounterFieldSlice() {
+			if value, ok := getJsonMapInt64(fieldJsonMap, getRollupKey(field)); ok {
+				if name == "lastValue" {
+					state.LastValueMap[field] = value
+				} else {
+					state.OffsetMap[field] = value
+				}
+			}
+		}
+	}
+	return state
+}
+
+// addPendingCounterStateToBulkProcessor adds the pending states of the containers whose records are added
+func addPendingCounterStateToBulkProcessor(bulkProcessor *bulk.BulkProcessor, keyMap map[string]bool) {
+	counterStateLock.Lock()
+	defer counterStateLock.Unlock()
+
+	for key, _ := range keyMap {
+		pending, ok := pendingCounterStateMap[key]
+		if ok == false {
+			continue
+		}
+		bulkProcessor.Add(bulk.BulkItem{
+			Index:    indexContainerMetricsCounterStateIndex,
+			Type:     typeContainerMetricsCounterState,
+			ID:       getCounterStateID(pending.namespace, pending.podName, pending.containerName),
+			Document: convertCounterStateToJsonMap(pending.namespace, pending.podName, pending.containerName, pending.state),
+		})
+	}
+}
+
+// completePendingCounterState keeps the pending states of the keys as saved if the bulk succeeds and drops all pending states
+func completePendingCounterState(keyMap map[string]bool, succeeded bool) {
+	counterStateLock.Lock()
+	defer counterStateLock.Unlock()
+
+	if succeeded {
+		for key, _ := range keyMap {
+			if pending, ok := pendingCounterStateMap[key]; ok {
+				counterStateMap[key] = pending.state
+			}
+		}
+	}
+	pendingCounterStateMap = make(map[string]pendingCounterState)
+}
+
+func convertCounterStateToJsonMap(namespace string, podName string, containerName string, state *counterState) map[string]interface{} {
+	lastValueJsonMap := make(map[string]interface{})
+	for field, value := range state.LastValueMap {
+		lastValueJsonMap[getRollupKey(field)] = value
+	}
+	offsetJsonMap := make(map[string]interface{})
+	for field, offset := range state.OffsetMap {
+		offsetJsonMap[getRollupKey(field)] = offset
+	}
+
+	jsonMap := make(map[string]interface{})
+	jsonMap["namespace"] = namespace
+	jsonMap["podName"] = podName
+	jsonMap["containerName"] = containerName
+	jsonMap["creationTime"] = state.CreationTime
+	jsonMap["timestamp"] = state.LastTimestamp.UTC().Format(time.RFC3339Nano)
+	jsonMap["lastValue"] = lastValueJsonMap
+	jsonMap["offset"] = offsetJsonMap
+	return jsonMap
+}
+
+func getContainerRecordTimestamp(containerRecord map[string]interface{}) time.Time {
+	statsJsonMap, _ := containerRecord["stats"].(map[string]interface{})
+	timestampText, _ := statsJsonMap["timestamp"].(string)
+	timestamp, _ := time.Parse(time.RFC3339Nano, timestampText)
+	return timestamp
+}
+
+// getJsonMapInt64 returns the value with the field name in the dot format like stats.cpu.usage.total. The values
+// are summed if the field is in the array like the diskio of devices.
+func getJsonMapInt64(jsonMap map[string]interface{}, field string) (int64, bool) {
+	return getSourceInt64(jsonMap, strings.Split(field, "."))
+}
+
+func getSourceInt64(value interface{}, nameSlice []string) (int64, bool) {
+	if slice, ok := value.([]interface{}); ok {
+		sum := int64(0)
+		found := false
+		for _, element := range slice {
+			if result, ok := getSourceInt64(element, nameSlice); ok {
+				sum += result
+				found = true
+			}
+		}
+		return sum, found
+	}
+	if len(nameSlice) > 0 {
+		jsonMap, ok := value.(map[string]interface{})
+		if ok == false {
+			return 0, false
+		}
+		return getSourceInt64(jsonMap[nameSlice[0]], nameSlice[1:])
+	}
+
+	switch number := value.(type) {
+	case json.Number:
+		if result, err := number.Int64(); err == nil {
+			return result, true
+		}
+		result, err := number.Float64()
+		return int64(result), err == nil
+	case float64:
+		return int64(number), true
+	case int64:
+		return number, true
+	case int:
+		return int64(number), true
+	default:
+		return 0, false
+	}
+}
+
+// addJsonMapOffset adds the offset to the existing value with the field name in the dot format. Only the first
+// value in the array like the diskio of devices has the offset so the sum of the array has it once.
+func addJsonMapOffset(jsonMap map[string]interface{}, field string, offset int64) {
+	addSourceOffset(jsonMap, strings.Split(field, "."), offset)
+}
+
+func addSourceOffset(value interface{}, nameSlice []string, offset int64) bool {
+	if slice, ok := value.([]interface{}); ok {
+		for _, element := range slice {
+			if addSourceOffset(element, nameSlice, offset) {
+				return true
+			}
+		}
+		return false
+	}
+	jsonMap, ok := value.(map[string]interface{})
+	if ok == false {
+		return false
+	}
+	if len(nameSlice) > 1 {
+		return addSourceOffset(jsonMap[nameSlice[0]], nameSlice[1:], offset)
+	}
+	result, ok := getSourceInt64(jsonMap[nameSlice[0]], nil)
+	if ok == false {
+		return false
+	}
+	jsonMap[nameSlice[0]] = result + offset
+	return true
+}
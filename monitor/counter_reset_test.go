@@ -0,0 +1,149 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func TestStitchCounterReset(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	stitch := func(creationTime string, secondSlice []int, cpuUsageTotalSlice []int64) []int64 {
+		containerJsonMap := map[string]interface{}{"spec": map[string]interface{}{"creation_time": creationTime}}
+		containerRecordSlice := make([]map[string]interface{}, 0)
+		for i, second := range secondSlice {
+			containerRecordSlice = append(containerRecordSlice,
+				createTestContainerRecord("nginx-1", "nginx", from.Add(time.Duration(second)*time.Second), cpuUsageTotalSlice[i]))
+		}
+		resultSlice := make([]int64, 0)
+		for _, containerRecord := range stitchCounterReset("default", "nginx-1", "nginx", containerJsonMap, containerRecordSlice) {
+			value, _ := getJsonMapInt64(containerRecord, "stats.cpu.usage.total")
+			resultSlice = append(resultSlice, value)
+		}
+		return resultSlice
+	}
+	// The counter state is saved with the records in the bulk like the sweep
+	keyMap := map[string]bool{getCounterStateKey("default", "nginx-1", "nginx"): true}
+	save := func(succeeded bool) {
+		bulkProcessor := bulk.CreateBulkProcessor(0, 0, storage.BulkSaveContainerRecord)
+		if succeeded {
+			addPendingCounterStateToBulkProcessor(bulkProcessor, keyMap)
+		}
+		if err := bulk.ConvertToError(bulkProcessor.Close()); err != nil {
+			t.Fatal(err)
+		}
+		completePendingCounterState(keyMap, succeeded)
+	}
+	expect := func(resultSlice []int64, expectedSlice []int64) {
+		if len(resultSlice) != len(expectedSlice) {
+			t.Fatalf("Expect %v but get %v", expectedSlice, resultSlice)
+		}
+		for i, _ := range resultSlice {
+			if resultSlice[i] != expectedSlice[i] {
+				t.Errorf("Expect %v but get %v", expectedSlice, resultSlice)
+				return
+			}
+		}
+	}
+
+	// The value decreases
+	expect(stitch("2016-01-01T00:00:00Z", []int{0, 1, 2, 3}, []int64{100, 200, 10, 20}), []int64{100, 200, 210, 220})
+	save(true)
+	// The overlapped samples are dropped
+	expect(stitch("2016-01-01T00:00:00Z", []int{2, 3, 4}, []int64{10, 20, 30}), []int64{230})
+	save(true)
+	// The container is created again while the value doesn't decrease
+	expect(stitch("2016-01-01T00:00:05Z", []int{5}, []int64{50}), []int64{280})
+	save(true)
+	expect(stitch("2016-01-01T00:00:05Z", []int{6}, []int64{60}), []int64{290})
+	save(true)
+
+	// The state doesn't advance if the records fail to be saved so they are stitched again
+	expect(stitch("2016-01-01T00:00:05Z", []int{7}, []int64{70}), []int64{300})
+	save(false)
+	expect(stitch("2016-01-01T00:00:05Z", []int{7}, []int64{70}), []int64{300})
+	save(false)
+
+	// The last sample and the offset are loaded after this process restarts
+	counterStateLock.Lock()
+	counterStateMap = make(map[string]*counterState)
+	counterStateLock.Unlock()
+	expect(stitch("2016-01-01T00:00:05Z", []int{6, 7}, []int64{60, 5}), []int64{295})
+}
+
+func TestGetJsonMapInt64InArray(t *testing.T) {
+	containerRecord := map[string]interface{}{
+		"stats": map[string]interface{}{
+			"diskio": map[string]interface{}{
+				"io_service_bytes": []interface{}{
+					map[string]interface{}{"device": "/dev/sda", "stats": map[string]interface{}{"Total": json.Number("100")}},
+					map[string]interface{}{"device": "/dev/sdb", "stats": map[string]interface{}{"Total": json.Number("50")}},
+				},
+			},
+		},
+	}
+	field := "stats.diskio.io_service_bytes.stats.Total"
+	if value, ok := getJsonMapInt64(containerRecord, field); ok == false || value != 150 {
+		t.Errorf("Expect the sum 150 of the devices but get %v", value)
+	}
+
+	// The offset is added once to the sum
+	addJsonMapOffset(containerRecord, field, 1000)
+	if value, ok := getJsonMapInt64(containerRecord, field); ok == false || value != 1150 {
+		t.Errorf("Expect 1150 with the offset but get %v", value)
+	}
+}
+
+func TestGetLastValueFromTopHits(t *testing.T) {
+	topHitsJsonMap := map[string]interface{}{
+		"hits": map[string]interface{}{
+			"hits": []interface{}{
+				map[string]interface{}{
+					"_source": map[string]interface{}{
+						"stats": map[string]interface{}{
+							"diskio": map[string]interface{}{
+								"io_service_bytes": []interface{}{
+									map[string]interface{}{"stats": map[string]interface{}{"Total": json.Number("100")}},
+									map[string]interface{}{"stats": map[string]interface{}{"Total": json.Number("50")}},
+								},
+							},
+							"filesystem": []interface{}{
+								map[string]interface{}{"usage": json.Number("10")},
+								map[string]interface{}{"usage": json.Number("20")},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	// The counter of all devices is summed
+	if value, ok := getLastValueFromTopHits(topHitsJsonMap, "stats.diskio.io_service_bytes.stats.Total"); ok == false || value != 150 {
+		t.Errorf("Expect the sum 150 but get %v", value)
+	}
+	if value, ok := getLastValueFromTopHits(topHitsJsonMap, "stats.filesystem.usage"); ok == false || value != 20 {
+		t.Errorf("Expect the last value 20 but get %v", value)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const (
+	// Keep the missing value as null
+	FillNone = "none"
+	// Use 0 for the missing value
+	FillZero = "zero"
+	// Use the previous value for the missing value
+	FillPrevious = "previous"
+	// Interpolate linearly by the distance to the neighbours
+	FillLinear = "linear"
+	// The slice name -> whether each value is filled
+	interpolatedName = "interpolated"
+)
+
+// ParseFill returns the fill policy. null is the same as none and linear is used if the text is empty.
+func ParseFill(text string) (string, error) {
+	switch strings.ToLower(text) {
+	case "":
+		return FillLinear, nil
+	case FillNone, "null":
+		return FillNone, nil
+	case FillZero:
+		return FillZero, nil
+	case FillPrevious:
+		return FillPrevious, nil
+	case FillLinear:
+		return FillLinear, nil
+	default:
+		return "", errors.New("Unknown fill " + text + ". The fill is none, null, zero, previous or linear.")
+	}
+}
+
+// fillTheNullData fills the null values with the policy and returns which are filled, or nil if none is filled.
+// The filled value has the same type as zero which is either int64 or float64. Neither previous nor linear
+// fills the values before the first value and linear doesn't fill the values after the last one since there
+// is no data to tell the container was running.
+func fillTheNullData(dataSlice []interface{}, fill string, zero interface{}) []bool {
+	var filledSlice []bool = nil
+	markFilled := func(index int) {
+		if filledSlice == nil {
+			filledSlice = make([]bool, len(dataSlice))
+		}
+		filledSlice[index] = true
+	}
+
+	leftIndex := -1
+	for i := 0; i < len(dataSlice); i++ {
+		if dataSlice[i] != nil {
+			leftIndex = i
+			continue
+		}
+		switch fill {
+		case FillZero:
+			dataSlice[i] = zero
+			markFilled(i)
+		case FillPrevious:
+			if leftIndex >= 0 {
+				dataSlice[i] = dataSlice[leftIndex]
+				markFilled(i)
+			}
+		case FillLinear:
+			if leftIndex < 0 {
+				continue
+			}
+			rightIndex := -1
+			for j := i + 1; j < len(dataSlice); j++ {
+				if dataSlice[j] != nil {
+					rightIndex = j
+					break
+				}
+			}
+			if rightIndex < 0 {
+				continue
+			}
+			leftValue := convertToFloat64(dataSlice[leftIndex])
+			rightValue := convertToFloat64(dataSlice[rightIndex])
+			// Fill the whole gap at once so the filled value is not used as the neighbour
+			for j := i; j < rightIndex; j++ {
+				value := leftValue + (rightValue-leftValue)*float64(j-leftIndex)/float64(rightIndex-leftIndex)
+				if _, ok := zero.(int64); ok {
+					dataSlice[j] = int64(math.Floor(value + 0.5))
+				} else {
+					dataSlice[j] = value
+				}
+				markFilled(j)
+			}
+			i = rightIndex - 1
+		}
+	}
+	return filledSlice
+}
+
+func convertToFloat64(value interface{}) float64 {
+	switch number := value.(type) {
+	case int64:
+		return float64(number)
+	case float64:
+		return number
+	default:
+		return 0
+	}
+}
+
+// fillSliceInJsonMap fills the slice and marks the filled values in the interpolated map of the json map
+func fillSliceInJsonMap(jsonMap map[string]interface{}, sliceName string, fill string, zero interface{}) {
+	slice, ok := jsonMap[sliceName].([]interface{})
+	if ok == false {
+		return
+	}
+	if filledSlice := fillTheNullData(slice, fill, zero); filledSlice != nil {
+		addToInterpolatedInJsonMap(jsonMap, sliceName, filledSlice)
+	}
+}
+
+// addToInterpolatedInJsonMap marks the value as filled if it is filled in any of the added slices.
+// It is used for the total so the total is marked if any summed value is filled.
+func addToInterpolatedInJsonMap(jsonMap map[string]interface{}, sliceName string, filledSlice []bool) {
+	if filledSlice == nil {
+		return
+	}
+	interpolatedJsonMap, _ := jsonMap[interpolatedName].(map[string]interface{})
+	if interpolatedJsonMap == nil {
+		interpolatedJsonMap = make(map[string]interface{})
+		jsonMap[interpolatedName] = interpolatedJsonMap
+	}
+	markSlice, ok := interpolatedJsonMap[sliceName].([]bool)
+	if ok == false {
+		markSlice = make([]bool, len(filledSlice))
+		interpolatedJsonMap[sliceName] = markSlice
+	}
+	for i, filled := range filledSlice {
+		if filled {
+			markSlice[i] = true
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFillTheNullData(t *testing.T) {
+	for _, testCase := range []struct {
+		Fill           string
+		ExpectedSlice  []interface{}
+		ExpectedFilled []bool
+	}{
+		{FillNone, []interface{}{nil, int64(10), nil, nil, int64(40), nil}, nil},
+		{FillZero, []interface{}{int64(0), int64(10), int64(0), int64(0), int64(40), int64(0)}, []bool{true, false, true, true, false, true}},
+		// Nothing is before the first value
+		{FillPrevious, []interface{}{nil, int64(10), int64(10), int64(10), int64(40), int64(40)}, []bool{false, false, true, true, false, true}},
+		// Weighted by the distance instead of the average of the neighbours, and no value is made up at both ends
+		{FillLinear, []interface{}{nil, int64(10), int64(20), int64(30), int64(40), nil}, []bool{false, false, true, true, false, false}},
+	} {
+		dataSlice := []interface{}{nil, int64(10), nil, nil, int64(40), nil}
+		filledSlice := fillTheNullData(dataSlice, testCase.Fill, int64(0))
+		if reflect.DeepEqual(dataSlice, testCase.ExpectedSlice) == false {
+			t.Errorf("Expect %v with %s but get %v", testCase.ExpectedSlice, testCase.Fill, dataSlice)
+		}
+		if reflect.DeepEqual(filledSlice, testCase.ExpectedFilled) == false {
+			t.Errorf("Expect filled %v with %s but get %v", testCase.ExpectedFilled, testCase.Fill, filledSlice)
+		}
+	}
+
+	dataSlice := []interface{}{1.0, nil, nil, 2.5}
+	fillTheNullData(dataSlice, FillLinear, 0.0)
+	if dataSlice[1] != 1.5 || dataSlice[2] != 2.0 {
+		t.Errorf("Expect [1 1.5 2 2.5] but get %v", dataSlice)
+	}
+}
+
+func TestFillSliceInJsonMap(t *testing.T) {
+	totalJsonMap := make(map[string]interface{})
+	for _, dataSlice := range [][]interface{}{
+		[]interface{}{1.0, nil, 3.0},
+		[]interface{}{nil, 2.0, nil},
+	} {
+		jsonMap := map[string]interface{}{"cpuUsageCoresSlice": dataSlice}
+		fillSliceInJsonMap(jsonMap, "cpuUsageCoresSlice", FillZero, 0.0)
+		filledSlice, _ := jsonMap[interpolatedName].(map[string]interface{})["cpuUsageCoresSlice"].([]bool)
+		addToInterpolatedInJsonMap(totalJsonMap, "cpuUsageCoresSlice", filledSlice)
+	}
+	// The total is filled if any summed value is filled
+	markSlice := totalJsonMap[interpolatedName].(map[string]interface{})["cpuUsageCoresSlice"].([]bool)
+	if reflect.DeepEqual(markSlice, []bool{true, true, true}) == false {
+		t.Errorf("Expect all filled but get %v", markSlice)
+	}
+
+	if fill, err := ParseFill("null"); err != nil || fill != FillNone {
+		t.Errorf("Expect none but get %s %v", fill, err)
+	}
+	if fill, err := ParseFill(""); err != nil || fill != FillLinear {
+		t.Errorf("Expect linear but get %s %v", fill, err)
+	}
+	if _, err := ParseFill("spline"); err == nil {
+		t.Error("Expect the error for the unknown fill")
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Namespace names are in lower case so the key doesn't conflict with them
+	clusterTotalName   = "clusterTotal"
+	namespaceTotalName = "namespaceTotal"
+)
+
+// The gauges summed up over the containers. The rates derived from the counters are summed up as well.
+var summedMetricAggregationSlice = []MetricAggregation{
+	MetricAggregation{"memoryUsage", aggregatorAverage, "stats.memory.usage"},
+	MetricAggregation{"memoryWorkingSet", aggregatorAverage, "stats.memory.working_set"},
+}
+
+// GetHistoricalNamespaceMetrics returns the CPU, memory, network and disk IO summed up over all containers in the namespace
+func GetHistoricalNamespaceMetrics(namespace string, aggregationAmount int,
+	from time.Time, to time.Time, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	containerRecordAggregation, err := searchHistoricalNamespaceMetrics(namespace, aggregationAmount, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceTotalJsonMap, err := convertContainerRecordAggregationToTotalJsonMap(containerRecordAggregation, fill)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonMap := make(map[string]interface{})
+	jsonMap[namespaceTotalName] = namespaceTotalJsonMap[namespace]
+	if jsonMap[namespaceTotalName] == nil {
+		jsonMap[namespaceTotalName] = make(map[string]interface{})
+	}
+	jsonMap["timestamp"] = containerRecordAggregation.TimestampSlice
+	return jsonMap, nil
+}
+
+// GetHistoricalClusterMetrics returns the CPU, memory, network and disk IO summed up over all containers in the cluster
+// and in each namespace by namespace name
+func GetHistoricalClusterMetrics(aggregationAmount int,
+	from time.Time, to time.Time, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	// All namespaces are searched in one query
+	containerRecordAggregation, err := searchHistoricalNamespaceMetrics("*", aggregationAmount, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonMap, err := convertContainerRecordAggregationToTotalJsonMap(containerRecordAggregation, fill)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonMap[clusterTotalName] = sumClusterTotalJsonMap(jsonMap, len(containerRecordAggregation.TimestampSlice))
+	jsonMap["timestamp"] = containerRecordAggregation.TimestampSlice
+	return jsonMap, nil
+}
+
+// sumClusterTotalJsonMap returns the slices summed up over the totals of the namespaces
+func sumClusterTotalJsonMap(namespaceJsonMap map[string]interface{}, timeBucketAmount int) map[string]interface{} {
+	clusterTotalJsonMap := make(map[string]interface{})
+	for _, namespaceTotalJsonMap := range namespaceJsonMap {
+		for sliceName, slice := range namespaceTotalJsonMap.(map[string]interface{}) {
+			if sliceName == interpolatedName {
+				for interpolatedSliceName, filledSlice := range slice.(map[string]interface{}) {
+					addToInterpolatedInJsonMap(clusterTotalJsonMap, interpolatedSliceName, filledSlice.([]bool))
+				}
+			} else {
+				addToSumSliceInJsonMap(timeBucketAmount, clusterTotalJsonMap, sliceName, slice.([]interface{}))
+			}
+		}
+	}
+	return clusterTotalJsonMap
+}
+
+// convertContainerRecordAggregationToTotalJsonMap returns the summed slices by namespace.
+// The slice of each container is filled before being summed up so the missing sample doesn't drop the total.
+// The rate of the pod-level counter like the network is counted once per pod.
+func convertContainerRecordAggregationToTotalJsonMap(containerRecordAggregation *ContainerRecordAggregation, fill string) (map[string]interface{}, error) {
+	if fill == "" {
+		fill = FillLinear
+	}
+
+	timeBucketAmount := len(containerRecordAggregation.TimestampSlice)
+	timestampSlice := make([]time.Time, timeBucketAmount)
+	for i, timestampText := range containerRecordAggregation.TimestampSlice {
+		timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		timestampSlice[i] = timestamp
+	}
+
+	// namespace/pod/container -> buckets
+	bucketMap := make(map[string][]ContainerRecordBucket)
+	for _, containerRecordBucket := range containerRecordAggregation.BucketSlice {
+		key := containerRecordBucket.Namespace + "/" + containerRecordBucket.PodName + "/" + containerRecordBucket.ContainerName
+		bucketMap[key] = append(bucketMap[key], containerRecordBucket)
+	}
+
+	jsonMap := make(map[string]interface{})
+	// namespace/pod -> the pod-level rate slices counted once per pod
+	podTotalJsonMap := make(map[string]map[string]interface{})
+	for _, containerRecordBucketSlice := range bucketMap {
+		namespace := containerRecordBucketSlice[0].Namespace
+		namespaceTotalJsonMap, _ := jsonMap[namespace].(map[string]interface{})
+		if namespaceTotalJsonMap == nil {
+			namespaceTotalJsonMap = make(map[string]interface{})
+			jsonMap[namespace] = namespaceTotalJsonMap
+		}
+		podKey := namespace + "/" + containerRecordBucketSlice[0].PodName
+		if podTotalJsonMap[podKey] == nil {
+			podTotalJsonMap[podKey] = make(map[string]interface{})
+		}
+
+		sort.Slice(containerRecordBucketSlice, func(i int, j int) bool {
+			return containerRecordBucketSlice[i].TimeIndex < containerRecordBucketSlice[j].TimeIndex
+		})
+		for _, metricAggregation := range summedMetricAggregationSlice {
+			valueSlice := make([]interface{}, timeBucketAmount)
+			for _, containerRecordBucket := range containerRecordBucketSlice {
+				if value, ok := containerRecordBucket.ValueMap[metricAggregation.Name]; ok {
+					valueSlice[containerRecordBucket.TimeIndex] = value
+				}
+			}
+			filledSlice := fillTheNullData(valueSlice, fill, 0.0)
+			addToSumSliceInJsonMap(timeBucketAmount, namespaceTotalJsonMap, metricAggregation.Name+"Slice", valueSlice)
+			addToInterpolatedInJsonMap(namespaceTotalJsonMap, metricAggregation.Name+"Slice", filledSlice)
+		}
+		for _, rateMetric := range rateMetricSlice {
+			rateSlice := calculateRateSlice(timestampSlice, containerRecordBucketSlice, rateMetric)
+			filledSlice := fillTheNullData(rateSlice, fill, 0.0)
+			if isPodLevelField(rateMetric.Field) {
+				addToMaximumSliceInJsonMap(timeBucketAmount, podTotalJsonMap[podKey], rateMetric.Name+"Slice", rateSlice)
+				addToInterpolatedInJsonMap(podTotalJsonMap[podKey], rateMetric.Name+"Slice", filledSlice)
+			} else {
+				addToSumSliceInJsonMap(timeBucketAmount, namespaceTotalJsonMap, rateMetric.Name+"Slice", rateSlice)
+				addToInterpolatedInJsonMap(namespaceTotalJsonMap, rateMetric.Name+"Slice", filledSlice)
+			}
+		}
+	}
+	for podKey, podTotal := range podTotalJsonMap {
+		namespace := podKey[:strings.Index(podKey, "/")]
+		addPodLevelSliceToTotalJsonMap(timeBucketAmount, jsonMap[namespace].(map[string]interface{}), podTotal)
+	}
+
+	return jsonMap, nil
+}
+
+func searchHistoricalNamespaceMetrics(namespace string, aggregationAmount int,
+	from time.Time, to time.Time) (returnedContainerRecordAggregation *ContainerRecordAggregation, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("searchHistoricalNamespaceMetrics Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedContainerRecordAggregation = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	if from.After(to) {
+		return nil, errors.New("From " + from.String() + " can't be after to " + to.String())
+	}
+	if aggregationAmount <= 0 {
+		return nil, errors.New("The aggregation amount must be positive")
+	}
+
+	duration := int(to.Sub(from).Seconds())
+	intervalInSecond := int(duration / aggregationAmount)
+
+	searchMetricAggregationSlice := make([]MetricAggregation, 0)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, summedMetricAggregationSlice...)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, getRateMetricAggregationSlice()...)
+
+	// All workloads in the namespace
+	return searchRecordAggregationWithRollup(storage.SearchNamespaceRecordAggregation, namespace, "",
+		from, to, intervalInSecond, searchMetricAggregationSlice)
+}
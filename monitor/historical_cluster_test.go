@@ -0,0 +1,94 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func TestGetHistoricalClusterMetrics(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	// The pods of the same name in different namespaces are not merged
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, namespace := range []string{"default", "staging"} {
+		core := int64(1)
+		memoryUsage := int64(100)
+		if namespace == "staging" {
+			core = 2
+			memoryUsage = 300
+		}
+		index := getDocumentIndex(namespace)
+		documentType := getDocumentType(control.WorkloadKindStatefulSet, "redis")
+		for i := 0; i < 3; i++ {
+			timestamp := from.Add(time.Duration(i*10) * time.Second)
+			containerRecord := createTestContainerRecord("redis-0", "redis", timestamp, int64(i*10)*core*1000000000)
+			containerRecord["searchMetaData"].(map[string]interface{})["namespace"] = namespace
+			containerRecord["stats"].(map[string]interface{})["memory"] = map[string]interface{}{"usage": memoryUsage}
+			containerRecord["stats"].(map[string]interface{})["network"] = map[string]interface{}{"rx_bytes": i * 10000}
+			storage.SaveContainerRecord(index, documentType, getDocumentID("redis-0", "redis", timestamp), containerRecord)
+			// The sidecar reports the same network of the pod
+			containerRecord = createTestContainerRecord("redis-0", "sentinel", timestamp, 0)
+			containerRecord["searchMetaData"].(map[string]interface{})["namespace"] = namespace
+			containerRecord["stats"].(map[string]interface{})["network"] = map[string]interface{}{"rx_bytes": i * 10000}
+			storage.SaveContainerRecord(index, documentType, getDocumentID("redis-0", "sentinel", timestamp), containerRecord)
+		}
+	}
+
+	jsonMap, err := GetHistoricalNamespaceMetrics("default", 3, from, from.Add(30*time.Second), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaceTotalJsonMap := jsonMap[namespaceTotalName].(map[string]interface{})
+	cpuUsageCoresSlice := namespaceTotalJsonMap["cpuUsageCoresSlice"].([]interface{})
+	memoryUsageSlice := namespaceTotalJsonMap["memoryUsageSlice"].([]interface{})
+	if len(cpuUsageCoresSlice) != 3 || cpuUsageCoresSlice[0] != nil || cpuUsageCoresSlice[2] != 1.0 {
+		t.Errorf("Expect 1 core but get %v", cpuUsageCoresSlice)
+	}
+	if memoryUsageSlice[1] != 100.0 {
+		t.Errorf("Expect memory 100 but get %v", memoryUsageSlice)
+	}
+	if networkRxBytesPerSecondSlice := namespaceTotalJsonMap["networkRxBytesPerSecondSlice"].([]interface{}); networkRxBytesPerSecondSlice[2] != 1000.0 {
+		t.Errorf("Expect 1000 bytes per second counted once for the pod but get %v", networkRxBytesPerSecondSlice)
+	}
+
+	jsonMap, err = GetHistoricalClusterMetrics(3, from, from.Add(30*time.Second), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusterTotalJsonMap := jsonMap[clusterTotalName].(map[string]interface{})
+	cpuUsageCoresSlice = clusterTotalJsonMap["cpuUsageCoresSlice"].([]interface{})
+	memoryUsageSlice = clusterTotalJsonMap["memoryUsageSlice"].([]interface{})
+	if cpuUsageCoresSlice[1] != 3.0 {
+		t.Errorf("Expect 3 cores but get %v", cpuUsageCoresSlice)
+	}
+	if memoryUsageSlice[1] != 400.0 {
+		t.Errorf("Expect memory 400 but get %v", memoryUsageSlice)
+	}
+	if networkRxBytesPerSecondSlice := clusterTotalJsonMap["networkRxBytesPerSecondSlice"].([]interface{}); networkRxBytesPerSecondSlice[2] != 2000.0 {
+		t.Errorf("Expect 2000 bytes per second for the two pods but get %v", networkRxBytesPerSecondSlice)
+	}
+	stagingMemoryUsageSlice := jsonMap["staging"].(map[string]interface{})["memoryUsageSlice"].([]interface{})
+	if stagingMemoryUsageSlice[1] != 300.0 {
+		t.Errorf("Expect memory 300 in staging but get %v", stagingMemoryUsageSlice)
+	}
+}
@@ -15,50 +15,143 @@
 package monitor
 
 import (
+	"errors"
 	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
 	"github.com/cloudawan/cloudone_utility/logger"
+	"sync"
+	"time"
 )
 
-func RecordHistoricalAllNamespace(kubeApiServerEndPoint string, kubeApiServerToken string) (returnedError error) {
+// ContainerMetricsSweep is the result of one collection of all namespaces
+type ContainerMetricsSweep struct {
+	StartTime             time.Time
+	DurationInMilliSecond int64
+	RecordCount           int
+	ErrorCount            int
+	Timeout               bool
+}
+
+type ContainerMetricsSweepStatus struct {
+	LastSweep                    *ContainerMetricsSweep
+	SweepCount                   int64
+	TotalErrorCount              int64
+	TimeoutCount                 int64
+	MaximumDurationInMilliSecond int64
+}
+
+var errDeadlineExceeded = errors.New("Deadline exceeded")
+
+var containerMetricsSweepStatus = ContainerMetricsSweepStatus{}
+var containerMetricsSweepStatusLock = sync.Mutex{}
+
+func recordContainerMetricsSweep(containerMetricsSweep ContainerMetricsSweep) {
+	containerMetricsSweepStatusLock.Lock()
+	defer containerMetricsSweepStatusLock.Unlock()
+
+	containerMetricsSweepStatus.LastSweep = &containerMetricsSweep
+	containerMetricsSweepStatus.SweepCount++
+	containerMetricsSweepStatus.TotalErrorCount += int64(containerMetricsSweep.ErrorCount)
+	if containerMetricsSweep.Timeout {
+		containerMetricsSweepStatus.TimeoutCount++
+	}
+	if containerMetricsSweep.DurationInMilliSecond > containerMetricsSweepStatus.MaximumDurationInMilliSecond {
+		containerMetricsSweepStatus.MaximumDurationInMilliSecond = containerMetricsSweep.DurationInMilliSecond
+	}
+}
+
+func GetContainerMetricsSweepStatus() ContainerMetricsSweepStatus {
+	containerMetricsSweepStatusLock.Lock()
+	defer containerMetricsSweepStatusLock.Unlock()
+	return containerMetricsSweepStatus
+}
+
+// isDeadlineExceeded returns false for the zero deadline which means no limit
+func isDeadlineExceeded(deadline time.Time) bool {
+	return deadline.IsZero() == false && time.Now().After(deadline)
+}
+
+// RecordHistoricalAllNamespace collects the container metrics of all namespaces.
+// The collection stops at the deadline and the zero deadline means no limit. The deadline is checked before
+// each pod and the requests in progress are canceled at it. The records collected before the deadline are saved.
+func RecordHistoricalAllNamespace(kubeApiServerEndPoint string, kubeApiServerToken string, deadline time.Time) (returnedError error) {
+	containerMetricsSweep := ContainerMetricsSweep{}
+	containerMetricsSweep.StartTime = time.Now()
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error("RecordHistoricalAllNamespace Error: %s", err)
 			log.Error(logger.GetStackTrace(4096, false))
 			returnedError = err.(error)
+			containerMetricsSweep.ErrorCount++
 		}
+		containerMetricsSweep.DurationInMilliSecond = int64(time.Since(containerMetricsSweep.StartTime) / time.Millisecond)
+		recordContainerMetricsSweep(containerMetricsSweep)
+		log.Info("Container metrics sweep takes %d ms with %d records and %d errors",
+			containerMetricsSweep.DurationInMilliSecond, containerMetricsSweep.RecordCount, containerMetricsSweep.ErrorCount)
 	}()
 
 	namespaceNameSlice, err := control.GetAllNamespaceName(kubeApiServerEndPoint, kubeApiServerToken)
 	if err != nil {
 		log.Error(err)
+		containerMetricsSweep.ErrorCount++
 		return err
 	}
 
-	allNamespaceContainerRecordSlice := make([]map[string]interface{}, 0)
+	bulkProcessor := createContainerRecordBulkProcessor()
+	// The containers whose records are added so their counter states are saved together
+	counterStateKeyMap := make(map[string]bool)
 	for _, namespaceName := range namespaceNameSlice {
-		replicationControllerNameSlice, err := control.GetAllReplicationControllerName(kubeApiServerEndPoint, kubeApiServerToken, namespaceName)
+		if isDeadlineExceeded(deadline) {
+			log.Error("Container metrics sweep timeout at namespace %s", namespaceName)
+			containerMetricsSweep.Timeout = true
+			break
+		}
+		workloadSlice, err := control.GetAllWorkload(kubeApiServerEndPoint, kubeApiServerToken, namespaceName)
 		if err != nil {
 			log.Error(err)
+			containerMetricsSweep.ErrorCount++
 		} else {
-			for _, replicationControllerName := range replicationControllerNameSlice {
-				replicationControllerContainerRecordSlice, err := RecordHistoricalReplicationController(kubeApiServerEndPoint, kubeApiServerToken, namespaceName, replicationControllerName)
-				if err != nil {
+			for _, workload := range workloadSlice {
+				workloadContainerRecordSlice, err := RecordHistoricalWorkload(kubeApiServerEndPoint, kubeApiServerToken, namespaceName, workload, deadline)
+				if err == errDeadlineExceeded {
+					// The records of the pods before the deadline are kept
+					log.Error("Container metrics sweep timeout at namespace %s %s %s", namespaceName, workload.Kind, workload.Name)
+					containerMetricsSweep.Timeout = true
+				} else if err != nil {
 					log.Error(err)
-				} else {
-					allNamespaceContainerRecordSlice = append(allNamespaceContainerRecordSlice, replicationControllerContainerRecordSlice...)
+					containerMetricsSweep.ErrorCount++
+					// The request in progress is canceled at the deadline
+					containerMetricsSweep.Timeout = isDeadlineExceeded(deadline)
+				}
+				containerMetricsSweep.RecordCount += len(workloadContainerRecordSlice)
+				for _, containerRecord := range workloadContainerRecordSlice {
+					index, _ := containerRecord["searchMetaData"].(map[string]interface{})["index"].(string)
+					documentType, _ := containerRecord["searchMetaData"].(map[string]interface{})["documentType"].(string)
+					id, _ := containerRecord["searchMetaData"].(map[string]interface{})["id"].(string)
+					podName, _ := containerRecord["searchMetaData"].(map[string]interface{})["podName"].(string)
+					containerName, _ := containerRecord["searchMetaData"].(map[string]interface{})["containerName"].(string)
+					bulkProcessor.Add(bulk.BulkItem{Index: index, Type: documentType, ID: id, Document: containerRecord})
+					counterStateKeyMap[getCounterStateKey(namespaceName, podName, containerName)] = true
+				}
+				if containerMetricsSweep.Timeout {
+					break
 				}
 			}
 		}
 	}
 
-	for _, containerRecord := range allNamespaceContainerRecordSlice {
-		index, _ := containerRecord["searchMetaData"].(map[string]interface{})["index"].(string)
-		documentType, _ := containerRecord["searchMetaData"].(map[string]interface{})["documentType"].(string)
-		id, _ := containerRecord["searchMetaData"].(map[string]interface{})["id"].(string)
-		if err := saveContainerRecord(index, documentType, id, containerRecord); err != nil {
-			log.Error("Save error %s", err)
-		}
+	// Send the remaining records with the counter states and report the failed ones
+	addPendingCounterStateToBulkProcessor(bulkProcessor, counterStateKeyMap)
+	bulkItemErrorSlice := bulkProcessor.Close()
+	for _, bulkItemError := range bulkItemErrorSlice {
+		log.Error("Save error %s", bulkItemError.String())
 	}
+	containerMetricsSweep.ErrorCount += len(bulkItemErrorSlice)
+	// The counter states advance only if all are saved, otherwise the records are stitched again in the next sweep
+	completePendingCounterState(counterStateKeyMap, len(bulkItemErrorSlice) == 0)
 
-	return nil
+	if containerMetricsSweep.Timeout {
+		return errors.New("Container metrics sweep doesn't complete before the deadline " + deadline.String())
+	}
+	return bulk.ConvertToError(bulkItemErrorSlice)
 }
@@ -14,6 +14,16 @@
 
 package monitor
 
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
 /*
 import (
 	"fmt"
@@ -24,3 +34,75 @@ func TestRecordHistoricalPod(t *testing.T) {
 	fmt.Println(RecordHistoricalAllNamespace("192.168.0.31", 8080))
 }
 */
+
+// blockingMetricsSource blocks until the deadline like the kubelet which doesn't respond
+type blockingMetricsSource struct {
+	lock      sync.Mutex
+	callCount int
+}
+
+func (blockingMetricsSource *blockingMetricsSource) GetContainerJsonMap(kubeApiServerEndPoint string, kubeApiServerToken string,
+	namespace string, podName string, podJsonMap map[string]interface{}, deadline time.Time) (map[string]map[string]interface{}, error) {
+	blockingMetricsSource.lock.Lock()
+	blockingMetricsSource.callCount++
+	blockingMetricsSource.lock.Unlock()
+
+	if deadline.IsZero() {
+		return nil, errors.New("No deadline is passed to the metrics source")
+	}
+	<-time.After(deadline.Sub(time.Now()))
+	return nil, errors.New("Request to the pod " + podName + " is canceled at the deadline")
+}
+
+func TestRecordHistoricalAllNamespaceTimeout(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	originalMetricsSource := metricsSource
+	stubMetricsSource := &blockingMetricsSource{}
+	metricsSource = stubMetricsSource
+	defer func() {
+		storage = originalStorage
+		metricsSource = originalMetricsSource
+	}()
+
+	// One namespace with the replication controller nginx of two pods
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/api/v1/namespaces/":
+			responseWriter.Write([]byte(`{"items": [{"metadata": {"name": "default"}}]}`))
+		case "/api/v1/namespaces/default/replicationcontrollers/":
+			responseWriter.Write([]byte(`{"items": [{"metadata": {"name": "nginx"}}]}`))
+		case "/api/v1/namespaces/default/pods/":
+			responseWriter.Write([]byte(`{"items": [{"metadata": {"name": "nginx-a", "generateName": "nginx-"}},
+				{"metadata": {"name": "nginx-b", "generateName": "nginx-"}}]}`))
+		case "/api/v1/namespaces/default/pods/nginx-a/", "/api/v1/namespaces/default/pods/nginx-b/":
+			responseWriter.Write([]byte(`{"status": {"hostIP": "127.0.0.1"}}`))
+		default:
+			responseWriter.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	timeoutCount := GetContainerMetricsSweepStatus().TimeoutCount
+	start := time.Now()
+	if err := RecordHistoricalAllNamespace(server.URL, "", start.Add(200*time.Millisecond)); err == nil {
+		t.Error("Expect timeout error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("The sweep doesn't stop at the deadline but takes %s", time.Since(start))
+	}
+	// The second pod of the workload is not requested after the deadline
+	if stubMetricsSource.callCount != 1 {
+		t.Errorf("Expect 1 request to the metrics source but get %d", stubMetricsSource.callCount)
+	}
+
+	containerMetricsSweepStatus := GetContainerMetricsSweepStatus()
+	if containerMetricsSweepStatus.LastSweep == nil || containerMetricsSweepStatus.LastSweep.Timeout == false {
+		t.Errorf("Expect the last sweep to time out but get %v", containerMetricsSweepStatus.LastSweep)
+	} else if containerMetricsSweepStatus.LastSweep.ErrorCount != 1 || containerMetricsSweepStatus.LastSweep.RecordCount != 0 {
+		t.Errorf("Expect 1 error and no record but get %v", containerMetricsSweepStatus.LastSweep)
+	}
+	if containerMetricsSweepStatus.TimeoutCount != timeoutCount+1 {
+		t.Errorf("Expect the timeout count %d but get %d", timeoutCount+1, containerMetricsSweepStatus.TimeoutCount)
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"strings"
+	"time"
+)
+
+// The condition status is saved as 1 for True and 0 otherwise so the minimum of Ready is 0 if the node is not ready
+// in any sample of the bucket and the maximum of the pressure is 1 if the node has the pressure in any sample.
+var nodeMetricSlice = []Metric{
+	Metric{"cpuUsageTotal", "stats.cpu.usage.total", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"memoryUsage", "stats.memory.usage", aggregatorAverage, MetricFamilyBasic},
+	Metric{"memoryWorkingSet", "stats.memory.working_set", aggregatorAverage, MetricFamilyBasic},
+	Metric{"memoryAvailable", "stats.memory.available", aggregatorAverage, MetricFamilyBasic},
+	Metric{"networkRxBytes", "stats.network.rx_bytes", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"networkTxBytes", "stats.network.tx_bytes", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"networkRxErrors", "stats.network.rx_errors", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"networkTxErrors", "stats.network.tx_errors", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"filesystemUsage", "stats.filesystem.usage", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"filesystemCapacity", "stats.filesystem.capacity", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"filesystemAvailable", "stats.filesystem.available", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"imageFilesystemUsage", "stats.image_filesystem.usage", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"imageFilesystemCapacity", "stats.image_filesystem.capacity", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"imageFilesystemAvailable", "stats.image_filesystem.available", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"capacityCpuMilliCores", "status.capacity.cpu", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"capacityMemory", "status.capacity.memory", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"capacityPods", "status.capacity.pods", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"allocatableCpuMilliCores", "status.allocatable.cpu", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"allocatableMemory", "status.allocatable.memory", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"allocatablePods", "status.allocatable.pods", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"allocatableEphemeralStorage", "status.allocatable.ephemeral_storage", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"conditionReady", "status.condition.Ready", aggregatorMinimum, MetricFamilyStatus},
+	Metric{"conditionMemoryPressure", "status.condition.MemoryPressure", aggregatorMaximum, MetricFamilyStatus},
+	Metric{"conditionDiskPressure", "status.condition.DiskPressure", aggregatorMaximum, MetricFamilyStatus},
+	Metric{"conditionPIDPressure", "status.condition.PIDPressure", aggregatorMaximum, MetricFamilyStatus},
+	Metric{"conditionNetworkUnavailable", "status.condition.NetworkUnavailable", aggregatorMaximum, MetricFamilyStatus},
+	Metric{"unschedulable", "status.unschedulable", aggregatorMaximum, MetricFamilyStatus},
+}
+
+// ParseNodeMetricAggregation is the same as ParseMetricAggregation for the node metrics.
+// All families are used if none is selected.
+func ParseNodeMetricAggregation(familyTextSlice []string, aggregatorTextSlice []string) ([]MetricAggregation, error) {
+	return parseMetricAggregation(nodeMetricSlice, []string{MetricFamilyBasic, MetricFamilyFilesystem, MetricFamilyStatus},
+		familyTextSlice, aggregatorTextSlice)
+}
+
+// RecordHistoricalAllNode records the kubelet node stats and the node status of all nodes
+func RecordHistoricalAllNode(kubeApiServerEndPoint string, kubeApiServerToken string) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("RecordHistoricalAllNode Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	nodeSlice, err := control.GetAllNode(kubeApiServerEndPoint, kubeApiServerToken)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	errorBuffer := bytes.Buffer{}
+	errorBuffer.WriteString("The following node has error: ")
+	errorHappened := false
+
+	bulkProcessor := createContainerRecordBulkProcessor()
+	for _, node := range nodeSlice {
+		nodeRecordSlice, err := RecordHistoricalNode(node)
+		if err != nil {
+			errorHappened = true
+			log.Error("RecordHistoricalNode error %s", err)
+			errorBuffer.WriteString("RecordHistoricalNode " + node.Name + " error " + err.Error())
+		} else {
+			for _, nodeRecord := range nodeRecordSlice {
+				index, _ := nodeRecord["searchMetaData"].(map[string]interface{})["index"].(string)
+				documentType, _ := nodeRecord["searchMetaData"].(map[string]interface{})["documentType"].(string)
+				id, _ := nodeRecord["searchMetaData"].(map[string]interface{})["id"].(string)
+				bulkProcessor.Add(bulk.BulkItem{Index: index, Type: documentType, ID: id, Document: nodeRecord})
+			}
+		}
+	}
+	if err := bulk.ConvertToError(bulkProcessor.Close()); err != nil {
+		errorHappened = true
+		errorBuffer.WriteString(err.Error())
+	}
+
+	if errorHappened {
+		return errors.New(errorBuffer.String())
+	} else {
+		return nil
+	}
+}
+
+// RecordHistoricalNode returns the node record with the node stats of the kubelet Summary API and the node status
+func RecordHistoricalNode(node control.Node) ([]map[string]interface{}, error) {
+	if node.Address == "" {
+		return nil, errors.New("Node " + node.Name + " doesn't have any address")
+	}
+
+	url := kubeletClient.GetURL(node.Address) + "/stats/summary"
+	result, err := kubeletClient.RequestGet(url)
+	if err != nil {
+		log.Error("Request to url %s error %s", url, err)
+		return nil, err
+	}
+	nodeSummary, _ := result.(map[string]interface{})["node"].(map[string]interface{})
+	if nodeSummary == nil {
+		return nil, errors.New("The summary of the node " + node.Name + " doesn't have the node stats")
+	}
+
+	nodeJsonMap := convertNodeSummaryToNodeJsonMap(nodeSummary)
+	statsJsonMap, _ := nodeJsonMap["stats"].([]interface{})[0].(map[string]interface{})
+	timestamp, err := time.Parse(time.RFC3339Nano, statsJsonMap["timestamp"].(string))
+	if err != nil {
+		log.Error("Parse timestamp error %s", statsJsonMap)
+		return nil, errors.New("Parse timestamp error")
+	}
+
+	index := rollover.GetIndexName(indexNodeMetricsIndex, timestamp)
+	documentType := getNodeDocumentType(node.Name)
+	id := getDocumentID(node.Name, nodeMetricsContainerName, timestamp)
+
+	searchMetaData := make(map[string]interface{})
+	searchMetaData["nodeName"] = node.Name
+	searchMetaData["podName"] = node.Name
+	searchMetaData["containerName"] = nodeMetricsContainerName
+	searchMetaData["index"] = index
+	searchMetaData["documentType"] = documentType
+	searchMetaData["id"] = id
+
+	nodeRecord := make(map[string]interface{})
+	nodeRecord["searchMetaData"] = searchMetaData
+	nodeRecord["spec"] = nodeJsonMap["spec"]
+	nodeRecord["stats"] = statsJsonMap
+	nodeRecord["status"] = createNodeStatusJsonMap(node)
+
+	return stitchCounterReset("", node.Name, nodeMetricsContainerName, nodeJsonMap, []map[string]interface{}{nodeRecord}), nil
+}
+
+// convertNodeSummaryToNodeJsonMap maps the node summary to the cAdvisor layout like the container.
+// The image filesystem of the container runtime is saved in image_filesystem.
+func convertNodeSummaryToNodeJsonMap(nodeSummary map[string]interface{}) map[string]interface{} {
+	cpuJsonMap, _ := nodeSummary["cpu"].(map[string]interface{})
+	memoryJsonMap, _ := nodeSummary["memory"].(map[string]interface{})
+	networkJsonMap, _ := nodeSummary["network"].(map[string]interface{})
+	fsJsonMap, _ := nodeSummary["fs"].(map[string]interface{})
+	runtimeJsonMap, _ := nodeSummary["runtime"].(map[string]interface{})
+	imageFsJsonMap, _ := runtimeJsonMap["imageFs"].(map[string]interface{})
+
+	timestamp, _ := cpuJsonMap["time"].(string)
+	if timestamp == "" {
+		timestamp, _ = memoryJsonMap["time"].(string)
+	}
+
+	specJsonMap := make(map[string]interface{})
+	copyJsonMapValue(specJsonMap, "creation_time", nodeSummary, "startTime")
+
+	statsJsonMap := make(map[string]interface{})
+	statsJsonMap["timestamp"] = timestamp
+	if cpuJsonMap != nil {
+		usageJsonMap := make(map[string]interface{})
+		copyJsonMapValue(usageJsonMap, "total", cpuJsonMap, "usageCoreNanoSeconds")
+		copyJsonMapValue(usageJsonMap, "nano_cores", cpuJsonMap, "usageNanoCores")
+		statsJsonMap["cpu"] = map[string]interface{}{"usage": usageJsonMap}
+	}
+	if memoryJsonMap != nil {
+		statsMemoryJsonMap := make(map[string]interface{})
+		copyJsonMapValue(statsMemoryJsonMap, "usage", memoryJsonMap, "usageBytes")
+		copyJsonMapValue(statsMemoryJsonMap, "working_set", memoryJsonMap, "workingSetBytes")
+		copyJsonMapValue(statsMemoryJsonMap, "rss", memoryJsonMap, "rssBytes")
+		copyJsonMapValue(statsMemoryJsonMap, "available", memoryJsonMap, "availableBytes")
+		statsJsonMap["memory"] = statsMemoryJsonMap
+	}
+	if networkJsonMap != nil {
+		statsNetworkJsonMap := make(map[string]interface{})
+		copyJsonMapValue(statsNetworkJsonMap, "rx_bytes", networkJsonMap, "rxBytes")
+		copyJsonMapValue(statsNetworkJsonMap, "rx_errors", networkJsonMap, "rxErrors")
+		copyJsonMapValue(statsNetworkJsonMap, "tx_bytes", networkJsonMap, "txBytes")
+		copyJsonMapValue(statsNetworkJsonMap, "tx_errors", networkJsonMap, "txErrors")
+		statsJsonMap["network"] = statsNetworkJsonMap
+	}
+	if fsJsonMap != nil {
+		filesystemJsonMap := make(map[string]interface{})
+		filesystemJsonMap["device"] = "nodefs"
+		copyJsonMapValue(filesystemJsonMap, "usage", fsJsonMap, "usedBytes")
+		copyJsonMapValue(filesystemJsonMap, "capacity", fsJsonMap, "capacityBytes")
+		copyJsonMapValue(filesystemJsonMap, "available", fsJsonMap, "availableBytes")
+		statsJsonMap["filesystem"] = []interface{}{filesystemJsonMap}
+	}
+	if imageFsJsonMap != nil {
+		imageFilesystemJsonMap := make(map[string]interface{})
+		copyJsonMapValue(imageFilesystemJsonMap, "usage", imageFsJsonMap, "usedBytes")
+		copyJsonMapValue(imageFilesystemJsonMap, "capacity", imageFsJsonMap, "capacityBytes")
+		copyJsonMapValue(imageFilesystemJsonMap, "available", imageFsJsonMap, "availableBytes")
+		statsJsonMap["image_filesystem"] = imageFilesystemJsonMap
+	}
+
+	return createContainerJsonMap(nodeMetricsContainerName, specJsonMap, statsJsonMap)
+}
+
+// createNodeStatusJsonMap returns the capacity and allocatable in number, the CPU in millicore,
+// and the condition status as 1 for True and 0 otherwise
+func createNodeStatusJsonMap(node control.Node) map[string]interface{} {
+	statusJsonMap := make(map[string]interface{})
+	for name, quantityMap := range map[string]map[string]string{
+		"capacity":    node.CapacityMap,
+		"allocatable": node.AllocatableMap,
+	} {
+		resourceJsonMap := make(map[string]interface{})
+		for resource, quantity := range quantityMap {
+			value, err := parseQuantity(quantity)
+			if err != nil {
+				log.Error("Parse quantity %s of %s error %s", quantity, resource, err)
+				continue
+			}
+			if resource == "cpu" {
+				value = value * 1000
+			}
+			// ElasticSearch doesn't allow to use character '.' in the field name
+			key := strings.Replace(strings.Replace(resource, ".", "_", -1), "-", "_", -1)
+			resourceJsonMap[key] = int64(value)
+		}
+		statusJsonMap[name] = resourceJsonMap
+	}
+
+	conditionJsonMap := make(map[string]interface{})
+	for conditionType, conditionStatus := range node.ConditionMap {
+		if conditionStatus == "True" {
+			conditionJsonMap[conditionType] = 1
+		} else {
+			conditionJsonMap[conditionType] = 0
+		}
+	}
+	statusJsonMap["condition"] = conditionJsonMap
+
+	if node.Unschedulable {
+		statusJsonMap["unschedulable"] = 1
+	} else {
+		statusJsonMap["unschedulable"] = 0
+	}
+
+	return statusJsonMap
+}
+
+// ElasticSearch doesn't allow to use character '.' in the type name so it is replaced with '_' which is not allowed in the node name
+func getNodeDocumentType(nodeName string) string {
+	return typeNodeMetricsPrefix + strings.Replace(strings.ToLower(nodeName), ".", "_", -1)
+}
+
+// GetAllHistoricalNodeMetrics returns the metrics of all nodes by node name with the timestamp
+func GetAllHistoricalNodeMetrics(aggregationAmount int, from time.Time, to time.Time,
+	metricAggregationSlice []MetricAggregation, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	return getHistoricalNodeMetrics("", aggregationAmount, from, to, metricAggregationSlice, fill)
+}
+
+// GetHistoricalNodeMetrics returns the metrics of the node with the timestamp
+func GetHistoricalNodeMetrics(nodeName string, aggregationAmount int, from time.Time, to time.Time,
+	metricAggregationSlice []MetricAggregation, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	allNodeJsonMap, err := getHistoricalNodeMetrics(getNodeDocumentType(nodeName), aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeJsonMap, ok := allNodeJsonMap[nodeName].(map[string]interface{})
+	if ok == false {
+		nodeJsonMap = make(map[string]interface{})
+	}
+	nodeJsonMap["timestamp"] = allNodeJsonMap["timestamp"]
+	return nodeJsonMap, nil
+}
+
+func getHistoricalNodeMetrics(documentType string, aggregationAmount int, from time.Time, to time.Time,
+	metricAggregationSlice []MetricAggregation, fill string) (map[string]interface{}, error) {
+	allNodeJsonMap, timestampSlice, err := getHistoricalNodeJsonMap(documentType, aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+	allNodeJsonMap["timestamp"] = timestampSlice
+	return allNodeJsonMap, nil
+}
+
+// getHistoricalNodeJsonMap returns the slices by node name and the timestamps
+func getHistoricalNodeJsonMap(documentType string, aggregationAmount int, from time.Time, to time.Time,
+	metricAggregationSlice []MetricAggregation,
+	fill string) (returnedJsonMap map[string]interface{}, returnedTimestampSlice []string, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("getHistoricalNodeJsonMap Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedJsonMap = nil
+			returnedTimestampSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	if from.After(to) {
+		return nil, nil, errors.New("From " + from.String() + " can't be after to " + to.String())
+	}
+	if aggregationAmount <= 0 {
+		return nil, nil, errors.New("The aggregation amount must be positive")
+	}
+	if metricAggregationSlice == nil {
+		metricAggregationSlice, _ = ParseNodeMetricAggregation(nil, nil)
+	}
+
+	duration := int(to.Sub(from).Seconds())
+	intervalInSecond := int(duration / aggregationAmount)
+
+	searchMetricAggregationSlice := make([]MetricAggregation, 0)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, metricAggregationSlice...)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, getRateMetricAggregationSlice()...)
+
+	containerRecordAggregation, err := storage.SearchContainerRecordAggregation(indexNodeMetricsIndex, documentType,
+		from, to, intervalInSecond, searchMetricAggregationSlice)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	jsonMap, err := convertContainerRecordAggregationToWorkloadJsonMap(containerRecordAggregation, metricAggregationSlice, fill)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	// The node is the only container of the node record so the total is the same
+	allNodeJsonMap := make(map[string]interface{})
+	for key, value := range jsonMap {
+		if podJsonMap, ok := value.(map[string]interface{}); ok {
+			if nodeJsonMap, ok := podJsonMap[nodeMetricsContainerName]; ok {
+				allNodeJsonMap[key] = nodeJsonMap
+			}
+		}
+	}
+
+	return allNodeJsonMap, containerRecordAggregation.TimestampSlice, nil
+}
+
+// DeleteExpiredNodeRecordIndex deletes the node record indices older than the retention
+func DeleteExpiredNodeRecordIndex(now time.Time) error {
+	indexSlice, err := storage.GetAllIndex(indexNodeMetricsIndex + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return rollover.DeleteExpiredIndex(rollover.KindNodeMetrics, indexSlice, now, storage.DeleteContainerRecordIndex)
+}
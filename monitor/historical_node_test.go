@@ -0,0 +1,127 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"testing"
+	"time"
+)
+
+func TestConvertNodeSummaryToNodeJsonMap(t *testing.T) {
+	nodeSummary := map[string]interface{}{
+		"nodeName":  "node-1",
+		"startTime": "2015-12-31T00:00:00Z",
+		"cpu": map[string]interface{}{
+			"time":                 "2016-01-01T00:00:00Z",
+			"usageCoreNanoSeconds": 123456789.0,
+		},
+		"memory": map[string]interface{}{
+			"time":           "2016-01-01T00:00:00Z",
+			"availableBytes": 2048.0,
+		},
+		"fs": map[string]interface{}{"usedBytes": 100.0, "capacityBytes": 1000.0},
+		"runtime": map[string]interface{}{
+			"imageFs": map[string]interface{}{"usedBytes": 200.0},
+		},
+	}
+
+	nodeJsonMap := convertNodeSummaryToNodeJsonMap(nodeSummary)
+	if nodeJsonMap["spec"].(map[string]interface{})["creation_time"] != "2015-12-31T00:00:00Z" {
+		t.Errorf("Unexpected spec %v", nodeJsonMap["spec"])
+	}
+	stats := nodeJsonMap["stats"].([]interface{})[0].(map[string]interface{})
+	if stats["timestamp"] != "2016-01-01T00:00:00Z" || stats["memory"].(map[string]interface{})["available"] != 2048.0 {
+		t.Errorf("Unexpected stats %v", stats)
+	}
+	if stats["filesystem"].([]interface{})[0].(map[string]interface{})["capacity"] != 1000.0 ||
+		stats["image_filesystem"].(map[string]interface{})["usage"] != 200.0 {
+		t.Errorf("Unexpected filesystem %v", stats)
+	}
+
+	statusJsonMap := createNodeStatusJsonMap(control.Node{
+		Name:           "node-1",
+		Address:        "10.0.0.1",
+		Unschedulable:  false,
+		CapacityMap:    map[string]string{"cpu": "4"},
+		AllocatableMap: map[string]string{"cpu": "3800m", "memory": "1Ki", "ephemeral-storage": "1k"},
+		ConditionMap:   map[string]string{"Ready": "True", "DiskPressure": "False"},
+	})
+	allocatableJsonMap := statusJsonMap["allocatable"].(map[string]interface{})
+	if allocatableJsonMap["cpu"] != int64(3800) || allocatableJsonMap["memory"] != int64(1024) || allocatableJsonMap["ephemeral_storage"] != int64(1000) {
+		t.Errorf("Unexpected allocatable %v", allocatableJsonMap)
+	}
+	if statusJsonMap["capacity"].(map[string]interface{})["cpu"] != int64(4000) {
+		t.Errorf("Unexpected capacity %v", statusJsonMap["capacity"])
+	}
+	conditionJsonMap := statusJsonMap["condition"].(map[string]interface{})
+	if conditionJsonMap["Ready"] != 1 || conditionJsonMap["DiskPressure"] != 0 || statusJsonMap["unschedulable"] != 0 {
+		t.Errorf("Unexpected status %v", statusJsonMap)
+	}
+}
+
+func TestGetHistoricalNodeMetrics(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Minute)
+	for _, nodeName := range []string{"node-1", "node-2.example.com"} {
+		for timestamp := from; timestamp.Before(to); timestamp = timestamp.Add(10 * time.Second) {
+			// One core is used
+			nodeRecord := createTestContainerRecord(nodeName, nodeMetricsContainerName, timestamp, int64(timestamp.Sub(from).Seconds())*1000000000)
+			nodeRecord["status"] = map[string]interface{}{
+				"allocatable": map[string]interface{}{"cpu": 3800},
+				"condition":   map[string]interface{}{"Ready": 1},
+			}
+			storage.SaveContainerRecord(rollover.GetIndexName(indexNodeMetricsIndex, timestamp), getNodeDocumentType(nodeName),
+				getDocumentID(nodeName, nodeMetricsContainerName, timestamp), nodeRecord)
+		}
+	}
+
+	allNodeJsonMap, err := GetAllHistoricalNodeMetrics(3, from, to, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allNodeJsonMap) != 3 || len(allNodeJsonMap["timestamp"].([]string)) != 3 {
+		t.Fatalf("Expect 2 nodes with 3 timestamps but get %v", allNodeJsonMap)
+	}
+
+	nodeJsonMap, err := GetHistoricalNodeMetrics("node-2.example.com", 3, from, to, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range nodeJsonMap["minimumAllocatableCpuMilliCoresSlice"].([]interface{}) {
+		if value != int64(3800) {
+			t.Errorf("Expect 3800 millicores but get %v", nodeJsonMap["minimumAllocatableCpuMilliCoresSlice"])
+		}
+	}
+	for _, value := range nodeJsonMap["minimumConditionReadySlice"].([]interface{}) {
+		if value != int64(1) {
+			t.Errorf("Expect ready but get %v", nodeJsonMap["minimumConditionReadySlice"])
+		}
+	}
+	// The first bucket has no previous one so it has no rate
+	for _, value := range nodeJsonMap["cpuUsageCoresSlice"].([]interface{})[1:] {
+		if value != 1.0 {
+			t.Errorf("Expect 1 core but get %v", nodeJsonMap["cpuUsageCoresSlice"])
+		}
+	}
+}
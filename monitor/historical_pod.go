@@ -17,13 +17,18 @@ package monitor
 import (
 	"bytes"
 	"errors"
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 	"strings"
 	"time"
 )
 
-func RecordHistoricalPod(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, replicationControllerName string, podName string) (returnedPodContainerRecordSlice []map[string]interface{}, returnedError error) {
+// RecordHistoricalPod returns the container records of the pod. The requests are canceled at the deadline
+// and the zero deadline means no limit.
+func RecordHistoricalPod(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, workloadKind string, workloadName string, podName string, deadline time.Time) (returnedPodContainerRecordSlice []map[string]interface{}, returnedError error) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error("RecordHistoricalPod Error: %s", err)
@@ -38,7 +43,7 @@ func RecordHistoricalPod(kubeApiServerEndPoint string, kubeApiServerToken string
 	headerMap := make(map[string]string)
 	headerMap["Authorization"] = kubeApiServerToken
 
-	result, err := restclient.RequestGet(kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/"+podName+"/", headerMap, true)
+	result, err := httpclient.RequestGetWithDeadline(configuration.GetKubeApiServerHTTPClient(), kubeApiServerEndPoint+"/api/v1/namespaces/"+namespace+"/pods/"+podName+"/", headerMap, deadline)
 	if err != nil {
 		log.Error("Fail to get pod inofrmation with endpoint %s, token: %s, namespace: %s, pod name: %s, error %s", kubeApiServerEndPoint, kubeApiServerToken, namespace, podName, err.Error())
 		return nil, err
@@ -49,40 +54,34 @@ func RecordHistoricalPod(kubeApiServerEndPoint string, kubeApiServerToken string
 	errorBuffer.WriteString("The following container has error: ")
 	errorHappened := false
 
-	kubeletHost, _ := jsonMap["status"].(map[string]interface{})["hostIP"].(string)
-	uid, _ := jsonMap["metadata"].(map[string]interface{})["uid"].(string)
-	containerSlice, _ := jsonMap["spec"].(map[string]interface{})["containers"].([]interface{})
-	for _, container := range containerSlice {
-		containerName, _ := container.(map[string]interface{})["name"].(string)
-		url := "https://" + kubeletHost + ":10250/stats/" + namespace + "/" + podName + "/" + uid + "/" + containerName
-		result, err := restclient.RequestGet(url, nil, true)
-		containerJsonMap, _ := result.(map[string]interface{})
-		if err != nil {
-			errorHappened = true
-			log.Error("Request to url %s error %s", url, err)
-			errorBuffer.WriteString("Request to url " + url + " error " + err.Error())
-		} else {
-			// ElasticSearch doesn't allow to use character '.' in the field name so it should be replaced with '_'
-			if containerJsonMap["spec"].(map[string]interface{})["labels"] != nil {
-				for key, value := range containerJsonMap["spec"].(map[string]interface{})["labels"].(map[string]interface{}) {
-					if strings.Contains(key, ".") {
-						newKey := strings.Replace(key, ".", "_", -1)
-						containerJsonMap["spec"].(map[string]interface{})["labels"].(map[string]interface{})[newKey] = value
-						delete(containerJsonMap["spec"].(map[string]interface{})["labels"].(map[string]interface{}), key)
-					}
+	containerJsonMapMap, err := metricsSource.GetContainerJsonMap(kubeApiServerEndPoint, kubeApiServerToken, namespace, podName, jsonMap, deadline)
+	if err != nil {
+		errorHappened = true
+		log.Error("Get container metrics of pod %s error %s", podName, err)
+		errorBuffer.WriteString("Get container metrics of pod " + podName + " error " + err.Error())
+	}
+	for containerName, containerJsonMap := range containerJsonMapMap {
+		// ElasticSearch doesn't allow to use character '.' in the field name so it should be replaced with '_'
+		if specJsonMap, ok := containerJsonMap["spec"].(map[string]interface{}); ok && specJsonMap["labels"] != nil {
+			for key, value := range specJsonMap["labels"].(map[string]interface{}) {
+				if strings.Contains(key, ".") {
+					newKey := strings.Replace(key, ".", "_", -1)
+					specJsonMap["labels"].(map[string]interface{})[newKey] = value
+					delete(specJsonMap["labels"].(map[string]interface{}), key)
 				}
 			}
+		}
 
-			// Historical data
-			containerRecordSlice, err := splitHistoricalDataIntoSecondBased(namespace, replicationControllerName,
-				podName, containerName, containerJsonMap)
-			if err != nil {
-				errorHappened = true
-				log.Error("Save container record %s error %s", containerJsonMap, err)
-				errorBuffer.WriteString("Save container record  " + containerName + " error " + err.Error())
-			} else {
-				podContainerRecordSlice = append(podContainerRecordSlice, containerRecordSlice...)
-			}
+		// Historical data
+		containerRecordSlice, err := splitHistoricalDataIntoSecondBased(namespace, workloadKind, workloadName,
+			podName, containerName, containerJsonMap)
+		if err != nil {
+			errorHappened = true
+			log.Error("Save container record %s error %s", containerJsonMap, err)
+			errorBuffer.WriteString("Save container record  " + containerName + " error " + err.Error())
+		} else {
+			containerRecordSlice = stitchCounterReset(namespace, podName, containerName, containerJsonMap, containerRecordSlice)
+			podContainerRecordSlice = append(podContainerRecordSlice, containerRecordSlice...)
 		}
 	}
 
@@ -94,7 +93,7 @@ func RecordHistoricalPod(kubeApiServerEndPoint string, kubeApiServerToken string
 	}
 }
 
-func splitHistoricalDataIntoSecondBased(namespace string, replicationControllerName string,
+func splitHistoricalDataIntoSecondBased(namespace string, workloadKind string, workloadName string,
 	podName string, containerName string, jsonMap map[string]interface{}) ([]map[string]interface{}, error) {
 	statsSlice, ok := jsonMap["stats"].([]interface{})
 	if ok {
@@ -114,12 +113,17 @@ func splitHistoricalDataIntoSecondBased(namespace string, replicationControllerN
 							containerRecord[key] = value
 						}
 
-						index := getDocumentIndex(namespace)
-						documentType := getDocumentType(replicationControllerName)
+						// The record is saved in the index of its period and searched with the alias
+						index := rollover.GetIndexName(getDocumentIndex(namespace), timestamp)
+						documentType := getDocumentType(workloadKind, workloadName)
 						id := getDocumentID(podName, containerName, timestamp)
 						containerRecord["searchMetaData"] = make(map[string]interface{})
 						containerRecord["searchMetaData"].(map[string]interface{})["namespace"] = namespace
-						containerRecord["searchMetaData"].(map[string]interface{})["replicationControllerName"] = replicationControllerName
+						containerRecord["searchMetaData"].(map[string]interface{})["workloadKind"] = workloadKind
+						containerRecord["searchMetaData"].(map[string]interface{})["workloadName"] = workloadName
+						if workloadKind == control.WorkloadKindReplicationController {
+							containerRecord["searchMetaData"].(map[string]interface{})["replicationControllerName"] = workloadName
+						}
 						containerRecord["searchMetaData"].(map[string]interface{})["podName"] = podName
 						containerRecord["searchMetaData"].(map[string]interface{})["containerName"] = containerName
 						containerRecord["searchMetaData"].(map[string]interface{})["index"] = index
@@ -155,12 +159,113 @@ func splitHistoricalDataIntoSecondBased(namespace string, replicationControllerN
 	}
 }
 
+// GetHistoricalPodMetrics returns the metrics of the pod by container with the pod total and the timestamp.
+// The pod is found from the records of all workloads in the namespace so it could be the one no longer existing.
+func GetHistoricalPodMetrics(namespace string, podName string, aggregationAmount int,
+	from time.Time, to time.Time, metricAggregationSlice []MetricAggregation, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	return getHistoricalPodMetrics(namespace, podName, "", aggregationAmount, from, to, metricAggregationSlice, fill)
+}
+
+// GetHistoricalContainerMetrics returns the metrics of the container in the pod with the timestamp
+func GetHistoricalContainerMetrics(namespace string, podName string, containerName string, aggregationAmount int,
+	from time.Time, to time.Time, metricAggregationSlice []MetricAggregation, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	podJsonMap, err := getHistoricalPodMetrics(namespace, podName, containerName, aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	containerJsonMap, ok := podJsonMap[containerName].(map[string]interface{})
+	if ok == false {
+		return nil, errors.New("No record of the container " + containerName + " in the pod " + podName)
+	}
+	containerJsonMap["timestamp"] = podJsonMap["timestamp"]
+	return containerJsonMap, nil
+}
+
+func getHistoricalPodMetrics(namespace string, podName string, containerName string, aggregationAmount int,
+	from time.Time, to time.Time, metricAggregationSlice []MetricAggregation, fill string) (map[string]interface{}, error) {
+	podJsonMap, timestampSlice, err := getHistoricalPodJsonMap(namespace, podName, containerName,
+		aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+	podJsonMap["timestamp"] = timestampSlice
+	return podJsonMap, nil
+}
+
+// getHistoricalPodJsonMap returns the slices of the pod by container and the timestamps
+func getHistoricalPodJsonMap(namespace string, podName string, containerName string, aggregationAmount int,
+	from time.Time, to time.Time, metricAggregationSlice []MetricAggregation,
+	fill string) (returnedPodJsonMap map[string]interface{}, returnedTimestampSlice []string, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("getHistoricalPodJsonMap Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedPodJsonMap = nil
+			returnedTimestampSlice = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	if from.After(to) {
+		return nil, nil, errors.New("From " + from.String() + " can't be after to " + to.String())
+	}
+	if metricAggregationSlice == nil {
+		metricAggregationSlice = replicationControllerMetricAggregationSlice
+	}
+
+	duration := int(to.Sub(from).Seconds())
+	intervalInSecond := int(duration / aggregationAmount)
+
+	searchMetricAggregationSlice := make([]MetricAggregation, 0)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, metricAggregationSlice...)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, getRateMetricAggregationSlice()...)
+
+	search := func(index string, documentType string, from time.Time, to time.Time,
+		intervalInSecond int, metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+		return storage.SearchPodRecordAggregation(index, documentType, podName, containerName,
+			from, to, intervalInSecond, metricAggregationSlice)
+	}
+	// All workloads in the namespace
+	containerRecordAggregation, err := searchRecordAggregationWithRollup(search, namespace, "",
+		from, to, intervalInSecond, searchMetricAggregationSlice)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	workloadJsonMap, err := convertContainerRecordAggregationToWorkloadJsonMap(containerRecordAggregation, metricAggregationSlice, fill)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	podJsonMap, ok := workloadJsonMap[podName].(map[string]interface{})
+	if ok == false {
+		return nil, nil, errors.New("No record of the pod " + podName + " in the namespace " + namespace)
+	}
+	return podJsonMap, containerRecordAggregation.TimestampSlice, nil
+}
+
 func getDocumentIndex(namespace string) string {
 	return indexContainerMetricsIndexPrefix + strings.ToLower(namespace)
 }
 
-func getDocumentType(replicationControllerName string) string {
-	return indexContainerMetricsTypePrefix + strings.ToLower(replicationControllerName)
+func getDocumentType(workloadKind string, workloadName string) string {
+	return indexContainerMetricsTypePrefix + strings.ToLower(workloadKind) + indexContainerMetricsTypeSeparator + strings.ToLower(workloadName)
+}
+
+// getWorkloadFromDocumentType returns the workload kind and name. The kind is in lower case if it is unknown.
+func getWorkloadFromDocumentType(documentType string) (string, string, bool) {
+	if strings.HasPrefix(documentType, indexContainerMetricsTypePrefix) == false {
+		return "", "", false
+	}
+	// Neither the kind nor the name has the separator
+	fieldSlice := strings.SplitN(documentType[len(indexContainerMetricsTypePrefix):], indexContainerMetricsTypeSeparator, 2)
+	if len(fieldSlice) != 2 || fieldSlice[0] == "" || fieldSlice[1] == "" {
+		return "", "", false
+	}
+	return NormalizeWorkloadKind(fieldSlice[0]), fieldSlice[1], true
 }
 
 func getDocumentID(podName string, containerName string, timestamp time.Time) string {
@@ -168,5 +273,6 @@ func getDocumentID(podName string, containerName string, timestamp time.Time) st
 }
 
 func getReplicationControllerNameFromDocumentType(documentType string) string {
-	return documentType[len(indexContainerMetricsTypePrefix):len(documentType)]
+	_, workloadName, _ := getWorkloadFromDocumentType(documentType)
+	return workloadName
 }
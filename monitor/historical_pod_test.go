@@ -14,6 +14,13 @@
 
 package monitor
 
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
 /*
 import (
 	"fmt"
@@ -30,3 +37,53 @@ func TestGetReplicationControllerNameFromDocumentType(t *testing.T) {
 
 }
 */
+
+func TestGetHistoricalPodMetrics(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	// The pod is searched without the workload
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	index := getDocumentIndex("default")
+	for _, podName := range []string{"nginx-1", "nginx-2"} {
+		for _, containerName := range []string{"nginx", "sidecar"} {
+			for i := 0; i < 3; i++ {
+				timestamp := from.Add(time.Duration(i*10) * time.Second)
+				storage.SaveContainerRecord(index, getDocumentType(control.WorkloadKindReplicaSet, "nginx"),
+					getDocumentID(podName, containerName, timestamp),
+					createTestContainerRecord(podName, containerName, timestamp, int64(i*10*1000000000)))
+			}
+		}
+	}
+
+	podJsonMap, err := GetHistoricalPodMetrics("default", "nginx-1", 3, from, from.Add(30*time.Second), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := podJsonMap["sidecar"]; ok == false {
+		t.Errorf("Expect the container sidecar but get %v", podJsonMap)
+	}
+	if len(podJsonMap["timestamp"].([]string)) != 3 {
+		t.Errorf("Expect 3 timestamps but get %v", podJsonMap["timestamp"])
+	}
+	cpuUsageCoresSlice := podJsonMap[podTotalName].(map[string]interface{})["cpuUsageCoresSlice"].([]interface{})
+	if cpuUsageCoresSlice[1] != 2.0 {
+		t.Errorf("Expect 2 cores of the pod but get %v", cpuUsageCoresSlice)
+	}
+
+	containerJsonMap, err := GetHistoricalContainerMetrics("default", "nginx-1", "nginx", 3, from, from.Add(30*time.Second), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpuUsageCoresSlice = containerJsonMap["cpuUsageCoresSlice"].([]interface{})
+	if cpuUsageCoresSlice[1] != 1.0 {
+		t.Errorf("Expect 1 core of the container but get %v", cpuUsageCoresSlice)
+	}
+
+	if _, err := GetHistoricalPodMetrics("default", "nginx-3", 3, from, from.Add(30*time.Second), nil, ""); err == nil {
+		t.Error("Expect the error for the pod without record")
+	}
+}
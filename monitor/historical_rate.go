@@ -0,0 +1,211 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// The rate is derived from the cumulative counter per container. Scale converts the counter unit per second
+// to the unit of the rate like the CPU nanoseconds per second to the cores.
+type RateMetric struct {
+	Name  string
+	Field string
+	Scale float64
+}
+
+var rateMetricSlice = []RateMetric{
+	RateMetric{"cpuUsageCores", "stats.cpu.usage.total", 1e-9},
+	RateMetric{"diskioIoServiceBytesPerSecond", "stats.diskio.io_service_bytes.stats.Total", 1},
+	RateMetric{"diskioIoServicedPerSecond", "stats.diskio.io_serviced.stats.Total", 1},
+	RateMetric{"networkRxPacketsPerSecond", "stats.network.rx_packets", 1},
+	RateMetric{"networkTxPacketsPerSecond", "stats.network.tx_packets", 1},
+	RateMetric{"networkRxBytesPerSecond", "stats.network.rx_bytes", 1},
+	RateMetric{"networkTxBytesPerSecond", "stats.network.tx_bytes", 1},
+}
+
+const (
+	// The network is shared by the containers of the pod so every container has the same counters of the pod
+	podLevelFieldPrefix = "stats.network."
+	rateCounterSuffix   = "Counter"
+	// Container names and pod names are in lower case so the keys don't conflict with them
+	podTotalName      = "podTotal"
+	workloadTotalName = "workloadTotal"
+)
+
+// The latest counter in each bucket is used to calculate the rate between buckets
+func getRateMetricAggregationSlice() []MetricAggregation {
+	metricAggregationSlice := make([]MetricAggregation, 0)
+	for _, rateMetric := range rateMetricSlice {
+		metricAggregationSlice = append(metricAggregationSlice,
+			MetricAggregation{rateMetric.Name + rateCounterSuffix, aggregatorLast, rateMetric.Field})
+	}
+	return metricAggregationSlice
+}
+
+// appendRateToWorkloadJsonMap calculates the rates per container and then sums them up to the pod and the workload.
+// The rate of the pod-level counter like the network is counted once per pod.
+// The rate of the bucket is the counter difference from the previous bucket with data divided by the time between them.
+// The first bucket has no previous one so it has no rate.
+func appendRateToWorkloadJsonMap(workloadJsonMap map[string]interface{}, containerRecordAggregation *ContainerRecordAggregation, fill string) error {
+	timeBucketAmount := len(containerRecordAggregation.TimestampSlice)
+	timestampSlice := make([]time.Time, timeBucketAmount)
+	for i, timestampText := range containerRecordAggregation.TimestampSlice {
+		timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		timestampSlice[i] = timestamp
+	}
+
+	// pod name -> container name -> buckets
+	bucketMap := make(map[string]map[string][]ContainerRecordBucket)
+	for _, containerRecordBucket := range containerRecordAggregation.BucketSlice {
+		containerBucketMap, ok := bucketMap[containerRecordBucket.PodName]
+		if ok == false {
+			containerBucketMap = make(map[string][]ContainerRecordBucket)
+			bucketMap[containerRecordBucket.PodName] = containerBucketMap
+		}
+		containerBucketMap[containerRecordBucket.ContainerName] = append(
+			containerBucketMap[containerRecordBucket.ContainerName], containerRecordBucket)
+	}
+
+	workloadTotalJsonMap := make(map[string]interface{})
+	for podName, containerBucketMap := range bucketMap {
+		podJsonMap, _ := workloadJsonMap[podName].(map[string]interface{})
+		if podJsonMap == nil {
+			podJsonMap = make(map[string]interface{})
+			workloadJsonMap[podName] = podJsonMap
+		}
+		podTotalJsonMap := make(map[string]interface{})
+		for containerName, containerRecordBucketSlice := range containerBucketMap {
+			containerJsonMap, _ := podJsonMap[containerName].(map[string]interface{})
+			if containerJsonMap == nil {
+				containerJsonMap = make(map[string]interface{})
+				podJsonMap[containerName] = containerJsonMap
+			}
+
+			sort.Slice(containerRecordBucketSlice, func(i int, j int) bool {
+				return containerRecordBucketSlice[i].TimeIndex < containerRecordBucketSlice[j].TimeIndex
+			})
+			for _, rateMetric := range rateMetricSlice {
+				rateSlice := calculateRateSlice(timestampSlice, containerRecordBucketSlice, rateMetric)
+				filledSlice := fillTheNullData(rateSlice, fill, 0.0)
+				containerJsonMap[rateMetric.Name+"Slice"] = rateSlice
+				addToInterpolatedInJsonMap(containerJsonMap, rateMetric.Name+"Slice", filledSlice)
+				if isPodLevelField(rateMetric.Field) {
+					addToMaximumSliceInJsonMap(timeBucketAmount, podTotalJsonMap, rateMetric.Name+"Slice", rateSlice)
+					addToInterpolatedInJsonMap(podTotalJsonMap, rateMetric.Name+"Slice", filledSlice)
+				} else {
+					addToSumSliceInJsonMap(timeBucketAmount, podTotalJsonMap, rateMetric.Name+"Slice", rateSlice)
+					addToInterpolatedInJsonMap(podTotalJsonMap, rateMetric.Name+"Slice", filledSlice)
+					addToSumSliceInJsonMap(timeBucketAmount, workloadTotalJsonMap, rateMetric.Name+"Slice", rateSlice)
+					addToInterpolatedInJsonMap(workloadTotalJsonMap, rateMetric.Name+"Slice", filledSlice)
+				}
+			}
+		}
+		addPodLevelSliceToTotalJsonMap(timeBucketAmount, workloadTotalJsonMap, podTotalJsonMap)
+		podJsonMap[podTotalName] = podTotalJsonMap
+	}
+	workloadJsonMap[workloadTotalName] = workloadTotalJsonMap
+
+	return nil
+}
+
+func calculateRateSlice(timestampSlice []time.Time, containerRecordBucketSlice []ContainerRecordBucket, rateMetric RateMetric) []interface{} {
+	rateSlice := make([]interface{}, len(timestampSlice))
+	hasPrevious := false
+	var previousTimestamp time.Time
+	var previousCounter float64
+	for _, containerRecordBucket := range containerRecordBucketSlice {
+		counter, ok := containerRecordBucket.ValueMap[rateMetric.Name+rateCounterSuffix]
+		if ok == false {
+			continue
+		}
+		timestamp := timestampSlice[containerRecordBucket.TimeIndex]
+		if hasPrevious {
+			second := timestamp.Sub(previousTimestamp).Seconds()
+			difference := counter - previousCounter
+			// The counter decreases when it is reset
+			if second > 0 && difference >= 0 {
+				rateSlice[containerRecordBucket.TimeIndex] = difference / second * rateMetric.Scale
+			}
+		}
+		hasPrevious = true
+		previousTimestamp = timestamp
+		previousCounter = counter
+	}
+	return rateSlice
+}
+
+func addToSumSliceInJsonMap(timeBucketAmount int, jsonMap map[string]interface{}, sliceName string, dataSlice []interface{}) {
+	slice, ok := jsonMap[sliceName].([]interface{})
+	if ok == false {
+		slice = make([]interface{}, timeBucketAmount)
+		jsonMap[sliceName] = slice
+	}
+	for i, data := range dataSlice {
+		value, ok := data.(float64)
+		if ok == false {
+			continue
+		}
+		sum, _ := slice[i].(float64)
+		slice[i] = sum + value
+	}
+}
+
+// isPodLevelField returns true if the field is the counter of the pod copied to every container of the pod
+func isPodLevelField(field string) bool {
+	return strings.HasPrefix(field, podLevelFieldPrefix)
+}
+
+// addToMaximumSliceInJsonMap keeps the maximum of the added slices. It is used for the pod-level counter so the
+// value of the pod is counted once no matter how many containers report it.
+func addToMaximumSliceInJsonMap(timeBucketAmount int, jsonMap map[string]interface{}, sliceName string, dataSlice []interface{}) {
+	slice, ok := jsonMap[sliceName].([]interface{})
+	if ok == false {
+		slice = make([]interface{}, timeBucketAmount)
+		jsonMap[sliceName] = slice
+	}
+	for i, data := range dataSlice {
+		value, ok := data.(float64)
+		if ok == false {
+			continue
+		}
+		if maximum, ok := slice[i].(float64); ok == false || value > maximum {
+			slice[i] = value
+		}
+	}
+}
+
+// addPodLevelSliceToTotalJsonMap sums up the pod-level rate slices of the pod to the total
+func addPodLevelSliceToTotalJsonMap(timeBucketAmount int, totalJsonMap map[string]interface{}, podTotalJsonMap map[string]interface{}) {
+	interpolatedJsonMap, _ := podTotalJsonMap[interpolatedName].(map[string]interface{})
+	for _, rateMetric := range rateMetricSlice {
+		if isPodLevelField(rateMetric.Field) == false {
+			continue
+		}
+		slice, ok := podTotalJsonMap[rateMetric.Name+"Slice"].([]interface{})
+		if ok == false {
+			continue
+		}
+		filledSlice, _ := interpolatedJsonMap[rateMetric.Name+"Slice"].([]bool)
+		addToSumSliceInJsonMap(timeBucketAmount, totalJsonMap, rateMetric.Name+"Slice", slice)
+		addToInterpolatedInJsonMap(totalJsonMap, rateMetric.Name+"Slice", filledSlice)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func TestGetHistoricalWorkloadMetricsRate(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	documentType := getDocumentType(control.WorkloadKindReplicationController, "nginx")
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Minute)
+	for timestamp := from; timestamp.Before(to); timestamp = timestamp.Add(5 * time.Second) {
+		second := int64(timestamp.Sub(from).Seconds())
+		// Half core for nginx and a quarter core for the sidecar
+		for _, container := range []struct {
+			Name          string
+			CpuUsageTotal int64
+		}{
+			{"nginx", second * 500000000},
+			{"sidecar", second * 250000000},
+		} {
+			containerRecord := createTestContainerRecord("nginx-1", container.Name, timestamp, container.CpuUsageTotal)
+			containerRecord["stats"].(map[string]interface{})["network"] = map[string]interface{}{"rx_bytes": second * 1000}
+			storage.SaveContainerRecord(getDocumentIndex("default"), documentType,
+				getDocumentID("nginx-1", container.Name, timestamp), containerRecord)
+		}
+	}
+
+	workloadJsonMap, err := GetHistoricalReplicationControllerMetrics("default", "nginx", 6, from, to, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first bucket has no previous one so it has no rate
+	containerJsonMap := workloadJsonMap["nginx-1"].(map[string]interface{})["nginx"].(map[string]interface{})
+	if value := containerJsonMap["cpuUsageCoresSlice"].([]interface{})[0]; value != nil {
+		t.Errorf("Expect no rate at 0 but get %v", value)
+	}
+	for i, value := range containerJsonMap["cpuUsageCoresSlice"].([]interface{})[1:] {
+		if value != 0.5 {
+			t.Errorf("Expect 0.5 core at %d but get %v", i+1, value)
+		}
+	}
+	for i, value := range containerJsonMap["networkRxBytesPerSecondSlice"].([]interface{})[1:] {
+		if value != 1000.0 {
+			t.Errorf("Expect 1000 bytes per second at %d but get %v", i+1, value)
+		}
+	}
+
+	podTotalJsonMap := workloadJsonMap["nginx-1"].(map[string]interface{})[podTotalName].(map[string]interface{})
+	workloadTotalJsonMap := workloadJsonMap[workloadTotalName].(map[string]interface{})
+	for _, totalJsonMap := range []map[string]interface{}{podTotalJsonMap, workloadTotalJsonMap} {
+		for i, value := range totalJsonMap["cpuUsageCoresSlice"].([]interface{})[1:] {
+			if value != 0.75 {
+				t.Errorf("Expect 0.75 core at %d but get %v", i+1, value)
+			}
+		}
+		// The network of the pod is reported by both containers but counted once
+		for i, value := range totalJsonMap["networkRxBytesPerSecondSlice"].([]interface{})[1:] {
+			if value != 1000.0 {
+				t.Errorf("Expect 1000 bytes per second in total at %d but get %v", i+1, value)
+			}
+		}
+	}
+}
+
+func TestCalculateRateSlice(t *testing.T) {
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	timestampSlice := []time.Time{from, from.Add(10 * time.Second), from.Add(20 * time.Second), from.Add(30 * time.Second)}
+	rateMetric := RateMetric{"networkRxBytesPerSecond", "stats.network.rx_bytes", 1}
+	name := rateMetric.Name + rateCounterSuffix
+	containerRecordBucketSlice := []ContainerRecordBucket{
+		ContainerRecordBucket{0, "", "nginx-1", "nginx", 1, map[string]float64{name: 100}},
+		// The bucket 1 is missing so the rate of the bucket 2 covers both
+		ContainerRecordBucket{2, "", "nginx-1", "nginx", 1, map[string]float64{name: 300}},
+		// The counter is reset
+		ContainerRecordBucket{3, "", "nginx-1", "nginx", 1, map[string]float64{name: 50}},
+	}
+
+	rateSlice := calculateRateSlice(timestampSlice, containerRecordBucketSlice, rateMetric)
+	if rateSlice[0] != nil || rateSlice[1] != nil || rateSlice[2] != 10.0 || rateSlice[3] != nil {
+		t.Errorf("Unexpected rate %v", rateSlice)
+	}
+}
@@ -25,8 +25,8 @@ func TestSearchHistoricalReplicationControllerMetrics(t *testing.T) {
 	nodeAmount := 10
 	from := current.Add(-1 * time.Minute)
 	to := current.Add(-0 * time.Minute)
-	byteSlice, err := searchHistoricalReplicationControllerMetrics("default", "cloudone-all", nodeAmount, from, to)
-	fmt.Println(string(byteSlice), err)
+	containerRecordAggregation, err := searchHistoricalReplicationControllerMetrics("default", "cloudone-all", nodeAmount, from, to, replicationControllerMetricAggregationSlice)
+	fmt.Println(containerRecordAggregation, err)
 }
 
 /*
@@ -35,7 +35,7 @@ func TestGetAllHistoricalReplicationControllerMetrics(t *testing.T) {
 	nodeAmount := 10
 	from := current.Add(-11 * time.Minute)
 	to := current.Add(-1 * time.Minute)
-	fmt.Println(GetAllHistoricalReplicationControllerMetrics("default", nodeAmount, from, to))
+	fmt.Println(GetAllHistoricalReplicationControllerMetrics("default", nodeAmount, from, to, nil, ""))
 }
 
 
@@ -44,7 +44,7 @@ func TestGetHistoricalReplicationControllerMetrics(t *testing.T) {
 	nodeAmount := 10
 	from := current.Add(-11 * time.Minute)
 	to := current.Add(-1 * time.Minute)
-	fmt.Println(GetHistoricalReplicationControllerMetrics("default", "private-repository", nodeAmount, from, to))
+	fmt.Println(GetHistoricalReplicationControllerMetrics("default", "private-repository", nodeAmount, from, to, nil, ""))
 }
 
 
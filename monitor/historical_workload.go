@@ -0,0 +1,242 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"strings"
+	"time"
+)
+
+var workloadKindSlice = []string{
+	control.WorkloadKindReplicationController,
+	control.WorkloadKindReplicaSet,
+	control.WorkloadKindDeployment,
+	control.WorkloadKindStatefulSet,
+	control.WorkloadKindDaemonSet,
+	control.WorkloadKindJob,
+	control.WorkloadKindCronJob,
+	control.WorkloadKindPod,
+}
+
+// NormalizeWorkloadKind returns the kind like Deployment for deployment or deployments.
+// The unknown kind is returned in lower case.
+func NormalizeWorkloadKind(text string) string {
+	lowerCaseText := strings.ToLower(text)
+	for _, workloadKind := range workloadKindSlice {
+		lowerCaseWorkloadKind := strings.ToLower(workloadKind)
+		if lowerCaseText == lowerCaseWorkloadKind || lowerCaseText == lowerCaseWorkloadKind+"s" {
+			return workloadKind
+		}
+	}
+	return lowerCaseText
+}
+
+type HistoricalWorkload struct {
+	Kind string
+	Name string
+}
+
+// RecordHistoricalWorkload returns the container records of the pods of the workload. The pods are not requested
+// after the deadline and the records collected before it are returned with errDeadlineExceeded.
+// The zero deadline means no limit.
+func RecordHistoricalWorkload(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string, workload control.Workload, deadline time.Time) (returnedWorkloadContainerRecordSlice []map[string]interface{}, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("RecordHistoricalWorkload Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+			returnedWorkloadContainerRecordSlice = nil
+		}
+	}()
+
+	errorBuffer := bytes.Buffer{}
+	errorBuffer.WriteString("The following container has error: ")
+	errorHappened := false
+
+	workloadContainerRecordSlice := make([]map[string]interface{}, 0)
+	deadlineExceeded := false
+	for _, podName := range workload.PodNameSlice {
+		if isDeadlineExceeded(deadline) {
+			log.Error("Deadline exceeded at namespace %s %s %s pod %s", namespace, workload.Kind, workload.Name, podName)
+			deadlineExceeded = true
+			break
+		}
+		podContainerRecordSlice, err := RecordHistoricalPod(kubeApiServerEndPoint, kubeApiServerToken, namespace, workload.Kind, workload.Name, podName, deadline)
+		if err != nil {
+			errorHappened = true
+			log.Error("RecordHistoricalPod error %s", err)
+			errorBuffer.WriteString("RecordHistoricalPod error " + err.Error())
+		} else {
+			workloadContainerRecordSlice = append(workloadContainerRecordSlice, podContainerRecordSlice...)
+		}
+	}
+
+	if errorHappened {
+		log.Error("Fail to get all container inofrmation with endpoint %s, namespace: %s, %s %s, error %s", kubeApiServerEndPoint, namespace, workload.Kind, workload.Name, errorBuffer.String())
+		return nil, errors.New(errorBuffer.String())
+	} else if deadlineExceeded {
+		return workloadContainerRecordSlice, errDeadlineExceeded
+	} else {
+		return workloadContainerRecordSlice, nil
+	}
+}
+
+// GetAllHistoricalWorkloadMetrics returns the metrics of all workloads in the namespace by kind and then name
+func GetAllHistoricalWorkloadMetrics(namespace string,
+	aggregationAmount int, from time.Time, to time.Time,
+	metricAggregationSlice []MetricAggregation, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	historicalWorkloadSlice, err := GetAllWorkloadInNameSpace(namespace)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	} else {
+		namespaceJsonMap := make(map[string]interface{})
+		for _, historicalWorkload := range historicalWorkloadSlice {
+			workloadJsonMap, err := GetHistoricalWorkloadMetrics(namespace,
+				historicalWorkload.Kind, historicalWorkload.Name, aggregationAmount, from, to, metricAggregationSlice, fill)
+			if err != nil {
+				log.Error(err)
+			} else {
+				kindJsonMap, _ := namespaceJsonMap[historicalWorkload.Kind].(map[string]interface{})
+				if kindJsonMap == nil {
+					kindJsonMap = make(map[string]interface{})
+					namespaceJsonMap[historicalWorkload.Kind] = kindJsonMap
+				}
+				kindJsonMap[historicalWorkload.Name] = workloadJsonMap
+			}
+		}
+		return namespaceJsonMap, nil
+	}
+}
+
+// GetHistoricalWorkloadMetrics returns the metrics aggregated with the metric aggregations.
+// The default aggregations are used if the metric aggregation slice is nil.
+// The missing values are filled with the fill policy and linear is used if it is empty.
+func GetHistoricalWorkloadMetrics(namespace string, workloadKind string,
+	workloadName string, aggregationAmount int, from time.Time,
+	to time.Time, metricAggregationSlice []MetricAggregation, fill string) (returnedJsonMap map[string]interface{}, returnedError error) {
+	if metricAggregationSlice == nil {
+		metricAggregationSlice = replicationControllerMetricAggregationSlice
+	}
+	containerRecordAggregation, err := searchHistoricalWorkloadMetrics(namespace,
+		workloadKind, workloadName, aggregationAmount, from, to, metricAggregationSlice)
+	if err != nil {
+		return nil, err
+	} else {
+		return convertContainerRecordAggregationToJsonMap(containerRecordAggregation, metricAggregationSlice, fill)
+	}
+}
+
+// convertContainerRecordAggregationToJsonMap returns the slices of the metrics by pod and container with the timestamp
+func convertContainerRecordAggregationToJsonMap(containerRecordAggregation *ContainerRecordAggregation,
+	metricAggregationSlice []MetricAggregation, fill string) (map[string]interface{}, error) {
+	workloadJsonMap, err := convertContainerRecordAggregationToWorkloadJsonMap(containerRecordAggregation, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add timestamp
+	workloadJsonMap["timestamp"] = containerRecordAggregation.TimestampSlice
+
+	return workloadJsonMap, nil
+}
+
+// convertContainerRecordAggregationToWorkloadJsonMap returns the slices of the metrics by pod and container.
+// The hole is filled with the fill policy and the rates derived from the counters are added.
+func convertContainerRecordAggregationToWorkloadJsonMap(containerRecordAggregation *ContainerRecordAggregation,
+	metricAggregationSlice []MetricAggregation, fill string) (map[string]interface{}, error) {
+	if fill == "" {
+		fill = FillLinear
+	}
+
+	workloadJsonMap := make(map[string]interface{})
+
+	timeBucketAmount := len(containerRecordAggregation.TimestampSlice)
+	for _, containerRecordBucket := range containerRecordAggregation.BucketSlice {
+		timeIndex := containerRecordBucket.TimeIndex
+		podName := containerRecordBucket.PodName
+		containerName := containerRecordBucket.ContainerName
+
+		podJsonMap, _ := workloadJsonMap[podName].(map[string]interface{})
+		if podJsonMap == nil {
+			podJsonMap = make(map[string]interface{})
+		}
+
+		containerJsonMap, _ := podJsonMap[containerName].(map[string]interface{})
+		if containerJsonMap == nil {
+			containerJsonMap = make(map[string]interface{})
+		}
+
+		appendToSliceInJsonMap(timeBucketAmount, timeIndex, containerJsonMap, "documentCountSlice", containerRecordBucket.DocumentCount)
+		for _, metricAggregation := range metricAggregationSlice {
+			// Use 0 if there is no data in the bucket
+			value := containerRecordBucket.ValueMap[metricAggregation.Name]
+			appendToSliceInJsonMap(timeBucketAmount, timeIndex, containerJsonMap, metricAggregation.Name+"Slice", int64(value))
+		}
+
+		podJsonMap[containerName] = containerJsonMap
+		workloadJsonMap[podName] = podJsonMap
+	}
+
+	// Fill the hole. There is no document in the bucket without data so the count is not filled but 0.
+	for podName, _ := range workloadJsonMap {
+		for containerName, _ := range workloadJsonMap[podName].(map[string]interface{}) {
+			containerJsonMap := workloadJsonMap[podName].(map[string]interface{})[containerName].(map[string]interface{})
+			fillTheNullData(containerJsonMap["documentCountSlice"].([]interface{}), FillZero, int64(0))
+			for _, metricAggregation := range metricAggregationSlice {
+				fillSliceInJsonMap(containerJsonMap, metricAggregation.Name+"Slice", fill, int64(0))
+			}
+		}
+	}
+
+	// Add the rates derived from the counters
+	if err := appendRateToWorkloadJsonMap(workloadJsonMap, containerRecordAggregation, fill); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return workloadJsonMap, nil
+}
+
+func searchHistoricalWorkloadMetrics(
+	namespace string, workloadKind string, workloadName string, aggregationAmount int,
+	from time.Time, to time.Time, metricAggregationSlice []MetricAggregation) (returnedContainerRecordAggregation *ContainerRecordAggregation, returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("searchHistoricalWorkloadMetrics Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedContainerRecordAggregation = nil
+			returnedError = err.(error)
+		}
+	}()
+
+	if from.After(to) {
+		return nil, errors.New("From " + from.String() + " can't be after to " + to.String())
+	}
+
+	duration := int(to.Sub(from).Seconds())
+	intervalInSecond := int(duration / aggregationAmount)
+
+	searchMetricAggregationSlice := make([]MetricAggregation, 0)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, metricAggregationSlice...)
+	searchMetricAggregationSlice = append(searchMetricAggregationSlice, getRateMetricAggregationSlice()...)
+
+	return searchContainerRecordAggregationWithRollup(namespace, getDocumentType(workloadKind, workloadName),
+		from, to, intervalInSecond, searchMetricAggregationSlice)
+}
@@ -0,0 +1,42 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"testing"
+)
+
+func TestGetWorkloadFromDocumentType(t *testing.T) {
+	documentType := getDocumentType(control.WorkloadKindStatefulSet, "Cassandra")
+	if documentType != "typestatefulset_cassandra" {
+		t.Errorf("Expect typestatefulset_cassandra but get %s", documentType)
+	}
+
+	workloadKind, workloadName, ok := getWorkloadFromDocumentType(documentType)
+	if ok == false || workloadKind != control.WorkloadKindStatefulSet || workloadName != "cassandra" {
+		t.Errorf("Expect StatefulSet cassandra but get %s %s", workloadKind, workloadName)
+	}
+
+	// The document type of the replication controller is the same as before
+	workloadKind, workloadName, ok = getWorkloadFromDocumentType("typereplicationcontroller_kube-dns-v6")
+	if ok == false || workloadKind != control.WorkloadKindReplicationController || workloadName != "kube-dns-v6" {
+		t.Errorf("Expect ReplicationController kube-dns-v6 but get %s %s", workloadKind, workloadName)
+	}
+
+	if NormalizeWorkloadKind("deployments") != control.WorkloadKindDeployment {
+		t.Errorf("Expect Deployment but get %s", NormalizeWorkloadKind("deployments"))
+	}
+}
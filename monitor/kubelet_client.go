@@ -0,0 +1,122 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kubeletSchemeDefault                  = "https"
+	kubeletPortDefault                    = 10250
+	kubeletServiceAccountTokenPathDefault = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	kubeletCertificateAuthorityDefault    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	kubeletRequestTimeout                 = 30 * time.Second
+)
+
+// KubeletClient authenticates to the kubelet with the client certificate if it is configured or
+// the service account token otherwise, and verifies the kubelet serving certificate with the CA bundle.
+type KubeletClient struct {
+	scheme     string
+	port       int
+	tokenPath  string
+	httpClient *http.Client
+}
+
+var kubeletClient *KubeletClient
+
+func init() {
+	var err error
+	kubeletClient, err = CreateKubeletClientWithConfiguration()
+	if err != nil {
+		log.Critical("Can't create the kubelet client with error %s", err)
+		panic(err)
+	}
+}
+
+func CreateKubeletClientWithConfiguration() (*KubeletClient, error) {
+	scheme, ok := configuration.LocalConfiguration.GetString("kubeletScheme")
+	if ok == false || scheme == "" {
+		scheme = kubeletSchemeDefault
+	}
+	port, ok := configuration.LocalConfiguration.GetInt("kubeletPort")
+	if ok == false || port <= 0 {
+		port = kubeletPortDefault
+	}
+	tokenPath, ok := configuration.LocalConfiguration.GetString("kubeletServiceAccountTokenPath")
+	if ok == false {
+		tokenPath = kubeletServiceAccountTokenPathDefault
+	}
+	certificateAuthorityPath, ok := configuration.LocalConfiguration.GetString("kubeletCertificateAuthority")
+	if ok == false {
+		certificateAuthorityPath = kubeletCertificateAuthorityDefault
+	}
+	if _, err := os.Stat(certificateAuthorityPath); certificateAuthorityPath != "" && err != nil {
+		log.Error("The kubelet CA bundle %s is not found so the system CA is used", certificateAuthorityPath)
+		certificateAuthorityPath = ""
+	}
+	clientCertificatePath, _ := configuration.LocalConfiguration.GetString("kubeletClientCertificate")
+	clientKeyPath, _ := configuration.LocalConfiguration.GetString("kubeletClientKey")
+	insecureSkipVerify, _ := configuration.LocalConfiguration.GetNative("kubeletInsecureSkipVerify").(bool)
+
+	tlsConfig, err := httpclient.CreateTLSConfig(certificateAuthorityPath, clientCertificatePath, clientKeyPath, insecureSkipVerify)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if clientCertificatePath != "" {
+		// The client certificate is used instead of the token
+		tokenPath = ""
+	}
+
+	return &KubeletClient{
+		scheme,
+		port,
+		tokenPath,
+		httpclient.CreateHTTPClient(tlsConfig, kubeletRequestTimeout),
+	}, nil
+}
+
+func (kubeletClient *KubeletClient) GetURL(kubeletHost string) string {
+	return kubeletClient.scheme + "://" + kubeletHost + ":" + strconv.Itoa(kubeletClient.port)
+}
+
+func (kubeletClient *KubeletClient) RequestGet(url string) (interface{}, error) {
+	return kubeletClient.RequestGetWithDeadline(url, time.Time{})
+}
+
+// RequestGetWithDeadline cancels the request at the deadline and the zero deadline means no limit
+func (kubeletClient *KubeletClient) RequestGetWithDeadline(url string, deadline time.Time) (interface{}, error) {
+	headerMap := make(map[string]string)
+	if kubeletClient.tokenPath != "" {
+		// Read every time since the projected token is rotated
+		byteSlice, err := ioutil.ReadFile(kubeletClient.tokenPath)
+		if err != nil {
+			log.Error("Fail to read the service account token %s with error %s", kubeletClient.tokenPath, err)
+			return nil, err
+		}
+		headerMap["Authorization"] = "Bearer " + strings.TrimSpace(string(byteSlice))
+	}
+
+	return httpclient.RequestGetWithDeadline(kubeletClient.httpClient, url, headerMap, deadline)
+}
@@ -0,0 +1,222 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// The metrics returned by default
+	MetricFamilyBasic      = "basic"
+	MetricFamilyMemory     = "memory"
+	MetricFamilyFilesystem = "filesystem"
+	MetricFamilyTCP        = "tcp"
+	MetricFamilyTaskStats  = "taskstats"
+	// The node status like the allocatable resources and conditions
+	MetricFamilyStatus = "status"
+	// All families
+	MetricFamilyAll = "all"
+)
+
+// The metric of the container record. The default aggregator is used if the aggregator is not selected.
+type Metric struct {
+	Name              string
+	Field             string
+	DefaultAggregator string
+	Family            string
+}
+
+// The filesystem is the slice of the devices so the value is aggregated over all devices like Elastic Search
+var metricSlice = append([]Metric{
+	Metric{"cpuUsageTotal", "stats.cpu.usage.total", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"memoryUsage", "stats.memory.usage", aggregatorAverage, MetricFamilyBasic},
+	Metric{"memoryWorkingSet", "stats.memory.working_set", aggregatorAverage, MetricFamilyBasic},
+	Metric{"diskioIoServiceBytesStatsTotal", "stats.diskio.io_service_bytes.stats.Total", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"diskioIoServicedStatsTotal", "stats.diskio.io_serviced.stats.Total", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"networkRxPackets", "stats.network.rx_packets", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"networkTxPackets", "stats.network.tx_packets", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"networkRxBytes", "stats.network.rx_bytes", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"networkTxBytes", "stats.network.tx_bytes", aggregatorMinimum, MetricFamilyBasic},
+	Metric{"memoryFailcnt", "stats.memory.failcnt", aggregatorMaximum, MetricFamilyMemory},
+	Metric{"memoryPgfault", "stats.memory.container_data.pgfault", aggregatorMinimum, MetricFamilyMemory},
+	Metric{"memoryPgmajfault", "stats.memory.container_data.pgmajfault", aggregatorMinimum, MetricFamilyMemory},
+	Metric{"memoryHierarchicalPgfault", "stats.memory.hierarchical_data.pgfault", aggregatorMinimum, MetricFamilyMemory},
+	Metric{"memoryHierarchicalPgmajfault", "stats.memory.hierarchical_data.pgmajfault", aggregatorMinimum, MetricFamilyMemory},
+	Metric{"filesystemUsage", "stats.filesystem.usage", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"filesystemCapacity", "stats.filesystem.capacity", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"filesystemAvailable", "stats.filesystem.available", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"filesystemReadsCompleted", "stats.filesystem.reads_completed", aggregatorMinimum, MetricFamilyFilesystem},
+	Metric{"filesystemWritesCompleted", "stats.filesystem.writes_completed", aggregatorMinimum, MetricFamilyFilesystem},
+	Metric{"filesystemIoInProgress", "stats.filesystem.io_in_progress", aggregatorAverage, MetricFamilyFilesystem},
+	Metric{"filesystemIoTime", "stats.filesystem.io_time", aggregatorMinimum, MetricFamilyFilesystem},
+	Metric{"taskStatsNrRunning", "stats.task_stats.nr_running", aggregatorAverage, MetricFamilyTaskStats},
+	Metric{"taskStatsNrSleeping", "stats.task_stats.nr_sleeping", aggregatorAverage, MetricFamilyTaskStats},
+	Metric{"taskStatsNrStopped", "stats.task_stats.nr_stopped", aggregatorAverage, MetricFamilyTaskStats},
+	Metric{"taskStatsNrUninterruptible", "stats.task_stats.nr_uninterruptible", aggregatorAverage, MetricFamilyTaskStats},
+	Metric{"taskStatsNrIoWait", "stats.task_stats.nr_io_wait", aggregatorAverage, MetricFamilyTaskStats},
+}, getTCPMetricSlice()...)
+
+// The TCP states of cAdvisor
+var tcpStateSlice = []string{
+	"Established",
+	"SynSent",
+	"SynRecv",
+	"FinWait1",
+	"FinWait2",
+	"TimeWait",
+	"Close",
+	"CloseWait",
+	"LastAck",
+	"Listen",
+	"Closing",
+}
+
+// The connection amount of each state like networkTcpEstablished and networkTcp6Established
+func getTCPMetricSlice() []Metric {
+	tcpMetricSlice := make([]Metric, 0)
+	for _, tcp := range []string{"tcp", "tcp6"} {
+		for _, tcpState := range tcpStateSlice {
+			tcpMetricSlice = append(tcpMetricSlice,
+				Metric{"network" + strings.Title(tcp) + tcpState, "stats.network." + tcp + "." + tcpState, aggregatorAverage, MetricFamilyTCP})
+		}
+	}
+	return tcpMetricSlice
+}
+
+// The aggregator -> the prefix of the metric aggregation name like minimumCpuUsageTotal
+var aggregatorNamePrefixMap = map[string]string{
+	aggregatorMinimum:      "minimum",
+	aggregatorMaximum:      "maximum",
+	aggregatorAverage:      "average",
+	aggregatorSum:          "sum",
+	aggregatorLast:         "last",
+	aggregatorPercentile50: "percentile50",
+	aggregatorPercentile90: "percentile90",
+	aggregatorPercentile95: "percentile95",
+	aggregatorPercentile99: "percentile99",
+}
+
+func getDefaultMetricAggregationSlice() []MetricAggregation {
+	metricAggregationSlice := make([]MetricAggregation, 0)
+	for _, metric := range metricSlice {
+		if metric.Family == MetricFamilyBasic {
+			metricAggregationSlice = append(metricAggregationSlice, createMetricAggregation(metric, metric.DefaultAggregator))
+		}
+	}
+	return metricAggregationSlice
+}
+
+func createMetricAggregation(metric Metric, aggregator string) MetricAggregation {
+	return MetricAggregation{
+		aggregatorNamePrefixMap[aggregator] + strings.ToUpper(metric.Name[:1]) + metric.Name[1:],
+		aggregator,
+		metric.Field,
+	}
+}
+
+// ParseMetricAggregation returns the metric aggregations of the selected families and aggregators.
+// Each family text has the comma separated families like basic,memory. The basic family is used if none is selected.
+// Each aggregator text has the comma separated metric name and aggregator pairs like memoryUsage:max,memoryUsage:p95.
+// A metric could have more than one aggregator. The metric not selected uses the default aggregator.
+// The metric with the selected aggregator is returned even if its family is not selected.
+func ParseMetricAggregation(familyTextSlice []string, aggregatorTextSlice []string) ([]MetricAggregation, error) {
+	return parseMetricAggregation(metricSlice, []string{MetricFamilyBasic}, familyTextSlice, aggregatorTextSlice)
+}
+
+func parseMetricAggregation(metricSlice []Metric, defaultFamilySlice []string,
+	familyTextSlice []string, aggregatorTextSlice []string) ([]MetricAggregation, error) {
+	// The families of the metrics
+	availableFamilyMap := make(map[string]bool)
+	for _, metric := range metricSlice {
+		availableFamilyMap[metric.Family] = true
+	}
+
+	familyMap := make(map[string]bool)
+	for _, text := range familyTextSlice {
+		for _, family := range strings.Split(text, ",") {
+			family = strings.ToLower(strings.TrimSpace(family))
+			if family == "" {
+				continue
+			}
+			if family == MetricFamilyAll {
+				for availableFamily, _ := range availableFamilyMap {
+					familyMap[availableFamily] = true
+				}
+			} else if availableFamilyMap[family] {
+				familyMap[family] = true
+			} else {
+				return nil, errors.New("Unknown metric family " + family)
+			}
+		}
+	}
+	if len(familyMap) == 0 {
+		for _, family := range defaultFamilySlice {
+			familyMap[family] = true
+		}
+	}
+
+	// metric name -> aggregators
+	aggregatorMap := make(map[string][]string)
+	for _, text := range aggregatorTextSlice {
+		for _, pair := range strings.Split(text, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			fieldSlice := strings.Split(pair, ":")
+			if len(fieldSlice) != 2 {
+				return nil, errors.New("The metric aggregation " + pair + " is not in the format metric:aggregator")
+			}
+			metricName := fieldSlice[0]
+			aggregator := strings.ToLower(fieldSlice[1])
+			if _, ok := aggregatorNamePrefixMap[aggregator]; ok == false {
+				return nil, errors.New("Unknown aggregator " + fieldSlice[1] + " of metric " + metricName)
+			}
+			found := false
+			for _, metric := range metricSlice {
+				if metric.Name == metricName {
+					found = true
+					break
+				}
+			}
+			if found == false {
+				return nil, errors.New("Unknown metric " + metricName)
+			}
+			aggregatorMap[metricName] = append(aggregatorMap[metricName], aggregator)
+		}
+	}
+
+	metricAggregationSlice := make([]MetricAggregation, 0)
+	for _, metric := range metricSlice {
+		aggregatorSlice, ok := aggregatorMap[metric.Name]
+		if ok == false {
+			if familyMap[metric.Family] == false {
+				continue
+			}
+			aggregatorSlice = []string{metric.DefaultAggregator}
+		}
+		nameMap := make(map[string]bool)
+		for _, aggregator := range aggregatorSlice {
+			metricAggregation := createMetricAggregation(metric, aggregator)
+			if nameMap[metricAggregation.Name] == false {
+				nameMap[metricAggregation.Name] = true
+				metricAggregationSlice = append(metricAggregationSlice, metricAggregation)
+			}
+		}
+	}
+	return metricAggregationSlice, nil
+}
@@ -0,0 +1,377 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MetricScopeContainer = "container"
+	MetricScopePod       = "pod"
+	MetricScopeWorkload  = "workload"
+	MetricScopeNamespace = "namespace"
+	MetricScopeCluster   = "cluster"
+	MetricScopeNode      = "node"
+
+	// The aggregator of the rate derived from the counter and of the document count
+	metricSeriesAggregatorRate  = "rate"
+	metricSeriesAggregatorCount = "count"
+)
+
+// MetricSeriesResult is the typed metrics response of API v2
+type MetricSeriesResult struct {
+	From             time.Time
+	To               time.Time
+	IntervalInSecond int
+	Fill             string
+	SeriesSlice      []MetricSeries
+}
+
+// MetricSeries is the values of one metric with one aggregator of one container, pod, workload, namespace, cluster or node
+type MetricSeries struct {
+	Name       string
+	Aggregator string
+	Unit       string
+	Labels     MetricLabels
+	PointSlice []MetricPoint
+}
+
+// MetricLabels tells what the series belongs to. The label not applied to the scope is empty.
+type MetricLabels struct {
+	Scope        string
+	Namespace    string
+	WorkloadKind string
+	WorkloadName string
+	Pod          string
+	Container    string
+	Node         string
+}
+
+// MetricPoint is the value of the time bucket starting at the timestamp. The value is null if there is no data.
+type MetricPoint struct {
+	Timestamp    time.Time
+	Value        *float64
+	Interpolated bool
+}
+
+// The metric name -> unit. The metric not listed is in count.
+var metricUnitMap = map[string]string{
+	"cpuUsageTotal":               "nanoseconds",
+	"cpuUsageCores":               "cores",
+	"capacityCpuMilliCores":       "millicores",
+	"allocatableCpuMilliCores":    "millicores",
+	"memoryUsage":                 "bytes",
+	"memoryWorkingSet":            "bytes",
+	"memoryAvailable":             "bytes",
+	"capacityMemory":              "bytes",
+	"allocatableMemory":           "bytes",
+	"allocatableEphemeralStorage": "bytes",
+	"filesystemUsage":             "bytes",
+	"filesystemCapacity":          "bytes",
+	"filesystemAvailable":         "bytes",
+	"imageFilesystemUsage":        "bytes",
+	"imageFilesystemCapacity":     "bytes",
+	"imageFilesystemAvailable":    "bytes",
+	"filesystemIoTime":            "milliseconds",
+	"unschedulable":               "boolean",
+}
+
+func getMetricUnit(name string) string {
+	if unit, ok := metricUnitMap[name]; ok {
+		return unit
+	}
+	switch {
+	case strings.HasSuffix(name, "BytesPerSecond"):
+		return "bytes/second"
+	case strings.HasSuffix(name, "PerSecond"):
+		return "count/second"
+	case strings.Contains(name, "Bytes"):
+		return "bytes"
+	case strings.HasPrefix(name, "condition"):
+		return "boolean"
+	default:
+		return "count"
+	}
+}
+
+// getMetricNameAndAggregator returns the metric name and the aggregator of the slice name like minimumCpuUsageTotalSlice
+func getMetricNameAndAggregator(sliceName string) (string, string) {
+	name := strings.TrimSuffix(sliceName, "Slice")
+	for aggregator, prefix := range aggregatorNamePrefixMap {
+		metricName := strings.TrimPrefix(name, prefix)
+		// The metric name follows the prefix in upper camel case
+		if len(metricName) < len(name) && metricName != "" && strings.ToUpper(metricName[:1]) == metricName[:1] {
+			return strings.ToLower(metricName[:1]) + metricName[1:], aggregator
+		}
+	}
+	for _, rateMetric := range rateMetricSlice {
+		if rateMetric.Name == name {
+			return name, metricSeriesAggregatorRate
+		}
+	}
+	for _, metricAggregation := range summedMetricAggregationSlice {
+		if metricAggregation.Name == name {
+			return name, metricAggregation.Aggregator
+		}
+	}
+	return name, metricSeriesAggregatorCount
+}
+
+func createMetricSeriesResult(from time.Time, to time.Time, aggregationAmount int, fill string) *MetricSeriesResult {
+	if fill == "" {
+		fill = FillLinear
+	}
+	metricSeriesResult := &MetricSeriesResult{}
+	metricSeriesResult.From = from
+	metricSeriesResult.To = to
+	metricSeriesResult.IntervalInSecond = int(to.Sub(from).Seconds()) / aggregationAmount
+	metricSeriesResult.Fill = fill
+	metricSeriesResult.SeriesSlice = make([]MetricSeries, 0)
+	return metricSeriesResult
+}
+
+// appendMetricSeries converts each slice in the json map to the series with the labels.
+// The series are sorted by name so the order is stable.
+func (metricSeriesResult *MetricSeriesResult) appendMetricSeries(labels MetricLabels,
+	jsonMap map[string]interface{}, timestampSlice []string) error {
+	pointTimestampSlice := make([]time.Time, len(timestampSlice))
+	for i, timestampText := range timestampSlice {
+		timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		pointTimestampSlice[i] = timestamp
+	}
+
+	interpolatedJsonMap, _ := jsonMap[interpolatedName].(map[string]interface{})
+	sliceNameSlice := make([]string, 0)
+	for sliceName, _ := range jsonMap {
+		if sliceName != interpolatedName {
+			sliceNameSlice = append(sliceNameSlice, sliceName)
+		}
+	}
+	sort.Strings(sliceNameSlice)
+
+	for _, sliceName := range sliceNameSlice {
+		dataSlice, ok := jsonMap[sliceName].([]interface{})
+		if ok == false {
+			continue
+		}
+		filledSlice, _ := interpolatedJsonMap[sliceName].([]bool)
+
+		metricSeries := MetricSeries{}
+		metricSeries.Name, metricSeries.Aggregator = getMetricNameAndAggregator(sliceName)
+		metricSeries.Unit = getMetricUnit(metricSeries.Name)
+		metricSeries.Labels = labels
+		metricSeries.PointSlice = make([]MetricPoint, 0)
+		for i, data := range dataSlice {
+			if i >= len(pointTimestampSlice) {
+				break
+			}
+			metricPoint := MetricPoint{}
+			metricPoint.Timestamp = pointTimestampSlice[i]
+			if data != nil {
+				value := convertToFloat64(data)
+				metricPoint.Value = &value
+			}
+			metricPoint.Interpolated = filledSlice != nil && filledSlice[i]
+			metricSeries.PointSlice = append(metricSeries.PointSlice, metricPoint)
+		}
+		metricSeriesResult.SeriesSlice = append(metricSeriesResult.SeriesSlice, metricSeries)
+	}
+	return nil
+}
+
+// appendPodMetricSeries appends the series of each container and the pod total
+func (metricSeriesResult *MetricSeriesResult) appendPodMetricSeries(labels MetricLabels,
+	podJsonMap map[string]interface{}, timestampSlice []string) error {
+	for _, containerName := range getSortedKeySlice(podJsonMap) {
+		containerLabels := labels
+		if containerName == podTotalName {
+			containerLabels.Scope = MetricScopePod
+		} else {
+			containerLabels.Scope = MetricScopeContainer
+			containerLabels.Container = containerName
+		}
+		if err := metricSeriesResult.appendMetricSeries(containerLabels,
+			podJsonMap[containerName].(map[string]interface{}), timestampSlice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getSortedKeySlice(jsonMap map[string]interface{}) []string {
+	keySlice := make([]string, 0)
+	for key, _ := range jsonMap {
+		keySlice = append(keySlice, key)
+	}
+	sort.Strings(keySlice)
+	return keySlice
+}
+
+// GetWorkloadMetricSeries returns the series of each container, pod and the workload
+func GetWorkloadMetricSeries(namespace string, workloadKind string, workloadName string, aggregationAmount int,
+	from time.Time, to time.Time, metricAggregationSlice []MetricAggregation, fill string) (*MetricSeriesResult, error) {
+	if metricAggregationSlice == nil {
+		metricAggregationSlice = replicationControllerMetricAggregationSlice
+	}
+	containerRecordAggregation, err := searchHistoricalWorkloadMetrics(namespace,
+		workloadKind, workloadName, aggregationAmount, from, to, metricAggregationSlice)
+	if err != nil {
+		return nil, err
+	}
+	workloadJsonMap, err := convertContainerRecordAggregationToWorkloadJsonMap(containerRecordAggregation, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	metricSeriesResult := createMetricSeriesResult(from, to, aggregationAmount, fill)
+	labels := MetricLabels{}
+	labels.Namespace = namespace
+	labels.WorkloadKind = workloadKind
+	labels.WorkloadName = workloadName
+	for _, podName := range getSortedKeySlice(workloadJsonMap) {
+		podLabels := labels
+		if podName == workloadTotalName {
+			podLabels.Scope = MetricScopeWorkload
+			err = metricSeriesResult.appendMetricSeries(podLabels,
+				workloadJsonMap[podName].(map[string]interface{}), containerRecordAggregation.TimestampSlice)
+		} else {
+			podLabels.Pod = podName
+			err = metricSeriesResult.appendPodMetricSeries(podLabels,
+				workloadJsonMap[podName].(map[string]interface{}), containerRecordAggregation.TimestampSlice)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return metricSeriesResult, nil
+}
+
+// GetPodMetricSeries returns the series of each container and the pod, or only those of the container
+// if the container name is not empty. The pod could be the one no longer existing.
+func GetPodMetricSeries(namespace string, podName string, containerName string, aggregationAmount int,
+	from time.Time, to time.Time, metricAggregationSlice []MetricAggregation, fill string) (*MetricSeriesResult, error) {
+	podJsonMap, timestampSlice, err := getHistoricalPodJsonMap(namespace, podName, containerName,
+		aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	metricSeriesResult := createMetricSeriesResult(from, to, aggregationAmount, fill)
+	labels := MetricLabels{}
+	labels.Namespace = namespace
+	labels.Pod = podName
+	if containerName != "" {
+		containerJsonMap, ok := podJsonMap[containerName].(map[string]interface{})
+		if ok == false {
+			return nil, errors.New("No record of the container " + containerName + " in the pod " + podName)
+		}
+		labels.Scope = MetricScopeContainer
+		labels.Container = containerName
+		err = metricSeriesResult.appendMetricSeries(labels, containerJsonMap, timestampSlice)
+	} else {
+		err = metricSeriesResult.appendPodMetricSeries(labels, podJsonMap, timestampSlice)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return metricSeriesResult, nil
+}
+
+// GetNodeMetricSeries returns the series of the node, or of all nodes if the node name is empty
+func GetNodeMetricSeries(nodeName string, aggregationAmount int, from time.Time, to time.Time,
+	metricAggregationSlice []MetricAggregation, fill string) (*MetricSeriesResult, error) {
+	documentType := ""
+	if nodeName != "" {
+		documentType = getNodeDocumentType(nodeName)
+	}
+	allNodeJsonMap, timestampSlice, err := getHistoricalNodeJsonMap(documentType, aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	metricSeriesResult := createMetricSeriesResult(from, to, aggregationAmount, fill)
+	for _, name := range getSortedKeySlice(allNodeJsonMap) {
+		labels := MetricLabels{}
+		labels.Scope = MetricScopeNode
+		labels.Node = name
+		if err := metricSeriesResult.appendMetricSeries(labels,
+			allNodeJsonMap[name].(map[string]interface{}), timestampSlice); err != nil {
+			return nil, err
+		}
+	}
+	return metricSeriesResult, nil
+}
+
+// GetNamespaceMetricSeries returns the series summed up over all containers in the namespace
+func GetNamespaceMetricSeries(namespace string, aggregationAmount int,
+	from time.Time, to time.Time, fill string) (*MetricSeriesResult, error) {
+	containerRecordAggregation, err := searchHistoricalNamespaceMetrics(namespace, aggregationAmount, from, to)
+	if err != nil {
+		return nil, err
+	}
+	namespaceJsonMap, err := convertContainerRecordAggregationToTotalJsonMap(containerRecordAggregation, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	metricSeriesResult := createMetricSeriesResult(from, to, aggregationAmount, fill)
+	if namespaceTotalJsonMap, ok := namespaceJsonMap[namespace].(map[string]interface{}); ok {
+		labels := MetricLabels{}
+		labels.Scope = MetricScopeNamespace
+		labels.Namespace = namespace
+		if err := metricSeriesResult.appendMetricSeries(labels, namespaceTotalJsonMap, containerRecordAggregation.TimestampSlice); err != nil {
+			return nil, err
+		}
+	}
+	return metricSeriesResult, nil
+}
+
+// GetClusterMetricSeries returns the series summed up over all containers in the cluster and in each namespace
+func GetClusterMetricSeries(aggregationAmount int, from time.Time, to time.Time, fill string) (*MetricSeriesResult, error) {
+	containerRecordAggregation, err := searchHistoricalNamespaceMetrics("*", aggregationAmount, from, to)
+	if err != nil {
+		return nil, err
+	}
+	namespaceJsonMap, err := convertContainerRecordAggregationToTotalJsonMap(containerRecordAggregation, fill)
+	if err != nil {
+		return nil, err
+	}
+
+	metricSeriesResult := createMetricSeriesResult(from, to, aggregationAmount, fill)
+	labels := MetricLabels{}
+	labels.Scope = MetricScopeCluster
+	clusterTotalJsonMap := sumClusterTotalJsonMap(namespaceJsonMap, len(containerRecordAggregation.TimestampSlice))
+	if err := metricSeriesResult.appendMetricSeries(labels, clusterTotalJsonMap, containerRecordAggregation.TimestampSlice); err != nil {
+		return nil, err
+	}
+	for _, namespace := range getSortedKeySlice(namespaceJsonMap) {
+		labels := MetricLabels{}
+		labels.Scope = MetricScopeNamespace
+		labels.Namespace = namespace
+		if err := metricSeriesResult.appendMetricSeries(labels,
+			namespaceJsonMap[namespace].(map[string]interface{}), containerRecordAggregation.TimestampSlice); err != nil {
+			return nil, err
+		}
+	}
+	return metricSeriesResult, nil
+}
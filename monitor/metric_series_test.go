@@ -0,0 +1,106 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func TestGetWorkloadMetricSeries(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	// The pod named timestamp doesn't conflict with anything
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	documentType := getDocumentType(control.WorkloadKindStatefulSet, "timestamp")
+	for i := 0; i < 3; i++ {
+		// The bucket 1 has no data
+		if i == 1 {
+			continue
+		}
+		timestamp := from.Add(time.Duration(i*10) * time.Second)
+		storage.SaveContainerRecord(getDocumentIndex("default"), documentType, getDocumentID("timestamp", "app", timestamp),
+			createTestContainerRecord("timestamp", "app", timestamp, int64(i*10*1000000000)))
+	}
+
+	metricSeriesResult, err := GetWorkloadMetricSeries("default", control.WorkloadKindStatefulSet, "timestamp",
+		3, from, from.Add(30*time.Second), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metricSeriesResult.IntervalInSecond != 10 || metricSeriesResult.Fill != FillLinear {
+		t.Errorf("Unexpected interval %d or fill %s", metricSeriesResult.IntervalInSecond, metricSeriesResult.Fill)
+	}
+
+	found := false
+	for _, metricSeries := range metricSeriesResult.SeriesSlice {
+		if metricSeries.Name == "cpuUsageTotal" && metricSeries.Labels.Scope == MetricScopeContainer {
+			found = true
+			if metricSeries.Aggregator != aggregatorMinimum || metricSeries.Unit != "nanoseconds" {
+				t.Errorf("Unexpected aggregator %s or unit %s", metricSeries.Aggregator, metricSeries.Unit)
+			}
+			if metricSeries.Labels.Pod != "timestamp" || metricSeries.Labels.Container != "app" || metricSeries.Labels.WorkloadName != "timestamp" {
+				t.Errorf("Unexpected labels %v", metricSeries.Labels)
+			}
+			if len(metricSeries.PointSlice) != 3 {
+				t.Fatalf("Expect 3 points but get %v", metricSeries.PointSlice)
+			}
+			point := metricSeries.PointSlice[1]
+			if point.Timestamp.Equal(from.Add(10*time.Second)) == false || point.Value == nil || *point.Value != 10000000000 || point.Interpolated == false {
+				t.Errorf("Expect the interpolated point but get %v", point)
+			}
+			if metricSeries.PointSlice[0].Interpolated {
+				t.Errorf("Expect the real point but get %v", metricSeries.PointSlice[0])
+			}
+		}
+		if metricSeries.Name == "cpuUsageCores" && metricSeries.Labels.Scope == MetricScopeWorkload {
+			if metricSeries.Aggregator != metricSeriesAggregatorRate || metricSeries.Unit != "cores" {
+				t.Errorf("Unexpected aggregator %s or unit %s", metricSeries.Aggregator, metricSeries.Unit)
+			}
+			// The first bucket has no rate
+			if metricSeries.PointSlice[0].Value != nil || *metricSeries.PointSlice[2].Value != 1 {
+				t.Errorf("Unexpected rate %v", metricSeries.PointSlice)
+			}
+		}
+	}
+	if found == false {
+		t.Errorf("Expect the series of the container but get %v", metricSeriesResult.SeriesSlice)
+	}
+}
+
+func TestGetMetricNameAndAggregator(t *testing.T) {
+	for _, testCase := range []struct {
+		SliceName  string
+		Name       string
+		Aggregator string
+	}{
+		{"percentile95MemoryUsageSlice", "memoryUsage", aggregatorPercentile95},
+		{"lastCpuUsageTotalSlice", "cpuUsageTotal", aggregatorLast},
+		{"networkRxBytesPerSecondSlice", "networkRxBytesPerSecond", metricSeriesAggregatorRate},
+		{"memoryUsageSlice", "memoryUsage", aggregatorAverage},
+		{"documentCountSlice", "documentCount", metricSeriesAggregatorCount},
+	} {
+		name, aggregator := getMetricNameAndAggregator(testCase.SliceName)
+		if name != testCase.Name || aggregator != testCase.Aggregator {
+			t.Errorf("Expect %s %s but get %s %s", testCase.Name, testCase.Aggregator, name, aggregator)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/stream"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The records are collected in the interval so the stream looks back long enough to find the latest one
+const metricStreamLookbackInSecondDefault = 180
+
+// MetricStreamPoint is the basic metrics and the rates of one container record newly collected
+type MetricStreamPoint struct {
+	Timestamp time.Time
+	Labels    MetricLabels
+	ValueMap  map[string]float64
+}
+
+type metricStreamLast struct {
+	timestamp  time.Time
+	counterMap map[string]float64
+}
+
+// metricStreamSource polls the records of the workload in the lookback with the bucket of one second so
+// each record has its own bucket. The records not newer than the last one of the container are skipped.
+type metricStreamSource struct {
+	namespace    string
+	workloadKind string
+	workloadName string
+	lock         sync.Mutex
+	// pod name/container name -> the last record
+	lastMap map[string]metricStreamLast
+}
+
+var metricStreamLock = sync.Mutex{}
+
+// index/document type -> tail shared by the subscribers of the same workload
+var metricStreamTailMap = make(map[string]*stream.Tail)
+
+func getMetricStreamLookback() time.Duration {
+	lookbackInSecond, ok := configuration.LocalConfiguration.GetInt("streamMetricsLookbackInSecond")
+	if ok == false || lookbackInSecond <= 0 {
+		lookbackInSecond = metricStreamLookbackInSecondDefault
+	}
+	return time.Duration(lookbackInSecond) * time.Second
+}
+
+func getMetricStreamKey(namespace string, workloadKind string, workloadName string) string {
+	return getDocumentIndex(namespace) + "/" + getDocumentType(workloadKind, workloadName)
+}
+
+// SubscribeWorkloadMetricStream receives the MetricStreamPoint of each container record of the workload newly collected
+func SubscribeWorkloadMetricStream(namespace string, workloadKind string, workloadName string) *stream.Subscriber {
+	metricStreamLock.Lock()
+	defer metricStreamLock.Unlock()
+
+	key := getMetricStreamKey(namespace, workloadKind, workloadName)
+	tail, ok := metricStreamTailMap[key]
+	if ok == false {
+		source := &metricStreamSource{
+			namespace:    namespace,
+			workloadKind: workloadKind,
+			workloadName: workloadName,
+			lastMap:      make(map[string]metricStreamLast),
+		}
+		tail = stream.CreateTail(source.poll, stream.GetPollInterval())
+		metricStreamTailMap[key] = tail
+	}
+	return tail.Subscribe(stream.DefaultBufferSize)
+}
+
+// UnsubscribeWorkloadMetricStream removes the tail of the workload after the last subscriber leaves
+func UnsubscribeWorkloadMetricStream(namespace string, workloadKind string, workloadName string, subscriber *stream.Subscriber) {
+	metricStreamLock.Lock()
+	defer metricStreamLock.Unlock()
+
+	key := getMetricStreamKey(namespace, workloadKind, workloadName)
+	tail, ok := metricStreamTailMap[key]
+	if ok == false {
+		return
+	}
+	if tail.Unsubscribe(subscriber) == 0 {
+		delete(metricStreamTailMap, key)
+	}
+}
+
+// The last value of each basic metric is the value of the record since each bucket has one record
+func getMetricStreamAggregationSlice() []MetricAggregation {
+	metricAggregationSlice := make([]MetricAggregation, 0)
+	for _, metric := range metricSlice {
+		if metric.Family == MetricFamilyBasic {
+			metricAggregationSlice = append(metricAggregationSlice, MetricAggregation{metric.Name, aggregatorLast, metric.Field})
+		}
+	}
+	return append(metricAggregationSlice, getRateMetricAggregationSlice()...)
+}
+
+func (source *metricStreamSource) poll(initial bool) ([]interface{}, error) {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+
+	to := time.Now()
+	from := to.Add(-getMetricStreamLookback())
+	if initial {
+		source.lastMap = make(map[string]metricStreamLast)
+	}
+
+	containerRecordAggregation, err := storage.SearchContainerRecordAggregation(getDocumentIndex(source.namespace),
+		getDocumentType(source.workloadKind, source.workloadName), from, to, 1, getMetricStreamAggregationSlice())
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	timestampSlice := make([]time.Time, len(containerRecordAggregation.TimestampSlice))
+	for i, timestampText := range containerRecordAggregation.TimestampSlice {
+		timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		timestampSlice[i] = timestamp
+	}
+
+	containerRecordBucketSlice := containerRecordAggregation.BucketSlice
+	sort.SliceStable(containerRecordBucketSlice, func(i int, j int) bool {
+		return containerRecordBucketSlice[i].TimeIndex < containerRecordBucketSlice[j].TimeIndex
+	})
+
+	pointSlice := make([]interface{}, 0)
+	for _, containerRecordBucket := range containerRecordBucketSlice {
+		if containerRecordBucket.TimeIndex >= len(timestampSlice) {
+			continue
+		}
+		timestamp := timestampSlice[containerRecordBucket.TimeIndex]
+		key := containerRecordBucket.PodName + "/" + containerRecordBucket.ContainerName
+		last, hasLast := source.lastMap[key]
+		if hasLast && timestamp.After(last.timestamp) == false {
+			continue
+		}
+
+		point := MetricStreamPoint{
+			timestamp,
+			MetricLabels{
+				Scope:        MetricScopeContainer,
+				Namespace:    source.namespace,
+				WorkloadKind: source.workloadKind,
+				WorkloadName: source.workloadName,
+				Pod:          containerRecordBucket.PodName,
+				Container:    containerRecordBucket.ContainerName,
+			},
+			make(map[string]float64),
+		}
+		counterMap := make(map[string]float64)
+		for name, value := range containerRecordBucket.ValueMap {
+			point.ValueMap[name] = value
+		}
+		for _, rateMetric := range rateMetricSlice {
+			counter, ok := containerRecordBucket.ValueMap[rateMetric.Name+rateCounterSuffix]
+			if ok == false {
+				continue
+			}
+			delete(point.ValueMap, rateMetric.Name+rateCounterSuffix)
+			counterMap[rateMetric.Name] = counter
+			previousCounter, ok := last.counterMap[rateMetric.Name]
+			second := timestamp.Sub(last.timestamp).Seconds()
+			// The counter decreases when it is reset
+			if hasLast && ok && second > 0 && counter >= previousCounter {
+				point.ValueMap[rateMetric.Name] = (counter - previousCounter) / second * rateMetric.Scale
+			}
+		}
+		source.lastMap[key] = metricStreamLast{timestamp, counterMap}
+
+		// The initial poll only remembers the latest records to calculate the rates
+		if initial == false {
+			pointSlice = append(pointSlice, point)
+		}
+	}
+
+	// The containers gone have no record in the lookback
+	for key, last := range source.lastMap {
+		if last.timestamp.Before(from) {
+			delete(source.lastMap, key)
+		}
+	}
+
+	return pointSlice, nil
+}
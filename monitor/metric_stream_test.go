@@ -0,0 +1,90 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func TestMetricStreamSourcePoll(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	documentType := getDocumentType(control.WorkloadKindDeployment, "nginx")
+	saveContainerRecord := func(timestamp time.Time, cpuUsageTotal int64) {
+		storage.SaveContainerRecord(getDocumentIndex("default"), documentType,
+			getDocumentID("nginx-1", "nginx", timestamp), createTestContainerRecord("nginx-1", "nginx", timestamp, cpuUsageTotal))
+	}
+
+	source := &metricStreamSource{
+		namespace:    "default",
+		workloadKind: control.WorkloadKindDeployment,
+		workloadName: "nginx",
+		lastMap:      make(map[string]metricStreamLast),
+	}
+
+	now := time.Now().Truncate(time.Second)
+	saveContainerRecord(now.Add(-20*time.Second), 1000000000)
+
+	// The initial poll only remembers the existing record
+	pointSlice, err := source.poll(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pointSlice) != 0 {
+		t.Errorf("Expect no point from the initial poll but get %v", pointSlice)
+	}
+
+	// Half core since the last record
+	saveContainerRecord(now.Add(-10*time.Second), 6000000000)
+	pointSlice, err = source.poll(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pointSlice) != 1 {
+		t.Fatalf("Expect 1 point but get %v", pointSlice)
+	}
+	point := pointSlice[0].(MetricStreamPoint)
+	if point.Timestamp.Equal(now.Add(-10*time.Second)) == false {
+		t.Errorf("Expect the timestamp %v but get %v", now.Add(-10*time.Second), point.Timestamp)
+	}
+	if point.Labels.Pod != "nginx-1" || point.Labels.Container != "nginx" || point.Labels.Scope != MetricScopeContainer {
+		t.Errorf("Unexpected labels %v", point.Labels)
+	}
+	if value := point.ValueMap["cpuUsageTotal"]; value != 6000000000 {
+		t.Errorf("Expect cpuUsageTotal 6000000000 but get %v", value)
+	}
+	if value := point.ValueMap["cpuUsageCores"]; value != 0.5 {
+		t.Errorf("Expect cpuUsageCores 0.5 but get %v", value)
+	}
+	if _, ok := point.ValueMap["cpuUsageCores"+rateCounterSuffix]; ok {
+		t.Error("Expect no counter in the values")
+	}
+
+	// Nothing new
+	pointSlice, err = source.poll(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pointSlice) != 0 {
+		t.Errorf("Expect no point but get %v", pointSlice)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"testing"
+)
+
+func TestParseMetricAggregation(t *testing.T) {
+	metricAggregationSlice, err := ParseMetricAggregation(nil, nil)
+	if err != nil || len(metricAggregationSlice) != len(replicationControllerMetricAggregationSlice) {
+		t.Fatalf("Expect the default aggregations but get %v %v", metricAggregationSlice, err)
+	}
+	for i, metricAggregation := range metricAggregationSlice {
+		if metricAggregation != replicationControllerMetricAggregationSlice[i] {
+			t.Errorf("Expect %v but get %v", replicationControllerMetricAggregationSlice[i], metricAggregation)
+		}
+	}
+
+	metricAggregationSlice, err = ParseMetricAggregation(nil, []string{"memoryUsage:max,memoryUsage:P95", "cpuUsageTotal:last"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nameMap := make(map[string]string)
+	for _, metricAggregation := range metricAggregationSlice {
+		nameMap[metricAggregation.Name] = metricAggregation.Aggregator
+	}
+	if nameMap["maximumMemoryUsage"] != aggregatorMaximum || nameMap["percentile95MemoryUsage"] != aggregatorPercentile95 ||
+		nameMap["lastCpuUsageTotal"] != aggregatorLast || nameMap["minimumNetworkRxBytes"] != aggregatorMinimum {
+		t.Errorf("Unexpected aggregations %v", nameMap)
+	}
+	if _, ok := nameMap["averageMemoryUsage"]; ok {
+		t.Errorf("The default aggregation of the selected metric is not expected %v", nameMap)
+	}
+
+	for _, text := range []string{"memoryUsage:median", "memory:max", "memoryUsage"} {
+		if _, err := ParseMetricAggregation(nil, []string{text}); err == nil {
+			t.Errorf("Expect error for %s", text)
+		}
+	}
+}
+
+func TestParseMetricAggregationFamily(t *testing.T) {
+	metricAggregationSlice, err := ParseMetricAggregation([]string{"tcp,TaskStats"}, []string{"filesystemUsage:max"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nameMap := make(map[string]string)
+	for _, metricAggregation := range metricAggregationSlice {
+		nameMap[metricAggregation.Name] = metricAggregation.Field
+	}
+	if nameMap["averageNetworkTcp6TimeWait"] != "stats.network.tcp6.TimeWait" || nameMap["averageTaskStatsNrRunning"] != "stats.task_stats.nr_running" {
+		t.Errorf("Expect the selected families but get %v", nameMap)
+	}
+	// The metric with the selected aggregator is returned without its family
+	if nameMap["maximumFilesystemUsage"] != "stats.filesystem.usage" || len(nameMap) != 2*len(tcpStateSlice)+5+1 {
+		t.Errorf("Unexpected metrics %v", nameMap)
+	}
+	if _, ok := nameMap["averageMemoryUsage"]; ok {
+		t.Errorf("The basic family is not expected %v", nameMap)
+	}
+
+	metricAggregationSlice, err = ParseMetricAggregation([]string{"all"}, nil)
+	if err != nil || len(metricAggregationSlice) != len(metricSlice) {
+		t.Errorf("Expect all %d metrics but get %d %v", len(metricSlice), len(metricAggregationSlice), err)
+	}
+
+	if _, err := ParseMetricAggregation([]string{"gpu"}, nil); err == nil {
+		t.Error("Expect error for the unknown family")
+	}
+}
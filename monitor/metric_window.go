@@ -0,0 +1,148 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// The time of the sample aggregated in milliseconds since the epoch
+	containerRecordTimestampField = "stats.timestamp"
+	firstSampleName               = "firstSample"
+	lastSampleName                = "lastSample"
+)
+
+// ValidateMetricWindow checks the metric and the aggregator of GetMetricWindowValue
+func ValidateMetricWindow(metricName string, aggregator string) error {
+	for _, rateMetric := range rateMetricSlice {
+		if rateMetric.Name == metricName {
+			if aggregator != aggregatorAverage {
+				return errors.New("The rate metric " + metricName + " only supports the aggregator " + aggregatorAverage)
+			}
+			return nil
+		}
+	}
+	for _, metric := range metricSlice {
+		if metric.Name == metricName {
+			if _, ok := aggregatorNamePrefixMap[aggregator]; ok == false {
+				return errors.New("Unknown aggregator " + aggregator + " of metric " + metricName)
+			}
+			return nil
+		}
+	}
+	return errors.New("Unknown metric " + metricName)
+}
+
+// GetMetricWindowValue returns the metric aggregated over the window per container and summed up over the containers
+// of the namespace, the workload or the pod in the labels. The rate metric like cpuUsageCores is the average rate
+// between the first and the last sample in the window so the container started in the window or sampled sparsely
+// is not diluted by the time without samples. The pod-level metric like the network is counted once per pod.
+// False is returned if there is no data.
+func GetMetricWindowValue(labels MetricLabels, metricName string, aggregator string,
+	from time.Time, to time.Time) (float64, bool, error) {
+	if err := ValidateMetricWindow(metricName, aggregator); err != nil {
+		return 0, false, err
+	}
+	if to.After(from) == false {
+		return 0, false, errors.New("From " + from.String() + " must be before to " + to.String())
+	}
+
+	var rateMetric *RateMetric
+	for i, _ := range rateMetricSlice {
+		if rateMetricSlice[i].Name == metricName {
+			rateMetric = &rateMetricSlice[i]
+		}
+	}
+	metricAggregationSlice := make([]MetricAggregation, 0)
+	podLevel := false
+	if rateMetric != nil {
+		// The counter never decreases after the reset is stitched so the difference is from the minimum to the maximum
+		metricAggregationSlice = append(metricAggregationSlice,
+			MetricAggregation{aggregatorMinimum, aggregatorMinimum, rateMetric.Field},
+			MetricAggregation{aggregatorMaximum, aggregatorMaximum, rateMetric.Field},
+			MetricAggregation{firstSampleName, aggregatorMinimum, containerRecordTimestampField},
+			MetricAggregation{lastSampleName, aggregatorMaximum, containerRecordTimestampField})
+		podLevel = isPodLevelField(rateMetric.Field)
+	} else {
+		for _, metric := range metricSlice {
+			if metric.Name == metricName {
+				metricAggregationSlice = append(metricAggregationSlice, MetricAggregation{metricName, aggregator, metric.Field})
+				podLevel = isPodLevelField(metric.Field)
+			}
+		}
+	}
+
+	// The whole window is one bucket
+	intervalInSecond := 0
+	index := getDocumentIndex(labels.Namespace)
+	var containerRecordAggregation *ContainerRecordAggregation
+	var err error
+	switch labels.Scope {
+	case MetricScopeNamespace:
+		containerRecordAggregation, err = storage.SearchNamespaceRecordAggregation(index, "",
+			from, to, intervalInSecond, metricAggregationSlice)
+	case MetricScopeWorkload:
+		containerRecordAggregation, err = storage.SearchContainerRecordAggregation(index,
+			getDocumentType(labels.WorkloadKind, labels.WorkloadName), from, to, intervalInSecond, metricAggregationSlice)
+	case MetricScopePod:
+		containerRecordAggregation, err = storage.SearchPodRecordAggregation(index, "", labels.Pod, labels.Container,
+			from, to, intervalInSecond, metricAggregationSlice)
+	default:
+		return 0, false, errors.New("Unsupported scope " + labels.Scope)
+	}
+	if err != nil {
+		log.Error(err)
+		return 0, false, err
+	}
+
+	// namespace/pod/container -> value. The pod-level metric like the network is reported by every container of the
+	// pod so only the maximum of the pod is kept under namespace/pod.
+	valueMap := make(map[string]float64)
+	for _, containerRecordBucket := range containerRecordAggregation.BucketSlice {
+		var value float64
+		if rateMetric != nil {
+			minimum, minimumOk := containerRecordBucket.ValueMap[aggregatorMinimum]
+			maximum, maximumOk := containerRecordBucket.ValueMap[aggregatorMaximum]
+			firstSample, firstSampleOk := containerRecordBucket.ValueMap[firstSampleName]
+			lastSample, lastSampleOk := containerRecordBucket.ValueMap[lastSampleName]
+			// One sample has no rate
+			if minimumOk == false || maximumOk == false || firstSampleOk == false || lastSampleOk == false ||
+				lastSample <= firstSample {
+				continue
+			}
+			value = (maximum - minimum) / ((lastSample - firstSample) / 1000) * rateMetric.Scale
+		} else if metricValue, ok := containerRecordBucket.ValueMap[metricName]; ok {
+			value = metricValue
+		} else {
+			continue
+		}
+
+		key := containerRecordBucket.Namespace + "/" + containerRecordBucket.PodName
+		if podLevel == false {
+			key += "/" + containerRecordBucket.ContainerName
+		}
+		if existingValue, ok := valueMap[key]; ok == false || value > existingValue {
+			valueMap[key] = value
+		}
+	}
+
+	sum := 0.0
+	for _, value := range valueMap {
+		sum += value
+	}
+	return sum, len(valueMap) > 0, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func TestGetMetricWindowValue(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	documentType := getDocumentType(control.WorkloadKindReplicationController, "nginx")
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Minute)
+	for timestamp := from; timestamp.Before(to); timestamp = timestamp.Add(10 * time.Second) {
+		second := int64(timestamp.Sub(from).Seconds())
+		for _, podName := range []string{"nginx-1", "nginx-2"} {
+			containerRecord := createTestContainerRecord(podName, "nginx", timestamp, second*1000000000)
+			containerRecord["stats"].(map[string]interface{})["memory"] = map[string]interface{}{"usage": 100 + second}
+			containerRecord["stats"].(map[string]interface{})["network"] = map[string]interface{}{"rx_bytes": second * 1000}
+			storage.SaveContainerRecord(getDocumentIndex("default"), documentType,
+				getDocumentID(podName, "nginx", timestamp), containerRecord)
+			// The sidecar reports the same network of the pod
+			containerRecord = createTestContainerRecord(podName, "sidecar", timestamp, 0)
+			containerRecord["stats"].(map[string]interface{})["network"] = map[string]interface{}{"rx_bytes": second * 1000}
+			storage.SaveContainerRecord(getDocumentIndex("default"), documentType,
+				getDocumentID(podName, "sidecar", timestamp), containerRecord)
+		}
+	}
+
+	workloadLabels := MetricLabels{
+		Scope:        MetricScopeWorkload,
+		Namespace:    "default",
+		WorkloadKind: control.WorkloadKindReplicationController,
+		WorkloadName: "nginx",
+	}
+	// The maximum of each pod is at 50 second
+	value, ok, err := GetMetricWindowValue(workloadLabels, "memoryUsage", aggregatorMaximum, from, to)
+	if err != nil || ok == false || value != 300 {
+		t.Errorf("Expect 300 but get %v %v %v", value, ok, err)
+	}
+
+	// One core of each pod in 50 seconds over the window of 50 seconds
+	value, ok, err = GetMetricWindowValue(workloadLabels, "cpuUsageCores", aggregatorAverage, from, from.Add(50*time.Second))
+	if err != nil || ok == false || value != 2 {
+		t.Errorf("Expect 2 cores but get %v %v %v", value, ok, err)
+	}
+
+	// The containers started in the window have the rate of the time with the samples
+	value, ok, err = GetMetricWindowValue(workloadLabels, "cpuUsageCores", aggregatorAverage, from.Add(-time.Minute), to)
+	if err != nil || ok == false || value != 2 {
+		t.Errorf("Expect 2 cores for the containers started in the window but get %v %v %v", value, ok, err)
+	}
+
+	// The network of each pod is counted once though both containers report it
+	namespaceLabels := MetricLabels{
+		Scope:     MetricScopeNamespace,
+		Namespace: "default",
+	}
+	value, ok, err = GetMetricWindowValue(namespaceLabels, "networkRxBytesPerSecond", aggregatorAverage, from, from.Add(50*time.Second))
+	if err != nil || ok == false || value != 2000 {
+		t.Errorf("Expect 2000 bytes per second but get %v %v %v", value, ok, err)
+	}
+	value, ok, err = GetMetricWindowValue(namespaceLabels, "networkRxBytes", aggregatorMaximum, from, to)
+	if err != nil || ok == false || value != 100000 {
+		t.Errorf("Expect 100000 bytes but get %v %v %v", value, ok, err)
+	}
+
+	podLabels := MetricLabels{
+		Scope:     MetricScopePod,
+		Namespace: "default",
+		Pod:       "nginx-1",
+	}
+	value, ok, err = GetMetricWindowValue(podLabels, "memoryUsage", aggregatorMinimum, from.Add(30*time.Second), to)
+	if err != nil || ok == false || value != 130 {
+		t.Errorf("Expect 130 but get %v %v %v", value, ok, err)
+	}
+
+	value, ok, err = GetMetricWindowValue(podLabels, "memoryUsage", aggregatorMinimum, to, to.Add(time.Minute))
+	if err != nil || ok {
+		t.Errorf("Expect no data but get %v %v %v", value, ok, err)
+	}
+
+	if _, _, err := GetMetricWindowValue(podLabels, "cpuUsageCores", aggregatorMaximum, from, to); err == nil {
+		t.Error("Expect the error of the aggregator not supported by the rate metric")
+	}
+	if _, _, err := GetMetricWindowValue(podLabels, "unknown", aggregatorMaximum, from, to); err == nil {
+		t.Error("Expect the error of the unknown metric")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"time"
+)
+
+const (
+	MetricsSourceTypeSummary    = "summary"
+	MetricsSourceTypeMetricsAPI = "metricsapi"
+	// The legacy cAdvisor stats of the kubelet which is removed from the current Kubernetes
+	MetricsSourceTypeCAdvisor = "cadvisor"
+
+	metricsSourceTypeDefault = MetricsSourceTypeSummary
+)
+
+// MetricsSource provides the container metrics in the layout of the legacy cAdvisor stats so all sources are saved
+// and searched in the same way. Each container json map has the fields name, spec and stats where stats is the
+// slice of the samples with the fields like timestamp, cpu.usage.total, memory.usage and network.rx_bytes.
+type MetricsSource interface {
+	// Return the container name -> container json map of the pod. The requests are canceled at the deadline
+	// and the zero deadline means no limit.
+	GetContainerJsonMap(kubeApiServerEndPoint string, kubeApiServerToken string, namespace string,
+		podName string, podJsonMap map[string]interface{}, deadline time.Time) (map[string]map[string]interface{}, error)
+}
+
+var metricsSource MetricsSource
+
+func init() {
+	switch GetMetricsSourceType() {
+	case MetricsSourceTypeMetricsAPI:
+		metricsSource = CreateMetricsSourceMetricsAPI()
+	case MetricsSourceTypeCAdvisor:
+		metricsSource = CreateMetricsSourceCAdvisor()
+	default:
+		metricsSource = CreateMetricsSourceSummary()
+	}
+}
+
+func GetMetricsSourceType() string {
+	metricsSourceType, ok := configuration.LocalConfiguration.GetString("containerMetricsSource")
+	if ok == false {
+		return metricsSourceTypeDefault
+	}
+	switch metricsSourceType {
+	case MetricsSourceTypeSummary, MetricsSourceTypeMetricsAPI, MetricsSourceTypeCAdvisor:
+		return metricsSourceType
+	default:
+		log.Error("Unknown containerMetricsSource %s so %s is used", metricsSourceType, metricsSourceTypeDefault)
+		return metricsSourceTypeDefault
+	}
+}
+
+func createContainerJsonMap(containerName string, specJsonMap map[string]interface{}, statsJsonMap map[string]interface{}) map[string]interface{} {
+	containerJsonMap := make(map[string]interface{})
+	containerJsonMap["name"] = containerName
+	containerJsonMap["spec"] = specJsonMap
+	containerJsonMap["stats"] = []interface{}{statsJsonMap}
+	return containerJsonMap
+}
+
+// copyJsonMapValue copies the value only if it exists so the absent metric is not saved as null
+func copyJsonMapValue(targetJsonMap map[string]interface{}, targetKey string, sourceJsonMap map[string]interface{}, sourceKey string) {
+	if value, ok := sourceJsonMap[sourceKey]; ok && value != nil {
+		targetJsonMap[targetKey] = value
+	}
+}
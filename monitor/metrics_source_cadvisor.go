@@ -0,0 +1,58 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+type MetricsSourceCAdvisor struct {
+}
+
+func CreateMetricsSourceCAdvisor() *MetricsSourceCAdvisor {
+	return &MetricsSourceCAdvisor{}
+}
+
+func (metricsSourceCAdvisor *MetricsSourceCAdvisor) GetContainerJsonMap(kubeApiServerEndPoint string, kubeApiServerToken string,
+	namespace string, podName string, podJsonMap map[string]interface{}, deadline time.Time) (map[string]map[string]interface{}, error) {
+	errorBuffer := bytes.Buffer{}
+	errorHappened := false
+
+	kubeletHost, _ := podJsonMap["status"].(map[string]interface{})["hostIP"].(string)
+	uid, _ := podJsonMap["metadata"].(map[string]interface{})["uid"].(string)
+	containerSlice, _ := podJsonMap["spec"].(map[string]interface{})["containers"].([]interface{})
+	containerJsonMapMap := make(map[string]map[string]interface{})
+	for _, container := range containerSlice {
+		containerName, _ := container.(map[string]interface{})["name"].(string)
+		url := kubeletClient.GetURL(kubeletHost) + "/stats/" + namespace + "/" + podName + "/" + uid + "/" + containerName
+		result, err := kubeletClient.RequestGetWithDeadline(url, deadline)
+		containerJsonMap, _ := result.(map[string]interface{})
+		if err != nil {
+			errorHappened = true
+			log.Error("Request to url %s error %s", url, err)
+			errorBuffer.WriteString("Request to url " + url + " error " + err.Error())
+		} else {
+			containerJsonMapMap[containerName] = containerJsonMap
+		}
+	}
+
+	if errorHappened {
+		return containerJsonMapMap, errors.New(errorBuffer.String())
+	} else {
+		return containerJsonMapMap, nil
+	}
+}
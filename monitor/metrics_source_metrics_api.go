@@ -0,0 +1,173 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cpuUsageAccumulationExpiration = 1 * time.Hour
+)
+
+// The suffix of the Kubernetes quantity -> multiplier. The longer suffix is checked first.
+var quantitySuffixSlice = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"Pi", 1 << 50},
+	{"Ei", 1 << 60},
+	{"n", 1e-9},
+	{"u", 1e-6},
+	{"m", 1e-3},
+	{"k", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+	{"P", 1e15},
+	{"E", 1e18},
+}
+
+type cpuUsageAccumulation struct {
+	timestamp time.Time
+	// The accumulated CPU time in nanosecond
+	total float64
+}
+
+// MetricsSourceMetricsAPI reads metrics.k8s.io through the apiserver. The API only provides the current CPU usage
+// in cores so the cumulative CPU time of stats.cpu.usage.total is accumulated from the samples by this process.
+// The accumulation starts from 0 when this process starts. Network and disk IO are not provided.
+type MetricsSourceMetricsAPI struct {
+	lock sync.Mutex
+	// namespace/podName/containerName -> accumulation
+	cpuUsageAccumulationMap map[string]*cpuUsageAccumulation
+}
+
+func CreateMetricsSourceMetricsAPI() *MetricsSourceMetricsAPI {
+	return &MetricsSourceMetricsAPI{
+		cpuUsageAccumulationMap: make(map[string]*cpuUsageAccumulation),
+	}
+}
+
+func (metricsSourceMetricsAPI *MetricsSourceMetricsAPI) GetContainerJsonMap(kubeApiServerEndPoint string, kubeApiServerToken string,
+	namespace string, podName string, podJsonMap map[string]interface{}, deadline time.Time) (map[string]map[string]interface{}, error) {
+	headerMap := make(map[string]string)
+	headerMap["Authorization"] = kubeApiServerToken
+
+	url := kubeApiServerEndPoint + "/apis/metrics.k8s.io/v1beta1/namespaces/" + namespace + "/pods/" + podName
+	result, err := httpclient.RequestGetWithDeadline(configuration.GetKubeApiServerHTTPClient(), url, headerMap, deadline)
+	if err != nil {
+		log.Error("Request to url %s error %s", url, err)
+		return nil, err
+	}
+	podMetricsJsonMap, _ := result.(map[string]interface{})
+
+	timestampText, _ := podMetricsJsonMap["timestamp"].(string)
+	timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+	if err != nil {
+		log.Error("Parse timestamp error %s", podMetricsJsonMap)
+		return nil, errors.New("Parse timestamp error " + timestampText)
+	}
+
+	containerJsonMapMap := make(map[string]map[string]interface{})
+	containerSlice, _ := podMetricsJsonMap["containers"].([]interface{})
+	for _, container := range containerSlice {
+		containerName, _ := container.(map[string]interface{})["name"].(string)
+		usageJsonMap, _ := container.(map[string]interface{})["usage"].(map[string]interface{})
+
+		specJsonMap := make(map[string]interface{})
+		statsJsonMap := make(map[string]interface{})
+		statsJsonMap["timestamp"] = timestamp.UTC().Format(time.RFC3339Nano)
+
+		cpuText, _ := usageJsonMap["cpu"].(string)
+		if cores, err := parseQuantity(cpuText); err == nil {
+			specJsonMap["has_cpu"] = true
+			nanoCores := cores * 1e9
+			total := metricsSourceMetricsAPI.accumulateCpuUsage(namespace+"/"+podName+"/"+containerName, timestamp, nanoCores)
+			statsJsonMap["cpu"] = map[string]interface{}{
+				"usage": map[string]interface{}{
+					"total":      int64(total),
+					"nano_cores": int64(nanoCores),
+				},
+			}
+		}
+
+		memoryText, _ := usageJsonMap["memory"].(string)
+		if bytes, err := parseQuantity(memoryText); err == nil {
+			specJsonMap["has_memory"] = true
+			// The memory of the metrics API is the working set
+			statsJsonMap["memory"] = map[string]interface{}{
+				"usage":       int64(bytes),
+				"working_set": int64(bytes),
+			}
+		}
+
+		containerJsonMapMap[containerName] = createContainerJsonMap(containerName, specJsonMap, statsJsonMap)
+	}
+
+	return containerJsonMapMap, nil
+}
+
+func (metricsSourceMetricsAPI *MetricsSourceMetricsAPI) accumulateCpuUsage(key string, timestamp time.Time, nanoCores float64) float64 {
+	metricsSourceMetricsAPI.lock.Lock()
+	defer metricsSourceMetricsAPI.lock.Unlock()
+
+	accumulation, ok := metricsSourceMetricsAPI.cpuUsageAccumulationMap[key]
+	if ok == false {
+		// Drop the containers which are gone
+		for existingKey, existingAccumulation := range metricsSourceMetricsAPI.cpuUsageAccumulationMap {
+			if timestamp.Sub(existingAccumulation.timestamp) > cpuUsageAccumulationExpiration {
+				delete(metricsSourceMetricsAPI.cpuUsageAccumulationMap, existingKey)
+			}
+		}
+		accumulation = &cpuUsageAccumulation{timestamp, 0}
+		metricsSourceMetricsAPI.cpuUsageAccumulationMap[key] = accumulation
+	} else if timestamp.After(accumulation.timestamp) {
+		accumulation.total += nanoCores * timestamp.Sub(accumulation.timestamp).Seconds()
+		accumulation.timestamp = timestamp
+	}
+	return accumulation.total
+}
+
+// parseQuantity parses the Kubernetes quantity like 250m, 12345n, 128Mi or 1e3
+func parseQuantity(text string) (float64, error) {
+	if text == "" {
+		return 0, errors.New("Empty quantity")
+	}
+	multiplier := 1.0
+	for _, quantitySuffix := range quantitySuffixSlice {
+		if strings.HasSuffix(text, quantitySuffix.suffix) {
+			text = text[:len(text)-len(quantitySuffix.suffix)]
+			multiplier = quantitySuffix.multiplier
+			break
+		}
+	}
+	// The exponent like 1e3 is parsed by ParseFloat
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, err
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// The summary of the node is reused for the pods on the same node in one sweep
+	summaryCacheDuration = 10 * time.Second
+)
+
+type summaryCache struct {
+	fetchTime time.Time
+	// namespace/podName -> pod summary
+	podSummaryMap map[string]map[string]interface{}
+}
+
+// MetricsSourceSummary reads the kubelet Summary API with one request per node
+type MetricsSourceSummary struct {
+	lock sync.Mutex
+	// kubelet host -> summary
+	summaryCacheMap map[string]*summaryCache
+}
+
+func CreateMetricsSourceSummary() *MetricsSourceSummary {
+	return &MetricsSourceSummary{
+		summaryCacheMap: make(map[string]*summaryCache),
+	}
+}
+
+func (metricsSourceSummary *MetricsSourceSummary) GetContainerJsonMap(kubeApiServerEndPoint string, kubeApiServerToken string,
+	namespace string, podName string, podJsonMap map[string]interface{}, deadline time.Time) (map[string]map[string]interface{}, error) {
+	kubeletHost, _ := podJsonMap["status"].(map[string]interface{})["hostIP"].(string)
+	if kubeletHost == "" {
+		return nil, errors.New("Pod " + namespace + "/" + podName + " is not scheduled to any node")
+	}
+
+	podSummaryMap, err := metricsSourceSummary.getPodSummaryMap(kubeletHost, deadline)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	podSummary, ok := podSummaryMap[namespace+"/"+podName]
+	if ok == false {
+		return nil, errors.New("Pod " + namespace + "/" + podName + " is not in the summary of the node " + kubeletHost)
+	}
+
+	return convertPodSummaryToContainerJsonMap(podSummary), nil
+}
+
+func (metricsSourceSummary *MetricsSourceSummary) getPodSummaryMap(kubeletHost string, deadline time.Time) (map[string]map[string]interface{}, error) {
+	metricsSourceSummary.lock.Lock()
+	defer metricsSourceSummary.lock.Unlock()
+
+	cache, ok := metricsSourceSummary.summaryCacheMap[kubeletHost]
+	if ok && time.Since(cache.fetchTime) < summaryCacheDuration {
+		return cache.podSummaryMap, nil
+	}
+
+	url := kubeletClient.GetURL(kubeletHost) + "/stats/summary"
+	result, err := kubeletClient.RequestGetWithDeadline(url, deadline)
+	if err != nil {
+		log.Error("Request to url %s error %s", url, err)
+		return nil, err
+	}
+
+	podSummaryMap := make(map[string]map[string]interface{})
+	podSlice, _ := result.(map[string]interface{})["pods"].([]interface{})
+	for _, pod := range podSlice {
+		podSummary, ok := pod.(map[string]interface{})
+		if ok == false {
+			continue
+		}
+		podNamespace, _ := podSummary["podRef"].(map[string]interface{})["namespace"].(string)
+		podName, _ := podSummary["podRef"].(map[string]interface{})["name"].(string)
+		podSummaryMap[podNamespace+"/"+podName] = podSummary
+	}
+
+	metricsSourceSummary.summaryCacheMap[kubeletHost] = &summaryCache{time.Now(), podSummaryMap}
+	return podSummaryMap, nil
+}
+
+// convertPodSummaryToContainerJsonMap maps the pod summary to the cAdvisor layout. The network of the pod is shared by
+// its containers like cAdvisor. The disk IO is not provided by the Summary API.
+func convertPodSummaryToContainerJsonMap(podSummary map[string]interface{}) map[string]map[string]interface{} {
+	networkJsonMap, _ := podSummary["network"].(map[string]interface{})
+
+	containerJsonMapMap := make(map[string]map[string]interface{})
+	containerSlice, _ := podSummary["containers"].([]interface{})
+	for _, container := range containerSlice {
+		containerSummary, ok := container.(map[string]interface{})
+		if ok == false {
+			continue
+		}
+		containerName, _ := containerSummary["name"].(string)
+		cpuJsonMap, _ := containerSummary["cpu"].(map[string]interface{})
+		memoryJsonMap, _ := containerSummary["memory"].(map[string]interface{})
+		rootfsJsonMap, _ := containerSummary["rootfs"].(map[string]interface{})
+
+		timestamp, _ := cpuJsonMap["time"].(string)
+		if timestamp == "" {
+			timestamp, _ = memoryJsonMap["time"].(string)
+		}
+
+		specJsonMap := make(map[string]interface{})
+		copyJsonMapValue(specJsonMap, "creation_time", containerSummary, "startTime")
+		specJsonMap["has_cpu"] = cpuJsonMap != nil
+		specJsonMap["has_memory"] = memoryJsonMap != nil
+		specJsonMap["has_network"] = networkJsonMap != nil
+		specJsonMap["has_filesystem"] = rootfsJsonMap != nil
+
+		statsJsonMap := make(map[string]interface{})
+		statsJsonMap["timestamp"] = timestamp
+		if cpuJsonMap != nil {
+			usageJsonMap := make(map[string]interface{})
+			copyJsonMapValue(usageJsonMap, "total", cpuJsonMap, "usageCoreNanoSeconds")
+			copyJsonMapValue(usageJsonMap, "nano_cores", cpuJsonMap, "usageNanoCores")
+			statsJsonMap["cpu"] = map[string]interface{}{"usage": usageJsonMap}
+		}
+		if memoryJsonMap != nil {
+			statsMemoryJsonMap := make(map[string]interface{})
+			copyJsonMapValue(statsMemoryJsonMap, "usage", memoryJsonMap, "usageBytes")
+			copyJsonMapValue(statsMemoryJsonMap, "working_set", memoryJsonMap, "workingSetBytes")
+			copyJsonMapValue(statsMemoryJsonMap, "rss", memoryJsonMap, "rssBytes")
+			containerDataJsonMap := make(map[string]interface{})
+			copyJsonMapValue(containerDataJsonMap, "pgfault", memoryJsonMap, "pageFaults")
+			copyJsonMapValue(containerDataJsonMap, "pgmajfault", memoryJsonMap, "majorPageFaults")
+			if len(containerDataJsonMap) > 0 {
+				statsMemoryJsonMap["container_data"] = containerDataJsonMap
+			}
+			statsJsonMap["memory"] = statsMemoryJsonMap
+		}
+		if networkJsonMap != nil {
+			statsNetworkJsonMap := make(map[string]interface{})
+			copyJsonMapValue(statsNetworkJsonMap, "rx_bytes", networkJsonMap, "rxBytes")
+			copyJsonMapValue(statsNetworkJsonMap, "rx_errors", networkJsonMap, "rxErrors")
+			copyJsonMapValue(statsNetworkJsonMap, "tx_bytes", networkJsonMap, "txBytes")
+			copyJsonMapValue(statsNetworkJsonMap, "tx_errors", networkJsonMap, "txErrors")
+			statsJsonMap["network"] = statsNetworkJsonMap
+		}
+		if rootfsJsonMap != nil {
+			filesystemJsonMap := make(map[string]interface{})
+			filesystemJsonMap["device"] = "rootfs"
+			copyJsonMapValue(filesystemJsonMap, "usage", rootfsJsonMap, "usedBytes")
+			copyJsonMapValue(filesystemJsonMap, "capacity", rootfsJsonMap, "capacityBytes")
+			copyJsonMapValue(filesystemJsonMap, "available", rootfsJsonMap, "availableBytes")
+			statsJsonMap["filesystem"] = []interface{}{filesystemJsonMap}
+		}
+
+		containerJsonMapMap[containerName] = createContainerJsonMap(containerName, specJsonMap, statsJsonMap)
+	}
+
+	return containerJsonMapMap
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"testing"
+)
+
+func TestConvertPodSummaryToContainerJsonMap(t *testing.T) {
+	podSummary := map[string]interface{}{
+		"podRef": map[string]interface{}{"name": "nginx-1", "namespace": "default"},
+		"network": map[string]interface{}{
+			"time":    "2016-01-01T00:00:00Z",
+			"rxBytes": 100.0,
+			"txBytes": 200.0,
+		},
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name":      "nginx",
+				"startTime": "2015-12-31T00:00:00Z",
+				"cpu": map[string]interface{}{
+					"time":                 "2016-01-01T00:00:00Z",
+					"usageNanoCores":       5000000.0,
+					"usageCoreNanoSeconds": 123456789.0,
+				},
+				"memory": map[string]interface{}{
+					"time":            "2016-01-01T00:00:00Z",
+					"usageBytes":      1024.0,
+					"workingSetBytes": 512.0,
+					"pageFaults":      10.0,
+				},
+			},
+		},
+	}
+
+	containerJsonMapMap := convertPodSummaryToContainerJsonMap(podSummary)
+	containerRecordSlice, err := splitHistoricalDataIntoSecondBased("default", "Deployment", "nginx", "nginx-1", "nginx", containerJsonMapMap["nginx"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containerRecordSlice) != 1 {
+		t.Fatalf("Expect 1 record but get %v", containerRecordSlice)
+	}
+	stats := containerRecordSlice[0]["stats"].(map[string]interface{})
+	if stats["cpu"].(map[string]interface{})["usage"].(map[string]interface{})["total"] != 123456789.0 {
+		t.Errorf("Unexpected cpu %v", stats["cpu"])
+	}
+	if stats["memory"].(map[string]interface{})["usage"] != 1024.0 || stats["memory"].(map[string]interface{})["working_set"] != 512.0 {
+		t.Errorf("Unexpected memory %v", stats["memory"])
+	}
+	if stats["memory"].(map[string]interface{})["container_data"].(map[string]interface{})["pgfault"] != 10.0 {
+		t.Errorf("Unexpected page fault %v", stats["memory"])
+	}
+	if stats["network"].(map[string]interface{})["tx_bytes"] != 200.0 {
+		t.Errorf("Unexpected network %v", stats["network"])
+	}
+	if _, ok := stats["network"].(map[string]interface{})["rx_errors"]; ok {
+		t.Errorf("The absent metric should not be saved %v", stats["network"])
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	for text, expected := range map[string]float64{
+		"250m":   0.25,
+		"12345n": 0.000012345,
+		"2":      2,
+		"128Mi":  128 * 1024 * 1024,
+		"1e3":    1000,
+		"1k":     1000,
+	} {
+		value, err := parseQuantity(text)
+		if err != nil || value-expected > 1e-12 || expected-value > 1e-12 {
+			t.Errorf("Expect %v for %s but get %v %v", expected, text, value, err)
+		}
+	}
+
+	metricsSourceMetricsAPI := CreateMetricsSourceMetricsAPI()
+	timestamp := getLocalTimestamp("2016-01-01T00:00:00Z")
+	metricsSourceMetricsAPI.accumulateCpuUsage("default/nginx-1/nginx", timestamp, 1e9)
+	// One core for 10 seconds
+	total := metricsSourceMetricsAPI.accumulateCpuUsage("default/nginx-1/nginx", timestamp.Add(10e9), 1e9)
+	if total != 1e10 {
+		t.Errorf("Expect 1e10 but get %v", total)
+	}
+}
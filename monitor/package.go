@@ -23,5 +23,21 @@ var log = logger.GetLogManager().GetLogger("monitor")
 const (
 	// No Captial is allowed in index name
 	indexContainerMetricsIndexPrefix = "indexcontainermetrics_"
-	indexContainerMetricsTypePrefix  = "typereplicationcontroller_"
+	// The document type is the prefix, the workload kind, the separator and the workload name in lower case
+	// like typereplicationcontroller_nginx or typedeployment_nginx
+	indexContainerMetricsTypePrefix    = "type"
+	indexContainerMetricsTypeSeparator = "_"
+
+	indexContainerMetricsRollupIndexPrefix    = "indexcontainermetricsrollup_"
+	indexContainerMetricsRollupWatermarkIndex = "indexcontainermetricsrollupwatermark"
+	typeContainerMetricsRollupWatermark       = "watermark"
+
+	indexContainerMetricsCounterStateIndex = "indexcontainermetricscounterstate"
+	typeContainerMetricsCounterState       = "counterstate"
+
+	// The node record is saved in the layout of the container record so it is searched in the same way.
+	// The pod name is the node name and the container name is always node.
+	indexNodeMetricsIndex    = "indexnodemetrics"
+	typeNodeMetricsPrefix    = "typenode_"
+	nodeMetricsContainerName = "node"
 )
@@ -0,0 +1,445 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"strings"
+	"time"
+)
+
+// The rollup summarizes the raw records into the coarser resolution. Each resolution is built from the finer one.
+// The raw records are collected with delay so the rollup waits for the delay before summarizing a bucket.
+type RollupResolution struct {
+	Name     string
+	Interval time.Duration
+	Delay    time.Duration
+}
+
+var rollupResolutionSlice = []RollupResolution{
+	RollupResolution{"1m", time.Minute, 2 * time.Minute},
+	RollupResolution{"1h", time.Hour, 5 * time.Minute},
+	RollupResolution{"1d", 24 * time.Hour, 30 * time.Minute},
+}
+
+const (
+	// The range used when there is no watermark yet
+	rollupInitialLookback = 24 * time.Hour
+	// Limit the buckets in one run so catching up doesn't produce a huge query
+	rollupMaximumBucketAmountPerRun = 1000
+	rollupDocumentCountName         = "rollupDocumentCount"
+)
+
+// The fields summarized by the rollup
+func getRollupFieldSlice() []string {
+	fieldSlice := make([]string, 0)
+	fieldMap := make(map[string]bool)
+	for _, metric := range metricSlice {
+		if fieldMap[metric.Field] == false {
+			fieldMap[metric.Field] = true
+			fieldSlice = append(fieldSlice, metric.Field)
+		}
+	}
+	for _, rateMetric := range rateMetricSlice {
+		if fieldMap[rateMetric.Field] == false {
+			fieldMap[rateMetric.Field] = true
+			fieldSlice = append(fieldSlice, rateMetric.Field)
+		}
+	}
+	return fieldSlice
+}
+
+// ElasticSearch doesn't allow to use character '.' in the field name so it should be replaced with '_'
+func getRollupKey(field string) string {
+	return strings.Replace(field, ".", "_", -1)
+}
+
+func getRollupIndex(resolution RollupResolution, namespace string) string {
+	return indexContainerMetricsRollupIndexPrefix + resolution.Name + "_" + strings.ToLower(namespace)
+}
+
+// RollupAllNamespace summarizes the records of all namespaces into all resolutions up to now
+func RollupAllNamespace(now time.Time) (returnedError error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("RollupAllNamespace Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+			returnedError = err.(error)
+		}
+	}()
+
+	indexSlice, err := storage.GetAllIndex(indexContainerMetricsIndexPrefix + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	namespaceMap := make(map[string]bool)
+	for _, index := range indexSlice {
+		if alias, _, _, ok := rollover.ParseIndexName(index); ok {
+			namespaceMap[alias[len(indexContainerMetricsIndexPrefix):]] = true
+		}
+	}
+
+	hasError := false
+	errorBuffer := bytes.Buffer{}
+	for i, resolution := range rollupResolutionSlice {
+		// The finer resolution must be summarized first
+		var sourceStart *time.Time = nil
+		var sourceWatermark *time.Time = nil
+		if i > 0 {
+			start, watermark, err := getRollupWatermark(rollupResolutionSlice[i-1])
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			sourceStart = start
+			sourceWatermark = watermark
+		}
+
+		if err := rollupResolution(now, resolution, i, sourceStart, sourceWatermark, namespaceMap); err != nil {
+			log.Error(err)
+			errorBuffer.WriteString(err.Error())
+			hasError = true
+		}
+	}
+
+	if hasError {
+		return errors.New(errorBuffer.String())
+	} else {
+		return nil
+	}
+}
+
+func rollupResolution(now time.Time, resolution RollupResolution, resolutionIndex int,
+	sourceStart *time.Time, sourceWatermark *time.Time, namespaceMap map[string]bool) error {
+	start, watermark, err := getRollupWatermark(resolution)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	var from time.Time
+	if watermark == nil {
+		from = now.Add(-rollupInitialLookback).Truncate(resolution.Interval)
+	} else {
+		from = *watermark
+	}
+	if start == nil {
+		// The watermark saved without the start doesn't tell what was summarized before it
+		start = &from
+		// The buckets before the start of the source have no or partial data
+		if sourceStart != nil && sourceStart.After(*start) {
+			sourceStartCeiling := sourceStart.Truncate(resolution.Interval)
+			if sourceStartCeiling.Before(*sourceStart) {
+				sourceStartCeiling = sourceStartCeiling.Add(resolution.Interval)
+			}
+			start = &sourceStartCeiling
+		}
+	}
+	to := now.Add(-resolution.Delay).Truncate(resolution.Interval)
+	if resolutionIndex > 0 {
+		if sourceWatermark == nil {
+			// The source is not summarized yet
+			return nil
+		}
+		if sourceWatermark.Before(to) {
+			to = sourceWatermark.Truncate(resolution.Interval)
+		}
+	}
+	maximumTo := from.Add(resolution.Interval * rollupMaximumBucketAmountPerRun)
+	if to.After(maximumTo) {
+		to = maximumTo
+	}
+	if to.After(from) == false {
+		return nil
+	}
+
+	bulkProcessor := createContainerRecordBulkProcessor()
+	hasError := false
+	errorBuffer := bytes.Buffer{}
+	for namespace, _ := range namespaceMap {
+		if err := rollupNamespace(bulkProcessor, resolution, resolutionIndex, namespace, from, to); err != nil {
+			log.Error(err)
+			errorBuffer.WriteString(err.Error())
+			hasError = true
+		}
+	}
+	if err := bulk.ConvertToError(bulkProcessor.Close()); err != nil {
+		log.Error(err)
+		errorBuffer.WriteString(err.Error())
+		hasError = true
+	}
+
+	if hasError {
+		// Keep the watermark so the range is summarized again in the next run
+		return errors.New(errorBuffer.String())
+	}
+
+	return saveRollupWatermark(resolution, *start, to)
+}
+
+func rollupNamespace(bulkProcessor *bulk.BulkProcessor, resolution RollupResolution, resolutionIndex int,
+	namespace string, from time.Time, to time.Time) error {
+	var sourceIndex string
+	if resolutionIndex == 0 {
+		sourceIndex = getDocumentIndex(namespace)
+	} else {
+		sourceIndex = getRollupIndex(rollupResolutionSlice[resolutionIndex-1], namespace)
+	}
+
+	documentTypeSlice, err := storage.GetAllDocumentTypeForIndex(sourceIndex)
+	if err != nil {
+		// No data in the source yet
+		return nil
+	}
+
+	metricAggregationSlice := make([]MetricAggregation, 0)
+	if resolutionIndex > 0 {
+		metricAggregationSlice = append(metricAggregationSlice, MetricAggregation{rollupDocumentCountName, aggregatorSum, "documentCount"})
+	}
+	for _, field := range getRollupFieldSlice() {
+		key := getRollupKey(field)
+		if resolutionIndex == 0 {
+			metricAggregationSlice = append(metricAggregationSlice,
+				MetricAggregation{key + "_min", aggregatorMinimum, field},
+				MetricAggregation{key + "_max", aggregatorMaximum, field},
+				MetricAggregation{key + "_sum", aggregatorSum, field},
+				MetricAggregation{key + "_last", aggregatorLast, field},
+			)
+		} else {
+			metricAggregationSlice = append(metricAggregationSlice,
+				MetricAggregation{key + "_min", aggregatorMinimum, "rollup." + key + ".min"},
+				MetricAggregation{key + "_max", aggregatorMaximum, "rollup." + key + ".max"},
+				MetricAggregation{key + "_sum", aggregatorSum, "rollup." + key + ".sum"},
+				MetricAggregation{key + "_count", aggregatorSum, "rollup." + key + ".count"},
+				MetricAggregation{key + "_last", aggregatorLast, "rollup." + key + ".last"},
+			)
+		}
+	}
+
+	// The upper bound is inclusive in the search
+	searchTo := to.Add(-time.Millisecond)
+	for _, documentType := range documentTypeSlice {
+		workloadKind, workloadName, ok := getWorkloadFromDocumentType(documentType)
+		if ok == false {
+			continue
+		}
+		containerRecordAggregation, err := storage.SearchContainerRecordAggregation(sourceIndex, documentType,
+			from, searchTo, int(resolution.Interval.Seconds()), metricAggregationSlice)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+
+		for _, containerRecordBucket := range containerRecordAggregation.BucketSlice {
+			timestamp, err := time.Parse(time.RFC3339Nano, containerRecordAggregation.TimestampSlice[containerRecordBucket.TimeIndex])
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+
+			rollupJsonMap := make(map[string]interface{})
+			for _, field := range getRollupFieldSlice() {
+				key := getRollupKey(field)
+				sum, ok := containerRecordBucket.ValueMap[key+"_sum"]
+				if ok == false {
+					continue
+				}
+				count := float64(containerRecordBucket.DocumentCount)
+				if resolutionIndex > 0 {
+					count = containerRecordBucket.ValueMap[key+"_count"]
+				}
+				valueJsonMap := make(map[string]interface{})
+				valueJsonMap["min"] = containerRecordBucket.ValueMap[key+"_min"]
+				valueJsonMap["max"] = containerRecordBucket.ValueMap[key+"_max"]
+				valueJsonMap["sum"] = sum
+				valueJsonMap["count"] = count
+				valueJsonMap["last"] = containerRecordBucket.ValueMap[key+"_last"]
+				if count > 0 {
+					valueJsonMap["avg"] = sum / count
+				}
+				rollupJsonMap[key] = valueJsonMap
+			}
+
+			alias := getRollupIndex(resolution, namespace)
+			index := rollover.GetIndexName(alias, timestamp)
+			id := getDocumentID(containerRecordBucket.PodName, containerRecordBucket.ContainerName, timestamp)
+
+			searchMetaData := make(map[string]interface{})
+			searchMetaData["namespace"] = namespace
+			searchMetaData["workloadKind"] = workloadKind
+			searchMetaData["workloadName"] = workloadName
+			if workloadKind == control.WorkloadKindReplicationController {
+				searchMetaData["replicationControllerName"] = workloadName
+			}
+			searchMetaData["podName"] = containerRecordBucket.PodName
+			searchMetaData["containerName"] = containerRecordBucket.ContainerName
+			searchMetaData["index"] = index
+			searchMetaData["documentType"] = documentType
+			searchMetaData["id"] = id
+			searchMetaData["resolution"] = resolution.Name
+
+			documentJsonMap := make(map[string]interface{})
+			documentJsonMap["searchMetaData"] = searchMetaData
+			documentJsonMap["stats"] = map[string]interface{}{
+				"timestamp": timestamp.UTC().Format(time.RFC3339Nano),
+			}
+			documentJsonMap["rollup"] = rollupJsonMap
+			if resolutionIndex == 0 {
+				documentJsonMap["documentCount"] = containerRecordBucket.DocumentCount
+			} else {
+				documentJsonMap["documentCount"] = int64(containerRecordBucket.ValueMap[rollupDocumentCountName])
+			}
+
+			bulkProcessor.Add(bulk.BulkItem{Index: index, Type: documentType, ID: id, Document: documentJsonMap})
+		}
+	}
+
+	return nil
+}
+
+// getRollupWatermark returns the start, the earliest time summarized, and the watermark, the time summarized up to.
+// Both are nil if nothing is summarized yet.
+func getRollupWatermark(resolution RollupResolution) (*time.Time, *time.Time, error) {
+	jsonMap, err := storage.GetContainerRecord(indexContainerMetricsRollupWatermarkIndex, typeContainerMetricsRollupWatermark, resolution.Name)
+	if err != nil {
+		if err.Error() == "record not found" {
+			return nil, nil, nil
+		}
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	timestampText, _ := jsonMap["timestamp"].(string)
+	timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	// The watermark saved before the start is recorded has no start
+	startTimestampText, _ := jsonMap["startTimestamp"].(string)
+	startTimestamp, err := time.Parse(time.RFC3339Nano, startTimestampText)
+	if err != nil {
+		return nil, &timestamp, nil
+	}
+	return &startTimestamp, &timestamp, nil
+}
+
+func saveRollupWatermark(resolution RollupResolution, start time.Time, timestamp time.Time) error {
+	jsonMap := make(map[string]interface{})
+	jsonMap["startTimestamp"] = start.UTC().Format(time.RFC3339Nano)
+	jsonMap["timestamp"] = timestamp.UTC().Format(time.RFC3339Nano)
+	return storage.SaveContainerRecord(indexContainerMetricsRollupWatermarkIndex, typeContainerMetricsRollupWatermark, resolution.Name, jsonMap)
+}
+
+// Find the coarsest rollup resolution not larger than the interval.
+// The rollup must cover the range from the start except the last bucket which may be still in progress.
+// The raw records are used if no rollup covers the range like the range before the rollup is deployed.
+func selectRollupResolution(from time.Time, to time.Time, intervalInSecond int) (*RollupResolution, error) {
+	interval := time.Duration(intervalInSecond) * time.Second
+	for i := len(rollupResolutionSlice) - 1; i >= 0; i-- {
+		resolution := rollupResolutionSlice[i]
+		if resolution.Interval > interval {
+			continue
+		}
+		start, watermark, err := getRollupWatermark(resolution)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		if start != nil && start.After(from) == false && watermark.Before(to.Add(-interval)) == false {
+			return &resolution, nil
+		}
+	}
+	return nil, nil
+}
+
+// searchContainerRecordAggregationWithRollup uses the coarsest available rollup resolution instead of the raw records
+func searchContainerRecordAggregationWithRollup(namespace string, documentType string, from time.Time, to time.Time,
+	intervalInSecond int, metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	return searchRecordAggregationWithRollup(storage.SearchContainerRecordAggregation, namespace, documentType,
+		from, to, intervalInSecond, metricAggregationSlice)
+}
+
+type searchRecordAggregationFunction func(index string, documentType string, from time.Time, to time.Time,
+	intervalInSecond int, metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error)
+
+// searchRecordAggregationWithRollup searches with the function. The namespace could be the pattern * for all namespaces.
+func searchRecordAggregationWithRollup(search searchRecordAggregationFunction, namespace string, documentType string,
+	from time.Time, to time.Time, intervalInSecond int, metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	resolution, err := selectRollupResolution(from, to, intervalInSecond)
+	if err != nil {
+		log.Error(err)
+	}
+	// The percentile can't be calculated from the summary
+	for _, metricAggregation := range metricAggregationSlice {
+		if _, ok := getPercentile(metricAggregation.Aggregator); ok {
+			resolution = nil
+		}
+	}
+	if resolution == nil {
+		return search(getDocumentIndex(namespace), documentType,
+			from, to, intervalInSecond, metricAggregationSlice)
+	}
+
+	rollupMetricAggregationSlice := make([]MetricAggregation, 0)
+	rollupMetricAggregationSlice = append(rollupMetricAggregationSlice, MetricAggregation{rollupDocumentCountName, aggregatorSum, "documentCount"})
+	for _, metricAggregation := range metricAggregationSlice {
+		key := getRollupKey(metricAggregation.Field)
+		switch metricAggregation.Aggregator {
+		case aggregatorAverage:
+			rollupMetricAggregationSlice = append(rollupMetricAggregationSlice,
+				MetricAggregation{metricAggregation.Name + "_sum", aggregatorSum, "rollup." + key + ".sum"},
+				MetricAggregation{metricAggregation.Name + "_count", aggregatorSum, "rollup." + key + ".count"},
+			)
+		default:
+			rollupMetricAggregationSlice = append(rollupMetricAggregationSlice,
+				MetricAggregation{metricAggregation.Name, metricAggregation.Aggregator, "rollup." + key + "." + metricAggregation.Aggregator})
+		}
+	}
+
+	containerRecordAggregation, err := search(getRollupIndex(*resolution, namespace), documentType,
+		from, to, intervalInSecond, rollupMetricAggregationSlice)
+	if err != nil {
+		// Fall back to the raw records
+		log.Error(err)
+		return search(getDocumentIndex(namespace), documentType,
+			from, to, intervalInSecond, metricAggregationSlice)
+	}
+
+	for i, containerRecordBucket := range containerRecordAggregation.BucketSlice {
+		valueMap := make(map[string]float64)
+		for _, metricAggregation := range metricAggregationSlice {
+			if metricAggregation.Aggregator == aggregatorAverage {
+				sum, ok := containerRecordBucket.ValueMap[metricAggregation.Name+"_sum"]
+				count := containerRecordBucket.ValueMap[metricAggregation.Name+"_count"]
+				if ok && count > 0 {
+					valueMap[metricAggregation.Name] = sum / count
+				}
+			} else if value, ok := containerRecordBucket.ValueMap[metricAggregation.Name]; ok {
+				valueMap[metricAggregation.Name] = value
+			}
+		}
+		containerRecordAggregation.BucketSlice[i].ValueMap = valueMap
+		containerRecordAggregation.BucketSlice[i].DocumentCount = int64(containerRecordBucket.ValueMap[rollupDocumentCountName])
+	}
+
+	return containerRecordAggregation, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"testing"
+	"time"
+)
+
+func TestRollupAllNamespace(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	documentType := getDocumentType(control.WorkloadKindReplicationController, "nginx")
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(3 * time.Hour)
+	for timestamp := from; timestamp.Before(to); timestamp = timestamp.Add(10 * time.Second) {
+		containerRecord := createTestContainerRecord("nginx-1", "nginx", timestamp, int64(timestamp.Sub(from).Seconds()))
+		containerRecord["stats"].(map[string]interface{})["memory"] = map[string]interface{}{"usage": 100}
+		index := rollover.GetIndexName(getDocumentIndex("default"), timestamp)
+		storage.SaveContainerRecord(index, documentType, getDocumentID("nginx-1", "nginx", timestamp), containerRecord)
+	}
+
+	// Catching up takes more than one run
+	now := to.Add(10 * time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := RollupAllNamespace(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resolution, err := selectRollupResolution(from, to, 3600)
+	if err != nil || resolution == nil || resolution.Name != "1h" {
+		t.Fatalf("Expect 1h resolution but get %v %v", resolution, err)
+	}
+
+	rawAggregation, err := storage.SearchContainerRecordAggregation(getDocumentIndex("default"), documentType,
+		from, to, 3600, replicationControllerMetricAggregationSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollupAggregation, err := searchHistoricalReplicationControllerMetrics("default", "nginx", 3, from, to, replicationControllerMetricAggregationSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rollupAggregation.BucketSlice) != 3 || len(rawAggregation.BucketSlice) != 3 {
+		t.Fatalf("Expect 3 buckets but get rollup %v raw %v", rollupAggregation.BucketSlice, rawAggregation.BucketSlice)
+	}
+	rawBucketMap := make(map[int]ContainerRecordBucket)
+	for _, rawBucket := range rawAggregation.BucketSlice {
+		rawBucketMap[rawBucket.TimeIndex] = rawBucket
+	}
+	for _, rollupBucket := range rollupAggregation.BucketSlice {
+		rawBucket := rawBucketMap[rollupBucket.TimeIndex]
+		if rollupBucket.DocumentCount != 360 || rollupBucket.DocumentCount != rawBucket.DocumentCount {
+			t.Errorf("Expect 360 documents but get rollup %d raw %d", rollupBucket.DocumentCount, rawBucket.DocumentCount)
+		}
+		for _, name := range []string{"minimumCpuUsageTotal", "averageMemoryUsage"} {
+			if rollupBucket.ValueMap[name] != rawBucket.ValueMap[name] {
+				t.Errorf("Expect %s %v but get %v", name, rawBucket.ValueMap[name], rollupBucket.ValueMap[name])
+			}
+		}
+	}
+}
+
+func TestSelectRollupResolutionBeforeFirstRollup(t *testing.T) {
+	originalStorage := storage
+	storage = &StorageLocal{local.CreateDocumentStore()}
+	defer func() {
+		storage = originalStorage
+	}()
+
+	documentType := getDocumentType(control.WorkloadKindReplicationController, "nginx")
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(2 * rollupInitialLookback)
+	for timestamp := from; timestamp.Before(to); timestamp = timestamp.Add(time.Minute) {
+		containerRecord := createTestContainerRecord("nginx-1", "nginx", timestamp, int64(timestamp.Sub(from).Seconds()))
+		index := rollover.GetIndexName(getDocumentIndex("default"), timestamp)
+		storage.SaveContainerRecord(index, documentType, getDocumentID("nginx-1", "nginx", timestamp), containerRecord)
+	}
+
+	// The first rollup only looks back the initial range so the first day is not summarized
+	now := to.Add(10 * time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := RollupAllNamespace(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if resolution, err := selectRollupResolution(from, to, 3600); err != nil || resolution != nil {
+		t.Errorf("Expect the raw records before the first rollup but get %v %v", resolution, err)
+	}
+	if resolution, err := selectRollupResolution(to.Add(-3*time.Hour), to, 3600); err != nil || resolution == nil || resolution.Name != "1h" {
+		t.Errorf("Expect 1h resolution after the first rollup but get %v %v", resolution, err)
+	}
+
+	// The buckets of the first day are from the raw records
+	aggregation, err := searchHistoricalReplicationControllerMetrics("default", "nginx", 48, from, to, replicationControllerMetricAggregationSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentCount := int64(0)
+	for _, bucket := range aggregation.BucketSlice {
+		documentCount += bucket.DocumentCount
+	}
+	if documentCount != int64(2*rollupInitialLookback/time.Minute) {
+		t.Errorf("Expect all records counted but get %d", documentCount)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	aggregatorMinimum = "min"
+	aggregatorMaximum = "max"
+	aggregatorAverage = "avg"
+	aggregatorSum     = "sum"
+	// The value of the latest document in the bucket
+	aggregatorLast = "last"
+	// The percentile in the bucket. Elastic Search calculates the approximate value.
+	aggregatorPercentile50 = "p50"
+	aggregatorPercentile90 = "p90"
+	aggregatorPercentile95 = "p95"
+	aggregatorPercentile99 = "p99"
+)
+
+// getPercentile returns the percent like 95 of the percentile aggregator like p95
+func getPercentile(aggregator string) (float64, bool) {
+	if strings.HasPrefix(aggregator, "p") == false {
+		return 0, false
+	}
+	percent, err := strconv.ParseFloat(aggregator[1:], 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, false
+	}
+	return percent, true
+}
+
+// Storage is the backend keeping the container records
+type Storage interface {
+	SaveContainerRecord(index string, documentType string, id string, jsonMap map[string]interface{}) error
+	BulkSaveContainerRecord(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError
+	// Aggregate the container records into time buckets per pod and container. The interval 0 aggregates
+	// the whole range into one bucket.
+	SearchContainerRecordAggregation(index string, documentType string, from time.Time, to time.Time,
+		intervalInSecond int, metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error)
+	// Aggregate the container records into time buckets per namespace, pod and container
+	SearchNamespaceRecordAggregation(index string, documentType string, from time.Time, to time.Time,
+		intervalInSecond int, metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error)
+	// Aggregate the container records of the pod, or only the container if the container name is not empty
+	SearchPodRecordAggregation(index string, documentType string, podName string, containerName string,
+		from time.Time, to time.Time, intervalInSecond int, metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error)
+	// Delete the index or all indices of the alias
+	DeleteContainerRecordIndex(index string) error
+	// Move the documents of the legacy indices not named with period into the indices named with period by the first time field found
+	MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error
+	GetAllIndex(indexPattern string) ([]string, error)
+	GetAllDocumentTypeForIndex(index string) ([]string, error)
+	GetContainerRecord(index string, documentType string, id string) (map[string]interface{}, error)
+}
+
+type MetricAggregation struct {
+	Name       string
+	Aggregator string
+	Field      string
+}
+
+type ContainerRecordAggregation struct {
+	TimestampSlice []string
+	BucketSlice    []ContainerRecordBucket
+}
+
+type ContainerRecordBucket struct {
+	TimeIndex int
+	// The namespace is only set by SearchNamespaceRecordAggregation
+	Namespace     string
+	PodName       string
+	ContainerName string
+	DocumentCount int64
+	// Metric aggregation name -> value. The value is absent if there is no data.
+	ValueMap map[string]float64
+}
+
+var storage Storage
+
+func getPodTermMap(podName string, containerName string) map[string]string {
+	termMap := make(map[string]string)
+	termMap["searchMetaData.podName"] = podName
+	if containerName != "" {
+		termMap["searchMetaData.containerName"] = containerName
+	}
+	return termMap
+}
+
+func init() {
+	switch configuration.GetStorageType() {
+	case configuration.StorageTypeLocal:
+		storage = CreateStorageLocal()
+	default:
+		storage = CreateStorageElasticSearch()
+	}
+}
+
+func saveContainerRecord(index string, documentType string, id string, jsonMap map[string]interface{}) error {
+	return storage.SaveContainerRecord(index, documentType, id, jsonMap)
+}
+
+func createContainerRecordBulkProcessor() *bulk.BulkProcessor {
+	return bulk.CreateBulkProcessorWithConfiguration(storage.BulkSaveContainerRecord)
+}
+
+func DeleteContainerRecordIndex(index string) error {
+	return storage.DeleteContainerRecordIndex(index)
+}
+
+// MigrateLegacyIndex moves the container metrics indices created before the rollover into the indices named with period
+func MigrateLegacyIndex() error {
+	return storage.MigrateLegacyIndex(indexContainerMetricsIndexPrefix+"*", []string{"stats.timestamp"})
+}
+
+// DeleteExpiredContainerRecordIndex deletes the container record indices older than the retention
+func DeleteExpiredContainerRecordIndex(now time.Time) error {
+	indexSlice, err := storage.GetAllIndex(indexContainerMetricsIndexPrefix + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if err := rollover.DeleteExpiredIndex(rollover.KindContainerMetrics, indexSlice, now, storage.DeleteContainerRecordIndex); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	rollupIndexSlice, err := storage.GetAllIndex(indexContainerMetricsRollupIndexPrefix + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return rollover.DeleteExpiredIndex(rollover.KindContainerMetricsRollup, rollupIndexSlice, now, storage.DeleteContainerRecordIndex)
+}
+
+func GetAllReplicationControllerNameInNameSpace(namespace string) ([]string, error) {
+	historicalWorkloadSlice, err := GetAllWorkloadInNameSpace(namespace)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	} else {
+		replicationControllerNameSlice := make([]string, 0)
+		for _, historicalWorkload := range historicalWorkloadSlice {
+			if historicalWorkload.Kind == control.WorkloadKindReplicationController {
+				replicationControllerNameSlice = append(replicationControllerNameSlice, historicalWorkload.Name)
+			}
+		}
+		return replicationControllerNameSlice, nil
+	}
+}
+
+func GetAllWorkloadInNameSpace(namespace string) ([]HistoricalWorkload, error) {
+	documentTypeSlice, err := storage.GetAllDocumentTypeForIndex(getDocumentIndex(namespace))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	} else {
+		historicalWorkloadSlice := make([]HistoricalWorkload, 0)
+		for _, documentType := range documentTypeSlice {
+			workloadKind, workloadName, ok := getWorkloadFromDocumentType(documentType)
+			if ok {
+				historicalWorkloadSlice = append(historicalWorkloadSlice, HistoricalWorkload{workloadKind, workloadName})
+			}
+		}
+		return historicalWorkloadSlice, nil
+	}
+}
+
+func GetContainerRecord(index string, documentType string, id string) (map[string]interface{}, error) {
+	return storage.GetContainerRecord(index, documentType, id)
+}
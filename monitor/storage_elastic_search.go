@@ -17,12 +17,23 @@ package monitor
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
 	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
-	elasticsearchlib "github.com/cloudawan/cloudone_utility/database/elasticsearch"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func init() {
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
 	createIndexTemplate()
+	createRollupIndexTemplate()
+	createNodeIndexTemplate()
+	return &StorageElasticSearch{}
 }
 
 func createIndexTemplate() error {
@@ -78,6 +89,14 @@ func createIndexTemplate() error {
 							"replicationControllerName":{
 								"type":"string",
 								"index":"not_analyzed"
+							},
+							"workloadKind":{
+								"type":"string",
+								"index":"not_analyzed"
+							},
+							"workloadName":{
+								"type":"string",
+								"index":"not_analyzed"
 							}
 						}
 					},
@@ -475,72 +494,474 @@ func createIndexTemplate() error {
 	return nil
 }
 
-func saveContainerRecord(index string, documentType string, id string, jsonMap map[string]interface{}) error {
+func createRollupIndexTemplate() error {
+	// The rollup values are double since the average is not integer
+	tempateBody := `
+	{
+		"template": "` + indexContainerMetricsRollupIndexPrefix + `*",
+		"mappings": {
+			"_default_": {
+				"_all": {
+					"enabled":true
+				},
+				"dynamic_templates":[
+					{
+						"string_fields":{
+							"match":"*",
+							"match_mapping_type":"string",
+							"mapping":{
+								"type":"string",
+								"index":"not_analyzed",
+								"omit_norms":true
+							}
+						}
+					},
+					{
+						"rollup_fields":{
+							"path_match":"rollup.*",
+							"mapping":{
+								"type":"double"
+							}
+						}
+					}
+				],
+				"properties":{
+					"documentCount":{
+						"type":"long"
+					},
+					"stats":{
+						"properties":{
+							"timestamp":{
+								"type":"date",
+								"format":"dateOptionalTime"
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	`
+
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.Index(index, documentType, id, nil, jsonMap)
+	request, err := connection.NewRequest("PUT", "/_template/template_"+indexContainerMetricsRollupIndexPrefix, "")
 	if err != nil {
 		log.Error(err)
 		return err
-	} else {
-		return nil
 	}
-}
-
-// Bulk Process
-const (
-	maxConnection = 5
-)
+	request.SetBodyString(tempateBody)
+	statusCode, bodyBytes, err := request.Do(nil)
+	if err != nil {
+		log.Error(err)
+		log.Error("statusCode %d", statusCode)
+		log.Error(string(bodyBytes))
+		return err
+	}
 
-func createBulkProcessor() *elasticsearchlib.BulkProcessor {
-	return elasticsearch.ElasticSearchClient.CreateBulkProcessor(maxConnection)
+	return nil
 }
 
-func SearchContainerRecordRawJson(index string, _type string, query interface{}) ([]byte, error) {
+func createNodeIndexTemplate() error {
+	tempateBody := `
+	{
+		"template": "` + indexNodeMetricsIndex + `*",
+		"mappings": {
+			"_default_": {
+				"_all": {
+					"enabled":true
+				},
+				"dynamic_templates":[
+					{
+						"string_fields":{
+							"match":"*",
+							"match_mapping_type":"string",
+							"mapping":{
+								"type":"string",
+								"index":"not_analyzed",
+								"omit_norms":true
+							}
+						}
+					}
+				],
+				"properties":{
+					"stats":{
+						"properties":{
+							"timestamp":{
+								"type":"date",
+								"format":"dateOptionalTime"
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	`
+
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	searchResult, err := connection.Search(index, _type, nil, query)
+	request, err := connection.NewRequest("PUT", "/_template/template_"+indexNodeMetricsIndex, "")
 	if err != nil {
-		return nil, err
-	} else {
-		return searchResult.RawJSON, nil
+		log.Error(err)
+		return err
+	}
+	request.SetBodyString(tempateBody)
+	statusCode, bodyBytes, err := request.Do(nil)
+	if err != nil {
+		log.Error(err)
+		log.Error("statusCode %d", statusCode)
+		log.Error(string(bodyBytes))
+		return err
 	}
+
+	return nil
 }
 
-func DeleteContainerRecordIndex(index string) error {
+func (storageElasticSearch *StorageElasticSearch) SaveContainerRecord(index string, documentType string, id string, jsonMap map[string]interface{}) error {
+	if err := elasticsearch.EnsureIndexWithAlias(index); err != nil {
+		log.Error(err)
+		return err
+	}
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	_, err := connection.DeleteIndex(index)
+	_, err := connection.Index(index, documentType, id, nil, jsonMap)
 	if err != nil {
+		log.Error(err)
 		return err
 	} else {
 		return nil
 	}
 }
 
-func GetAllReplicationControllerNameInNameSpace(namespace string) ([]string, error) {
-	documentTypeSlice, err := elasticsearch.ElasticSearchClient.GetAllTypeForIndex(getDocumentIndex(namespace))
+func (storageElasticSearch *StorageElasticSearch) BulkSaveContainerRecord(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+	return elasticsearch.BulkIndex(bulkItemSlice)
+}
+
+func (storageElasticSearch *StorageElasticSearch) SearchContainerRecordAggregation(index string, documentType string,
+	from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	return searchContainerRecordAggregation(index, documentType, nil, from, to, intervalInSecond, metricAggregationSlice, false)
+}
+
+func (storageElasticSearch *StorageElasticSearch) SearchNamespaceRecordAggregation(index string, documentType string,
+	from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	return searchContainerRecordAggregation(index, documentType, nil, from, to, intervalInSecond, metricAggregationSlice, true)
+}
+
+func (storageElasticSearch *StorageElasticSearch) SearchPodRecordAggregation(index string, documentType string,
+	podName string, containerName string, from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	return searchContainerRecordAggregation(index, documentType, getPodTermMap(podName, containerName),
+		from, to, intervalInSecond, metricAggregationSlice, false)
+}
+
+// The records are filtered with the field -> value in the term map
+func searchContainerRecordAggregation(index string, documentType string, termMap map[string]string,
+	from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation, groupByNamespace bool) (*ContainerRecordAggregation, error) {
+	gte := from.UTC().Format(time.RFC3339Nano)
+	lte := to.UTC().Format(time.RFC3339Nano)
+
+	queryField := `
+			"range" : {
+				"stats.timestamp" : {
+					"gte": "` + gte + `",
+					"lte": "` + lte + `",
+					"time_zone": "+00:00"
+				}
+			}`
+	if len(termMap) > 0 {
+		fieldSlice := make([]string, 0)
+		for field, _ := range termMap {
+			fieldSlice = append(fieldSlice, field)
+		}
+		sort.Strings(fieldSlice)
+		termBuffer := bytes.Buffer{}
+		for i, field := range fieldSlice {
+			if i > 0 {
+				termBuffer.WriteString(",")
+			}
+			// Escape the value from the caller
+			valueByteSlice, _ := json.Marshal(termMap[field])
+			termBuffer.WriteString(`
+							{ "term": { "` + field + `": ` + string(valueByteSlice) + ` } }`)
+		}
+		queryField = `
+			"filtered": {
+				"query": {` + queryField + `
+				},
+				"filter": {
+					"bool": {
+						"must": [` + termBuffer.String() + `
+						]
+					}
+				}
+			}`
+	}
+
+	metricAggregationBuffer := bytes.Buffer{}
+	for i, metricAggregation := range metricAggregationSlice {
+		if i > 0 {
+			metricAggregationBuffer.WriteString(",")
+		}
+		if metricAggregation.Aggregator == aggregatorLast {
+			// The latest document in the bucket
+			metricAggregationBuffer.WriteString(`
+									"` + metricAggregation.Name + `" : {
+										"top_hits" : {
+											"size" : 1,
+											"sort" : [ { "stats.timestamp" : { "order" : "desc" } } ],
+											"_source" : [ "` + metricAggregation.Field + `" ]
+										}
+									}`)
+		} else if percent, ok := getPercentile(metricAggregation.Aggregator); ok {
+			metricAggregationBuffer.WriteString(`
+									"` + metricAggregation.Name + `" : {
+										"percentiles" : {
+											"field" : "` + metricAggregation.Field + `",
+											"percents" : [ ` + strconv.FormatFloat(percent, 'f', -1, 64) + ` ]
+										}
+									}`)
+		} else {
+			metricAggregationBuffer.WriteString(`
+									"` + metricAggregation.Name + `" : { "` + metricAggregation.Aggregator + `" : { "field" : "` + metricAggregation.Field + `" } }`)
+		}
+	}
+
+	podAggregation := `
+					"aggregation_pod": {	
+						"terms": {
+							"field": "searchMetaData.podName",
+							"size": 0
+						},
+						"aggregations" : {
+							"aggregation_container": {	
+								"terms": {
+									"field": "searchMetaData.containerName",
+									"size": 0
+								},
+								"aggregations" : {` + metricAggregationBuffer.String() + `
+								}
+							}
+						}
+					}`
+	if groupByNamespace {
+		// The pod name is unique only in the namespace
+		podAggregation = `
+					"aggregation_namespace": {
+						"terms": {
+							"field": "searchMetaData.namespace",
+							"size": 0
+						},
+						"aggregations" : {` + podAggregation + `
+						}
+					}`
+	}
+
+	timeAggregation := `
+			"aggregation_time_interval": { 
+				"date_histogram": {
+					"field": "stats.timestamp",
+					"interval" : "` + strconv.Itoa(intervalInSecond) + `s"
+				},
+				"aggregations": {` + podAggregation + `
+				}
+			}`
+	if intervalInSecond <= 0 {
+		// The whole range is one bucket
+		timeAggregation = podAggregation
+	}
+
+	query := `
+	{
+		"query": {` + queryField + `
+	    },
+		"size": 0,
+		"aggregations": {` + timeAggregation + `
+		}
+	}
+	`
+
+	byteSlice, err := searchContainerRecordRawJson(index, documentType, query)
 	if err != nil {
 		log.Error(err)
 		return nil, err
+	}
+
+	jsonMap := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	if err := decoder.Decode(&jsonMap); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	aggregationJsonMap, ok := jsonMap["aggregations"].(map[string]interface{})
+	if ok == false {
+		log.Error("Fail to get aggregations with byteSlice %s", string(byteSlice))
+		return nil, errors.New("Fail to get aggregations with byteSlice " + string(byteSlice))
+	}
+
+	containerRecordAggregation := &ContainerRecordAggregation{
+		make([]string, 0),
+		make([]ContainerRecordBucket, 0),
+	}
+	var timeBucketSlice []interface{}
+	if intervalInSecond <= 0 {
+		// The only bucket starts from the range start
+		aggregationJsonMap["key_as_string"] = from.UTC().Format(time.RFC3339Nano)
+		timeBucketSlice = []interface{}{aggregationJsonMap}
 	} else {
-		replicationControllerNameSlice := make([]string, 0)
-		for _, documentType := range documentTypeSlice {
-			replicationControllerName := getReplicationControllerNameFromDocumentType(documentType)
-			replicationControllerNameSlice = append(replicationControllerNameSlice, replicationControllerName)
+		timeBucketSlice, _ = aggregationJsonMap["aggregation_time_interval"].(map[string]interface{})["buckets"].([]interface{})
+	}
+	for timeIndex, timeBucket := range timeBucketSlice {
+		timestamp, _ := timeBucket.(map[string]interface{})["key_as_string"].(string)
+		containerRecordAggregation.TimestampSlice = append(containerRecordAggregation.TimestampSlice, timestamp)
+
+		// The time bucket is the only parent of the pod buckets if they are not grouped by namespace
+		namespaceBucketSlice := []interface{}{timeBucket}
+		if groupByNamespace {
+			namespaceBucketSlice, _ = timeBucket.(map[string]interface{})["aggregation_namespace"].(map[string]interface{})["buckets"].([]interface{})
+		}
+		for _, namespaceBucket := range namespaceBucketSlice {
+			namespace := ""
+			if groupByNamespace {
+				namespace, _ = namespaceBucket.(map[string]interface{})["key"].(string)
+			}
+			podBucketSlice, _ := namespaceBucket.(map[string]interface{})["aggregation_pod"].(map[string]interface{})["buckets"].([]interface{})
+			for _, podBucket := range podBucketSlice {
+				podName, _ := podBucket.(map[string]interface{})["key"].(string)
+				containerBucketSlice, _ := podBucket.(map[string]interface{})["aggregation_container"].(map[string]interface{})["buckets"].([]interface{})
+				for _, containerBucket := range containerBucketSlice {
+					containerBucketJsonMap, _ := containerBucket.(map[string]interface{})
+					containerName, _ := containerBucketJsonMap["key"].(string)
+					documentCount, _ := convertJsonNumberToFloat64(containerBucketJsonMap["doc_count"])
+
+					valueMap := make(map[string]float64)
+					for _, metricAggregation := range metricAggregationSlice {
+						metricJsonMap, _ := containerBucketJsonMap[metricAggregation.Name].(map[string]interface{})
+						var value float64
+						var ok bool
+						if metricAggregation.Aggregator == aggregatorLast {
+							value, ok = getLastValueFromTopHits(metricJsonMap, metricAggregation.Field)
+						} else if _, isPercentile := getPercentile(metricAggregation.Aggregator); isPercentile {
+							value, ok = getValueFromPercentiles(metricJsonMap)
+						} else {
+							// The value is null if there is no data
+							value, ok = convertJsonNumberToFloat64(metricJsonMap["value"])
+						}
+						if ok {
+							valueMap[metricAggregation.Name] = value
+						}
+					}
+
+					containerRecordAggregation.BucketSlice = append(containerRecordAggregation.BucketSlice, ContainerRecordBucket{
+						timeIndex,
+						namespace,
+						podName,
+						containerName,
+						int64(documentCount),
+						valueMap,
+					})
+				}
+			}
+		}
+	}
+
+	return containerRecordAggregation, nil
+}
+
+func convertJsonNumberToFloat64(value interface{}) (float64, bool) {
+	number, ok := value.(json.Number)
+	if ok == false {
+		return 0, false
+	}
+	result, err := number.Float64()
+	if err != nil {
+		return 0, false
+	}
+	return result, true
+}
+
+func getLastValueFromTopHits(topHitsJsonMap map[string]interface{}, field string) (float64, bool) {
+	hitsJsonMap, _ := topHitsJsonMap["hits"].(map[string]interface{})
+	hitSlice, _ := hitsJsonMap["hits"].([]interface{})
+	if len(hitSlice) == 0 {
+		return 0, false
+	}
+	hitJsonMap, _ := hitSlice[0].(map[string]interface{})
+	// The counters in the array like the diskio of devices are summed so the rate is of all devices
+	if isCounterField(field) {
+		sourceJsonMap, _ := hitJsonMap["_source"].(map[string]interface{})
+		value, ok := getJsonMapInt64(sourceJsonMap, field)
+		return float64(value), ok
+	}
+	return getLastValueFromSource(hitJsonMap["_source"], strings.Split(field, "."))
+}
+
+// The last value is used if the field is in the array like the filesystem of devices
+func getLastValueFromSource(value interface{}, nameSlice []string) (float64, bool) {
+	if slice, ok := value.([]interface{}); ok {
+		for i := len(slice) - 1; i >= 0; i-- {
+			if result, ok := getLastValueFromSource(slice[i], nameSlice); ok {
+				return result, true
+			}
 		}
-		return replicationControllerNameSlice, nil
+		return 0, false
+	}
+	if len(nameSlice) == 0 {
+		return convertJsonNumberToFloat64(value)
 	}
+	jsonMap, ok := value.(map[string]interface{})
+	if ok == false {
+		return 0, false
+	}
+	return getLastValueFromSource(jsonMap[nameSlice[0]], nameSlice[1:])
+}
+
+// The percentiles has only one percent so the only value is returned. The value is null if there is no data.
+func getValueFromPercentiles(percentilesJsonMap map[string]interface{}) (float64, bool) {
+	valuesJsonMap, _ := percentilesJsonMap["values"].(map[string]interface{})
+	for _, value := range valuesJsonMap {
+		return convertJsonNumberToFloat64(value)
+	}
+	return 0, false
 }
 
-func GetContainerRecord(index string, documentType string, id string) (map[string]interface{}, error) {
+func searchContainerRecordRawJson(index string, _type string, query interface{}) ([]byte, error) {
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
-	baseResponse, err := connection.Get(index, documentType, id, nil)
+	searchResult, err := connection.Search(index, _type, nil, query)
+	if err != nil {
+		return nil, err
+	} else {
+		return searchResult.RawJSON, nil
+	}
+}
+
+func (storageElasticSearch *StorageElasticSearch) DeleteContainerRecordIndex(index string) error {
+	return elasticsearch.DeleteIndexOrAlias(index)
+}
+
+func (storageElasticSearch *StorageElasticSearch) MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	return elasticsearch.MigrateLegacyIndex(indexPattern, timeFieldSlice)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllIndex(indexPattern string) ([]string, error) {
+	return elasticsearch.GetAllIndex(indexPattern)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllDocumentTypeForIndex(index string) ([]string, error) {
+	return elasticsearch.GetAllTypeForIndex(index)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetContainerRecord(index string, documentType string, id string) (map[string]interface{}, error) {
+	// The index could be an alias with multiple indices so search by id instead of get
+	_, byteSlice, err := elasticsearch.GetByID(index, documentType, id)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	} else {
 		jsonMap := make(map[string]interface{})
-		decoder := json.NewDecoder(bytes.NewReader(*baseResponse.Source))
-		decoder.UseNumber()
-		err := decoder.Decode(&jsonMap)
+		err := elasticsearch.DecodeSource(byteSlice, &jsonMap)
 		if err != nil {
 			log.Error(err)
 			return nil, err
@@ -107,7 +107,7 @@ func TestLoadContainerRecordRawJson(t *testing.T) {
 		}
 	}
 	`
-	result, err := SearchContainerRecordRawJson(getDocumentIndex("default"), getDocumentType("cassandra"), query)
+	result, err := searchContainerRecordRawJson(getDocumentIndex("default"), getDocumentType("cassandra"), query)
 	fmt.Println(err)
 	fmt.Println(string(result))
 }
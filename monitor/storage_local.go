@@ -0,0 +1,283 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"sort"
+	"time"
+)
+
+const (
+	// The same format as key_as_string of date_histogram in Elastic Search
+	localTimestampFormat = "2006-01-02T15:04:05.000Z"
+)
+
+type StorageLocal struct {
+	documentStore *local.DocumentStore
+}
+
+func CreateStorageLocal() *StorageLocal {
+	return &StorageLocal{local.LocalDocumentStore}
+}
+
+func (storageLocal *StorageLocal) SaveContainerRecord(index string, documentType string, id string, jsonMap map[string]interface{}) error {
+	if err := storageLocal.documentStore.Index(index, documentType, id, jsonMap); err != nil {
+		log.Error(err)
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (storageLocal *StorageLocal) BulkSaveContainerRecord(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+	return storageLocal.documentStore.BulkIndex(bulkItemSlice)
+}
+
+type localBucketKey struct {
+	timeBucket    int64
+	namespace     string
+	podName       string
+	containerName string
+}
+
+func (storageLocal *StorageLocal) SearchContainerRecordAggregation(index string, documentType string,
+	from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	return storageLocal.searchContainerRecordAggregation(index, documentType, nil, from, to, intervalInSecond, metricAggregationSlice, false)
+}
+
+func (storageLocal *StorageLocal) SearchNamespaceRecordAggregation(index string, documentType string,
+	from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	return storageLocal.searchContainerRecordAggregation(index, documentType, nil, from, to, intervalInSecond, metricAggregationSlice, true)
+}
+
+func (storageLocal *StorageLocal) SearchPodRecordAggregation(index string, documentType string,
+	podName string, containerName string, from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation) (*ContainerRecordAggregation, error) {
+	return storageLocal.searchContainerRecordAggregation(index, documentType, getPodTermMap(podName, containerName),
+		from, to, intervalInSecond, metricAggregationSlice, false)
+}
+
+// The records are filtered with the field -> value in the term map
+func (storageLocal *StorageLocal) searchContainerRecordAggregation(index string, documentType string, termMap map[string]string,
+	from time.Time, to time.Time, intervalInSecond int,
+	metricAggregationSlice []MetricAggregation, groupByNamespace bool) (*ContainerRecordAggregation, error) {
+	if intervalInSecond < 0 {
+		return nil, errors.New("The interval can't be negative")
+	}
+	// The whole range is one bucket starting from the range start
+	wholeRange := intervalInSecond == 0
+	if wholeRange {
+		intervalInSecond = 1
+	}
+
+	documentSlice, err := storageLocal.documentStore.Search(index, documentType, func(document *local.Document) bool {
+		for field, value := range termMap {
+			if text, _ := document.GetFieldString(field); text != value {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	interval := int64(intervalInSecond)
+	documentGroupMap := make(map[localBucketKey][]local.Document)
+	keySlice := make([]localBucketKey, 0)
+	var minimumTimeBucket, maximumTimeBucket int64
+	found := false
+	for _, document := range documentSlice {
+		timestampText, _ := document.GetFieldString("stats.timestamp")
+		timestamp, err := time.Parse(time.RFC3339Nano, timestampText)
+		if err != nil || timestamp.Before(from) || timestamp.After(to) {
+			continue
+		}
+		namespace := ""
+		if groupByNamespace {
+			namespace, _ = document.GetFieldString("searchMetaData.namespace")
+		}
+		podName, _ := document.GetFieldString("searchMetaData.podName")
+		containerName, _ := document.GetFieldString("searchMetaData.containerName")
+
+		// Align the bucket to the epoch like date_histogram
+		timeBucket := timestamp.Unix() - timestamp.Unix()%interval
+		if wholeRange {
+			timeBucket = from.Unix()
+		}
+		key := localBucketKey{timeBucket, namespace, podName, containerName}
+		if _, ok := documentGroupMap[key]; ok == false {
+			keySlice = append(keySlice, key)
+		}
+		documentGroupMap[key] = append(documentGroupMap[key], document)
+
+		if found == false || timeBucket < minimumTimeBucket {
+			minimumTimeBucket = timeBucket
+		}
+		if found == false || timeBucket > maximumTimeBucket {
+			maximumTimeBucket = timeBucket
+		}
+		found = true
+	}
+
+	containerRecordAggregation := &ContainerRecordAggregation{
+		make([]string, 0),
+		make([]ContainerRecordBucket, 0),
+	}
+	if found == false {
+		return containerRecordAggregation, nil
+	}
+
+	for timeBucket := minimumTimeBucket; timeBucket <= maximumTimeBucket; timeBucket += interval {
+		containerRecordAggregation.TimestampSlice = append(containerRecordAggregation.TimestampSlice,
+			time.Unix(timeBucket, 0).UTC().Format(localTimestampFormat))
+	}
+
+	for _, key := range keySlice {
+		groupDocumentSlice := documentGroupMap[key]
+		// Sort by timestamp so the last value is the latest one
+		sort.SliceStable(groupDocumentSlice, func(i int, j int) bool {
+			iTimestamp, _ := groupDocumentSlice[i].GetFieldString("stats.timestamp")
+			jTimestamp, _ := groupDocumentSlice[j].GetFieldString("stats.timestamp")
+			return getLocalTimestamp(iTimestamp).Before(getLocalTimestamp(jTimestamp))
+		})
+		valueMap := make(map[string]float64)
+		for _, metricAggregation := range metricAggregationSlice {
+			// The field in the array has multiple values like Elastic Search
+			valueSlice := make([]float64, 0)
+			for _, document := range groupDocumentSlice {
+				if metricAggregation.Field == containerRecordTimestampField {
+					// The date is aggregated in milliseconds since the epoch like Elastic Search
+					timestampText, _ := document.GetFieldString(containerRecordTimestampField)
+					valueSlice = append(valueSlice, float64(getLocalTimestamp(timestampText).UnixNano()/int64(time.Millisecond)))
+					continue
+				}
+				valueSlice = append(valueSlice, document.GetFieldFloat64Slice(metricAggregation.Field)...)
+			}
+			if value, ok := aggregateFloat64Slice(metricAggregation.Aggregator, valueSlice); ok {
+				valueMap[metricAggregation.Name] = value
+			}
+		}
+
+		containerRecordAggregation.BucketSlice = append(containerRecordAggregation.BucketSlice, ContainerRecordBucket{
+			int((key.timeBucket - minimumTimeBucket) / interval),
+			key.namespace,
+			key.podName,
+			key.containerName,
+			int64(len(groupDocumentSlice)),
+			valueMap,
+		})
+	}
+
+	return containerRecordAggregation, nil
+}
+
+func getLocalTimestamp(timestampText string) time.Time {
+	timestamp, _ := time.Parse(time.RFC3339Nano, timestampText)
+	return timestamp
+}
+
+func aggregateFloat64Slice(aggregator string, valueSlice []float64) (float64, bool) {
+	if len(valueSlice) == 0 {
+		return 0, false
+	}
+
+	switch aggregator {
+	case aggregatorMinimum:
+		result := valueSlice[0]
+		for _, value := range valueSlice {
+			if value < result {
+				result = value
+			}
+		}
+		return result, true
+	case aggregatorMaximum:
+		result := valueSlice[0]
+		for _, value := range valueSlice {
+			if value > result {
+				result = value
+			}
+		}
+		return result, true
+	case aggregatorAverage:
+		sum := 0.0
+		for _, value := range valueSlice {
+			sum += value
+		}
+		return sum / float64(len(valueSlice)), true
+	case aggregatorSum:
+		sum := 0.0
+		for _, value := range valueSlice {
+			sum += value
+		}
+		return sum, true
+	case aggregatorLast:
+		return valueSlice[len(valueSlice)-1], true
+	case aggregatorPercentile50, aggregatorPercentile90, aggregatorPercentile95, aggregatorPercentile99:
+		percent, _ := getPercentile(aggregator)
+		return calculatePercentile(valueSlice, percent), true
+	default:
+		log.Error("Unknown aggregator %s", aggregator)
+		return 0, false
+	}
+}
+
+// Interpolate linearly between the closest ranks
+func calculatePercentile(valueSlice []float64, percent float64) float64 {
+	sortedValueSlice := make([]float64, len(valueSlice))
+	copy(sortedValueSlice, valueSlice)
+	sort.Float64s(sortedValueSlice)
+
+	rank := percent / 100 * float64(len(sortedValueSlice)-1)
+	lowerIndex := int(rank)
+	if lowerIndex >= len(sortedValueSlice)-1 {
+		return sortedValueSlice[len(sortedValueSlice)-1]
+	}
+	fraction := rank - float64(lowerIndex)
+	return sortedValueSlice[lowerIndex] + (sortedValueSlice[lowerIndex+1]-sortedValueSlice[lowerIndex])*fraction
+}
+
+func (storageLocal *StorageLocal) DeleteContainerRecordIndex(index string) error {
+	return storageLocal.documentStore.DeleteIndex(index)
+}
+
+func (storageLocal *StorageLocal) MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	// The memory is never kept from the version before the rollover
+	return nil
+}
+
+func (storageLocal *StorageLocal) GetAllIndex(indexPattern string) ([]string, error) {
+	return storageLocal.documentStore.GetAllIndex(indexPattern), nil
+}
+
+func (storageLocal *StorageLocal) GetAllDocumentTypeForIndex(index string) ([]string, error) {
+	return storageLocal.documentStore.GetAllTypeForIndex(index)
+}
+
+func (storageLocal *StorageLocal) GetContainerRecord(index string, documentType string, id string) (map[string]interface{}, error) {
+	jsonMap, err := storageLocal.documentStore.Get(index, documentType, id)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	} else {
+		return jsonMap, nil
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"github.com/cloudawan/cloudone_analysis/control"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"testing"
+	"time"
+)
+
+func createTestContainerRecord(podName string, containerName string, timestamp time.Time, cpuUsageTotal int64) map[string]interface{} {
+	containerRecord := make(map[string]interface{})
+	containerRecord["searchMetaData"] = map[string]interface{}{
+		"podName":       podName,
+		"containerName": containerName,
+	}
+	containerRecord["stats"] = map[string]interface{}{
+		"timestamp": timestamp.UTC().Format(time.RFC3339Nano),
+		"cpu": map[string]interface{}{
+			"usage": map[string]interface{}{
+				"total": cpuUsageTotal,
+			},
+		},
+	}
+	return containerRecord
+}
+
+func TestStorageLocalSearchContainerRecordAggregation(t *testing.T) {
+	storageLocal := &StorageLocal{local.CreateDocumentStore()}
+	index := getDocumentIndex("default")
+	documentType := getDocumentType(control.WorkloadKindReplicationController, "nginx")
+
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 40; i++ {
+		// Leave a hole between 10 and 20 second
+		if i >= 10 && i < 20 {
+			continue
+		}
+		timestamp := from.Add(time.Duration(i) * time.Second)
+		storageLocal.SaveContainerRecord(index, documentType, getDocumentID("nginx-1", "nginx", timestamp),
+			createTestContainerRecord("nginx-1", "nginx", timestamp, int64(i*100)))
+	}
+
+	metricAggregationSlice := []MetricAggregation{
+		MetricAggregation{"minimumCpuUsageTotal", aggregatorMinimum, "stats.cpu.usage.total"},
+		MetricAggregation{"maximumCpuUsageTotal", aggregatorMaximum, "stats.cpu.usage.total"},
+	}
+	containerRecordAggregation, err := storageLocal.SearchContainerRecordAggregation(index, documentType,
+		from, from.Add(time.Minute), 10, metricAggregationSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containerRecordAggregation.TimestampSlice) != 4 {
+		t.Fatalf("Expect 4 time buckets but get %v", containerRecordAggregation.TimestampSlice)
+	}
+	if containerRecordAggregation.TimestampSlice[0] != "2016-01-01T00:00:00.000Z" {
+		t.Errorf("Unexpected first timestamp %s", containerRecordAggregation.TimestampSlice[0])
+	}
+	// The empty bucket has no data
+	if len(containerRecordAggregation.BucketSlice) != 3 {
+		t.Fatalf("Expect 3 buckets but get %v", containerRecordAggregation.BucketSlice)
+	}
+	for _, containerRecordBucket := range containerRecordAggregation.BucketSlice {
+		if containerRecordBucket.TimeIndex == 3 {
+			if containerRecordBucket.DocumentCount != 10 {
+				t.Errorf("Expect 10 documents but get %d", containerRecordBucket.DocumentCount)
+			}
+			if containerRecordBucket.ValueMap["minimumCpuUsageTotal"] != 3000 {
+				t.Errorf("Expect minimum 3000 but get %v", containerRecordBucket.ValueMap["minimumCpuUsageTotal"])
+			}
+			if containerRecordBucket.ValueMap["maximumCpuUsageTotal"] != 3900 {
+				t.Errorf("Expect maximum 3900 but get %v", containerRecordBucket.ValueMap["maximumCpuUsageTotal"])
+			}
+		}
+	}
+}
+
+func TestCalculatePercentile(t *testing.T) {
+	valueSlice := []float64{5, 1, 4, 2, 3}
+	for _, testCase := range []struct {
+		Aggregator string
+		Expected   float64
+	}{
+		{aggregatorPercentile50, 3},
+		{aggregatorPercentile90, 4.6},
+		{aggregatorPercentile99, 4.96},
+	} {
+		value, ok := aggregateFloat64Slice(testCase.Aggregator, valueSlice)
+		if ok == false || value < testCase.Expected-1e-9 || value > testCase.Expected+1e-9 {
+			t.Errorf("Expect %s %v but get %v", testCase.Aggregator, testCase.Expected, value)
+		}
+	}
+	// The input is not changed
+	if valueSlice[0] != 5 {
+		t.Errorf("The input is sorted %v", valueSlice)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"text/template"
+	"time"
+)
+
+const (
+	// The notification is posted as JSON
+	ChannelKindWebhook = "webhook"
+	// The Slack-compatible incoming webhook receiving the text
+	ChannelKindSlack = "slack"
+	// The email sent to the recipients through the configured SMTP server
+	ChannelKindEmail = "email"
+)
+
+const (
+	TopicAlert = "alert"
+	TopicEvent = "event"
+	TopicBuild = "build"
+	// The daily summary of the unacknowledged Warning events
+	TopicDigest = "digest"
+)
+
+var topicSlice = []string{TopicAlert, TopicEvent, TopicBuild, TopicDigest}
+
+// The secret is replaced with the mask when the channel is returned
+const secretMask = "******"
+
+// The channel name is the document id and the path parameter so it is restricted like the Kubernetes name
+var channelNameRegexp = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+// Channel receives the notifications of the topics or all topics if empty. The secret, if not empty,
+// signs the payload with HMAC-SHA256. The email channel has the recipients instead of the URL and
+// renders the subject and body with the text templates executed with the Notification.
+type Channel struct {
+	Name            string
+	Kind            string
+	URL             string
+	Secret          string
+	RecipientSlice  []string
+	SubjectTemplate string
+	BodyTemplate    string
+	TopicSlice      []string
+	CreatedTime     time.Time
+}
+
+func ValidateChannel(channel *Channel) error {
+	if channelNameRegexp.MatchString(channel.Name) == false {
+		return errors.New("The channel name " + channel.Name + " must consist of lower case alphanumeric characters or '-'")
+	}
+	switch channel.Kind {
+	case ChannelKindWebhook, ChannelKindSlack:
+		parsedURL, err := url.Parse(channel.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return errors.New("The URL " + channel.URL + " must be the absolute http or https URL")
+		}
+	case ChannelKindEmail:
+		if channel.URL != "" {
+			return errors.New("The email channel has no URL since the SMTP server is configured")
+		}
+		if len(channel.RecipientSlice) == 0 {
+			return errors.New("The email channel needs at least one recipient")
+		}
+		for _, recipient := range channel.RecipientSlice {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				return errors.New("Invalid recipient " + recipient + " with error " + err.Error())
+			}
+		}
+	default:
+		return errors.New("Unknown channel kind " + channel.Kind)
+	}
+	// The templates are executed with a sample so the reference to an unknown field fails here instead of in the delivery
+	sampleNotification := &Notification{"id", TopicAlert, "subject", "message", map[string]interface{}{}, time.Now().UTC()}
+	for _, text := range []string{channel.SubjectTemplate, channel.BodyTemplate} {
+		parsedTemplate, err := template.New("").Parse(text)
+		if err != nil {
+			return errors.New("Invalid template " + text + " with error " + err.Error())
+		}
+		if err := parsedTemplate.Execute(ioutil.Discard, sampleNotification); err != nil {
+			return errors.New("Invalid template " + text + " with error " + err.Error())
+		}
+	}
+	for _, topic := range channel.TopicSlice {
+		found := false
+		for _, knownTopic := range topicSlice {
+			if topic == knownTopic {
+				found = true
+			}
+		}
+		if found == false {
+			return errors.New("Unknown topic " + topic)
+		}
+	}
+	return nil
+}
+
+func (channel *Channel) isSubscribed(topic string) bool {
+	if len(channel.TopicSlice) == 0 {
+		return true
+	}
+	for _, subscribedTopic := range channel.TopicSlice {
+		if subscribedTopic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func maskSecret(channel *Channel) {
+	if channel.Secret != "" {
+		channel.Secret = secretMask
+	}
+}
+
+func CreateChannel(channel *Channel) error {
+	if err := ValidateChannel(channel); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := storage.GetChannel(indexNotificationChannelIndex, typeNotificationChannel, channel.Name); err == nil {
+		return errors.New("The channel " + channel.Name + " already exists")
+	}
+	channel.CreatedTime = time.Now().UTC()
+	return storage.SaveChannel(indexNotificationChannelIndex, typeNotificationChannel, channel)
+}
+
+// UpdateChannel replaces the channel with the same name. The secret is kept if it is empty or the mask
+// unless clearSecret is set to remove it.
+func UpdateChannel(channel *Channel, clearSecret bool) error {
+	if err := ValidateChannel(channel); err != nil {
+		log.Error(err)
+		return err
+	}
+	oldChannel, err := storage.GetChannel(indexNotificationChannelIndex, typeNotificationChannel, channel.Name)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if clearSecret {
+		channel.Secret = ""
+	} else if channel.Secret == "" || channel.Secret == secretMask {
+		channel.Secret = oldChannel.Secret
+	}
+	channel.CreatedTime = oldChannel.CreatedTime
+	return storage.SaveChannel(indexNotificationChannelIndex, typeNotificationChannel, channel)
+}
+
+// GetChannel returns the channel with the secret masked
+func GetChannel(name string) (*Channel, error) {
+	channel, err := storage.GetChannel(indexNotificationChannelIndex, typeNotificationChannel, name)
+	if err != nil {
+		return nil, err
+	}
+	maskSecret(channel)
+	return channel, nil
+}
+
+// GetAllChannel returns the channels sorted by name with the secret masked
+func GetAllChannel() ([]Channel, error) {
+	channelSlice, err := storage.GetAllChannel(indexNotificationChannelIndex, typeNotificationChannel)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	for i, _ := range channelSlice {
+		maskSecret(&channelSlice[i])
+	}
+	return channelSlice, nil
+}
+
+func DeleteChannel(name string) error {
+	return storage.DeleteChannel(indexNotificationChannelIndex, typeNotificationChannel, name)
+}
@@ -0,0 +1,410 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"github.com/cloudawan/cloudone_utility/logger"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Saved before the first attempt and while waiting for the retry
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	// The dead letter kept after all attempts failed
+	DeliveryStatusDead = "dead"
+)
+
+const (
+	workerAmountDefault                 = 4
+	queueSizeDefault                    = 1024
+	retryAmountDefault                  = 5
+	retryInitialIntervalInSecondDefault = 2
+	retryMaximumIntervalInSecondDefault = 300
+	timeoutInSecondDefault              = 10
+	resumePageSize                      = 100
+	deliveryStaleMargin                 = 1 * time.Minute
+)
+
+const (
+	HeaderDelivery  = "X-Cloudone-Delivery"
+	HeaderTopic     = "X-Cloudone-Topic"
+	HeaderSignature = "X-Cloudone-Signature"
+	// The signature is the hex HMAC-SHA256 of the body with the channel secret
+	signaturePrefix = "sha256="
+)
+
+// Notification is posted as the body to the webhook channels
+type Notification struct {
+	ID          string
+	Topic       string
+	Subject     string
+	Message     string
+	Data        interface{}
+	CreatedTime time.Time
+}
+
+// Delivery records the notification sent to a channel. The payload is kept as it is sent.
+type Delivery struct {
+	ID             string
+	NotificationID string
+	ChannelName    string
+	Topic          string
+	Subject        string
+	Status         string
+	AttemptAmount  int
+	// The response status code of the last attempt
+	StatusCode  int
+	Error       string
+	Payload     string
+	CreatedTime time.Time
+	UpdatedTime time.Time
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+var deliveryQueue chan *Delivery
+var startWorkerOnce sync.Once
+
+func getConfigurationInt(key string, defaultValue int) int {
+	value, ok := configuration.LocalConfiguration.GetInt(key)
+	if ok == false || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func createID() (string, error) {
+	byteSlice := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, byteSlice); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return hex.EncodeToString(byteSlice), nil
+}
+
+func createPayload(channel *Channel, notification *Notification) ([]byte, error) {
+	switch channel.Kind {
+	case ChannelKindSlack:
+		return json.Marshal(slackMessage{"*" + notification.Subject + "*\n" + notification.Message})
+	case ChannelKindEmail:
+		return createEmailMessage(getSMTPFrom(), channel, notification)
+	default:
+		return json.Marshal(notification)
+	}
+}
+
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish sends the notification to all channels subscribing the topic. The deliveries are
+// done in the background and recorded so the failed ones could be found. The failure of a channel is recorded
+// in its delivery, retried or kept as dead, instead of being returned.
+func Publish(topic string, subject string, message string, data interface{}) error {
+	channelSlice, err := storage.GetAllChannel(indexNotificationChannelIndex, typeNotificationChannel)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	notificationID, err := createID()
+	if err != nil {
+		return err
+	}
+	notification := &Notification{
+		notificationID,
+		topic,
+		subject,
+		message,
+		data,
+		time.Now().UTC(),
+	}
+
+	hasError := false
+	for i, _ := range channelSlice {
+		channel := &channelSlice[i]
+		if channel.isSubscribed(topic) == false {
+			continue
+		}
+		deliveryID, err := createID()
+		if err != nil {
+			hasError = true
+			continue
+		}
+		delivery := &Delivery{
+			deliveryID,
+			notification.ID,
+			channel.Name,
+			topic,
+			subject,
+			DeliveryStatusPending,
+			0,
+			0,
+			"",
+			"",
+			notification.CreatedTime,
+			notification.CreatedTime,
+		}
+		payload, err := createPayload(channel, notification)
+		if err != nil {
+			// The payload failing to be created never succeeds in the retry so it is kept as dead
+			log.Error(err)
+			delivery.Status = DeliveryStatusDead
+			delivery.Error = "Fail to create the payload: " + err.Error()
+			saveDelivery(delivery)
+			continue
+		}
+		delivery.Payload = string(payload)
+		// The delivery is still attempted if it fails to be saved and the result of the attempt is saved again
+		saveDelivery(delivery)
+		enqueue(delivery)
+	}
+
+	if hasError {
+		return errors.New("Fail to publish the notification " + subject + " to some channels")
+	} else {
+		return nil
+	}
+}
+
+func saveDelivery(delivery *Delivery) error {
+	// The delivery is always saved in the index of its creation so the update replaces the same document
+	index := rollover.GetIndexName(indexNotificationDeliveryIndex, delivery.CreatedTime)
+	if err := storage.SaveDelivery(index, typeNotificationDelivery, delivery); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func startWorker() {
+	startWorkerOnce.Do(func() {
+		deliveryQueue = make(chan *Delivery, getConfigurationInt("notificationQueueSize", queueSizeDefault))
+		workerAmount := getConfigurationInt("notificationWorkerAmount", workerAmountDefault)
+		for i := 0; i < workerAmount; i++ {
+			go func() {
+				for delivery := range deliveryQueue {
+					processDelivery(delivery)
+				}
+			}()
+		}
+	})
+}
+
+// enqueue keeps the delivery pending and tries again later if the queue is full
+func enqueue(delivery *Delivery) {
+	startWorker()
+	select {
+	case deliveryQueue <- delivery:
+	default:
+		log.Error("The delivery queue is full so the delivery %s to the channel %s is queued later",
+			delivery.ID, delivery.ChannelName)
+		// Keep it updated so it isn't taken as stale and resumed while waiting
+		if time.Since(delivery.UpdatedTime) > getDeliveryStaleDuration()/2 {
+			delivery.UpdatedTime = time.Now().UTC()
+			saveDelivery(delivery)
+		}
+		time.AfterFunc(getRetryDelay(1), func() {
+			enqueue(delivery)
+		})
+	}
+}
+
+// getDeliveryStaleDuration returns how long the pending delivery is not updated after which no instance is retrying it.
+// The instance retrying the delivery updates it at each attempt at least once in the maximum retry interval.
+func getDeliveryStaleDuration() time.Duration {
+	return time.Duration(getConfigurationInt("notificationRetryMaximumIntervalInSecond", retryMaximumIntervalInSecondDefault)+
+		getConfigurationInt("notificationTimeoutInSecond", timeoutInSecondDefault))*time.Second + deliveryStaleMargin
+}
+
+// ResumePendingDelivery queues the pending deliveries which no instance is retrying, like the ones left by
+// the instance restarted, again. The delivery is saved as updated before queuing so it isn't resumed twice.
+// The receiver may still get the same delivery twice if it was sent but not saved so the delivery id is in
+// the header to tell it.
+func ResumePendingDelivery(now time.Time) error {
+	staleTime := now.Add(-getDeliveryStaleDuration())
+	staleDeliverySlice := make([]Delivery, 0)
+	// All pending deliveries are read before queuing since the delivered ones are removed from the search
+	for offset := 0; ; offset += resumePageSize {
+		deliverySlice, err := SearchDelivery("", DeliveryStatusPending, nil, nil, resumePageSize, offset)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		for _, delivery := range deliverySlice {
+			if delivery.UpdatedTime.Before(staleTime) {
+				staleDeliverySlice = append(staleDeliverySlice, delivery)
+			}
+		}
+		if len(deliverySlice) < resumePageSize {
+			break
+		}
+	}
+	for i, _ := range staleDeliverySlice {
+		delivery := &staleDeliverySlice[i]
+		delivery.UpdatedTime = now.UTC()
+		if err := saveDelivery(delivery); err != nil {
+			continue
+		}
+		enqueue(delivery)
+	}
+	if len(staleDeliverySlice) > 0 {
+		log.Info("Resume %d pending deliveries", len(staleDeliverySlice))
+	}
+	return nil
+}
+
+func processDelivery(delivery *Delivery) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("processDelivery Error: %s", err)
+			log.Error(logger.GetStackTrace(4096, false))
+		}
+	}()
+
+	if retryDelay, retry := attemptDelivery(delivery); retry {
+		time.AfterFunc(retryDelay, func() {
+			enqueue(delivery)
+		})
+	}
+}
+
+// getRetryDelay doubles the delay after each failed attempt up to the maximum
+func getRetryDelay(attemptAmount int) time.Duration {
+	initialDelay := time.Duration(getConfigurationInt("notificationRetryInitialIntervalInSecond",
+		retryInitialIntervalInSecondDefault)) * time.Second
+	maximumDelay := time.Duration(getConfigurationInt("notificationRetryMaximumIntervalInSecond",
+		retryMaximumIntervalInSecondDefault)) * time.Second
+	delay := initialDelay
+	for i := 1; i < attemptAmount && delay < maximumDelay; i++ {
+		delay *= 2
+	}
+	if delay > maximumDelay {
+		return maximumDelay
+	}
+	return delay
+}
+
+// attemptDelivery posts the payload once and saves the result. It returns the delay if it needs to be retried.
+func attemptDelivery(delivery *Delivery) (time.Duration, bool) {
+	delivery.AttemptAmount++
+	delivery.StatusCode = 0
+	delivery.Error = ""
+
+	// The channel is read again so the change of the URL or secret applies to the retry
+	channel, err := storage.GetChannel(indexNotificationChannelIndex, typeNotificationChannel, delivery.ChannelName)
+	if err != nil {
+		delivery.Error = "Fail to get the channel " + delivery.ChannelName + ": " + err.Error()
+	} else {
+		delivery.StatusCode, err = send(channel, delivery)
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+	}
+	delivery.UpdatedTime = time.Now().UTC()
+
+	retryAmount := getConfigurationInt("notificationRetryAmount", retryAmountDefault)
+	retry := false
+	if delivery.Error == "" {
+		delivery.Status = DeliveryStatusDelivered
+	} else if delivery.AttemptAmount > retryAmount {
+		delivery.Status = DeliveryStatusDead
+		log.Error("Delivery %s to the channel %s is dead after %d attempts: %s",
+			delivery.ID, delivery.ChannelName, delivery.AttemptAmount, delivery.Error)
+	} else {
+		delivery.Status = DeliveryStatusPending
+		retry = true
+	}
+	saveDelivery(delivery)
+
+	return getRetryDelay(delivery.AttemptAmount), retry
+}
+
+// send returns the response status code of the webhook or 0 for the email
+func send(channel *Channel, delivery *Delivery) (int, error) {
+	if channel.Kind == ChannelKindEmail {
+		server, err := getSMTPServer()
+		if err != nil {
+			return 0, err
+		}
+		return 0, sendEmail(server, channel, []byte(delivery.Payload))
+	}
+	return post(channel, delivery)
+}
+
+func post(channel *Channel, delivery *Delivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	request, err := http.NewRequest("POST", channel.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderDelivery, delivery.ID)
+	request.Header.Set(HeaderTopic, delivery.Topic)
+	if channel.Secret != "" {
+		request.Header.Set(HeaderSignature, sign(channel.Secret, payload))
+	}
+
+	timeout := time.Duration(getConfigurationInt("notificationTimeoutInSecond", timeoutInSecondDefault)) * time.Second
+	client := &http.Client{Timeout: timeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// Read the body so the connection could be reused
+	ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, errors.New("The channel responds with the status code " + strconv.Itoa(response.StatusCode))
+	}
+	return response.StatusCode, nil
+}
+
+func SearchDelivery(channelName string, status string, from *time.Time, to *time.Time, size int, offset int) ([]Delivery, error) {
+	if from != nil && to != nil && from.After(*to) {
+		return nil, errors.New("From " + from.String() + " can't be after to " + to.String())
+	}
+	return storage.SearchDelivery(indexNotificationDeliveryIndex, typeNotificationDelivery, channelName, status,
+		from, to, size, offset)
+}
+
+func DeleteExpiredDeliveryIndex(now time.Time) error {
+	indexSlice, err := storage.GetAllIndex(indexNotificationDeliveryIndex + rollover.Separator + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return rollover.DeleteExpiredIndex(rollover.KindNotificationDelivery, indexSlice, now, storage.DeleteIndex)
+}
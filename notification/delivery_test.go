@@ -0,0 +1,231 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAttemptDelivery(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	var receivedSignature string
+	var receivedBody []byte
+	statusCode := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		receivedSignature = request.Header.Get(HeaderSignature)
+		receivedBody, _ = ioutil.ReadAll(request.Body)
+		responseWriter.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+
+	channel := &Channel{
+		Name:   "ops",
+		Kind:   ChannelKindWebhook,
+		URL:    server.URL,
+		Secret: "secret",
+	}
+	if err := CreateChannel(channel); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	delivery := &Delivery{
+		ID:          "delivery",
+		ChannelName: "ops",
+		Topic:       TopicAlert,
+		Status:      DeliveryStatusPending,
+		Payload:     `{"Subject":"test"}`,
+		CreatedTime: now,
+	}
+
+	// Delivered with the signature of the body
+	if _, retry := attemptDelivery(delivery); retry || delivery.Status != DeliveryStatusDelivered {
+		t.Fatalf("Expect delivered but get %v", delivery)
+	}
+	if string(receivedBody) != delivery.Payload || receivedSignature != sign("secret", receivedBody) {
+		t.Errorf("Unexpected body %s or signature %s", receivedBody, receivedSignature)
+	}
+
+	// Retried after the failure
+	statusCode = http.StatusInternalServerError
+	delivery.AttemptAmount = 0
+	retryDelay, retry := attemptDelivery(delivery)
+	if retry == false || delivery.Status != DeliveryStatusPending || delivery.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expect pending for the retry but get %v", delivery)
+	}
+	if retryDelay != time.Duration(retryInitialIntervalInSecondDefault)*time.Second {
+		t.Errorf("Expect the initial retry delay but get %v", retryDelay)
+	}
+
+	// Dead after the last attempt
+	delivery.AttemptAmount = retryAmountDefault
+	if _, retry := attemptDelivery(delivery); retry || delivery.Status != DeliveryStatusDead {
+		t.Errorf("Expect dead but get %v", delivery)
+	}
+
+	deliverySlice, err := SearchDelivery("ops", DeliveryStatusDead, nil, nil, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliverySlice) != 1 || deliverySlice[0].AttemptAmount != retryAmountDefault+1 {
+		t.Errorf("Expect the dead delivery but get %v", deliverySlice)
+	}
+}
+
+func TestResumePendingDelivery(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	receivedChannel := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		receivedChannel <- request.Header.Get(HeaderDelivery)
+	}))
+	defer server.Close()
+
+	if err := CreateChannel(&Channel{Name: "ops", Kind: ChannelKindWebhook, URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	// Left pending by the restarted instance and the one still retried by another instance
+	now := time.Now().UTC()
+	staleTime := now.Add(-getDeliveryStaleDuration() - time.Minute)
+	for _, delivery := range []*Delivery{
+		&Delivery{ID: "stale", ChannelName: "ops", Topic: TopicAlert, Status: DeliveryStatusPending,
+			Payload: `{"Subject":"test"}`, CreatedTime: staleTime, UpdatedTime: staleTime},
+		&Delivery{ID: "retrying", ChannelName: "ops", Topic: TopicAlert, Status: DeliveryStatusPending,
+			Payload: `{"Subject":"test"}`, CreatedTime: staleTime, UpdatedTime: now.Add(-time.Minute)},
+	} {
+		if err := saveDelivery(delivery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ResumePendingDelivery(now); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case deliveryID := <-receivedChannel:
+		if deliveryID != "stale" {
+			t.Errorf("Expect the stale delivery but get %s", deliveryID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expect the stale delivery sent again")
+	}
+	// Resumed only once
+	if err := ResumePendingDelivery(now); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case deliveryID := <-receivedChannel:
+		t.Errorf("Expect no more delivery but get %s", deliveryID)
+	case <-time.After(500 * time.Millisecond):
+	}
+	// Wait for the result saved by the worker
+	for i := 0; i < 50; i++ {
+		if deliverySlice, _ := SearchDelivery("ops", DeliveryStatusDelivered, nil, nil, 10, 0); len(deliverySlice) == 1 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Error("Expect the delivery saved as delivered")
+}
+
+func TestUpdateChannelSecret(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	channel := &Channel{Name: "ops", Kind: ChannelKindWebhook, URL: "http://example.com", Secret: "secret"}
+	if err := CreateChannel(channel); err != nil {
+		t.Fatal(err)
+	}
+
+	// The masked secret is kept
+	channel = &Channel{Name: "ops", Kind: ChannelKindWebhook, URL: "http://example.com", Secret: secretMask}
+	if err := UpdateChannel(channel, false); err != nil {
+		t.Fatal(err)
+	}
+	if savedChannel, _ := storage.GetChannel(indexNotificationChannelIndex, typeNotificationChannel, "ops"); savedChannel.Secret != "secret" {
+		t.Errorf("Expect the secret kept but get %s", savedChannel.Secret)
+	}
+
+	channel = &Channel{Name: "ops", Kind: ChannelKindWebhook, URL: "http://example.com", Secret: secretMask}
+	if err := UpdateChannel(channel, true); err != nil {
+		t.Fatal(err)
+	}
+	if savedChannel, _ := storage.GetChannel(indexNotificationChannelIndex, typeNotificationChannel, "ops"); savedChannel.Secret != "" {
+		t.Errorf("Expect the secret cleared but get %s", savedChannel.Secret)
+	}
+}
+
+func TestPublishKeepingFailedPayloadAsDead(t *testing.T) {
+	storage = &StorageLocal{local.CreateDocumentStore()}
+
+	// The field is only missing in the data of the real notification
+	channel := &Channel{
+		Name:           "ops-mail",
+		Kind:           ChannelKindEmail,
+		RecipientSlice: []string{"ops@example.com"},
+		BodyTemplate:   "{{.Data.Missing}}",
+	}
+	if err := CreateChannel(channel); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Publish(TopicBuild, "Build", "Finished", struct{ Name string }{"nginx"}); err != nil {
+		t.Fatalf("Expect the failure of the channel not returned but get %v", err)
+	}
+	deliverySlice, err := SearchDelivery("ops-mail", DeliveryStatusDead, nil, nil, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliverySlice) != 1 || deliverySlice[0].AttemptAmount != 0 || deliverySlice[0].Error == "" {
+		t.Errorf("Expect the dead delivery but get %v", deliverySlice)
+	}
+}
+
+func TestGetRetryDelay(t *testing.T) {
+	if delay := getRetryDelay(3); delay != 8*time.Second {
+		t.Errorf("Expect 8s but get %v", delay)
+	}
+	if delay := getRetryDelay(20); delay != time.Duration(retryMaximumIntervalInSecondDefault)*time.Second {
+		t.Errorf("Expect the maximum but get %v", delay)
+	}
+}
+
+func TestCreatePayload(t *testing.T) {
+	notification := &Notification{"id", TopicBuild, "Build", "Finished", nil, time.Now()}
+	byteSlice, err := createPayload(&Channel{Kind: ChannelKindSlack}, notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonMap := make(map[string]interface{})
+	json.Unmarshal(byteSlice, &jsonMap)
+	if jsonMap["text"] != "*Build*\nFinished" {
+		t.Errorf("Unexpected slack payload %s", byteSlice)
+	}
+}
+
+func TestValidateChannel(t *testing.T) {
+	if err := ValidateChannel(&Channel{Name: "ops", Kind: ChannelKindSlack, URL: "ftp://host"}); err == nil {
+		t.Error("Expect error for the non http URL")
+	}
+	if err := ValidateChannel(&Channel{Name: "ops", Kind: ChannelKindWebhook, URL: "http://host", TopicSlice: []string{"unknown"}}); err == nil {
+		t.Error("Expect error for the unknown topic")
+	}
+}
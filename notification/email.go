@@ -0,0 +1,200 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	smtpPortDefault        = 25
+	subjectTemplateDefault = "[CloudOne] {{.Subject}}"
+	bodyTemplateDefault    = "{{.Message}}\n\nTopic: {{.Topic}}\nTime: {{.CreatedTime.Format \"2006-01-02T15:04:05Z07:00\"}}\n"
+)
+
+// smtpServer is shared by all email channels so the credentials are kept in the configuration
+type smtpServer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	// The limit of the whole conversation with the server
+	timeout time.Duration
+}
+
+func getSMTPFrom() string {
+	from, _ := configuration.LocalConfiguration.GetString("smtpFrom")
+	return from
+}
+
+func getSMTPServer() (*smtpServer, error) {
+	host, _ := configuration.LocalConfiguration.GetString("smtpHost")
+	if host == "" {
+		return nil, errors.New("The SMTP server smtpHost is not configured")
+	}
+	from := getSMTPFrom()
+	if from == "" {
+		return nil, errors.New("The sender smtpFrom is not configured")
+	}
+	username, _ := configuration.LocalConfiguration.GetString("smtpUsername")
+	password, _ := configuration.LocalConfiguration.GetString("smtpPassword")
+	return &smtpServer{
+		host,
+		getConfigurationInt("smtpPort", smtpPortDefault),
+		username,
+		password,
+		from,
+		time.Duration(getConfigurationInt("notificationTimeoutInSecond", timeoutInSecondDefault)) * time.Second,
+	}, nil
+}
+
+func renderTemplate(text string, defaultText string, notification *Notification) (string, error) {
+	if text == "" {
+		text = defaultText
+	}
+	parsedTemplate, err := template.New("").Parse(text)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	buffer := bytes.Buffer{}
+	if err := parsedTemplate.Execute(&buffer, notification); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// createEmailMessage renders the templates of the channel into the plain text message in the RFC 5322 format
+func createEmailMessage(from string, channel *Channel, notification *Notification) ([]byte, error) {
+	subject, err := renderTemplate(channel.SubjectTemplate, subjectTemplateDefault, notification)
+	if err != nil {
+		return nil, err
+	}
+	body, err := renderTemplate(channel.BodyTemplate, bodyTemplateDefault, notification)
+	if err != nil {
+		return nil, err
+	}
+	// The line break in the subject would start another header
+	subject = strings.Join(strings.Fields(subject), " ")
+	// The line break is CRLF in the message. The line starting with a dot is escaped by net/smtp.
+	body = strings.Replace(strings.Replace(body, "\r\n", "\n", -1), "\n", "\r\n", -1)
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString("From: " + from + "\r\n")
+	buffer.WriteString("To: " + strings.Join(channel.RecipientSlice, ", ") + "\r\n")
+	buffer.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	buffer.WriteString("Date: " + notification.CreatedTime.Format(time.RFC1123Z) + "\r\n")
+	buffer.WriteString("Message-ID: <" + notification.ID + "." + channel.Name + "@cloudone>\r\n")
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buffer.WriteString("\r\n")
+	buffer.WriteString(body)
+	if strings.HasSuffix(body, "\r\n") == false {
+		buffer.WriteString("\r\n")
+	}
+	return buffer.Bytes(), nil
+}
+
+// sendEmail sends the message to the recipients of the channel. STARTTLS is used if the server supports it
+// and the credentials are only sent over TLS or to localhost. The whole conversation with the server is limited
+// by the timeout so the stuck server doesn't hold the worker.
+func sendEmail(server *smtpServer, channel *Channel, message []byte) error {
+	addressSlice := make([]string, 0)
+	for _, recipient := range channel.RecipientSlice {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		addressSlice = append(addressSlice, address.Address)
+	}
+	from, err := mail.ParseAddress(server.from)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	connection, err := net.DialTimeout("tcp", net.JoinHostPort(server.host, strconv.Itoa(server.port)), server.timeout)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer connection.Close()
+	if err := connection.SetDeadline(time.Now().Add(server.timeout)); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	client, err := smtp.NewClient(connection, server.host)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: server.host}); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	if server.username != "" {
+		if ok, _ := client.Extension("AUTH"); ok == false {
+			return errors.New("The SMTP server " + server.host + " doesn't support AUTH")
+		}
+		// PlainAuth refuses to send the credentials without TLS unless the server is localhost
+		if err := client.Auth(smtp.PlainAuth("", server.username, server.password, server.host)); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		log.Error(err)
+		return err
+	}
+	for _, address := range addressSlice {
+		if err := client.Rcpt(address); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		log.Error(err)
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		log.Error(err)
+		return err
+	}
+	return client.Quit()
+}
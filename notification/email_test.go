@@ -0,0 +1,183 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type receivedEmail struct {
+	from           string
+	recipientSlice []string
+	data           string
+}
+
+// startSMTPStandIn accepts one message with the minimal SMTP dialogue and passes it to the channel
+func startSMTPStandIn(t *testing.T) (net.Listener, chan receivedEmail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receivedChannel := make(chan receivedEmail, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		reader := bufio.NewReader(connection)
+		write := func(line string) {
+			connection.Write([]byte(line + "\r\n"))
+		}
+		email := receivedEmail{}
+		write("220 localhost stand-in")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				write("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				email.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+				write("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				email.recipientSlice = append(email.recipientSlice, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+				write("250 OK")
+			case command == "DATA":
+				write("354 End data with <CR><LF>.<CR><LF>")
+				dataBuffer := make([]string, 0)
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					dataBuffer = append(dataBuffer, dataLine)
+				}
+				email.data = strings.Join(dataBuffer, "")
+				write("250 OK")
+			case command == "QUIT":
+				write("221 Bye")
+				receivedChannel <- email
+				return
+			default:
+				write("250 OK")
+			}
+		}
+	}()
+	return listener, receivedChannel
+}
+
+func TestSendEmail(t *testing.T) {
+	listener, receivedChannel := startSMTPStandIn(t)
+	defer listener.Close()
+
+	host, portText, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := net.LookupPort("tcp", portText)
+	server := &smtpServer{host, port, "", "", "CloudOne <cloudone@example.com>", 5 * time.Second}
+
+	channel := &Channel{
+		Name:            "ops-mail",
+		Kind:            ChannelKindEmail,
+		RecipientSlice:  []string{"Ops <ops@example.com>", "dev@example.com"},
+		SubjectTemplate: "[{{.Topic}}] {{.Subject}}",
+		BodyTemplate:    "{{.Message}}\n.\nEnd",
+	}
+	if err := ValidateChannel(channel); err != nil {
+		t.Fatal(err)
+	}
+	notification := &Notification{"id", TopicAlert, "Alert nginx-memory is firing", "Memory is high",
+		nil, time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	message, err := createEmailMessage(server.from, channel, notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendEmail(server, channel, message); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case email := <-receivedChannel:
+		if email.from != "cloudone@example.com" {
+			t.Errorf("Unexpected sender %s", email.from)
+		}
+		if len(email.recipientSlice) != 2 || email.recipientSlice[0] != "ops@example.com" {
+			t.Errorf("Unexpected recipients %v", email.recipientSlice)
+		}
+		if strings.Contains(email.data, "Subject: [alert] Alert nginx-memory is firing\r\n") == false {
+			t.Errorf("Expect the rendered subject in %s", email.data)
+		}
+		// The dot line is escaped in the transmission
+		if strings.Contains(email.data, "\r\n\r\nMemory is high\r\n..\r\nEnd\r\n") == false {
+			t.Errorf("Expect the rendered body in %s", email.data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No email is received")
+	}
+}
+
+func TestSendEmailTimeout(t *testing.T) {
+	// The server accepts the connection but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		if connection, err := listener.Accept(); err == nil {
+			defer connection.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	host, portText, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := net.LookupPort("tcp", portText)
+	server := &smtpServer{host, port, "", "", "cloudone@example.com", 100 * time.Millisecond}
+	channel := &Channel{Name: "ops-mail", Kind: ChannelKindEmail, RecipientSlice: []string{"ops@example.com"}}
+
+	start := time.Now()
+	if err := sendEmail(server, channel, []byte("Subject: test\r\n\r\ntest\r\n")); err == nil {
+		t.Error("Expect the timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expect to give up after the timeout but take %v", elapsed)
+	}
+}
+
+func TestValidateEmailChannel(t *testing.T) {
+	if err := ValidateChannel(&Channel{Name: "mail", Kind: ChannelKindEmail}); err == nil {
+		t.Error("Expect error without recipient")
+	}
+	if err := ValidateChannel(&Channel{Name: "mail", Kind: ChannelKindEmail, RecipientSlice: []string{"not an address"}}); err == nil {
+		t.Error("Expect error for the invalid recipient")
+	}
+	if err := ValidateChannel(&Channel{Name: "mail", Kind: ChannelKindEmail, RecipientSlice: []string{"ops@example.com"},
+		BodyTemplate: "{{.Message"}); err == nil {
+		t.Error("Expect error for the invalid template")
+	}
+	if err := ValidateChannel(&Channel{Name: "mail", Kind: ChannelKindEmail, RecipientSlice: []string{"ops@example.com"},
+		SubjectTemplate: "{{.Unknown}}"}); err == nil {
+		t.Error("Expect error for the template referring to the unknown field")
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"time"
+)
+
+type Storage interface {
+	SaveChannel(index string, documentType string, channel *Channel) error
+	GetChannel(index string, documentType string, name string) (*Channel, error)
+	// Return the channels sorted by name
+	GetAllChannel(index string, documentType string) ([]Channel, error)
+	DeleteChannel(index string, documentType string, name string) error
+	// Create or replace the delivery with the same id
+	SaveDelivery(index string, documentType string, delivery *Delivery) error
+	// Return the matched deliveries sorted by CreatedTime in descending order. The empty channel name or status matches all.
+	SearchDelivery(index string, documentType string, channelName string, status string, from *time.Time, to *time.Time,
+		size int, offset int) ([]Delivery, error)
+	// Delete the index or all indices of the alias
+	DeleteIndex(index string) error
+	GetAllIndex(indexPattern string) ([]string, error)
+}
+
+var storage Storage
+
+func init() {
+	switch configuration.GetStorageType() {
+	case configuration.StorageTypeLocal:
+		storage = CreateStorageLocal()
+	default:
+		storage = CreateStorageElasticSearch()
+	}
+}
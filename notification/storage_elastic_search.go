@@ -0,0 +1,281 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
+	"strconv"
+	"time"
+)
+
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
+	createIndexTemplate()
+	// Create the index so it could be searched before the first document
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	connection.CreateIndex(indexNotificationChannelIndex)
+	return &StorageElasticSearch{}
+}
+
+func createIndexTemplate() error {
+	tempateBody := `
+	{
+		"template": "notification_*",
+		"mappings": {
+			"_default_": {
+				"_all": {
+					"enabled": true
+				},
+				"dynamic_templates": [
+					{
+						"string_fields": {
+							"match": "*",
+							"match_mapping_type": "string",
+							"mapping": {
+								"type": "string",
+								"index": "not_analyzed",
+								"omit_norms": true
+							}
+						}
+					}
+				],
+				"properties": {
+					"Payload": {
+						"type": "string",
+						"index": "no"
+					},
+					"AttemptAmount": {
+						"type": "integer"
+					},
+					"StatusCode": {
+						"type": "integer"
+					},
+					"CreatedTime": {
+						"type": "date",
+						"format": "dateOptionalTime"
+					},
+					"UpdatedTime": {
+						"type": "date",
+						"format": "dateOptionalTime"
+					}
+				}
+			}
+		}
+	}
+	`
+
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	request, err := connection.NewRequest("PUT", "/_template/template_notification", "")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	request.SetBodyString(tempateBody)
+	statusCode, bodyBytes, err := request.Do(nil)
+	if err != nil {
+		log.Error(err)
+		log.Error("statusCode %d", statusCode)
+		log.Error(string(bodyBytes))
+		return err
+	}
+	return nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) SaveChannel(index string, documentType string, channel *Channel) error {
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	if _, err := connection.Index(index, documentType, channel.Name, nil, channel); err != nil {
+		log.Debug(channel)
+		log.Error(err)
+		return err
+	}
+	if _, err := connection.Refresh(index); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetChannel(index string, documentType string, name string) (*Channel, error) {
+	_, byteSlice, err := elasticsearch.GetByID(index, documentType, name)
+	if err != nil {
+		return nil, err
+	}
+	channel := &Channel{}
+	if err := elasticsearch.DecodeSource(byteSlice, channel); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return channel, nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllChannel(index string, documentType string) ([]Channel, error) {
+	query := `
+	{
+		"query": {
+			"match_all": {}
+		},
+		"sort" : [
+			{
+				"Name" : "asc"
+			}
+		],
+		"size": ` + strconv.Itoa(elasticsearch.ScrollPageSize) + `
+	}
+	`
+	channelSlice := make([]Channel, 0)
+	err := elasticsearch.Scroll(index, documentType, query, func(hitSlice []interface{}) error {
+		for _, hit := range hitSlice {
+			byteSlice, err := json.Marshal(hit.(map[string]interface{})["_source"])
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			channel := Channel{}
+			if err := elasticsearch.DecodeSource(byteSlice, &channel); err != nil {
+				log.Error(err)
+				return err
+			}
+			channelSlice = append(channelSlice, channel)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return channelSlice, nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) DeleteChannel(index string, documentType string, name string) error {
+	if _, _, err := elasticsearch.GetByID(index, documentType, name); err != nil {
+		return err
+	}
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	if _, err := connection.Delete(index, documentType, name, nil); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := connection.Refresh(index); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) SaveDelivery(index string, documentType string, delivery *Delivery) error {
+	if err := elasticsearch.EnsureIndexWithAlias(index); err != nil {
+		log.Error(err)
+		return err
+	}
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	if _, err := connection.Index(index, documentType, delivery.ID, nil, delivery); err != nil {
+		log.Debug(delivery)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) SearchDelivery(index string, documentType string, channelName string,
+	status string, from *time.Time, to *time.Time, size int, offset int) ([]Delivery, error) {
+	mustSlice := make([]string, 0)
+	if channelName != "" {
+		// Escape the value from the caller
+		channelNameByteSlice, _ := json.Marshal(channelName)
+		mustSlice = append(mustSlice, `
+						{ "term": { "ChannelName": `+string(channelNameByteSlice)+` } }`)
+	}
+	if status != "" {
+		statusByteSlice, _ := json.Marshal(status)
+		mustSlice = append(mustSlice, `
+						{ "term": { "Status": `+string(statusByteSlice)+` } }`)
+	}
+	if from != nil || to != nil {
+		rangeText := `"time_zone": "+0:00"`
+		if from != nil {
+			rangeText += `, "gte": "` + from.UTC().Format(time.RFC3339Nano) + `"`
+		}
+		if to != nil {
+			rangeText += `, "lte": "` + to.UTC().Format(time.RFC3339Nano) + `"`
+		}
+		mustSlice = append(mustSlice, `
+						{ "range": { "CreatedTime": { `+rangeText+` } } }`)
+	}
+
+	queryField := `
+			"match_all": {}`
+	if len(mustSlice) > 0 {
+		mustBuffer := bytes.Buffer{}
+		for i, must := range mustSlice {
+			if i > 0 {
+				mustBuffer.WriteString(",")
+			}
+			mustBuffer.WriteString(must)
+		}
+		queryField = `
+			"bool": {
+				"must": [` + mustBuffer.String() + `
+				]
+			}`
+	}
+
+	query := `
+	{
+		"query": {` + queryField + `
+		},
+		"sort" : [
+			{
+				"CreatedTime" : "desc"
+			}
+		],
+		"size": ` + strconv.Itoa(size) + `,
+		"from": ` + strconv.Itoa(offset) + `
+	}
+	`
+
+	connection := elasticsearch.ElasticSearchClient.GetConnection()
+	searchResult, err := connection.Search(index, documentType, nil, query)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	deliverySlice := make([]Delivery, 0)
+	for _, hit := range searchResult.Hits.Hits {
+		if hit.Source == nil {
+			return nil, errors.New("The source of " + hit.Id + " is empty")
+		}
+		delivery := Delivery{}
+		if err := elasticsearch.DecodeSource([]byte(*hit.Source), &delivery); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		deliverySlice = append(deliverySlice, delivery)
+	}
+	return deliverySlice, nil
+}
+
+func (storageElasticSearch *StorageElasticSearch) DeleteIndex(index string) error {
+	return elasticsearch.DeleteIndexOrAlias(index)
+}
+
+func (storageElasticSearch *StorageElasticSearch) GetAllIndex(indexPattern string) ([]string, error) {
+	return elasticsearch.GetAllIndex(indexPattern)
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+	"sort"
+	"time"
+)
+
+type StorageLocal struct {
+	documentStore *local.DocumentStore
+}
+
+func CreateStorageLocal() *StorageLocal {
+	return &StorageLocal{local.LocalDocumentStore}
+}
+
+func decodeSource(source map[string]interface{}, target interface{}) error {
+	byteSlice, err := json.Marshal(source)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
+
+func (storageLocal *StorageLocal) SaveChannel(index string, documentType string, channel *Channel) error {
+	return storageLocal.documentStore.Index(index, documentType, channel.Name, channel)
+}
+
+func (storageLocal *StorageLocal) GetChannel(index string, documentType string, name string) (*Channel, error) {
+	jsonMap, err := storageLocal.documentStore.Get(index, documentType, name)
+	if err != nil {
+		return nil, err
+	}
+	channel := &Channel{}
+	if err := decodeSource(jsonMap, channel); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return channel, nil
+}
+
+func (storageLocal *StorageLocal) GetAllChannel(index string, documentType string) ([]Channel, error) {
+	documentSlice, err := storageLocal.documentStore.Search(index, documentType, nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	channelSlice := make([]Channel, 0)
+	for _, document := range documentSlice {
+		channel := Channel{}
+		if err := decodeSource(document.Source, &channel); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		channelSlice = append(channelSlice, channel)
+	}
+	sort.SliceStable(channelSlice, func(i int, j int) bool {
+		return channelSlice[i].Name < channelSlice[j].Name
+	})
+	return channelSlice, nil
+}
+
+func (storageLocal *StorageLocal) DeleteChannel(index string, documentType string, name string) error {
+	return storageLocal.documentStore.Delete(index, documentType, name)
+}
+
+func (storageLocal *StorageLocal) SaveDelivery(index string, documentType string, delivery *Delivery) error {
+	return storageLocal.documentStore.Index(index, documentType, delivery.ID, delivery)
+}
+
+func getCreatedTime(document *local.Document) time.Time {
+	createdTimeText, _ := document.GetFieldString("CreatedTime")
+	createdTime, _ := time.Parse(time.RFC3339Nano, createdTimeText)
+	return createdTime
+}
+
+func (storageLocal *StorageLocal) SearchDelivery(index string, documentType string, channelName string, status string,
+	from *time.Time, to *time.Time, size int, offset int) ([]Delivery, error) {
+	documentSlice, err := storageLocal.documentStore.Search(index, documentType, func(document *local.Document) bool {
+		if channelName != "" {
+			documentChannelName, _ := document.GetFieldString("ChannelName")
+			if documentChannelName != channelName {
+				return false
+			}
+		}
+		if status != "" {
+			documentStatus, _ := document.GetFieldString("Status")
+			if documentStatus != status {
+				return false
+			}
+		}
+		createdTime := getCreatedTime(document)
+		if from != nil && createdTime.Before(*from) {
+			return false
+		}
+		if to != nil && createdTime.After(*to) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	sort.SliceStable(documentSlice, func(i int, j int) bool {
+		return getCreatedTime(&documentSlice[i]).After(getCreatedTime(&documentSlice[j]))
+	})
+
+	deliverySlice := make([]Delivery, 0)
+	for i := offset; i < len(documentSlice) && i < offset+size; i++ {
+		delivery := Delivery{}
+		if err := decodeSource(documentSlice[i].Source, &delivery); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		deliverySlice = append(deliverySlice, delivery)
+	}
+	return deliverySlice, nil
+}
+
+func (storageLocal *StorageLocal) DeleteIndex(index string) error {
+	return storageLocal.documentStore.DeleteIndex(index)
+}
+
+func (storageLocal *StorageLocal) GetAllIndex(indexPattern string) ([]string, error) {
+	return storageLocal.documentStore.GetAllIndex(indexPattern), nil
+}
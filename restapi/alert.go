@@ -0,0 +1,300 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/alert"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func registerWebServiceAlert() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/alertrules")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/").Filter(authorize).Filter(auditLog).To(getAllAlertRule).
+		Doc("Get all alert rules").
+		Do(returns200AlertRuleSlice, returns404, returns500))
+
+	ws.Route(ws.POST("/").Filter(authorize).Filter(auditLog).To(postAlertRule).
+		Doc("Create the alert rule").
+		Do(returns200, returns400, returns422, returns500).
+		Reads(alert.Rule{}))
+
+	ws.Route(ws.GET("/{name}").Filter(authorize).Filter(auditLog).To(getAlertRule).
+		Doc("Get the alert rule").
+		Param(ws.PathParameter("name", "Rule name").DataType("string")).
+		Do(returns200AlertRule, returns404, returns500))
+
+	ws.Route(ws.PUT("/{name}").Filter(authorize).Filter(auditLog).To(putAlertRule).
+		Doc("Update the alert rule").
+		Param(ws.PathParameter("name", "Rule name").DataType("string")).
+		Do(returns200, returns400, returns422, returns500).
+		Reads(alert.Rule{}))
+
+	ws.Route(ws.DELETE("/{name}").Filter(authorize).Filter(auditLog).To(deleteAlertRule).
+		Doc("Delete the alert rule and its active alert").
+		Param(ws.PathParameter("name", "Rule name").DataType("string")).
+		Do(returns200, returns404, returns500))
+
+	alertWs := new(restful.WebService)
+	alertWs.Path("/api/v1/alerts")
+	alertWs.Consumes(restful.MIME_JSON)
+	alertWs.Produces(restful.MIME_JSON)
+	restful.Add(alertWs)
+
+	alertWs.Route(alertWs.GET("/").Filter(authorize).Filter(auditLog).To(getAllAlert).
+		Doc("Get the pending and firing alerts").
+		Do(returns200AlertSlice, returns404, returns500))
+
+	alertWs.Route(alertWs.GET("/histories").Filter(authorize).Filter(auditLog).To(getAlertHistory).
+		Doc("Get the history of the alerts fired and resolved").
+		Param(alertWs.QueryParameter("rule", "Rule name. All rules if empty.").DataType("string")).
+		Param(alertWs.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
+		Param(alertWs.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
+		Param(alertWs.QueryParameter("size", "The amount of data to return").DataType("int")).
+		Param(alertWs.QueryParameter("offset", "The offset from the result").DataType("int")).
+		Do(returns200AlertHistorySlice, returns400, returns404, returns500))
+}
+
+func getAllAlertRule(request *restful.Request, response *restful.Response) {
+	ruleSlice, err := alert.GetAllRule()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all alert rules failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(ruleSlice, "[]Rule")
+}
+
+func postAlertRule(request *restful.Request, response *restful.Response) {
+	rule := &alert.Rule{}
+	err := request.ReadEntity(&rule)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = alert.CreateRule(rule)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Create alert rule failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["rule"] = rule
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getAlertRule(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	rule, err := alert.GetRule(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get alert rule failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(rule, "Rule")
+}
+
+func putAlertRule(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	rule := &alert.Rule{}
+	err := request.ReadEntity(&rule)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+	// The name in the path identifies the rule
+	rule.Name = name
+
+	err = alert.UpdateRule(rule)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Update alert rule failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["rule"] = rule
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func deleteAlertRule(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	err := alert.DeleteRule(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete alert rule failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getAllAlert(request *restful.Request, response *restful.Response) {
+	alertSlice, err := alert.GetAllAlert()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all alerts failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(alertSlice, "[]Alert")
+}
+
+func getAlertHistory(request *restful.Request, response *restful.Response) {
+	ruleName := request.QueryParameter("rule")
+	fromText := request.QueryParameter("from")
+	toText := request.QueryParameter("to")
+	sizeText := request.QueryParameter("size")
+	offsetText := request.QueryParameter("offset")
+
+	var from *time.Time
+	if fromText == "" {
+		from = nil
+	} else {
+		fromValue, err := time.Parse(time.RFC3339Nano, fromText)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Could not parse fromText"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["fromText"] = fromText
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(400, string(errorMessageByteSlice))
+			return
+		} else {
+			from = &fromValue
+		}
+	}
+
+	var to *time.Time
+	if toText == "" {
+		to = nil
+	} else {
+		toValue, err := time.Parse(time.RFC3339Nano, toText)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Could not parse toText"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["toText"] = toText
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(400, string(errorMessageByteSlice))
+			return
+		} else {
+			to = &toValue
+		}
+	}
+
+	size, err := strconv.Atoi(sizeText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse sizeText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["sizeText"] = sizeText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	offset, err := strconv.Atoi(offsetText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse offsetText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["offsetText"] = offsetText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	alertHistorySlice, err := alert.SearchAlertHistory(ruleName, from, to, size, offset)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get alert history with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["rule"] = ruleName
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["size"] = size
+		jsonMap["offset"] = offset
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(alertHistorySlice, "[]AlertHistory")
+}
+
+func returns200AlertRuleSlice(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []alert.Rule{})
+}
+
+func returns200AlertRule(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", alert.Rule{})
+}
+
+func returns200AlertSlice(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []alert.Alert{})
+}
+
+func returns200AlertHistorySlice(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []alert.AlertHistory{})
+}
@@ -35,8 +35,10 @@ func registerWebServiceAuditLog() {
 		Doc("Get audit logs in the time range").
 		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
-		Param(ws.QueryParameter("size", "The amount of data to return").DataType("int")).
-		Param(ws.QueryParameter("offset", "The offset from the result").DataType("int")).
+		Param(ws.QueryParameter("size", "The amount of data to return. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("offset", "The offset from the result. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+		Produces(restful.MIME_JSON, mimeCsv, mimeNdjson).
 		Do(returns200AuditLogSlice, returns400, returns404, returns500))
 
 	// Don't audit itself to prevent loop. Also, this is used only by system
@@ -50,8 +52,10 @@ func registerWebServiceAuditLog() {
 		Param(ws.PathParameter("user", "User name").DataType("string")).
 		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
-		Param(ws.QueryParameter("size", "The amount of data to return").DataType("int")).
-		Param(ws.QueryParameter("offset", "The offset from the result").DataType("int")).
+		Param(ws.QueryParameter("size", "The amount of data to return. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("offset", "The offset from the result. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+		Produces(restful.MIME_JSON, mimeCsv, mimeNdjson).
 		Do(returns200AuditLogSlice, returns400, returns404, returns500))
 }
 
@@ -99,6 +103,22 @@ func getAllAuditLog(request *restful.Request, response *restful.Response) {
 		}
 	}
 
+	format, err := getExportFormat(request)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["formatText"] = request.QueryParameter("format")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+	if format != exportFormatJson {
+		exportAuditLog(response, format, "*", from, to)
+		return
+	}
+
 	size, err := strconv.Atoi(sizeText)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
@@ -186,6 +206,22 @@ func getAuditLog(request *restful.Request, response *restful.Response) {
 		}
 	}
 
+	format, err := getExportFormat(request)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["formatText"] = request.QueryParameter("format")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+	if format != exportFormatJson {
+		exportAuditLog(response, format, user, from, to)
+		return
+	}
+
 	size, err := strconv.Atoi(sizeText)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
@@ -255,6 +291,66 @@ func postAuditLog(request *restful.Request, response *restful.Response) {
 	}
 }
 
+// The request header is not exported to csv since it contains the token
+var auditLogCsvHeaderSlice = []string{
+	"CreatedTime",
+	"UserName",
+	"Component",
+	"Kind",
+	"Path",
+	"RemoteAddress",
+	"RemoteHost",
+	"RequestMethod",
+	"RequestURI",
+	"PathParameterMap",
+	"QueryParameterMap",
+	"RequestBody",
+	"Description",
+}
+
+// exportAuditLog streams all matched audit logs scrolled page by page. Each NDJSON line is the same as the element of the json result.
+func exportAuditLog(response *restful.Response, format string, user string, from *time.Time, to *time.Time) {
+	exportWriter := createExportWriter(response, format, "auditlogs", auditLogCsvHeaderSlice)
+	err := audit.ExportAuditLog(user, from, to, func(auditLogSlice []utilityaudit.AuditLog) error {
+		for _, auditLog := range auditLogSlice {
+			recordSlice := []string{
+				getText(auditLog.CreatedTime),
+				auditLog.UserName,
+				auditLog.Component,
+				auditLog.Kind,
+				auditLog.Path,
+				auditLog.RemoteAddress,
+				auditLog.RemoteHost,
+				auditLog.RequestMethod,
+				auditLog.RequestURI,
+				getText(auditLog.PathParameterMap),
+				getText(auditLog.QueryParameterMap),
+				auditLog.RequestBody,
+				auditLog.Description,
+			}
+			if err := exportWriter.Write(auditLog, recordSlice); err != nil {
+				return err
+			}
+		}
+		return exportWriter.Flush()
+	})
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Export audit log with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["user"] = user
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["format"] = format
+		writeExportError(response, exportWriter, jsonMap)
+		return
+	}
+
+	if err := exportWriter.Close(); err != nil {
+		log.Error(err)
+	}
+}
+
 func returns200AuditLogSlice(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []utilityaudit.AuditLog{})
 }
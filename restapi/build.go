@@ -17,6 +17,7 @@ package restapi
 import (
 	"encoding/json"
 	"github.com/cloudawan/cloudone_analysis/build"
+	"github.com/cloudawan/cloudone_analysis/notification"
 	utilitybuild "github.com/cloudawan/cloudone_utility/build"
 	"github.com/emicklei/go-restful"
 	"net/http"
@@ -41,8 +42,10 @@ func registerWebServiceBuildLog() {
 		Param(ws.PathParameter("imageinformation", "Image information").DataType("string")).
 		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
-		Param(ws.QueryParameter("size", "The amount of data to return").DataType("int")).
-		Param(ws.QueryParameter("offset", "The offset from the result").DataType("int")).
+		Param(ws.QueryParameter("size", "The amount of data to return. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("offset", "The offset from the result. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+		Produces(restful.MIME_JSON, mimeCsv, mimeNdjson).
 		Do(returns200BuildLogSlice, returns400, returns404, returns500))
 
 	ws.Route(ws.DELETE("/{imageinformation}").Filter(authorize).Filter(auditLog).To(deleteBuildLogBelongingToImageInformation).
@@ -87,6 +90,18 @@ func postBuildLog(request *restful.Request, response *restful.Response) {
 		response.WriteErrorString(422, string(errorMessageByteSlice))
 		return
 	}
+
+	// The content is left out since it could be large
+	data := make(map[string]interface{})
+	data["ImageInformation"] = buildLog.ImageInformation
+	data["Version"] = buildLog.Version
+	data["VersionInfo"] = buildLog.VersionInfo
+	data["CreatedTime"] = buildLog.CreatedTime
+	subject := "Build " + buildLog.ImageInformation + " " + buildLog.Version
+	message := "The build log of the image " + buildLog.ImageInformation + " version " + buildLog.Version + " is created"
+	if err := notification.Publish(notification.TopicBuild, subject, message, data); err != nil {
+		log.Error(err)
+	}
 }
 
 func getBuildLogBelongingToImageInformation(request *restful.Request, response *restful.Response) {
@@ -134,6 +149,22 @@ func getBuildLogBelongingToImageInformation(request *restful.Request, response *
 		}
 	}
 
+	format, err := getExportFormat(request)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["formatText"] = request.QueryParameter("format")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+	if format != exportFormatJson {
+		exportBuildLog(response, format, imageInformation, from, to)
+		return
+	}
+
 	size, err := strconv.Atoi(sizeText)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
@@ -231,6 +262,49 @@ func deleteBuildLog(request *restful.Request, response *restful.Response) {
 	}
 }
 
+var buildLogCsvHeaderSlice = []string{
+	"CreatedTime",
+	"ImageInformation",
+	"Version",
+	"VersionInfo",
+	"Content",
+}
+
+// exportBuildLog streams all matched build logs scrolled page by page. Each NDJSON line is the same as the element of the json result.
+func exportBuildLog(response *restful.Response, format string, imageInformation string, from *time.Time, to *time.Time) {
+	exportWriter := createExportWriter(response, format, "buildlogs", buildLogCsvHeaderSlice)
+	err := build.ExportBuildLog(imageInformation, from, to, func(buildLogSlice []utilitybuild.BuildLog) error {
+		for _, buildLog := range buildLogSlice {
+			recordSlice := []string{
+				getText(buildLog.CreatedTime),
+				buildLog.ImageInformation,
+				buildLog.Version,
+				getText(buildLog.VersionInfo),
+				buildLog.Content,
+			}
+			if err := exportWriter.Write(buildLog, recordSlice); err != nil {
+				return err
+			}
+		}
+		return exportWriter.Flush()
+	})
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Export build log with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["imageInformation"] = imageInformation
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["format"] = format
+		writeExportError(response, exportWriter, jsonMap)
+		return
+	}
+
+	if err := exportWriter.Close(); err != nil {
+		log.Error(err)
+	}
+}
+
 func returns200BuildLogSlice(b *restful.RouteBuilder) {
 	b.Returns(http.StatusOK, "OK", []utilitybuild.BuildLog{})
 }
@@ -0,0 +1,252 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportFormatJson   = "json"
+	exportFormatCsv    = "csv"
+	exportFormatNdjson = "ndjson"
+	mimeCsv            = "text/csv"
+	mimeNdjson         = "application/x-ndjson"
+)
+
+const exportFormatParameterDescription = "json, csv or ndjson. The Accept header text/csv or application/x-ndjson is used if absent. The default is json."
+
+// getExportFormat returns the format parameter or the format negotiated with the Accept header
+func getExportFormat(request *restful.Request) (string, error) {
+	formatText := request.QueryParameter("format")
+	switch strings.ToLower(formatText) {
+	case exportFormatJson:
+		return exportFormatJson, nil
+	case exportFormatCsv:
+		return exportFormatCsv, nil
+	case exportFormatNdjson:
+		return exportFormatNdjson, nil
+	case "":
+	default:
+		return "", errors.New("The format " + formatText + " is not json, csv or ndjson")
+	}
+
+	// The first supported media type is used
+	for _, mediaType := range strings.Split(request.Request.Header.Get("Accept"), ",") {
+		switch strings.TrimSpace(strings.Split(mediaType, ";")[0]) {
+		case restful.MIME_JSON:
+			return exportFormatJson, nil
+		case mimeCsv:
+			return exportFormatCsv, nil
+		case mimeNdjson, "application/ndjson":
+			return exportFormatNdjson, nil
+		}
+	}
+	return exportFormatJson, nil
+}
+
+// exportWriter writes each record as one CSV row or one NDJSON line. Nothing is written before the first record
+// so the error found before any data could still be responded with the error status.
+type exportWriter struct {
+	response    *restful.Response
+	format      string
+	fileName    string
+	headerSlice []string
+	csvWriter   *csv.Writer
+	encoder     *json.Encoder
+}
+
+func createExportWriter(response *restful.Response, format string, fileName string, headerSlice []string) *exportWriter {
+	return &exportWriter{response, format, fileName, headerSlice, nil, nil}
+}
+
+func (exportWriter *exportWriter) isStarted() bool {
+	return exportWriter.csvWriter != nil || exportWriter.encoder != nil
+}
+
+func (exportWriter *exportWriter) start() error {
+	header := exportWriter.response.Header()
+	if exportWriter.format == exportFormatCsv {
+		header.Set("Content-Type", mimeCsv)
+		header.Set("Content-Disposition", "attachment; filename=\""+exportWriter.fileName+".csv\"")
+		exportWriter.csvWriter = csv.NewWriter(exportWriter.response)
+		return exportWriter.csvWriter.Write(exportWriter.headerSlice)
+	} else {
+		header.Set("Content-Type", mimeNdjson)
+		header.Set("Content-Disposition", "attachment; filename=\""+exportWriter.fileName+".ndjson\"")
+		exportWriter.encoder = json.NewEncoder(exportWriter.response)
+		return nil
+	}
+}
+
+// Write writes the value as one NDJSON line or the record as one CSV row
+func (exportWriter *exportWriter) Write(value interface{}, recordSlice []string) error {
+	if exportWriter.isStarted() == false {
+		if err := exportWriter.start(); err != nil {
+			return err
+		}
+	}
+
+	if exportWriter.format == exportFormatCsv {
+		return exportWriter.csvWriter.Write(recordSlice)
+	} else {
+		return exportWriter.encoder.Encode(value)
+	}
+}
+
+// Flush sends the written records to the client so the export is streamed page by page
+func (exportWriter *exportWriter) Flush() error {
+	if exportWriter.csvWriter != nil {
+		exportWriter.csvWriter.Flush()
+		if err := exportWriter.csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := exportWriter.response.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// Close writes the CSV header if there is no record and flushes
+func (exportWriter *exportWriter) Close() error {
+	if exportWriter.isStarted() == false {
+		if err := exportWriter.start(); err != nil {
+			return err
+		}
+	}
+	return exportWriter.Flush()
+}
+
+// writeExportError responds the error if nothing is written yet. Otherwise, the status is sent already so the
+// connection is closed without ending the response and the client sees a failed download instead of a truncated one.
+func writeExportError(response *restful.Response, exportWriter *exportWriter, jsonMap map[string]interface{}) {
+	log.Error(jsonMap)
+	if exportWriter.isStarted() == false {
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	if hijacker, ok := response.ResponseWriter.(http.Hijacker); ok {
+		connection, _, err := hijacker.Hijack()
+		if err == nil {
+			connection.Close()
+			return
+		}
+		log.Error(err)
+	}
+	// The server aborts the response without logging the stack trace
+	panic(http.ErrAbortHandler)
+}
+
+// getFieldText returns the value with the field name in the dot format like involvedObject.kind as the text.
+// The value which is not a string, number or bool is returned as json.
+func getFieldText(jsonMap map[string]interface{}, field string) string {
+	var value interface{} = jsonMap
+	for _, name := range strings.Split(field, ".") {
+		fieldJsonMap, ok := value.(map[string]interface{})
+		if ok == false {
+			return ""
+		}
+		value = fieldJsonMap[name]
+	}
+	return getText(value)
+}
+
+func getText(value interface{}) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typedValue
+	case json.Number:
+		return typedValue.String()
+	case bool:
+		return strconv.FormatBool(typedValue)
+	case float64:
+		return strconv.FormatFloat(typedValue, 'f', -1, 64)
+	case time.Time:
+		return typedValue.Format(time.RFC3339Nano)
+	default:
+		byteSlice, _ := json.Marshal(typedValue)
+		return string(byteSlice)
+	}
+}
+
+var metricSeriesCsvHeaderSlice = []string{
+	"timestamp",
+	"name",
+	"aggregator",
+	"unit",
+	"scope",
+	"namespace",
+	"workloadKind",
+	"workloadName",
+	"pod",
+	"container",
+	"node",
+	"value",
+	"interpolated",
+}
+
+// writeMetricSeriesExport writes one record for each point. The metrics are aggregated into the time buckets
+// already so they are not scrolled.
+func writeMetricSeriesExport(response *restful.Response, format string, fileName string, metricSeriesResult *monitor.MetricSeriesResult) {
+	exportWriter := createExportWriter(response, format, fileName, metricSeriesCsvHeaderSlice)
+	for _, metricSeries := range metricSeriesResult.SeriesSlice {
+		for _, metricPoint := range metricSeries.PointSlice {
+			jsonMap := make(map[string]interface{})
+			jsonMap["timestamp"] = metricPoint.Timestamp
+			jsonMap["name"] = metricSeries.Name
+			jsonMap["aggregator"] = metricSeries.Aggregator
+			jsonMap["unit"] = metricSeries.Unit
+			jsonMap["scope"] = metricSeries.Labels.Scope
+			jsonMap["namespace"] = metricSeries.Labels.Namespace
+			jsonMap["workloadKind"] = metricSeries.Labels.WorkloadKind
+			jsonMap["workloadName"] = metricSeries.Labels.WorkloadName
+			jsonMap["pod"] = metricSeries.Labels.Pod
+			jsonMap["container"] = metricSeries.Labels.Container
+			jsonMap["node"] = metricSeries.Labels.Node
+			// Null for the bucket without data
+			if metricPoint.Value != nil {
+				jsonMap["value"] = *metricPoint.Value
+			} else {
+				jsonMap["value"] = nil
+			}
+			jsonMap["interpolated"] = metricPoint.Interpolated
+
+			recordSlice := make([]string, 0, len(metricSeriesCsvHeaderSlice))
+			for _, field := range metricSeriesCsvHeaderSlice {
+				recordSlice = append(recordSlice, getText(jsonMap[field]))
+			}
+			if err := exportWriter.Write(jsonMap, recordSlice); err != nil {
+				log.Error(err)
+				return
+			}
+		}
+	}
+	if err := exportWriter.Close(); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"github.com/emicklei/go-restful"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetExportFormat(t *testing.T) {
+	for _, testCase := range []struct {
+		url      string
+		accept   string
+		expected string
+		hasError bool
+	}{
+		{"/export", "", exportFormatJson, false},
+		{"/export?format=csv", "", exportFormatCsv, false},
+		{"/export?format=NDJSON", "", exportFormatNdjson, false},
+		{"/export?format=xml", "", "", true},
+		// The parameter overrides the Accept header
+		{"/export?format=json", "text/csv", exportFormatJson, false},
+		{"/export", "text/csv", exportFormatCsv, false},
+		{"/export", "application/x-ndjson", exportFormatNdjson, false},
+		{"/export", "application/ndjson", exportFormatNdjson, false},
+		// The first supported media type is used and the parameters of the media type are ignored
+		{"/export", "text/html, text/csv;q=0.9, application/json", exportFormatCsv, false},
+		{"/export", "application/json;q=0.5, text/csv", exportFormatJson, false},
+		{"/export", "text/html, */*", exportFormatJson, false},
+	} {
+		httpRequest := httptest.NewRequest("GET", testCase.url, nil)
+		if testCase.accept != "" {
+			httpRequest.Header.Set("Accept", testCase.accept)
+		}
+		format, err := getExportFormat(restful.NewRequest(httpRequest))
+		if testCase.hasError {
+			if err == nil {
+				t.Errorf("Expect error for %s but get %s", testCase.url, format)
+			}
+		} else if err != nil || format != testCase.expected {
+			t.Errorf("Expect %s for %s with Accept %s but get %s error %v", testCase.expected, testCase.url, testCase.accept, format, err)
+		}
+	}
+}
+
+func TestExportWriterCsv(t *testing.T) {
+	for _, testCase := range []struct {
+		recordSliceSlice [][]string
+		expected         string
+	}{
+		// Only the header is written if there is no record
+		{nil, "id,message\n"},
+		{[][]string{{"1", "plain"}}, "id,message\n1,plain\n"},
+		{[][]string{{"1", "a,b"}}, "id,message\n1,\"a,b\"\n"},
+		{[][]string{{"1", "say \"hi\""}}, "id,message\n1,\"say \"\"hi\"\"\"\n"},
+		{[][]string{{"1", "line\nbreak"}}, "id,message\n1,\"line\nbreak\"\n"},
+		{[][]string{{"1", " leading space"}, {"2", ""}}, "id,message\n1,\" leading space\"\n2,\n"},
+	} {
+		recorder := httptest.NewRecorder()
+		exportWriter := createExportWriter(restful.NewResponse(recorder), exportFormatCsv, "test", []string{"id", "message"})
+		for _, recordSlice := range testCase.recordSliceSlice {
+			if err := exportWriter.Write(nil, recordSlice); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := exportWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Body.String() != testCase.expected {
+			t.Errorf("Expect %q but get %q", testCase.expected, recorder.Body.String())
+		}
+		if recorder.Header().Get("Content-Type") != mimeCsv {
+			t.Errorf("Unexpected content type %s", recorder.Header().Get("Content-Type"))
+		}
+		if recorder.Header().Get("Content-Disposition") != "attachment; filename=\"test.csv\"" {
+			t.Errorf("Unexpected content disposition %s", recorder.Header().Get("Content-Disposition"))
+		}
+	}
+}
+
+func TestWriteExportError(t *testing.T) {
+	for _, testCase := range []struct {
+		format      string
+		started     bool
+		expectError bool
+	}{
+		// The error is responded with the status before any record
+		{exportFormatCsv, false, false},
+		{exportFormatNdjson, false, false},
+		// The download fails after the first record
+		{exportFormatCsv, true, true},
+		{exportFormatNdjson, true, true},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			response := restful.NewResponse(responseWriter)
+			exportWriter := createExportWriter(response, testCase.format, "test", []string{"id"})
+			if testCase.started {
+				exportWriter.Write(map[string]interface{}{"id": "1"}, []string{"1"})
+				exportWriter.Flush()
+			}
+			writeExportError(response, exportWriter, map[string]interface{}{"Error": "Scroll failure"})
+		}))
+
+		httpResponse, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byteSlice, err := ioutil.ReadAll(httpResponse.Body)
+		httpResponse.Body.Close()
+		server.Close()
+
+		if testCase.expectError {
+			if err == nil {
+				t.Errorf("Expect the failed download for %s but get %q", testCase.format, string(byteSlice))
+			}
+		} else if err != nil || httpResponse.StatusCode != 404 || strings.Contains(string(byteSlice), "Scroll failure") == false {
+			t.Errorf("Expect the error status for %s but get %d %q error %v", testCase.format, httpResponse.StatusCode, string(byteSlice), err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/emicklei/go-restful"
+	"strconv"
+	"time"
+)
+
+func registerWebServiceHistoricalClusterMetric() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/historicalnamespacemetrics")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/{namespace}").Filter(authorize).Filter(auditLog).To(getHistoricalNamespaceMetric).
+		Doc("Get the historical metrics summed up over all containers in the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
+		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
+		Param(ws.QueryParameter("aggregationAmount", "Aggregation amount").DataType("int")).
+		Param(ws.QueryParameter("fill", "Fill the missing value with none, null, zero, previous or linear. The default is linear.").DataType("string")).
+		Do(returns200JsonMap, returns400, returns404, returns500))
+
+	clusterWs := new(restful.WebService)
+	clusterWs.Path("/api/v1/historicalclustermetrics")
+	clusterWs.Consumes(restful.MIME_JSON)
+	clusterWs.Produces(restful.MIME_JSON)
+	restful.Add(clusterWs)
+
+	clusterWs.Route(clusterWs.GET("/").Filter(authorize).Filter(auditLog).To(getHistoricalClusterMetric).
+		Doc("Get the historical metrics summed up over all containers in the cluster and in each namespace").
+		Param(clusterWs.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
+		Param(clusterWs.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
+		Param(clusterWs.QueryParameter("aggregationAmount", "Aggregation amount").DataType("int")).
+		Param(clusterWs.QueryParameter("fill", "Fill the missing value with none, null, zero, previous or linear. The default is linear.").DataType("string")).
+		Do(returns200JsonMap, returns400, returns404, returns500))
+}
+
+func getHistoricalNamespaceMetric(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	fromText := request.QueryParameter("from")
+	toText := request.QueryParameter("to")
+	aggregationAmountText := request.QueryParameter("aggregationAmount")
+
+	from, err := time.Parse(time.RFC3339Nano, fromText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fromText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fromText"] = fromText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	to, err := time.Parse(time.RFC3339Nano, toText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse toText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["toText"] = toText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	aggregationAmount, err := strconv.Atoi(aggregationAmountText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse aggregationAmountText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["aggregationAmountText"] = aggregationAmountText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	fillText := request.QueryParameter("fill")
+	fill, err := monitor.ParseFill(fillText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fillText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fillText"] = fillText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	jsonMap, err := monitor.GetHistoricalNamespaceMetrics(namespace, aggregationAmount, from, to, fill)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get historical namespace metrics with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["aggregationAmount"] = aggregationAmount
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(jsonMap, "Json")
+}
+
+func getHistoricalClusterMetric(request *restful.Request, response *restful.Response) {
+	fromText := request.QueryParameter("from")
+	toText := request.QueryParameter("to")
+	aggregationAmountText := request.QueryParameter("aggregationAmount")
+
+	from, err := time.Parse(time.RFC3339Nano, fromText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fromText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fromText"] = fromText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	to, err := time.Parse(time.RFC3339Nano, toText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse toText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["toText"] = toText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	aggregationAmount, err := strconv.Atoi(aggregationAmountText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse aggregationAmountText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["aggregationAmountText"] = aggregationAmountText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	fillText := request.QueryParameter("fill")
+	fill, err := monitor.ParseFill(fillText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fillText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fillText"] = fillText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	jsonMap, err := monitor.GetHistoricalClusterMetrics(aggregationAmount, from, to, fill)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get historical cluster metrics with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["aggregationAmount"] = aggregationAmount
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(jsonMap, "Json")
+}
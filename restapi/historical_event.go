@@ -34,8 +34,10 @@ func registerWebServiceHistoricalEvent() {
 		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("acknowledge", "Already acknowledged or not").DataType("boolean")).
-		Param(ws.QueryParameter("size", "The amount of data to return").DataType("int")).
-		Param(ws.QueryParameter("offset", "The offset from the result").DataType("int")).
+		Param(ws.QueryParameter("size", "The amount of data to return. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("offset", "The offset from the result. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+		Produces(restful.MIME_JSON, mimeCsv, mimeNdjson).
 		Do(returns200JsonMap, returns400, returns404, returns500))
 
 	ws.Route(ws.GET("/{namespace}").Filter(authorize).Filter(auditLog).To(getHistoricalEvent).
@@ -44,8 +46,10 @@ func registerWebServiceHistoricalEvent() {
 		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("acknowledge", "Already acknowledged or not").DataType("boolean")).
-		Param(ws.QueryParameter("size", "The amount of data to return").DataType("int")).
-		Param(ws.QueryParameter("offset", "The offset from the result").DataType("int")).
+		Param(ws.QueryParameter("size", "The amount of data to return. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("offset", "The offset from the result. Ignored by csv and ndjson exporting all matched data.").DataType("int")).
+		Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+		Produces(restful.MIME_JSON, mimeCsv, mimeNdjson).
 		Do(returns200JsonMap, returns400, returns404, returns500))
 
 	ws.Route(ws.PUT("/{namespace}/{id}").Filter(authorize).Filter(auditLog).To(acknowledgeHistoricalEvent).
@@ -113,6 +117,22 @@ func getAllHistoricalEvent(request *restful.Request, response *restful.Response)
 		return
 	}
 
+	format, err := getExportFormat(request)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["formatText"] = request.QueryParameter("format")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+	if format != exportFormatJson {
+		exportHistoricalEvent(response, format, "*", from, to, acknowledge)
+		return
+	}
+
 	size, err := strconv.Atoi(sizeText)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
@@ -214,6 +234,22 @@ func getHistoricalEvent(request *restful.Request, response *restful.Response) {
 		return
 	}
 
+	format, err := getExportFormat(request)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["formatText"] = request.QueryParameter("format")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+	if format != exportFormatJson {
+		exportHistoricalEvent(response, format, namespace, from, to, acknowledge)
+		return
+	}
+
 	size, err := strconv.Atoi(sizeText)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
@@ -288,3 +324,69 @@ func acknowledgeHistoricalEvent(request *restful.Request, response *restful.Resp
 		return
 	}
 }
+
+var historicalEventCsvFieldSlice = []string{
+	"_id",
+	"_source.metadata.namespace",
+	"_source.firstTimestamp",
+	"_source.lastTimestamp",
+	"_source.count",
+	"_source.type",
+	"_source.reason",
+	"_source.message",
+	"_source.involvedObject.kind",
+	"_source.involvedObject.name",
+	"_source.source.component",
+	"_source.source.host",
+	"_source.searchMetaData.acknowledge",
+}
+
+var historicalEventCsvHeaderSlice = []string{
+	"id",
+	"namespace",
+	"firstTimestamp",
+	"lastTimestamp",
+	"count",
+	"type",
+	"reason",
+	"message",
+	"involvedObjectKind",
+	"involvedObjectName",
+	"sourceComponent",
+	"sourceHost",
+	"acknowledge",
+}
+
+// exportHistoricalEvent streams all matched events scrolled page by page. Each NDJSON line is the same as the element of the json result.
+func exportHistoricalEvent(response *restful.Response, format string, namespace string, from *time.Time, to *time.Time, acknowledge bool) {
+	exportWriter := createExportWriter(response, format, "historicalevents", historicalEventCsvHeaderSlice)
+	err := event.ExportHistoricalEvent(namespace, from, to, acknowledge, func(jsonSlice []interface{}) error {
+		for _, value := range jsonSlice {
+			jsonMap, _ := value.(map[string]interface{})
+			recordSlice := make([]string, 0, len(historicalEventCsvFieldSlice))
+			for _, field := range historicalEventCsvFieldSlice {
+				recordSlice = append(recordSlice, getFieldText(jsonMap, field))
+			}
+			if err := exportWriter.Write(value, recordSlice); err != nil {
+				return err
+			}
+		}
+		return exportWriter.Flush()
+	})
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Export historical event with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["acknowledge"] = acknowledge
+		jsonMap["format"] = format
+		writeExportError(response, exportWriter, jsonMap)
+		return
+	}
+
+	if err := exportWriter.Close(); err != nil {
+		log.Error(err)
+	}
+}
@@ -16,6 +16,7 @@ package restapi
 
 import (
 	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/control"
 	"github.com/cloudawan/cloudone_analysis/monitor"
 	"github.com/emicklei/go-restful"
 	"strconv"
@@ -35,6 +36,9 @@ func registerWebServiceHistoricalReplicationControllerMetric() {
 		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("aggregationAmount", "Aggregation amount").DataType("int")).
+		Param(ws.QueryParameter("fill", "Fill the missing value with none, null, zero, previous or linear. The default is linear.").DataType("string")).
+		Param(ws.QueryParameter("family", "Comma separated metric families basic, memory, filesystem, tcp, taskstats or all. The default is basic.").DataType("string")).
+		Param(ws.QueryParameter("aggregator", "Comma separated metric:aggregator like memoryUsage:max,memoryUsage:p95. The aggregator is min, max, avg, sum, last, p50, p90, p95 or p99.").DataType("string")).
 		Do(returns200JsonMap, returns400, returns404, returns500))
 
 	ws.Route(ws.GET("/{namespace}/{replicationcontroller}").Filter(authorize).Filter(auditLog).To(getHistoricalReplicationControllerMetric).
@@ -44,6 +48,11 @@ func registerWebServiceHistoricalReplicationControllerMetric() {
 		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
 		Param(ws.QueryParameter("aggregationAmount", "Aggregation amount").DataType("int")).
+		Param(ws.QueryParameter("fill", "Fill the missing value with none, null, zero, previous or linear. The default is linear.").DataType("string")).
+		Param(ws.QueryParameter("family", "Comma separated metric families basic, memory, filesystem, tcp, taskstats or all. The default is basic.").DataType("string")).
+		Param(ws.QueryParameter("aggregator", "Comma separated metric:aggregator like memoryUsage:max,memoryUsage:p95. The aggregator is min, max, avg, sum, last, p50, p90, p95 or p99.").DataType("string")).
+		Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+		Produces(restful.MIME_JSON, mimeCsv, mimeNdjson).
 		Do(returns200JsonMap, returns400, returns404, returns500))
 }
 
@@ -89,8 +98,36 @@ func getAllHistoricalReplicationControllerMetric(request *restful.Request, respo
 		return
 	}
 
+	fillText := request.QueryParameter("fill")
+	fill, err := monitor.ParseFill(fillText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fillText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fillText"] = fillText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	familyTextSlice := request.Request.URL.Query()["family"]
+	aggregatorTextSlice := request.Request.URL.Query()["aggregator"]
+	metricAggregationSlice, err := monitor.ParseMetricAggregation(familyTextSlice, aggregatorTextSlice)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse family or aggregator"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["family"] = familyTextSlice
+		jsonMap["aggregator"] = aggregatorTextSlice
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
 	jsonMap, err := monitor.GetAllHistoricalReplicationControllerMetrics(
-		namespace, aggregationAmount, from, to)
+		namespace, aggregationAmount, from, to, metricAggregationSlice, fill)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Get historical replication controller metrics with the criteria failure"
@@ -151,8 +188,69 @@ func getHistoricalReplicationControllerMetric(request *restful.Request, response
 		return
 	}
 
+	fillText := request.QueryParameter("fill")
+	fill, err := monitor.ParseFill(fillText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fillText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fillText"] = fillText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	familyTextSlice := request.Request.URL.Query()["family"]
+	aggregatorTextSlice := request.Request.URL.Query()["aggregator"]
+	metricAggregationSlice, err := monitor.ParseMetricAggregation(familyTextSlice, aggregatorTextSlice)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse family or aggregator"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["family"] = familyTextSlice
+		jsonMap["aggregator"] = aggregatorTextSlice
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	format, err := getExportFormat(request)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["formatText"] = request.QueryParameter("format")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	if format != exportFormatJson {
+		metricSeriesResult, err := monitor.GetWorkloadMetricSeries(
+			namespace, control.WorkloadKindReplicationController, replicationControllerName, aggregationAmount, from, to, metricAggregationSlice, fill)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Get historical replication controller metrics with the criteria failure"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["namespace"] = namespace
+			jsonMap["replicationControllerName"] = replicationControllerName
+			jsonMap["from"] = from
+			jsonMap["to"] = to
+			jsonMap["aggregationAmount"] = aggregationAmount
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(404, string(errorMessageByteSlice))
+			return
+		}
+		writeMetricSeriesExport(response, format, "historicalreplicationcontrollermetrics", metricSeriesResult)
+		return
+	}
+
 	jsonMap, err := monitor.GetHistoricalReplicationControllerMetrics(
-		namespace, replicationControllerName, aggregationAmount, from, to)
+		namespace, replicationControllerName, aggregationAmount, from, to, metricAggregationSlice, fill)
 	if err != nil {
 		jsonMap := make(map[string]interface{})
 		jsonMap["Error"] = "Get historical replication controller metrics with the criteria failure"
@@ -0,0 +1,57 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/emicklei/go-restful"
+	"net/http"
+)
+
+func registerWebServiceHistoricalWorkload() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/historicalworkloads")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/{namespace}").Filter(authorize).Filter(auditLog).To(getAllHistoricalWorkload).
+		Doc("Get all historical workload kinds and names in the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Do(returns200HistoricalWorkloadSlice, returns404, returns500))
+}
+
+func getAllHistoricalWorkload(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+
+	historicalWorkloadSlice, err := monitor.GetAllWorkloadInNameSpace(namespace)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all historical workload in the namespace failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(historicalWorkloadSlice, "[]HistoricalWorkload")
+}
+
+func returns200HistoricalWorkloadSlice(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", make([]monitor.HistoricalWorkload, 0))
+}
@@ -0,0 +1,273 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/emicklei/go-restful"
+	"strconv"
+	"time"
+)
+
+func registerWebServiceHistoricalWorkloadMetric() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/historicalworkloadmetrics")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/{namespace}").Filter(authorize).Filter(auditLog).To(getAllHistoricalWorkloadMetric).
+		Doc("Get all historical workloads in the namespace by kind and name").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
+		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
+		Param(ws.QueryParameter("aggregationAmount", "Aggregation amount").DataType("int")).
+		Param(ws.QueryParameter("fill", "Fill the missing value with none, null, zero, previous or linear. The default is linear.").DataType("string")).
+		Param(ws.QueryParameter("family", "Comma separated metric families basic, memory, filesystem, tcp, taskstats or all. The default is basic.").DataType("string")).
+		Param(ws.QueryParameter("aggregator", "Comma separated metric:aggregator like memoryUsage:max,memoryUsage:p95. The aggregator is min, max, avg, sum, last, p50, p90, p95 or p99.").DataType("string")).
+		Do(returns200JsonMap, returns400, returns404, returns500))
+
+	ws.Route(ws.GET("/{namespace}/{kind}/{name}").Filter(authorize).Filter(auditLog).To(getHistoricalWorkloadMetric).
+		Doc("Get the historical workload in the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("kind", "Workload kind like Deployment, StatefulSet, DaemonSet, Job, ReplicaSet, ReplicationController or Pod").DataType("string")).
+		Param(ws.PathParameter("name", "Workload name").DataType("string")).
+		Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
+		Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
+		Param(ws.QueryParameter("aggregationAmount", "Aggregation amount").DataType("int")).
+		Param(ws.QueryParameter("fill", "Fill the missing value with none, null, zero, previous or linear. The default is linear.").DataType("string")).
+		Param(ws.QueryParameter("family", "Comma separated metric families basic, memory, filesystem, tcp, taskstats or all. The default is basic.").DataType("string")).
+		Param(ws.QueryParameter("aggregator", "Comma separated metric:aggregator like memoryUsage:max,memoryUsage:p95. The aggregator is min, max, avg, sum, last, p50, p90, p95 or p99.").DataType("string")).
+		Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+		Produces(restful.MIME_JSON, mimeCsv, mimeNdjson).
+		Do(returns200JsonMap, returns400, returns404, returns500))
+}
+
+func getAllHistoricalWorkloadMetric(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	fromText := request.QueryParameter("from")
+	toText := request.QueryParameter("to")
+	aggregationAmountText := request.QueryParameter("aggregationAmount")
+
+	from, err := time.Parse(time.RFC3339Nano, fromText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fromText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fromText"] = fromText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	to, err := time.Parse(time.RFC3339Nano, toText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse toText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["toText"] = toText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	aggregationAmount, err := strconv.Atoi(aggregationAmountText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse aggregationAmountText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["aggregationAmountText"] = aggregationAmountText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	fillText := request.QueryParameter("fill")
+	fill, err := monitor.ParseFill(fillText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fillText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fillText"] = fillText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	familyTextSlice := request.Request.URL.Query()["family"]
+	aggregatorTextSlice := request.Request.URL.Query()["aggregator"]
+	metricAggregationSlice, err := monitor.ParseMetricAggregation(familyTextSlice, aggregatorTextSlice)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse family or aggregator"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["family"] = familyTextSlice
+		jsonMap["aggregator"] = aggregatorTextSlice
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	jsonMap, err := monitor.GetAllHistoricalWorkloadMetrics(
+		namespace, aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get historical workload metrics with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["aggregationAmount"] = aggregationAmount
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(jsonMap, "Json")
+}
+
+func getHistoricalWorkloadMetric(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	workloadKind := monitor.NormalizeWorkloadKind(request.PathParameter("kind"))
+	workloadName := request.PathParameter("name")
+	fromText := request.QueryParameter("from")
+	toText := request.QueryParameter("to")
+	aggregationAmountText := request.QueryParameter("aggregationAmount")
+
+	from, err := time.Parse(time.RFC3339Nano, fromText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fromText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fromText"] = fromText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	to, err := time.Parse(time.RFC3339Nano, toText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse toText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["toText"] = toText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	aggregationAmount, err := strconv.Atoi(aggregationAmountText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse aggregationAmountText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["aggregationAmountText"] = aggregationAmountText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	fillText := request.QueryParameter("fill")
+	fill, err := monitor.ParseFill(fillText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse fillText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["fillText"] = fillText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	familyTextSlice := request.Request.URL.Query()["family"]
+	aggregatorTextSlice := request.Request.URL.Query()["aggregator"]
+	metricAggregationSlice, err := monitor.ParseMetricAggregation(familyTextSlice, aggregatorTextSlice)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse family or aggregator"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["family"] = familyTextSlice
+		jsonMap["aggregator"] = aggregatorTextSlice
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	format, err := getExportFormat(request)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["formatText"] = request.QueryParameter("format")
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	if format != exportFormatJson {
+		metricSeriesResult, err := monitor.GetWorkloadMetricSeries(
+			namespace, workloadKind, workloadName, aggregationAmount, from, to, metricAggregationSlice, fill)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Get historical workload metrics with the criteria failure"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["namespace"] = namespace
+			jsonMap["workloadKind"] = workloadKind
+			jsonMap["workloadName"] = workloadName
+			jsonMap["from"] = from
+			jsonMap["to"] = to
+			jsonMap["aggregationAmount"] = aggregationAmount
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(404, string(errorMessageByteSlice))
+			return
+		}
+		writeMetricSeriesExport(response, format, "historicalworkloadmetrics", metricSeriesResult)
+		return
+	}
+
+	jsonMap, err := monitor.GetHistoricalWorkloadMetrics(
+		namespace, workloadKind, workloadName, aggregationAmount, from, to, metricAggregationSlice, fill)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get historical workload metrics with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["namespace"] = namespace
+		jsonMap["workloadKind"] = workloadKind
+		jsonMap["workloadName"] = workloadName
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["aggregationAmount"] = aggregationAmount
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(jsonMap, "Json")
+}
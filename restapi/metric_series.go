@@ -0,0 +1,245 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// API v2 returns the typed series instead of the nested map so the name of a pod or container never conflicts
+// with the other keys. The v1 endpoints are kept for the existing clients.
+func registerWebServiceMetricSeries() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v2/metrics")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	addMetricSeriesParameter := func(routeBuilder *restful.RouteBuilder, hasMetricAggregation bool) *restful.RouteBuilder {
+		routeBuilder.
+			Param(ws.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
+			Param(ws.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
+			Param(ws.QueryParameter("aggregationAmount", "Aggregation amount").DataType("int")).
+			Param(ws.QueryParameter("fill", "Fill the missing value with none, null, zero, previous or linear. The default is linear.").DataType("string")).
+			Param(ws.QueryParameter("format", exportFormatParameterDescription).DataType("string")).
+			Produces(restful.MIME_JSON, mimeCsv, mimeNdjson)
+		if hasMetricAggregation {
+			routeBuilder.
+				Param(ws.QueryParameter("family", "Comma separated metric families. The default is basic for the containers and all for the nodes.").DataType("string")).
+				Param(ws.QueryParameter("aggregator", "Comma separated metric:aggregator like memoryUsage:max,memoryUsage:p95. The aggregator is min, max, avg, sum, last, p50, p90, p95 or p99.").DataType("string"))
+		}
+		return routeBuilder.Writes(monitor.MetricSeriesResult{}).Do(returns200MetricSeriesResult, returns400, returns404, returns500)
+	}
+
+	ws.Route(addMetricSeriesParameter(ws.GET("/workloads/{namespace}/{kind}/{name}").Filter(authorize).Filter(auditLog).To(getWorkloadMetricSeries).
+		Doc("Get the series of each container, pod and the workload").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("kind", "Workload kind like Deployment, StatefulSet, DaemonSet, Job, ReplicaSet, ReplicationController or Pod").DataType("string")).
+		Param(ws.PathParameter("name", "Workload name").DataType("string")), true))
+
+	ws.Route(addMetricSeriesParameter(ws.GET("/pods/{namespace}/{pod}").Filter(authorize).Filter(auditLog).To(getPodMetricSeries).
+		Doc("Get the series of each container and the pod including the pod no longer existing").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("pod", "Pod name").DataType("string")), true))
+
+	ws.Route(addMetricSeriesParameter(ws.GET("/pods/{namespace}/{pod}/{container}").Filter(authorize).Filter(auditLog).To(getPodMetricSeries).
+		Doc("Get the series of the container including the pod no longer existing").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("pod", "Pod name").DataType("string")).
+		Param(ws.PathParameter("container", "Container name").DataType("string")), true))
+
+	ws.Route(addMetricSeriesParameter(ws.GET("/nodes").Filter(authorize).Filter(auditLog).To(getNodeMetricSeries).
+		Doc("Get the series of all nodes"), true))
+
+	ws.Route(addMetricSeriesParameter(ws.GET("/nodes/{node}").Filter(authorize).Filter(auditLog).To(getNodeMetricSeries).
+		Doc("Get the series of the node").
+		Param(ws.PathParameter("node", "Kubernetes node name").DataType("string")), true))
+
+	ws.Route(addMetricSeriesParameter(ws.GET("/namespaces/{namespace}").Filter(authorize).Filter(auditLog).To(getNamespaceMetricSeries).
+		Doc("Get the series summed up over all containers in the namespace").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")), false))
+
+	ws.Route(addMetricSeriesParameter(ws.GET("/cluster").Filter(authorize).Filter(auditLog).To(getClusterMetricSeries).
+		Doc("Get the series summed up over all containers in the cluster and in each namespace"), false))
+}
+
+func returns200MetricSeriesResult(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", monitor.MetricSeriesResult{})
+}
+
+type metricSeriesQuery struct {
+	From                   time.Time
+	To                     time.Time
+	AggregationAmount      int
+	Fill                   string
+	Format                 string
+	MetricAggregationSlice []monitor.MetricAggregation
+}
+
+// parseMetricSeriesQuery returns the query parameters or writes the bad request if any could not be parsed
+func parseMetricSeriesQuery(request *restful.Request, response *restful.Response,
+	parseMetricAggregation func(familyTextSlice []string, aggregatorTextSlice []string) ([]monitor.MetricAggregation, error)) (*metricSeriesQuery, bool) {
+	fromText := request.QueryParameter("from")
+	toText := request.QueryParameter("to")
+	aggregationAmountText := request.QueryParameter("aggregationAmount")
+	fillText := request.QueryParameter("fill")
+	familyTextSlice := request.Request.URL.Query()["family"]
+	aggregatorTextSlice := request.Request.URL.Query()["aggregator"]
+
+	query := &metricSeriesQuery{}
+	jsonMap := make(map[string]interface{})
+	var err error
+	if query.From, err = time.Parse(time.RFC3339Nano, fromText); err != nil {
+		jsonMap["Error"] = "Could not parse fromText"
+		jsonMap["fromText"] = fromText
+	} else if query.To, err = time.Parse(time.RFC3339Nano, toText); err != nil {
+		jsonMap["Error"] = "Could not parse toText"
+		jsonMap["toText"] = toText
+	} else if query.AggregationAmount, err = strconv.Atoi(aggregationAmountText); err != nil {
+		jsonMap["Error"] = "Could not parse aggregationAmountText"
+		jsonMap["aggregationAmountText"] = aggregationAmountText
+	} else if query.Fill, err = monitor.ParseFill(fillText); err != nil {
+		jsonMap["Error"] = "Could not parse fillText"
+		jsonMap["fillText"] = fillText
+	} else if query.Format, err = getExportFormat(request); err != nil {
+		jsonMap["Error"] = "Could not parse formatText"
+		jsonMap["formatText"] = request.QueryParameter("format")
+	} else if parseMetricAggregation != nil {
+		if query.MetricAggregationSlice, err = parseMetricAggregation(familyTextSlice, aggregatorTextSlice); err != nil {
+			jsonMap["Error"] = "Could not parse family or aggregator"
+			jsonMap["family"] = familyTextSlice
+			jsonMap["aggregator"] = aggregatorTextSlice
+		}
+	}
+	if err != nil {
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return nil, false
+	}
+	return query, true
+}
+
+func writeMetricSeriesResult(response *restful.Response, metricSeriesResult *monitor.MetricSeriesResult,
+	err error, query *metricSeriesQuery, criteriaJsonMap map[string]interface{}) {
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get metric series with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		for key, value := range criteriaJsonMap {
+			jsonMap[key] = value
+		}
+		jsonMap["from"] = query.From
+		jsonMap["to"] = query.To
+		jsonMap["aggregationAmount"] = query.AggregationAmount
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	if query.Format != exportFormatJson {
+		writeMetricSeriesExport(response, query.Format, "metrics", metricSeriesResult)
+	} else {
+		response.WriteEntity(metricSeriesResult)
+	}
+}
+
+func getWorkloadMetricSeries(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	workloadKind := monitor.NormalizeWorkloadKind(request.PathParameter("kind"))
+	workloadName := request.PathParameter("name")
+
+	query, ok := parseMetricSeriesQuery(request, response, monitor.ParseMetricAggregation)
+	if ok == false {
+		return
+	}
+
+	metricSeriesResult, err := monitor.GetWorkloadMetricSeries(namespace, workloadKind, workloadName,
+		query.AggregationAmount, query.From, query.To, query.MetricAggregationSlice, query.Fill)
+	writeMetricSeriesResult(response, metricSeriesResult, err, query, map[string]interface{}{
+		"namespace":    namespace,
+		"workloadKind": workloadKind,
+		"workloadName": workloadName,
+	})
+}
+
+func getPodMetricSeries(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	podName := request.PathParameter("pod")
+	// Empty for the pod
+	containerName := request.PathParameter("container")
+
+	query, ok := parseMetricSeriesQuery(request, response, monitor.ParseMetricAggregation)
+	if ok == false {
+		return
+	}
+
+	metricSeriesResult, err := monitor.GetPodMetricSeries(namespace, podName, containerName,
+		query.AggregationAmount, query.From, query.To, query.MetricAggregationSlice, query.Fill)
+	writeMetricSeriesResult(response, metricSeriesResult, err, query, map[string]interface{}{
+		"namespace":     namespace,
+		"podName":       podName,
+		"containerName": containerName,
+	})
+}
+
+func getNodeMetricSeries(request *restful.Request, response *restful.Response) {
+	// Empty for all nodes
+	nodeName := request.PathParameter("node")
+
+	query, ok := parseMetricSeriesQuery(request, response, monitor.ParseNodeMetricAggregation)
+	if ok == false {
+		return
+	}
+
+	metricSeriesResult, err := monitor.GetNodeMetricSeries(nodeName,
+		query.AggregationAmount, query.From, query.To, query.MetricAggregationSlice, query.Fill)
+	writeMetricSeriesResult(response, metricSeriesResult, err, query, map[string]interface{}{
+		"nodeName": nodeName,
+	})
+}
+
+func getNamespaceMetricSeries(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+
+	query, ok := parseMetricSeriesQuery(request, response, nil)
+	if ok == false {
+		return
+	}
+
+	metricSeriesResult, err := monitor.GetNamespaceMetricSeries(namespace,
+		query.AggregationAmount, query.From, query.To, query.Fill)
+	writeMetricSeriesResult(response, metricSeriesResult, err, query, map[string]interface{}{
+		"namespace": namespace,
+	})
+}
+
+func getClusterMetricSeries(request *restful.Request, response *restful.Response) {
+	query, ok := parseMetricSeriesQuery(request, response, nil)
+	if ok == false {
+		return
+	}
+
+	metricSeriesResult, err := monitor.GetClusterMetricSeries(
+		query.AggregationAmount, query.From, query.To, query.Fill)
+	writeMetricSeriesResult(response, metricSeriesResult, err, query, nil)
+}
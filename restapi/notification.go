@@ -0,0 +1,300 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/notification"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func registerWebServiceNotification() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/notificationchannels")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/").Filter(authorize).Filter(auditLog).To(getAllNotificationChannel).
+		Doc("Get all notification channels with the secret masked").
+		Do(returns200NotificationChannelSlice, returns404, returns500))
+
+	ws.Route(ws.POST("/").Filter(authorize).Filter(auditLogMaskingSecret).To(postNotificationChannel).
+		Doc("Create the notification channel").
+		Do(returns200, returns400, returns422, returns500).
+		Reads(notification.Channel{}))
+
+	ws.Route(ws.GET("/{name}").Filter(authorize).Filter(auditLog).To(getNotificationChannel).
+		Doc("Get the notification channel with the secret masked").
+		Param(ws.PathParameter("name", "Channel name").DataType("string")).
+		Do(returns200NotificationChannel, returns404, returns500))
+
+	ws.Route(ws.PUT("/{name}").Filter(authorize).Filter(auditLogMaskingSecret).To(putNotificationChannel).
+		Doc("Update the notification channel. The secret is kept if it is empty unless clearSecret is true.").
+		Param(ws.PathParameter("name", "Channel name").DataType("string")).
+		Param(ws.QueryParameter("clearSecret", "Remove the secret").DataType("boolean")).
+		Do(returns200, returns400, returns422, returns500).
+		Reads(notification.Channel{}))
+
+	ws.Route(ws.DELETE("/{name}").Filter(authorize).Filter(auditLog).To(deleteNotificationChannel).
+		Doc("Delete the notification channel").
+		Param(ws.PathParameter("name", "Channel name").DataType("string")).
+		Do(returns200, returns404, returns500))
+
+	notificationWs := new(restful.WebService)
+	notificationWs.Path("/api/v1/notifications")
+	notificationWs.Consumes(restful.MIME_JSON)
+	notificationWs.Produces(restful.MIME_JSON)
+	restful.Add(notificationWs)
+
+	notificationWs.Route(notificationWs.GET("/deliveries").Filter(authorize).Filter(auditLog).To(getNotificationDelivery).
+		Doc("Get the delivery history of the notifications").
+		Param(notificationWs.QueryParameter("channel", "Channel name. All channels if empty.").DataType("string")).
+		Param(notificationWs.QueryParameter("status", "pending, delivered or dead. All statuses if empty.").DataType("string")).
+		Param(notificationWs.QueryParameter("from", "Time start from in RFC3339Nano formt").DataType("string")).
+		Param(notificationWs.QueryParameter("to", "Time end to in RFC3339Nano formt").DataType("string")).
+		Param(notificationWs.QueryParameter("size", "The amount of data to return").DataType("int")).
+		Param(notificationWs.QueryParameter("offset", "The offset from the result").DataType("int")).
+		Do(returns200NotificationDeliverySlice, returns400, returns404, returns500))
+}
+
+func getAllNotificationChannel(request *restful.Request, response *restful.Response) {
+	channelSlice, err := notification.GetAllChannel()
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get all notification channels failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(channelSlice, "[]Channel")
+}
+
+func postNotificationChannel(request *restful.Request, response *restful.Response) {
+	channel := &notification.Channel{}
+	err := request.ReadEntity(&channel)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	err = notification.CreateChannel(channel)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Create notification channel failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		// The channel is not returned since it has the secret
+		jsonMap["name"] = channel.Name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getNotificationChannel(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	channel, err := notification.GetChannel(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get notification channel failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(channel, "Channel")
+}
+
+func putNotificationChannel(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+	clearSecretText := request.QueryParameter("clearSecret")
+
+	clearSecret := false
+	if clearSecretText != "" {
+		var err error
+		clearSecret, err = strconv.ParseBool(clearSecretText)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Could not parse clearSecretText"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["clearSecretText"] = clearSecretText
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(400, string(errorMessageByteSlice))
+			return
+		}
+	}
+
+	channel := &notification.Channel{}
+	err := request.ReadEntity(&channel)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Read body failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+	// The name in the path identifies the channel
+	channel.Name = name
+
+	err = notification.UpdateChannel(channel, clearSecret)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Update notification channel failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		// The channel is not returned since it has the secret
+		jsonMap["name"] = channel.Name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(422, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func deleteNotificationChannel(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+
+	err := notification.DeleteChannel(name)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Delete notification channel failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["name"] = name
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+}
+
+func getNotificationDelivery(request *restful.Request, response *restful.Response) {
+	channelName := request.QueryParameter("channel")
+	status := request.QueryParameter("status")
+	fromText := request.QueryParameter("from")
+	toText := request.QueryParameter("to")
+	sizeText := request.QueryParameter("size")
+	offsetText := request.QueryParameter("offset")
+
+	var from *time.Time
+	if fromText == "" {
+		from = nil
+	} else {
+		fromValue, err := time.Parse(time.RFC3339Nano, fromText)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Could not parse fromText"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["fromText"] = fromText
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(400, string(errorMessageByteSlice))
+			return
+		} else {
+			from = &fromValue
+		}
+	}
+
+	var to *time.Time
+	if toText == "" {
+		to = nil
+	} else {
+		toValue, err := time.Parse(time.RFC3339Nano, toText)
+		if err != nil {
+			jsonMap := make(map[string]interface{})
+			jsonMap["Error"] = "Could not parse toText"
+			jsonMap["ErrorMessage"] = err.Error()
+			jsonMap["toText"] = toText
+			errorMessageByteSlice, _ := json.Marshal(jsonMap)
+			log.Error(jsonMap)
+			response.WriteErrorString(400, string(errorMessageByteSlice))
+			return
+		} else {
+			to = &toValue
+		}
+	}
+
+	size, err := strconv.Atoi(sizeText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse sizeText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["sizeText"] = sizeText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	offset, err := strconv.Atoi(offsetText)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Could not parse offsetText"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["offsetText"] = offsetText
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(400, string(errorMessageByteSlice))
+		return
+	}
+
+	deliverySlice, err := notification.SearchDelivery(channelName, status, from, to, size, offset)
+	if err != nil {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Get notification delivery with the criteria failure"
+		jsonMap["ErrorMessage"] = err.Error()
+		jsonMap["channel"] = channelName
+		jsonMap["status"] = status
+		jsonMap["from"] = from
+		jsonMap["to"] = to
+		jsonMap["size"] = size
+		jsonMap["offset"] = offset
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(404, string(errorMessageByteSlice))
+		return
+	}
+
+	response.WriteJson(deliverySlice, "[]Delivery")
+}
+
+func returns200NotificationChannelSlice(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []notification.Channel{})
+}
+
+func returns200NotificationChannel(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", notification.Channel{})
+}
+
+func returns200NotificationDeliverySlice(b *restful.RouteBuilder) {
+	b.Returns(http.StatusOK, "OK", []notification.Delivery{})
+}
@@ -26,10 +26,19 @@ import (
 func StartRestAPIServer() {
 	registerWebServiceHistoricalReplicationControllerMetric()
 	registerWebServiceHistoricalReplicationController()
+	registerWebServiceHistoricalWorkloadMetric()
+	registerWebServiceHistoricalWorkload()
+	registerWebServiceHistoricalPodMetric()
+	registerWebServiceHistoricalNodeMetric()
+	registerWebServiceHistoricalClusterMetric()
+	registerWebServiceMetricSeries()
+	registerWebServiceStream()
 	registerWebServiceHistoricalEvent()
 	registerWebServiceHealthCheck()
 	registerWebServiceAuditLog()
 	registerWebServiceBuildLog()
+	registerWebServiceAlert()
+	registerWebServiceNotification()
 
 	// Place the method+path to description mapping to map for audit
 	for _, rws := range restful.DefaultContainer.RegisteredWebServices() {
@@ -16,6 +16,7 @@ package restapi
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/cloudawan/cloudone_analysis/audit"
 	utilityaudit "github.com/cloudawan/cloudone_utility/audit"
 	"github.com/emicklei/go-restful"
@@ -23,6 +24,28 @@ import (
 )
 
 func auditLog(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	recordAuditLog(req, resp, chain, nil)
+}
+
+// auditLogMaskingSecret is used where the JSON body has the field Secret so the secret is not kept in the audit log
+func auditLogMaskingSecret(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	recordAuditLog(req, resp, chain, func(requestBody []byte) []byte {
+		jsonMap := make(map[string]interface{})
+		if err := json.Unmarshal(requestBody, &jsonMap); err != nil {
+			return requestBody
+		}
+		if _, ok := jsonMap["Secret"]; ok {
+			jsonMap["Secret"] = "******"
+		}
+		byteSlice, err := json.Marshal(jsonMap)
+		if err != nil {
+			return requestBody
+		}
+		return byteSlice
+	})
+}
+
+func recordAuditLog(req *restful.Request, resp *restful.Response, chain *restful.FilterChain, mask func(requestBody []byte) []byte) {
 	token := req.Request.Header.Get("token")
 	requestURI := req.Request.URL.RequestURI()
 	method := req.Request.Method
@@ -35,8 +58,13 @@ func auditLog(req *restful.Request, resp *restful.Response, chain *restful.Filte
 	// Write data back for the later use
 	req.Request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
 
+	auditedRequestBody := requestBody
+	if mask != nil {
+		auditedRequestBody = mask(requestBody)
+	}
+
 	go func() {
-		sendAuditLog(token, requestURI, method, path, string(requestBody), queryParameterMap, pathParameterMap, remoteAddress)
+		sendAuditLog(token, requestURI, method, path, string(auditedRequestBody), queryParameterMap, pathParameterMap, remoteAddress)
 	}()
 
 	chain.ProcessFilter(req, resp)
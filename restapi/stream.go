@@ -0,0 +1,202 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/event"
+	"github.com/cloudawan/cloudone_analysis/monitor"
+	"github.com/cloudawan/cloudone_analysis/utility/stream"
+	"github.com/emicklei/go-restful"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	mimeEventStream = "text/event-stream"
+	// The comment sent when there is no data so the proxy doesn't close the idle connection
+	streamKeepAliveInterval = 15 * time.Second
+)
+
+func registerWebServiceStream() {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1/streams")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(mimeEventStream)
+	restful.Add(ws)
+
+	ws.Route(ws.GET("/events").Filter(authorizeStream).Filter(auditLog).To(streamAllHistoricalEvent).
+		Doc("Stream the events newly recorded as server-sent events").
+		Param(ws.QueryParameter("type", "Comma separated event types like Normal,Warning. All types if empty.").DataType("string")).
+		Param(ws.QueryParameter("reason", "Comma separated event reasons like BackOff,Killing. All reasons if empty.").DataType("string")).
+		Param(ws.QueryParameter("token", "The token used if the header token is absent like from the browser EventSource").DataType("string")).
+		Do(returns200, returns500))
+
+	ws.Route(ws.GET("/events/{namespace}").Filter(authorizeStream).Filter(auditLog).To(streamHistoricalEvent).
+		Doc("Stream the events newly recorded in the namespace as server-sent events").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.QueryParameter("type", "Comma separated event types like Normal,Warning. All types if empty.").DataType("string")).
+		Param(ws.QueryParameter("reason", "Comma separated event reasons like BackOff,Killing. All reasons if empty.").DataType("string")).
+		Param(ws.QueryParameter("token", "The token used if the header token is absent like from the browser EventSource").DataType("string")).
+		Do(returns200, returns500))
+
+	ws.Route(ws.GET("/workloadmetrics/{namespace}/{kind}/{name}").Filter(authorizeStream).Filter(auditLog).To(streamWorkloadMetric).
+		Doc("Stream the container metrics of the workload newly collected as server-sent events").
+		Param(ws.PathParameter("namespace", "Kubernetes namespace").DataType("string")).
+		Param(ws.PathParameter("kind", "Workload kind like Deployment, StatefulSet, DaemonSet, Job, ReplicaSet, ReplicationController or Pod").DataType("string")).
+		Param(ws.PathParameter("name", "Workload name").DataType("string")).
+		Param(ws.QueryParameter("token", "The token used if the header token is absent like from the browser EventSource").DataType("string")).
+		Do(returns200, returns500))
+}
+
+// authorizeStream accepts the token in the query since the browser EventSource can't set the header.
+// The token is removed from the query so it is not saved in the audit log.
+func authorizeStream(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	query := req.Request.URL.Query()
+	if token := query.Get("token"); token != "" {
+		if req.Request.Header.Get("token") == "" {
+			req.Request.Header.Set("token", token)
+		}
+		query.Del("token")
+		req.Request.URL.RawQuery = query.Encode()
+		req.Request.RequestURI = req.Request.URL.RequestURI()
+	}
+	authorize(req, resp, chain)
+}
+
+func streamAllHistoricalEvent(request *restful.Request, response *restful.Response) {
+	streamHistoricalEventInNamespace(request, response, "")
+}
+
+func streamHistoricalEvent(request *restful.Request, response *restful.Response) {
+	streamHistoricalEventInNamespace(request, response, request.PathParameter("namespace"))
+}
+
+// The empty namespace is for all namespaces
+func streamHistoricalEventInNamespace(request *restful.Request, response *restful.Response, namespace string) {
+	typeMap := getCommaSeparatedSet(request.QueryParameter("type"))
+	reasonMap := getCommaSeparatedSet(request.QueryParameter("reason"))
+
+	subscriber := event.SubscribeHistoricalEvent()
+	defer event.UnsubscribeHistoricalEvent(subscriber)
+
+	serveStream(request, response, subscriber, "event", func(value interface{}) bool {
+		sourceJsonMap, _ := value.(map[string]interface{})["_source"].(map[string]interface{})
+		metadataJsonMap, _ := sourceJsonMap["metadata"].(map[string]interface{})
+		eventNamespace, _ := metadataJsonMap["namespace"].(string)
+		eventType, _ := sourceJsonMap["type"].(string)
+		reason, _ := sourceJsonMap["reason"].(string)
+		if namespace != "" && eventNamespace != namespace {
+			return false
+		}
+		if len(typeMap) > 0 && typeMap[eventType] == false {
+			return false
+		}
+		if len(reasonMap) > 0 && reasonMap[reason] == false {
+			return false
+		}
+		return true
+	})
+}
+
+func streamWorkloadMetric(request *restful.Request, response *restful.Response) {
+	namespace := request.PathParameter("namespace")
+	workloadKind := monitor.NormalizeWorkloadKind(request.PathParameter("kind"))
+	workloadName := request.PathParameter("name")
+
+	subscriber := monitor.SubscribeWorkloadMetricStream(namespace, workloadKind, workloadName)
+	defer monitor.UnsubscribeWorkloadMetricStream(namespace, workloadKind, workloadName, subscriber)
+
+	serveStream(request, response, subscriber, "metric", func(value interface{}) bool {
+		return true
+	})
+}
+
+func getCommaSeparatedSet(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, value := range strings.Split(text, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			set[value] = true
+		}
+	}
+	return set
+}
+
+// serveStream writes each value passing the filter as the server-sent event with the name until the client leaves.
+// The dropped event tells how many values were dropped for the client reading too slowly.
+func serveStream(request *restful.Request, response *restful.Response, subscriber *stream.Subscriber,
+	name string, filter func(value interface{}) bool) {
+	flusher, ok := response.ResponseWriter.(http.Flusher)
+	if ok == false {
+		jsonMap := make(map[string]interface{})
+		jsonMap["Error"] = "Streaming is not supported"
+		errorMessageByteSlice, _ := json.Marshal(jsonMap)
+		log.Error(jsonMap)
+		response.WriteErrorString(500, string(errorMessageByteSlice))
+		return
+	}
+
+	header := response.Header()
+	header.Set("Content-Type", mimeEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// Disable the buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAliveTicker := time.NewTicker(streamKeepAliveInterval)
+	defer keepAliveTicker.Stop()
+
+	done := request.Request.Context().Done()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case value := <-subscriber.Channel:
+			if droppedCount := subscriber.TakeDroppedCount(); droppedCount > 0 {
+				err = writeServerSentEvent(response, "dropped", map[string]interface{}{"DroppedCount": droppedCount})
+			}
+			if err == nil && filter(value) {
+				err = writeServerSentEvent(response, name, value)
+			}
+		case <-keepAliveTicker.C:
+			_, err = response.Write([]byte(": keepalive\n\n"))
+		}
+		if err != nil {
+			// The client is gone
+			log.Debug(err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeServerSentEvent(response *restful.Response, name string, value interface{}) error {
+	byteSlice, err := json.Marshal(value)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	// The data of the event is on one line since the JSON has no new line
+	if _, err := response.Write([]byte("event: " + name + "\ndata: " + string(byteSlice) + "\n\n")); err != nil {
+		return errors.New("Fail to write the event " + name + " with error " + err.Error())
+	}
+	return nil
+}
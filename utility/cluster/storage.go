@@ -0,0 +1,45 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+)
+
+// Storage is the backend keeping the singleton lock shared by all instances
+type Storage interface {
+	SaveClusterSingletonLock(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error
+	// Return the error with message notFoundErrorMessage if the lock doesn't exist
+	LoadClusterSingletonLock(index string, documentType string, id string) (map[string]interface{}, error)
+}
+
+var storage Storage
+
+func init() {
+	switch configuration.GetStorageType() {
+	case configuration.StorageTypeLocal:
+		storage = CreateStorageLocal()
+	default:
+		storage = CreateStorageElasticSearch()
+	}
+}
+
+func saveClusterSingletonLock(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
+	return storage.SaveClusterSingletonLock(index, documentType, id, jsonMap, refreshForSearch)
+}
+
+func loadClusterSingletonLock(index string, documentType string, id string) (map[string]interface{}, error) {
+	return storage.LoadClusterSingletonLock(index, documentType, id)
+}
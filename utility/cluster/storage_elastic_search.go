@@ -18,14 +18,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/cloudawan/cloudone_analysis/utility/database/elasticsearch"
-	elasticsearchlib "github.com/cloudawan/cloudone_utility/database/elasticsearch"
 )
 
-func init() {
+type StorageElasticSearch struct {
+}
+
+func CreateStorageElasticSearch() *StorageElasticSearch {
 	createIndexTemplate()
 	// Create index
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
 	connection.CreateIndex(indexClusterSingletonLock)
+	return &StorageElasticSearch{}
 }
 
 func createIndexTemplate() error {
@@ -91,7 +94,7 @@ func createIndexTemplate() error {
 	return nil
 }
 
-func saveClusterSingletonLock(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
+func (storageElasticSearch *StorageElasticSearch) SaveClusterSingletonLock(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
 	_, err := connection.Index(index, documentType, id, nil, jsonMap)
 	if err != nil {
@@ -113,16 +116,7 @@ func saveClusterSingletonLock(index string, documentType string, id string, json
 	}
 }
 
-// Bulk Process
-const (
-	maxConnection = 5
-)
-
-func createBulkProcessor() *elasticsearchlib.BulkProcessor {
-	return elasticsearch.ElasticSearchClient.CreateBulkProcessor(maxConnection)
-}
-
-func loadClusterSingletonLock(index string, documentType string, id string) (map[string]interface{}, error) {
+func (storageElasticSearch *StorageElasticSearch) LoadClusterSingletonLock(index string, documentType string, id string) (map[string]interface{}, error) {
 	connection := elasticsearch.ElasticSearchClient.GetConnection()
 	baseResponse, err := connection.Get(index, documentType, id, nil)
 	if err != nil {
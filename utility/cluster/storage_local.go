@@ -0,0 +1,49 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/database/local"
+)
+
+// The local storage is only visible to this process so the single instance is always selected eventually
+type StorageLocal struct {
+	documentStore *local.DocumentStore
+}
+
+func CreateStorageLocal() *StorageLocal {
+	return &StorageLocal{local.LocalDocumentStore}
+}
+
+func (storageLocal *StorageLocal) SaveClusterSingletonLock(index string, documentType string, id string, jsonMap map[string]interface{}, refreshForSearch bool) error {
+	if err := storageLocal.documentStore.Index(index, documentType, id, jsonMap); err != nil {
+		log.Error(err)
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (storageLocal *StorageLocal) LoadClusterSingletonLock(index string, documentType string, id string) (map[string]interface{}, error) {
+	jsonMap, err := storageLocal.documentStore.Get(index, documentType, id)
+	if err != nil {
+		if err.Error() != notFoundErrorMessage {
+			log.Error(err)
+		}
+		return nil, err
+	} else {
+		return jsonMap, nil
+	}
+}
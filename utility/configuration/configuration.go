@@ -15,12 +15,15 @@
 package configuration
 
 import (
+	"crypto/tls"
 	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/httpclient"
 	analysisLogger "github.com/cloudawan/cloudone_analysis/utility/logger"
 	"github.com/cloudawan/cloudone_utility/configuration"
 	"github.com/cloudawan/cloudone_utility/logger"
-	"github.com/cloudawan/cloudone_utility/restclient"
 	"io/ioutil"
+	"net/http"
+	"sync"
 	"time"
 )
 
@@ -36,11 +39,63 @@ var configurationContent = `
 	"kubeApiServerEndPoints": ["https://kubernetes.default.svc.cluster.local:443"],
 	"kubeApiServerHealthCheckTimeoutInMilliSecond": 1000,
 	"kubeApiServerTokenPath": "/var/run/secrets/kubernetes.io/serviceaccount/token",
+	"kubeApiServerCertificateAuthority": "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+	"kubeApiServerClientCertificate": "",
+	"kubeApiServerClientKey": "",
+	"kubeApiServerInsecureSkipVerify": false,
+	"kubeConfigPath": "",
+	"kubeConfigContext": "",
 	"singletonLockTimeoutInMilliSecond": 5000,
 	"singletonLockWaitingAfterBeingCandidateInMilliSecond": 5000,
 	"cloudoneProtocol": "https",
 	"cloudoneHost": "127.0.0.1",
-	"cloudonePort": 8081
+	"cloudonePort": 8081,
+	"storageType": "elasticsearch",
+	"bulkBatchSize": 1000,
+	"bulkFlushIntervalInMilliSecond": 1000,
+	"containerMetricsCollectionEnabled": true,
+	"containerMetricsCollectionIntervalInSecond": 50,
+	"containerMetricsCollectionTimeoutInSecond": 45,
+	"containerMetricsSource": "summary",
+	"nodeMetricsCollectionEnabled": true,
+	"nodeMetricsCollectionIntervalInSecond": 60,
+	"kubeletScheme": "https",
+	"kubeletPort": 10250,
+	"kubeletServiceAccountTokenPath": "/var/run/secrets/kubernetes.io/serviceaccount/token",
+	"kubeletCertificateAuthority": "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+	"kubeletClientCertificate": "",
+	"kubeletClientKey": "",
+	"kubeletInsecureSkipVerify": false,
+	"eventIngestionMode": "watch",
+	"eventWatchTimeoutInSecond": 60,
+	"eventDeleteAfterRecord": false,
+	"streamPollIntervalInSecond": 2,
+	"streamMetricsLookbackInSecond": 180,
+	"alertEvaluationIntervalInSecond": 30,
+	"notificationWorkerAmount": 4,
+	"notificationQueueSize": 1024,
+	"notificationRetryAmount": 5,
+	"notificationRetryInitialIntervalInSecond": 2,
+	"notificationRetryMaximumIntervalInSecond": 300,
+	"notificationTimeoutInSecond": 10,
+	"smtpHost": "",
+	"smtpPort": 25,
+	"smtpUsername": "",
+	"smtpPassword": "",
+	"smtpFrom": "",
+	"eventDigestEnabled": true,
+	"eventDigestHourInUTC": 8,
+	"indexRolloverPeriod": "daily",
+	"retentionInDay": {
+		"containerMetrics": 30,
+		"containerMetricsRollup": 365,
+		"nodeMetrics": 30,
+		"event": 90,
+		"auditLog": 365,
+		"buildLog": 365,
+		"alertHistory": 365,
+		"notificationDelivery": 90
+	}
 }
 `
 
@@ -48,6 +103,19 @@ var LocalConfiguration *configuration.Configuration
 
 const (
 	KubeApiServerHealthCheckTimeoutInMilliSecond = 1000
+	KubeApiServerRequestTimeout                  = 30 * time.Second
+	KubeApiServerCertificateAuthorityDefault     = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+var kubeApiServerLock = sync.RWMutex{}
+var kubeApiServerEndPointSlice []string
+var kubeApiServerTLSConfig *tls.Config
+var kubeApiServerHTTPClient *http.Client
+
+const (
+	StorageTypeElasticSearch = "elasticsearch"
+	StorageTypeLocal         = "local"
+	StorageTypeDefault       = StorageTypeElasticSearch
 )
 
 func init() {
@@ -71,23 +139,113 @@ func Reload() error {
 }
 
 func reloadFile() error {
-	// Token
+	kubeApiServerConnection, err := loadKubeApiServerConnection()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	tlsConfig, err := httpclient.CreateTLSConfigFromPEM(
+		kubeApiServerConnection.CertificateAuthorityPEM,
+		kubeApiServerConnection.ClientCertificatePEM,
+		kubeApiServerConnection.ClientKeyPEM,
+		kubeApiServerConnection.InsecureSkipVerify)
+	if err != nil {
+		log.Error("Fail to create the TLS configuration of the kube apiserver with error %s", err)
+		return err
+	}
+
+	kubeApiServerLock.Lock()
+	defer kubeApiServerLock.Unlock()
+	LocalConfiguration.SetNative("kubeApiServerToken", kubeApiServerConnection.Token)
+	kubeApiServerEndPointSlice = kubeApiServerConnection.EndPointSlice
+	kubeApiServerTLSConfig = tlsConfig
+	kubeApiServerHTTPClient = httpclient.CreateHTTPClient(tlsConfig, KubeApiServerRequestTimeout)
+
+	return nil
+}
+
+// loadKubeApiServerConnection uses the kubeconfig file if kubeConfigPath is set or the individual configuration otherwise
+func loadKubeApiServerConnection() (*KubeApiServerConnection, error) {
+	kubeConfigPath, _ := LocalConfiguration.GetString("kubeConfigPath")
+	if kubeConfigPath != "" {
+		kubeConfigContext, _ := LocalConfiguration.GetString("kubeConfigContext")
+		return loadKubeConfig(kubeConfigPath, kubeConfigContext)
+	}
+
+	kubeApiServerConnection := &KubeApiServerConnection{}
+
+	kubeApiServerEndPointSlice, ok := LocalConfiguration.GetStringSlice("kubeApiServerEndPoints")
+	if ok == false {
+		log.Error("Fail to get configuration kubeApiServerEndPoints")
+		return nil, errors.New("Fail to get configuration kubeApiServerEndPoints")
+	}
+	kubeApiServerConnection.EndPointSlice = kubeApiServerEndPointSlice
+
+	// Client certificate
+	clientCertificatePath, _ := LocalConfiguration.GetString("kubeApiServerClientCertificate")
+	clientKeyPath, _ := LocalConfiguration.GetString("kubeApiServerClientKey")
+	if clientCertificatePath != "" || clientKeyPath != "" {
+		var err error
+		if kubeApiServerConnection.ClientCertificatePEM, err = ioutil.ReadFile(clientCertificatePath); err != nil {
+			log.Error("Fail to get the file content of kubeApiServerClientCertificate %s", clientCertificatePath)
+			return nil, err
+		}
+		if kubeApiServerConnection.ClientKeyPEM, err = ioutil.ReadFile(clientKeyPath); err != nil {
+			log.Error("Fail to get the file content of kubeApiServerClientKey %s", clientKeyPath)
+			return nil, err
+		}
+	}
+
+	// Token is optional with the client certificate
 	kubeApiServerTokenPath, ok := LocalConfiguration.GetString("kubeApiServerTokenPath")
 	if ok == false {
 		log.Error("Fail to get configuration kubeApiServerTokenPath")
-		return errors.New("Fail to get configuration kubeApiServerTokenPath")
+		return nil, errors.New("Fail to get configuration kubeApiServerTokenPath")
 	}
-
 	fileContent, err := ioutil.ReadFile(kubeApiServerTokenPath)
 	if err != nil {
-		log.Error("Fail to get the file content of kubeApiServerTokenPath %s", kubeApiServerTokenPath)
-		return errors.New("Fail to get the file content of kubeApiServerTokenPath " + kubeApiServerTokenPath)
+		if len(kubeApiServerConnection.ClientCertificatePEM) == 0 {
+			log.Error("Fail to get the file content of kubeApiServerTokenPath %s", kubeApiServerTokenPath)
+			return nil, errors.New("Fail to get the file content of kubeApiServerTokenPath " + kubeApiServerTokenPath)
+		}
+	} else {
+		kubeApiServerConnection.Token = string(fileContent)
 	}
-	LocalConfiguration.SetNative("kubeApiServerToken", string(fileContent))
 
-	return nil
+	// The system CA is used if the CA bundle doesn't exist like running outside the cluster
+	certificateAuthorityPath, ok := LocalConfiguration.GetString("kubeApiServerCertificateAuthority")
+	if ok == false {
+		certificateAuthorityPath = KubeApiServerCertificateAuthorityDefault
+	}
+	if certificateAuthorityPath != "" {
+		kubeApiServerConnection.CertificateAuthorityPEM, err = ioutil.ReadFile(certificateAuthorityPath)
+		if err != nil {
+			log.Error("Fail to get the file content of kubeApiServerCertificateAuthority %s so the system CA is used", certificateAuthorityPath)
+		}
+	}
+
+	kubeApiServerConnection.InsecureSkipVerify, _ = LocalConfiguration.GetNative("kubeApiServerInsecureSkipVerify").(bool)
+
+	return kubeApiServerConnection, nil
 }
 
+// GetKubeApiServerTLSConfig returns the TLS configuration to verify the apiserver and to present the client certificate
+func GetKubeApiServerTLSConfig() *tls.Config {
+	kubeApiServerLock.RLock()
+	defer kubeApiServerLock.RUnlock()
+	return kubeApiServerTLSConfig
+}
+
+// GetKubeApiServerHTTPClient returns the client to send the request to the apiserver
+func GetKubeApiServerHTTPClient() *http.Client {
+	kubeApiServerLock.RLock()
+	defer kubeApiServerLock.RUnlock()
+	return kubeApiServerHTTPClient
+}
+
+// GetAvailablekubeApiServerEndPoint returns the first healthy endpoint and the authorization header value.
+// The token is empty if only the client certificate is used.
 func GetAvailablekubeApiServerEndPoint() (returnedEndPoint string, returnedToken string, returnedError error) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -99,11 +257,10 @@ func GetAvailablekubeApiServerEndPoint() (returnedEndPoint string, returnedToken
 		}
 	}()
 
-	kubeApiServerEndPointSlice, ok := LocalConfiguration.GetStringSlice("kubeApiServerEndPoints")
-	if ok == false {
-		log.Error("Fail to get configuration kubeApiServerEndPoints")
-		return "", "", errors.New("Fail to get configuration kubeApiServerEndPoints")
-	}
+	kubeApiServerLock.RLock()
+	endPointSlice := kubeApiServerEndPointSlice
+	tlsConfig := kubeApiServerTLSConfig
+	kubeApiServerLock.RUnlock()
 
 	kubeApiServerHealthCheckTimeoutInMilliSecond, ok := LocalConfiguration.GetInt("kubeApiServerHealthCheckTimeoutInMilliSecond")
 	if ok == false {
@@ -116,15 +273,17 @@ func GetAvailablekubeApiServerEndPoint() (returnedEndPoint string, returnedToken
 		return "", "", errors.New("Fail to get configuration kubeApiServerToken")
 	}
 
-	token := "Bearer " + kubeApiServerToken
+	token := ""
+	if kubeApiServerToken != "" {
+		token = "Bearer " + kubeApiServerToken
+	}
 	headerMap := make(map[string]string)
 	headerMap["Authorization"] = token
 
-	for _, kubeApiServerEndPoint := range kubeApiServerEndPointSlice {
-		result, err := restclient.HealthCheck(
-			kubeApiServerEndPoint,
-			headerMap,
-			time.Duration(kubeApiServerHealthCheckTimeoutInMilliSecond)*time.Millisecond)
+	healthCheckClient := httpclient.CreateHTTPClient(tlsConfig,
+		time.Duration(kubeApiServerHealthCheckTimeoutInMilliSecond)*time.Millisecond)
+	for _, kubeApiServerEndPoint := range endPointSlice {
+		result, err := httpclient.HealthCheck(healthCheckClient, kubeApiServerEndPoint, headerMap)
 
 		if result {
 			return kubeApiServerEndPoint, token, nil
@@ -138,3 +297,18 @@ func GetAvailablekubeApiServerEndPoint() (returnedEndPoint string, returnedToken
 	log.Error("No available kube apiserver endpoint")
 	return "", "", errors.New("No available kube apiserver endpoint")
 }
+
+func GetStorageType() string {
+	storageType, ok := LocalConfiguration.GetString("storageType")
+	if ok == false {
+		return StorageTypeDefault
+	}
+
+	switch storageType {
+	case StorageTypeElasticSearch, StorageTypeLocal:
+		return storageType
+	default:
+		log.Error("Unknown storageType %s so use the default %s", storageType, StorageTypeDefault)
+		return StorageTypeDefault
+	}
+}
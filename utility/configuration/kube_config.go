@@ -0,0 +1,166 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"encoding/base64"
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// The subset of the kubeconfig file used to connect to the apiserver
+type kubeConfig struct {
+	CurrentContext string              `yaml:"current-context"`
+	Clusters       []kubeConfigCluster `yaml:"clusters"`
+	Contexts       []kubeConfigContext `yaml:"contexts"`
+	Users          []kubeConfigUser    `yaml:"users"`
+}
+
+type kubeConfigCluster struct {
+	Name    string `yaml:"name"`
+	Cluster struct {
+		Server                   string `yaml:"server"`
+		CertificateAuthority     string `yaml:"certificate-authority"`
+		CertificateAuthorityData string `yaml:"certificate-authority-data"`
+		InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	} `yaml:"cluster"`
+}
+
+type kubeConfigContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster string `yaml:"cluster"`
+		User    string `yaml:"user"`
+	} `yaml:"context"`
+}
+
+type kubeConfigUser struct {
+	Name string `yaml:"name"`
+	User struct {
+		Token                 string `yaml:"token"`
+		TokenFile             string `yaml:"tokenFile"`
+		ClientCertificate     string `yaml:"client-certificate"`
+		ClientCertificateData string `yaml:"client-certificate-data"`
+		ClientKey             string `yaml:"client-key"`
+		ClientKeyData         string `yaml:"client-key-data"`
+	} `yaml:"user"`
+}
+
+// KubeApiServerConnection is how to connect to the apiserver
+type KubeApiServerConnection struct {
+	EndPointSlice           []string
+	Token                   string
+	CertificateAuthorityPEM []byte
+	ClientCertificatePEM    []byte
+	ClientKeyPEM            []byte
+	InsecureSkipVerify      bool
+}
+
+// loadKubeConfig reads the context of the kubeconfig file. The current context is used if contextName is empty.
+// The relative file path in the kubeconfig is relative to the directory of the kubeconfig.
+func loadKubeConfig(kubeConfigPath string, contextName string) (*KubeApiServerConnection, error) {
+	byteSlice, err := ioutil.ReadFile(kubeConfigPath)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	config := kubeConfig{}
+	if err := yaml.Unmarshal(byteSlice, &config); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	var context *kubeConfigContext = nil
+	for i, _ := range config.Contexts {
+		if config.Contexts[i].Name == contextName {
+			context = &config.Contexts[i]
+		}
+	}
+	if context == nil {
+		return nil, errors.New("Context " + contextName + " is not found in kubeconfig " + kubeConfigPath)
+	}
+
+	var cluster *kubeConfigCluster = nil
+	for i, _ := range config.Clusters {
+		if config.Clusters[i].Name == context.Context.Cluster {
+			cluster = &config.Clusters[i]
+		}
+	}
+	if cluster == nil || cluster.Cluster.Server == "" {
+		return nil, errors.New("Cluster " + context.Context.Cluster + " is not found in kubeconfig " + kubeConfigPath)
+	}
+
+	directory := filepath.Dir(kubeConfigPath)
+	kubeApiServerConnection := &KubeApiServerConnection{}
+	kubeApiServerConnection.EndPointSlice = []string{strings.TrimSuffix(cluster.Cluster.Server, "/")}
+	kubeApiServerConnection.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+	kubeApiServerConnection.CertificateAuthorityPEM, err = readDataOrFile(cluster.Cluster.CertificateAuthorityData, cluster.Cluster.CertificateAuthority, directory)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// The user is optional like the cluster without authentication
+	for _, user := range config.Users {
+		if user.Name != context.Context.User {
+			continue
+		}
+		kubeApiServerConnection.Token = user.User.Token
+		if kubeApiServerConnection.Token == "" && user.User.TokenFile != "" {
+			tokenByteSlice, err := ioutil.ReadFile(resolvePath(user.User.TokenFile, directory))
+			if err != nil {
+				log.Error(err)
+				return nil, err
+			}
+			kubeApiServerConnection.Token = strings.TrimSpace(string(tokenByteSlice))
+		}
+		kubeApiServerConnection.ClientCertificatePEM, err = readDataOrFile(user.User.ClientCertificateData, user.User.ClientCertificate, directory)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		kubeApiServerConnection.ClientKeyPEM, err = readDataOrFile(user.User.ClientKeyData, user.User.ClientKey, directory)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+
+	return kubeApiServerConnection, nil
+}
+
+// readDataOrFile returns the decoded base64 data if it exists or the content of the file
+func readDataOrFile(data string, path string, directory string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path != "" {
+		return ioutil.ReadFile(resolvePath(path, directory))
+	}
+	return nil, nil
+}
+
+func resolvePath(path string, directory string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(directory, path)
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKubeConfig(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	ioutil.WriteFile(filepath.Join(directory, "token"), []byte("token-b\n"), 0600)
+	kubeConfigPath := filepath.Join(directory, "config")
+	ioutil.WriteFile(kubeConfigPath, []byte(`
+apiVersion: v1
+kind: Config
+current-context: a
+clusters:
+- name: cluster-a
+  cluster:
+    server: https://10.0.0.1:6443/
+    certificate-authority-data: Q0EtQQ==
+- name: cluster-b
+  cluster:
+    server: https://10.0.0.2:6443
+    insecure-skip-tls-verify: true
+contexts:
+- name: a
+  context:
+    cluster: cluster-a
+    user: user-a
+- name: b
+  context:
+    cluster: cluster-b
+    user: user-b
+users:
+- name: user-a
+  user:
+    token: token-a
+- name: user-b
+  user:
+    tokenFile: token
+`), 0600)
+
+	kubeApiServerConnection, err := loadKubeConfig(kubeConfigPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kubeApiServerConnection.EndPointSlice[0] != "https://10.0.0.1:6443" || kubeApiServerConnection.Token != "token-a" ||
+		string(kubeApiServerConnection.CertificateAuthorityPEM) != "CA-A" {
+		t.Errorf("Unexpected connection of the current context %v", kubeApiServerConnection)
+	}
+
+	kubeApiServerConnection, err = loadKubeConfig(kubeConfigPath, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kubeApiServerConnection.Token != "token-b" || kubeApiServerConnection.InsecureSkipVerify == false {
+		t.Errorf("Unexpected connection of the context b %v", kubeApiServerConnection)
+	}
+
+	if _, err := loadKubeConfig(kubeConfigPath, "c"); err == nil {
+		t.Error("Expect the error of the absent context")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulk
+
+import (
+	"bytes"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/logger"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var log = logger.GetLogManager().GetLogger("utility")
+
+const (
+	DefaultBatchSize                    = 1000
+	DefaultFlushIntervalInMilliSecond   = 1000
+	bulkItemErrorMessageAmountInSummary = 10
+)
+
+type BulkItem struct {
+	Index    string
+	Type     string
+	ID       string
+	Document interface{}
+	// If not nil, the existing document is partially updated with the document and the upsert is indexed
+	// only if the document doesn't exist, so the fields only in the upsert are kept in the update
+	Upsert interface{}
+}
+
+type BulkItemError struct {
+	Index        string
+	Type         string
+	ID           string
+	Status       int
+	ErrorMessage string
+}
+
+func (bulkItemError *BulkItemError) String() string {
+	return bulkItemError.Index + "/" + bulkItemError.Type + "/" + bulkItemError.ID + " status " +
+		strconv.Itoa(bulkItemError.Status) + " " + bulkItemError.ErrorMessage
+}
+
+// BulkFunction indexes the items in one request and returns the errors of the failed items
+type BulkFunction func(bulkItemSlice []BulkItem) []BulkItemError
+
+// BulkProcessor buffers the items and sends them in batch when the batch is full or the flush interval passes.
+// The errors of the failed items are kept until the processor is closed.
+type BulkProcessor struct {
+	batchSize          int
+	flushInterval      time.Duration
+	bulkFunction       BulkFunction
+	lock               sync.Mutex
+	bulkItemSlice      []BulkItem
+	bulkItemErrorSlice []BulkItemError
+	itemAmount         int
+	quitChannel        chan struct{}
+	waitGroup          sync.WaitGroup
+}
+
+func CreateBulkProcessor(batchSize int, flushInterval time.Duration, bulkFunction BulkFunction) *BulkProcessor {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	bulkProcessor := &BulkProcessor{
+		batchSize:          batchSize,
+		flushInterval:      flushInterval,
+		bulkFunction:       bulkFunction,
+		bulkItemSlice:      make([]BulkItem, 0, batchSize),
+		bulkItemErrorSlice: make([]BulkItemError, 0),
+		quitChannel:        make(chan struct{}),
+	}
+	if flushInterval > 0 {
+		bulkProcessor.waitGroup.Add(1)
+		go bulkProcessor.loopFlush()
+	}
+	return bulkProcessor
+}
+
+// CreateBulkProcessorWithConfiguration uses bulkBatchSize and bulkFlushIntervalInMilliSecond in the configuration
+func CreateBulkProcessorWithConfiguration(bulkFunction BulkFunction) *BulkProcessor {
+	batchSize, ok := configuration.LocalConfiguration.GetInt("bulkBatchSize")
+	if ok == false {
+		batchSize = DefaultBatchSize
+	}
+	flushIntervalInMilliSecond, ok := configuration.LocalConfiguration.GetInt("bulkFlushIntervalInMilliSecond")
+	if ok == false {
+		flushIntervalInMilliSecond = DefaultFlushIntervalInMilliSecond
+	}
+	return CreateBulkProcessor(batchSize, time.Duration(flushIntervalInMilliSecond)*time.Millisecond, bulkFunction)
+}
+
+func (bulkProcessor *BulkProcessor) loopFlush() {
+	defer bulkProcessor.waitGroup.Done()
+	ticker := time.NewTicker(bulkProcessor.flushInterval)
+	for {
+		select {
+		case <-ticker.C:
+			bulkProcessor.Flush()
+		case <-bulkProcessor.quitChannel:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Add buffers the item and sends the batch in the caller goroutine if the batch is full
+func (bulkProcessor *BulkProcessor) Add(bulkItem BulkItem) {
+	bulkProcessor.lock.Lock()
+	bulkProcessor.bulkItemSlice = append(bulkProcessor.bulkItemSlice, bulkItem)
+	bulkProcessor.itemAmount++
+	var bulkItemSlice []BulkItem = nil
+	if len(bulkProcessor.bulkItemSlice) >= bulkProcessor.batchSize {
+		bulkItemSlice = bulkProcessor.takeBulkItemSlice()
+	}
+	bulkProcessor.lock.Unlock()
+
+	if bulkItemSlice != nil {
+		bulkProcessor.send(bulkItemSlice)
+	}
+}
+
+func (bulkProcessor *BulkProcessor) Flush() {
+	bulkProcessor.lock.Lock()
+	bulkItemSlice := bulkProcessor.takeBulkItemSlice()
+	bulkProcessor.lock.Unlock()
+
+	if len(bulkItemSlice) > 0 {
+		bulkProcessor.send(bulkItemSlice)
+	}
+}
+
+// Close stops the flush interval, sends the remaining items and returns the errors of all failed items
+func (bulkProcessor *BulkProcessor) Close() []BulkItemError {
+	close(bulkProcessor.quitChannel)
+	bulkProcessor.waitGroup.Wait()
+	bulkProcessor.Flush()
+
+	bulkProcessor.lock.Lock()
+	defer bulkProcessor.lock.Unlock()
+	return bulkProcessor.bulkItemErrorSlice
+}
+
+// GetItemAmount returns the amount of the items added so far
+func (bulkProcessor *BulkProcessor) GetItemAmount() int {
+	bulkProcessor.lock.Lock()
+	defer bulkProcessor.lock.Unlock()
+	return bulkProcessor.itemAmount
+}
+
+// The lock must be held by the caller
+func (bulkProcessor *BulkProcessor) takeBulkItemSlice() []BulkItem {
+	bulkItemSlice := bulkProcessor.bulkItemSlice
+	bulkProcessor.bulkItemSlice = make([]BulkItem, 0, bulkProcessor.batchSize)
+	return bulkItemSlice
+}
+
+func (bulkProcessor *BulkProcessor) send(bulkItemSlice []BulkItem) {
+	bulkItemErrorSlice := bulkProcessor.bulkFunction(bulkItemSlice)
+	if len(bulkItemErrorSlice) > 0 {
+		log.Error("%d of %d items fail in bulk", len(bulkItemErrorSlice), len(bulkItemSlice))
+		bulkProcessor.lock.Lock()
+		bulkProcessor.bulkItemErrorSlice = append(bulkProcessor.bulkItemErrorSlice, bulkItemErrorSlice...)
+		bulkProcessor.lock.Unlock()
+	}
+}
+
+// CreateBulkItemErrorSlice marks all items failed when the whole request fails
+func CreateBulkItemErrorSlice(bulkItemSlice []BulkItem, err error) []BulkItemError {
+	bulkItemErrorSlice := make([]BulkItemError, 0, len(bulkItemSlice))
+	for _, bulkItem := range bulkItemSlice {
+		bulkItemErrorSlice = append(bulkItemErrorSlice, BulkItemError{
+			bulkItem.Index,
+			bulkItem.Type,
+			bulkItem.ID,
+			0,
+			err.Error(),
+		})
+	}
+	return bulkItemErrorSlice
+}
+
+// ConvertToError summarizes the failed items in one error. Nil is returned if there is no failed item.
+func ConvertToError(bulkItemErrorSlice []BulkItemError) error {
+	if len(bulkItemErrorSlice) == 0 {
+		return nil
+	}
+
+	errorBuffer := bytes.Buffer{}
+	errorBuffer.WriteString(strconv.Itoa(len(bulkItemErrorSlice)) + " items fail in bulk.")
+	for i, bulkItemError := range bulkItemErrorSlice {
+		if i >= bulkItemErrorMessageAmountInSummary {
+			errorBuffer.WriteString(" ...")
+			break
+		}
+		errorBuffer.WriteString(" ")
+		errorBuffer.WriteString(bulkItemError.String())
+		errorBuffer.WriteString(";")
+	}
+	return errors.New(errorBuffer.String())
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulk
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkProcessor(t *testing.T) {
+	lock := sync.Mutex{}
+	batchSizeSlice := make([]int, 0)
+	bulkProcessor := CreateBulkProcessor(3, 0, func(bulkItemSlice []BulkItem) []BulkItemError {
+		lock.Lock()
+		batchSizeSlice = append(batchSizeSlice, len(bulkItemSlice))
+		lock.Unlock()
+		bulkItemErrorSlice := make([]BulkItemError, 0)
+		for _, bulkItem := range bulkItemSlice {
+			if bulkItem.ID == "4" {
+				bulkItemErrorSlice = append(bulkItemErrorSlice, BulkItemError{bulkItem.Index, bulkItem.Type, bulkItem.ID, 400, "failure"})
+			}
+		}
+		return bulkItemErrorSlice
+	})
+
+	for i := 0; i < 7; i++ {
+		bulkProcessor.Add(BulkItem{Index: "index", Type: "type", ID: strconv.Itoa(i)})
+	}
+	bulkItemErrorSlice := bulkProcessor.Close()
+
+	if len(batchSizeSlice) != 3 || batchSizeSlice[0] != 3 || batchSizeSlice[1] != 3 || batchSizeSlice[2] != 1 {
+		t.Errorf("Expect batches 3, 3, 1 but get %v", batchSizeSlice)
+	}
+	if len(bulkItemErrorSlice) != 1 || bulkItemErrorSlice[0].ID != "4" {
+		t.Errorf("Expect item 4 fails but get %v", bulkItemErrorSlice)
+	}
+	if bulkProcessor.GetItemAmount() != 7 {
+		t.Errorf("Expect 7 items but get %d", bulkProcessor.GetItemAmount())
+	}
+	if ConvertToError(bulkItemErrorSlice) == nil {
+		t.Error("Expect error")
+	}
+}
+
+func TestBulkProcessorFlushInterval(t *testing.T) {
+	sentChannel := make(chan int, 1)
+	bulkProcessor := CreateBulkProcessor(100, 10*time.Millisecond, func(bulkItemSlice []BulkItem) []BulkItemError {
+		sentChannel <- len(bulkItemSlice)
+		return CreateBulkItemErrorSlice(bulkItemSlice, errors.New("failure"))
+	})
+	bulkProcessor.Add(BulkItem{Index: "index", Type: "type", ID: "1"})
+
+	select {
+	case amount := <-sentChannel:
+		if amount != 1 {
+			t.Errorf("Expect 1 item but get %d", amount)
+		}
+	case <-time.After(time.Second):
+		t.Error("The flush interval doesn't send the item")
+	}
+
+	if bulkItemErrorSlice := bulkProcessor.Close(); len(bulkItemErrorSlice) != 1 {
+		t.Errorf("Expect 1 failed item but get %v", bulkItemErrorSlice)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+)
+
+type bulkAction struct {
+	Index  *bulkActionMetaData `json:"index,omitempty"`
+	Update *bulkActionMetaData `json:"update,omitempty"`
+}
+
+type bulkUpdate struct {
+	Doc    interface{} `json:"doc"`
+	Upsert interface{} `json:"upsert"`
+}
+
+type bulkActionMetaData struct {
+	Index string `json:"_index"`
+	Type  string `json:"_type"`
+	ID    string `json:"_id"`
+}
+
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	Index  string          `json:"_index"`
+	Type   string          `json:"_type"`
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// BulkIndex indexes the items with the bulk API and returns the errors of the failed items.
+// The items of the index failing to be added to its alias are not sent and returned as errors.
+func BulkIndex(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+	if len(bulkItemSlice) == 0 {
+		return nil
+	}
+
+	ensuredIndexErrorMap := make(map[string]error)
+	bulkItemErrorSlice := make([]bulk.BulkItemError, 0)
+	sendingBulkItemSlice := make([]bulk.BulkItem, 0, len(bulkItemSlice))
+	for _, bulkItem := range bulkItemSlice {
+		err, ok := ensuredIndexErrorMap[bulkItem.Index]
+		if ok == false {
+			err = EnsureIndexWithAlias(bulkItem.Index)
+			ensuredIndexErrorMap[bulkItem.Index] = err
+		}
+		if err != nil {
+			bulkItemErrorSlice = append(bulkItemErrorSlice, bulk.CreateBulkItemErrorSlice([]bulk.BulkItem{bulkItem}, err)...)
+		} else {
+			sendingBulkItemSlice = append(sendingBulkItemSlice, bulkItem)
+		}
+	}
+
+	return append(bulkItemErrorSlice, sendBulk(sendingBulkItemSlice)...)
+}
+
+// sendBulk sends the items with the bulk API without adding the index to the alias
+func sendBulk(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+	if len(bulkItemSlice) == 0 {
+		return nil
+	}
+
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	for _, bulkItem := range bulkItemSlice {
+		// Encoder appends the new line required by the bulk API
+		metaData := &bulkActionMetaData{bulkItem.Index, bulkItem.Type, bulkItem.ID}
+		var action bulkAction
+		var body interface{}
+		if bulkItem.Upsert != nil {
+			action = bulkAction{nil, metaData}
+			body = bulkUpdate{bulkItem.Document, bulkItem.Upsert}
+		} else {
+			action = bulkAction{metaData, nil}
+			body = bulkItem.Document
+		}
+		if err := encoder.Encode(action); err != nil {
+			log.Error(err)
+			return bulk.CreateBulkItemErrorSlice(bulkItemSlice, err)
+		}
+		if err := encoder.Encode(body); err != nil {
+			log.Error(err)
+			return bulk.CreateBulkItemErrorSlice(bulkItemSlice, err)
+		}
+	}
+
+	connection := ElasticSearchClient.GetConnection()
+	byteSlice, err := connection.DoCommand("POST", "/_bulk", nil, buffer.Bytes())
+	if err != nil {
+		log.Error(err)
+		return bulk.CreateBulkItemErrorSlice(bulkItemSlice, err)
+	}
+
+	response := bulkResponse{}
+	if err := json.Unmarshal(byteSlice, &response); err != nil {
+		log.Error(err)
+		return bulk.CreateBulkItemErrorSlice(bulkItemSlice, err)
+	}
+
+	bulkItemErrorSlice := make([]bulk.BulkItemError, 0)
+	if response.Errors == false {
+		return bulkItemErrorSlice
+	}
+	for _, itemMap := range response.Items {
+		for _, item := range itemMap {
+			if item.Status >= 200 && item.Status < 300 {
+				continue
+			}
+			// The error is a string in the old version and an object in the new version
+			errorMessage := ""
+			if err := json.Unmarshal(item.Error, &errorMessage); err != nil {
+				errorMessage = string(item.Error)
+			}
+			bulkItemErrorSlice = append(bulkItemErrorSlice, bulk.BulkItemError{
+				Index:        item.Index,
+				Type:         item.Type,
+				ID:           item.ID,
+				Status:       item.Status,
+				ErrorMessage: errorMessage,
+			})
+		}
+	}
+	return bulkItemErrorSlice
+}
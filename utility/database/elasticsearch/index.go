@@ -0,0 +1,220 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"sort"
+	"sync"
+)
+
+// Use the same message as the Elastic Search client so the caller could handle both in the same way
+const (
+	notFoundErrorMessage = "record not found"
+)
+
+var ensuredIndexMap = make(map[string]bool)
+var ensuredIndexLock = sync.Mutex{}
+
+// EnsureIndexWithAlias creates the index named with period and adds it to its alias used for search.
+// The index not named with period is ignored.
+func EnsureIndexWithAlias(index string) error {
+	alias, _, _, ok := rollover.ParseIndexName(index)
+	if ok == false {
+		return nil
+	}
+
+	ensuredIndexLock.Lock()
+	defer ensuredIndexLock.Unlock()
+
+	if ensuredIndexMap[index] {
+		return nil
+	}
+
+	connection := ElasticSearchClient.GetConnection()
+	// The index may be created already by other instance
+	connection.CreateIndex(index)
+	if _, err := connection.AddAlias(index, alias); err != nil {
+		log.Error("Fail to add index %s to alias %s with error %s", index, alias, err)
+		return err
+	}
+
+	ensuredIndexMap[index] = true
+	return nil
+}
+
+// GetAllIndex returns the concrete indices matching the pattern
+func GetAllIndex(indexPattern string) ([]string, error) {
+	connection := ElasticSearchClient.GetConnection()
+	byteSlice, err := connection.DoCommand("GET", "/"+indexPattern+"/_settings", nil, nil)
+	if err != nil {
+		if err.Error() == notFoundErrorMessage {
+			return make([]string, 0), nil
+		}
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonMap := make(map[string]interface{})
+	if err := json.Unmarshal(byteSlice, &jsonMap); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	indexSlice := make([]string, 0)
+	for index, _ := range jsonMap {
+		indexSlice = append(indexSlice, index)
+	}
+	sort.Strings(indexSlice)
+	return indexSlice, nil
+}
+
+// GetAllIndexBelongingToAlias returns the indices named with period for the alias
+func GetAllIndexBelongingToAlias(alias string) ([]string, error) {
+	indexSlice, err := GetAllIndex(alias + rollover.Separator + "*")
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	belongingIndexSlice := make([]string, 0)
+	for _, index := range indexSlice {
+		// The pattern may match the other alias with the same prefix
+		if indexAlias, _, _, ok := rollover.ParseIndexName(index); ok && indexAlias == alias {
+			belongingIndexSlice = append(belongingIndexSlice, index)
+		}
+	}
+	return belongingIndexSlice, nil
+}
+
+func DeleteIndexBelongingToAlias(alias string) error {
+	indexSlice, err := GetAllIndexBelongingToAlias(alias)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	connection := ElasticSearchClient.GetConnection()
+	for _, index := range indexSlice {
+		if _, err := connection.DeleteIndex(index); err != nil {
+			log.Error(err)
+			return err
+		}
+		ensuredIndexLock.Lock()
+		delete(ensuredIndexMap, index)
+		ensuredIndexLock.Unlock()
+	}
+	return nil
+}
+
+// DeleteIndexOrAlias deletes the index named with period or all indices of the alias.
+// The name is deleted as the concrete index if there is no index belonging to it.
+func DeleteIndexOrAlias(name string) error {
+	if _, _, _, ok := rollover.ParseIndexName(name); ok {
+		return DeleteIndex(name)
+	}
+
+	indexSlice, err := GetAllIndexBelongingToAlias(name)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if len(indexSlice) == 0 {
+		return DeleteIndex(name)
+	}
+	return DeleteIndexBelongingToAlias(name)
+}
+
+func DeleteIndex(index string) error {
+	connection := ElasticSearchClient.GetConnection()
+	if _, err := connection.DeleteIndex(index); err != nil {
+		log.Error(err)
+		return err
+	}
+	ensuredIndexLock.Lock()
+	delete(ensuredIndexMap, index)
+	ensuredIndexLock.Unlock()
+	return nil
+}
+
+// GetAllTypeForIndex returns the document types in the index or in all indices of the alias
+func GetAllTypeForIndex(index string) ([]string, error) {
+	connection := ElasticSearchClient.GetConnection()
+	byteSlice, err := connection.DoCommand("GET", "/"+index+"/_mapping", nil, nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	jsonMap := make(map[string]interface{})
+	if err := json.Unmarshal(byteSlice, &jsonMap); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	typeMap := make(map[string]bool)
+	for _, value := range jsonMap {
+		mappingJsonMap, _ := value.(map[string]interface{})["mappings"].(map[string]interface{})
+		for documentType, _ := range mappingJsonMap {
+			if documentType != "_default_" {
+				typeMap[documentType] = true
+			}
+		}
+	}
+
+	typeSlice := make([]string, 0)
+	for documentType, _ := range typeMap {
+		typeSlice = append(typeSlice, documentType)
+	}
+	sort.Strings(typeSlice)
+	return typeSlice, nil
+}
+
+// GetByID returns the concrete index and the source of the document. The index could be an alias.
+func GetByID(index string, documentType string, id string) (string, []byte, error) {
+	query := make(map[string]interface{})
+	query["query"] = map[string]interface{}{
+		"ids": map[string]interface{}{
+			"values": []string{id},
+		},
+	}
+	query["size"] = 1
+
+	connection := ElasticSearchClient.GetConnection()
+	searchResult, err := connection.Search(index, documentType, nil, query)
+	if err != nil {
+		log.Error(err)
+		return "", nil, err
+	}
+
+	if len(searchResult.Hits.Hits) == 0 {
+		return "", nil, errors.New(notFoundErrorMessage)
+	}
+	hit := searchResult.Hits.Hits[0]
+	if hit.Source == nil {
+		return "", nil, errors.New("The source of " + id + " is empty")
+	}
+	return hit.Index, []byte(*hit.Source), nil
+}
+
+// DecodeSource decodes the source with the number kept as json.Number
+func DecodeSource(byteSlice []byte, target interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
@@ -0,0 +1,121 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MigrateLegacyIndex moves the documents of the indices matching the pattern but not named with period into the
+// indices named with period, and adds all indices named with period to their alias. The legacy index name becomes
+// the alias. The index of each document is chosen with the first time field found in the document source, where
+// the field is a path separated with '.', or with the current time if no field is found. The legacy index is deleted
+// only after all its documents are copied so the migration could be run again after any failure.
+func MigrateLegacyIndex(indexPattern string, timeFieldSlice []string) error {
+	indexSlice, err := GetAllIndex(indexPattern)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for _, index := range indexSlice {
+		if _, _, _, ok := rollover.ParseIndexName(index); ok {
+			continue
+		}
+		if err := migrateIndex(index, timeFieldSlice); err != nil {
+			log.Error("Fail to migrate the legacy index %s with error %s", index, err)
+			return err
+		}
+	}
+
+	// Add the alias again in case the last migration stopped after deleting the legacy index
+	indexSlice, err = GetAllIndex(indexPattern + rollover.Separator + "*")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	for _, index := range indexSlice {
+		if err := EnsureIndexWithAlias(index); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateIndex(index string, timeFieldSlice []string) error {
+	log.Info("Migrate the legacy index %s", index)
+	amount := 0
+	query := `{"query": {"match_all": {}}, "size": ` + strconv.Itoa(ScrollPageSize) + `}`
+	err := Scroll(index, "", query, func(hitSlice []interface{}) error {
+		bulkItemSlice := make([]bulk.BulkItem, 0, len(hitSlice))
+		for _, hit := range hitSlice {
+			hitJsonMap, _ := hit.(map[string]interface{})
+			documentType, _ := hitJsonMap["_type"].(string)
+			id, _ := hitJsonMap["_id"].(string)
+			sourceJsonMap, ok := hitJsonMap["_source"].(map[string]interface{})
+			if ok == false || documentType == "" || id == "" {
+				return errors.New("Fail to get the document in the legacy index " + index)
+			}
+			bulkItemSlice = append(bulkItemSlice, bulk.BulkItem{
+				Index:    rollover.GetIndexName(index, getDocumentTime(sourceJsonMap, timeFieldSlice)),
+				Type:     documentType,
+				ID:       id,
+				Document: sourceJsonMap,
+			})
+		}
+		// The alias could not be added before the legacy index with the same name is deleted
+		if err := bulk.ConvertToError(sendBulk(bulkItemSlice)); err != nil {
+			return err
+		}
+		amount += len(bulkItemSlice)
+		return nil
+	})
+	if err != nil {
+		// The other instance starting at the same time may have migrated and deleted it
+		if err.Error() == notFoundErrorMessage {
+			return nil
+		}
+		log.Error(err)
+		return err
+	}
+
+	if err := DeleteIndex(index); err != nil && err.Error() != notFoundErrorMessage {
+		log.Error(err)
+		return err
+	}
+	log.Info("Migrated %d documents of the legacy index %s", amount, index)
+	return nil
+}
+
+func getDocumentTime(sourceJsonMap map[string]interface{}, timeFieldSlice []string) time.Time {
+	for _, timeField := range timeFieldSlice {
+		var value interface{} = sourceJsonMap
+		for _, key := range strings.Split(timeField, ".") {
+			jsonMap, _ := value.(map[string]interface{})
+			value = jsonMap[key]
+		}
+		timeText, _ := value.(string)
+		if timestamp, err := time.Parse(time.RFC3339Nano, timeText); err == nil {
+			return timestamp
+		}
+	}
+	return time.Now()
+}
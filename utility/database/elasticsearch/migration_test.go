@@ -0,0 +1,45 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDocumentTime(t *testing.T) {
+	timeFieldSlice := []string{"firstTimestamp", "metadata.creationTimestamp"}
+
+	sourceJsonMap := map[string]interface{}{
+		"firstTimestamp": "2016-01-31T10:00:00Z",
+		"metadata": map[string]interface{}{
+			"creationTimestamp": "2016-01-30T10:00:00Z",
+		},
+	}
+	if timestamp := getDocumentTime(sourceJsonMap, timeFieldSlice); timestamp.Equal(time.Date(2016, 1, 31, 10, 0, 0, 0, time.UTC)) == false {
+		t.Errorf("Expect the first field but get %v", timestamp)
+	}
+
+	// The nested field is used if the first one is absent
+	delete(sourceJsonMap, "firstTimestamp")
+	if timestamp := getDocumentTime(sourceJsonMap, timeFieldSlice); timestamp.Equal(time.Date(2016, 1, 30, 10, 0, 0, 0, time.UTC)) == false {
+		t.Errorf("Expect the nested field but get %v", timestamp)
+	}
+
+	before := time.Now()
+	if timestamp := getDocumentTime(map[string]interface{}{"metadata": "invalid"}, timeFieldSlice); timestamp.Before(before) {
+		t.Errorf("Expect the current time but get %v", timestamp)
+	}
+}
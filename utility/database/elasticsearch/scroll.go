@@ -0,0 +1,101 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	// How long Elastic Search keeps the search context between two pages
+	scrollKeepAlive = "1m"
+	// The amount of hits in each page
+	ScrollPageSize = 500
+)
+
+// Scroll searches with the query and passes the hits page by page to the handle so the whole result is never
+// kept in the memory. The query should contain size as the page size and no from. Scroll stops at the first error
+// of the handle and returns it.
+func Scroll(index string, documentType string, query string, handle func(hitSlice []interface{}) error) error {
+	var url string
+	if documentType != "" && documentType != "*" {
+		url = "/" + index + "/" + documentType + "/_search"
+	} else {
+		url = "/" + index + "/_search"
+	}
+	args := map[string]interface{}{"scroll": scrollKeepAlive}
+
+	connection := ElasticSearchClient.GetConnection()
+	byteSlice, err := connection.DoCommand("POST", url, args, query)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	scrollID := ""
+	defer func() {
+		// Release the search context without waiting for the keep alive
+		if scrollID != "" {
+			connection.DoCommand("DELETE", "/_search/scroll", nil, scrollID)
+		}
+	}()
+
+	for {
+		var hitSlice []interface{}
+		scrollID, hitSlice, err = getScrollPage(byteSlice)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		if len(hitSlice) == 0 {
+			return nil
+		}
+		if err := handle(hitSlice); err != nil {
+			return err
+		}
+		if scrollID == "" {
+			return errors.New("No scroll id in the result")
+		}
+
+		byteSlice, err = connection.DoCommand("POST", "/_search/scroll", args, scrollID)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+}
+
+// getScrollPage returns the scroll id and the hits of the page with the number kept as json.Number
+func getScrollPage(byteSlice []byte) (string, []interface{}, error) {
+	jsonMap := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	if err := decoder.Decode(&jsonMap); err != nil {
+		return "", nil, err
+	}
+
+	scrollID, _ := jsonMap["_scroll_id"].(string)
+	hitsJsonMap, ok := jsonMap["hits"].(map[string]interface{})
+	if ok == false {
+		return "", nil, errors.New("Fail to get hits with byteSlice " + string(byteSlice))
+	}
+	hitSlice, ok := hitsJsonMap["hits"].([]interface{})
+	if ok == false {
+		return "", nil, errors.New("Fail to get hits with byteSlice " + string(byteSlice))
+	}
+	return scrollID, hitSlice, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetScrollPage(t *testing.T) {
+	byteSlice := []byte(`{"_scroll_id": "c2Nhbg==", "hits": {"total": 2, "hits": [
+		{"_index": "index_a", "_id": "1", "_source": {"count": 12345678901234}},
+		{"_index": "index_a", "_id": "2", "_source": {"count": 1}}
+	]}}`)
+
+	scrollID, hitSlice, err := getScrollPage(byteSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scrollID != "c2Nhbg==" {
+		t.Errorf("Expect scroll id c2Nhbg== but get %s", scrollID)
+	}
+	if len(hitSlice) != 2 {
+		t.Fatalf("Expect 2 hits but get %v", hitSlice)
+	}
+	// The large number should not lose the precision
+	count := hitSlice[0].(map[string]interface{})["_source"].(map[string]interface{})["count"]
+	if count != json.Number("12345678901234") {
+		t.Errorf("Expect 12345678901234 but get %v", count)
+	}
+
+	if _, _, err := getScrollPage([]byte(`{"error": "SearchContextMissingException"}`)); err == nil {
+		t.Error("Expect error for the result without hits")
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/database/bulk"
+	"github.com/cloudawan/cloudone_analysis/utility/database/rollover"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Use the same message as the Elastic Search client so the caller could handle both in the same way
+var ErrorRecordNotFound = errors.New("record not found")
+
+// The embedded document store keeps the documents in the memory of this process.
+// It is organized in the same index, type and id hierarchy as Elastic Search so
+// it could be used in place of Elastic Search for development and test.
+// The index named with period belongs to its alias like Elastic Search.
+var LocalDocumentStore *DocumentStore = CreateDocumentStore()
+
+type Document struct {
+	Index  string
+	Type   string
+	ID     string
+	Source map[string]interface{}
+}
+
+type DocumentStore struct {
+	lock sync.RWMutex
+	// index -> type -> id -> json
+	indexMap map[string]map[string]map[string][]byte
+}
+
+func CreateDocumentStore() *DocumentStore {
+	return &DocumentStore{
+		indexMap: make(map[string]map[string]map[string][]byte),
+	}
+}
+
+func (documentStore *DocumentStore) Index(index string, documentType string, id string, data interface{}) error {
+	// Keep the serialized data so the stored document is not affected by the later change of the caller
+	byteSlice, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	documentStore.lock.Lock()
+	defer documentStore.lock.Unlock()
+
+	typeMap, ok := documentStore.indexMap[index]
+	if ok == false {
+		typeMap = make(map[string]map[string][]byte)
+		documentStore.indexMap[index] = typeMap
+	}
+	idMap, ok := typeMap[documentType]
+	if ok == false {
+		idMap = make(map[string][]byte)
+		typeMap[documentType] = idMap
+	}
+	idMap[id] = byteSlice
+
+	return nil
+}
+
+func (documentStore *DocumentStore) BulkIndex(bulkItemSlice []bulk.BulkItem) []bulk.BulkItemError {
+	bulkItemErrorSlice := make([]bulk.BulkItemError, 0)
+	for _, bulkItem := range bulkItemSlice {
+		var err error
+		if bulkItem.Upsert != nil {
+			err = documentStore.Upsert(bulkItem.Index, bulkItem.Type, bulkItem.ID, bulkItem.Document, bulkItem.Upsert)
+		} else {
+			err = documentStore.Index(bulkItem.Index, bulkItem.Type, bulkItem.ID, bulkItem.Document)
+		}
+		if err != nil {
+			bulkItemErrorSlice = append(bulkItemErrorSlice, bulk.BulkItemError{
+				Index:        bulkItem.Index,
+				Type:         bulkItem.Type,
+				ID:           bulkItem.ID,
+				Status:       0,
+				ErrorMessage: err.Error(),
+			})
+		}
+	}
+	return bulkItemErrorSlice
+}
+
+// Upsert merges the data into the existing document like the partial update of Elastic Search or indexes
+// the upsert if the document doesn't exist
+func (documentStore *DocumentStore) Upsert(index string, documentType string, id string, data interface{}, upsert interface{}) error {
+	byteSlice, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	jsonMap, err := decode(byteSlice)
+	if err != nil {
+		return err
+	}
+	upsertByteSlice, err := json.Marshal(upsert)
+	if err != nil {
+		return err
+	}
+
+	documentStore.lock.Lock()
+	defer documentStore.lock.Unlock()
+
+	typeMap, ok := documentStore.indexMap[index]
+	if ok == false {
+		typeMap = make(map[string]map[string][]byte)
+		documentStore.indexMap[index] = typeMap
+	}
+	idMap, ok := typeMap[documentType]
+	if ok == false {
+		idMap = make(map[string][]byte)
+		typeMap[documentType] = idMap
+	}
+	existingByteSlice, ok := idMap[id]
+	if ok == false {
+		idMap[id] = upsertByteSlice
+		return nil
+	}
+	existingJsonMap, err := decode(existingByteSlice)
+	if err != nil {
+		return err
+	}
+	mergedByteSlice, err := json.Marshal(merge(existingJsonMap, jsonMap))
+	if err != nil {
+		return err
+	}
+	idMap[id] = mergedByteSlice
+	return nil
+}
+
+// merge puts the fields of the source into the target. The objects are merged recursively and the others are replaced.
+func merge(target map[string]interface{}, source map[string]interface{}) map[string]interface{} {
+	for key, value := range source {
+		sourceJsonMap, sourceOk := value.(map[string]interface{})
+		targetJsonMap, targetOk := target[key].(map[string]interface{})
+		if sourceOk && targetOk {
+			target[key] = merge(targetJsonMap, sourceJsonMap)
+		} else {
+			target[key] = value
+		}
+	}
+	return target
+}
+
+// Get returns the document. The index could be an alias.
+func (documentStore *DocumentStore) Get(index string, documentType string, id string) (map[string]interface{}, error) {
+	documentStore.lock.RLock()
+	var byteSlice []byte = nil
+	for _, resolvedIndex := range documentStore.resolveIndex(index) {
+		if value, ok := documentStore.indexMap[resolvedIndex][documentType][id]; ok {
+			byteSlice = value
+			break
+		}
+	}
+	documentStore.lock.RUnlock()
+
+	if byteSlice == nil {
+		return nil, ErrorRecordNotFound
+	}
+
+	return decode(byteSlice)
+}
+
+// Delete deletes the document. The index could be an alias.
+func (documentStore *DocumentStore) Delete(index string, documentType string, id string) error {
+	documentStore.lock.Lock()
+	defer documentStore.lock.Unlock()
+
+	found := false
+	for _, resolvedIndex := range documentStore.resolveIndex(index) {
+		if _, ok := documentStore.indexMap[resolvedIndex][documentType][id]; ok {
+			delete(documentStore.indexMap[resolvedIndex][documentType], id)
+			found = true
+		}
+	}
+	if found == false {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteIndex deletes the index or all indices of the alias
+func (documentStore *DocumentStore) DeleteIndex(index string) error {
+	documentStore.lock.Lock()
+	defer documentStore.lock.Unlock()
+
+	resolvedIndexSlice := documentStore.resolveIndex(index)
+	if len(resolvedIndexSlice) == 0 {
+		return errors.New("Index " + index + " doesn't exist")
+	}
+	for _, resolvedIndex := range resolvedIndexSlice {
+		delete(documentStore.indexMap, resolvedIndex)
+	}
+
+	return nil
+}
+
+func (documentStore *DocumentStore) GetAllIndex(indexPattern string) []string {
+	documentStore.lock.RLock()
+	defer documentStore.lock.RUnlock()
+
+	indexSlice := make([]string, 0)
+	for index, _ := range documentStore.indexMap {
+		if isMatched(indexPattern, index) {
+			indexSlice = append(indexSlice, index)
+		}
+	}
+	sort.Strings(indexSlice)
+
+	return indexSlice
+}
+
+func (documentStore *DocumentStore) GetAllTypeForIndex(index string) ([]string, error) {
+	documentStore.lock.RLock()
+	defer documentStore.lock.RUnlock()
+
+	resolvedIndexSlice := documentStore.resolveIndex(index)
+	if len(resolvedIndexSlice) == 0 {
+		return nil, errors.New("Index " + index + " doesn't exist")
+	}
+
+	typeMap := make(map[string]bool)
+	for _, resolvedIndex := range resolvedIndexSlice {
+		for documentType, _ := range documentStore.indexMap[resolvedIndex] {
+			typeMap[documentType] = true
+		}
+	}
+
+	typeSlice := make([]string, 0)
+	for documentType, _ := range typeMap {
+		typeSlice = append(typeSlice, documentType)
+	}
+	sort.Strings(typeSlice)
+
+	return typeSlice, nil
+}
+
+// Search returns the documents in the matched indices and types. The pattern supports the wildcard * and alias.
+// Filter could be nil to return all documents.
+func (documentStore *DocumentStore) Search(indexPattern string, typePattern string, filter func(document *Document) bool) ([]Document, error) {
+	documentStore.lock.RLock()
+	defer documentStore.lock.RUnlock()
+
+	documentSlice := make([]Document, 0)
+	for index, typeMap := range documentStore.indexMap {
+		if isIndexMatched(indexPattern, index) == false {
+			continue
+		}
+		for documentType, idMap := range typeMap {
+			if isMatched(typePattern, documentType) == false {
+				continue
+			}
+			for id, byteSlice := range idMap {
+				source, err := decode(byteSlice)
+				if err != nil {
+					return nil, err
+				}
+				document := Document{index, documentType, id, source}
+				if filter == nil || filter(&document) {
+					documentSlice = append(documentSlice, document)
+				}
+			}
+		}
+	}
+
+	return documentSlice, nil
+}
+
+// ConvertToSearchHit returns the document in the same format as the hit in the Elastic Search result
+func (document *Document) ConvertToSearchHit() map[string]interface{} {
+	jsonMap := make(map[string]interface{})
+	jsonMap["_index"] = document.Index
+	jsonMap["_type"] = document.Type
+	jsonMap["_id"] = document.ID
+	jsonMap["_score"] = nil
+	jsonMap["_source"] = document.Source
+	return jsonMap
+}
+
+// GetField returns the value with the field name in the dot format like stats.cpu.usage.total
+func (document *Document) GetField(field string) (interface{}, bool) {
+	var value interface{} = document.Source
+	for _, name := range strings.Split(field, ".") {
+		jsonMap, ok := value.(map[string]interface{})
+		if ok == false {
+			return nil, false
+		}
+		value, ok = jsonMap[name]
+		if ok == false {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func (document *Document) GetFieldString(field string) (string, bool) {
+	value, ok := document.GetField(field)
+	if ok == false {
+		return "", false
+	}
+	text, ok := value.(string)
+	return text, ok
+}
+
+func (document *Document) GetFieldFloat64(field string) (float64, bool) {
+	value, ok := document.GetField(field)
+	if ok == false {
+		return 0, false
+	}
+	return ConvertToFloat64(value)
+}
+
+// GetFieldFloat64Slice returns all values of the field in the arrays like Elastic Search. For example,
+// stats.filesystem.usage returns the usage of each device if stats.filesystem is the array of devices.
+func (document *Document) GetFieldFloat64Slice(field string) []float64 {
+	return collectFloat64(document.Source, strings.Split(field, "."), make([]float64, 0))
+}
+
+func collectFloat64(value interface{}, nameSlice []string, resultSlice []float64) []float64 {
+	if slice, ok := value.([]interface{}); ok {
+		for _, element := range slice {
+			resultSlice = collectFloat64(element, nameSlice, resultSlice)
+		}
+		return resultSlice
+	}
+	if len(nameSlice) == 0 {
+		if result, ok := ConvertToFloat64(value); ok {
+			resultSlice = append(resultSlice, result)
+		}
+		return resultSlice
+	}
+	jsonMap, ok := value.(map[string]interface{})
+	if ok == false {
+		return resultSlice
+	}
+	return collectFloat64(jsonMap[nameSlice[0]], nameSlice[1:], resultSlice)
+}
+
+func ConvertToFloat64(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case json.Number:
+		result, err := number.Float64()
+		return result, err == nil
+	case float64:
+		return number, true
+	case int64:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case string:
+		result, err := strconv.ParseFloat(number, 64)
+		return result, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func decode(byteSlice []byte) (map[string]interface{}, error) {
+	jsonMap := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(byteSlice))
+	decoder.UseNumber()
+	if err := decoder.Decode(&jsonMap); err != nil {
+		return nil, err
+	}
+	return jsonMap, nil
+}
+
+// The lock must be held by the caller
+func (documentStore *DocumentStore) resolveIndex(name string) []string {
+	if _, ok := documentStore.indexMap[name]; ok {
+		return []string{name}
+	}
+
+	indexSlice := make([]string, 0)
+	for index, _ := range documentStore.indexMap {
+		if alias, _, _, ok := rollover.ParseIndexName(index); ok && alias == name {
+			indexSlice = append(indexSlice, index)
+		}
+	}
+	sort.Strings(indexSlice)
+	return indexSlice
+}
+
+func isIndexMatched(pattern string, index string) bool {
+	if isMatched(pattern, index) {
+		return true
+	}
+	if alias, _, _, ok := rollover.ParseIndexName(index); ok {
+		for _, singlePattern := range strings.Split(pattern, ",") {
+			if singlePattern == alias {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isMatched(pattern string, name string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	// Multiple patterns are separated by comma like Elastic Search
+	for _, singlePattern := range strings.Split(pattern, ",") {
+		matched, err := path.Match(singlePattern, name)
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"testing"
+)
+
+func TestIndexAndGet(t *testing.T) {
+	documentStore := CreateDocumentStore()
+
+	jsonMap := make(map[string]interface{})
+	jsonMap["stats"] = map[string]interface{}{"cpu": map[string]interface{}{"total": 100}}
+	if err := documentStore.Index("index_a", "type_a", "id_a", jsonMap); err != nil {
+		t.Fatal(err)
+	}
+	// The stored document should not be affected by the later change
+	jsonMap["stats"] = nil
+
+	result, err := documentStore.Get("index_a", "type_a", "id_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := Document{"index_a", "type_a", "id_a", result}
+	value, ok := document.GetFieldFloat64("stats.cpu.total")
+	if ok == false || value != 100 {
+		t.Errorf("Expect 100 but get %v", value)
+	}
+
+	if _, err := documentStore.Get("index_a", "type_a", "id_b"); err != ErrorRecordNotFound {
+		t.Errorf("Expect record not found but get %v", err)
+	}
+}
+
+func TestGetFieldFloat64Slice(t *testing.T) {
+	document := Document{"index_a", "type_a", "id_a", map[string]interface{}{
+		"stats": map[string]interface{}{
+			"filesystem": []interface{}{
+				map[string]interface{}{"usage": 100},
+				map[string]interface{}{"usage": 200},
+				map[string]interface{}{"capacity": 300},
+			},
+			"memory": map[string]interface{}{"usage": 400},
+		},
+	}}
+
+	if valueSlice := document.GetFieldFloat64Slice("stats.filesystem.usage"); len(valueSlice) != 2 || valueSlice[0] != 100 || valueSlice[1] != 200 {
+		t.Errorf("Expect [100 200] but get %v", valueSlice)
+	}
+	if valueSlice := document.GetFieldFloat64Slice("stats.memory.usage"); len(valueSlice) != 1 || valueSlice[0] != 400 {
+		t.Errorf("Expect [400] but get %v", valueSlice)
+	}
+	if valueSlice := document.GetFieldFloat64Slice("stats.cpu.usage"); len(valueSlice) != 0 {
+		t.Errorf("Expect no value but get %v", valueSlice)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	documentStore := CreateDocumentStore()
+	documentStore.Index("build_log_a", "build_log", "1", map[string]interface{}{"Version": "1"})
+	documentStore.Index("build_log_b", "build_log", "2", map[string]interface{}{"Version": "2"})
+	documentStore.Index("audit_log", "admin", "3", map[string]interface{}{"Version": "3"})
+
+	documentSlice, err := documentStore.Search("build_log_*", "*", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documentSlice) != 2 {
+		t.Errorf("Expect 2 documents but get %d", len(documentSlice))
+	}
+
+	documentSlice, _ = documentStore.Search("build_log_a,audit_log", "*", func(document *Document) bool {
+		version, _ := document.GetFieldString("Version")
+		return version == "3"
+	})
+	if len(documentSlice) != 1 || documentSlice[0].ID != "3" {
+		t.Errorf("Expect document 3 but get %v", documentSlice)
+	}
+
+	if err := documentStore.DeleteIndex("build_log_a"); err != nil {
+		t.Error(err)
+	}
+	if indexSlice := documentStore.GetAllIndex("build_log_*"); len(indexSlice) != 1 {
+		t.Errorf("Expect 1 index but get %v", indexSlice)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	documentStore := CreateDocumentStore()
+	documentStore.Index("audit_log-2016.01.01", "admin", "1", map[string]interface{}{"Version": "1"})
+	documentStore.Index("audit_log-2016.01.02", "user", "2", map[string]interface{}{"Version": "2"})
+	documentStore.Index("audit_log_other-2016.01.02", "user", "3", map[string]interface{}{"Version": "3"})
+
+	documentSlice, _ := documentStore.Search("audit_log", "*", nil)
+	if len(documentSlice) != 2 {
+		t.Errorf("Expect 2 documents but get %v", documentSlice)
+	}
+	if _, err := documentStore.Get("audit_log", "user", "2"); err != nil {
+		t.Error(err)
+	}
+	if typeSlice, _ := documentStore.GetAllTypeForIndex("audit_log"); len(typeSlice) != 2 {
+		t.Errorf("Expect 2 types but get %v", typeSlice)
+	}
+	if err := documentStore.DeleteIndex("audit_log"); err != nil {
+		t.Error(err)
+	}
+	if indexSlice := documentStore.GetAllIndex("*"); len(indexSlice) != 1 || indexSlice[0] != "audit_log_other-2016.01.02" {
+		t.Errorf("Expect only the other index but get %v", indexSlice)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	documentStore := CreateDocumentStore()
+
+	upsertJsonMap := map[string]interface{}{"count": 1, "meta": map[string]interface{}{"acknowledge": false, "index": "index_a"}}
+	jsonMap := map[string]interface{}{"count": 1, "meta": map[string]interface{}{"index": "index_a"}}
+	if err := documentStore.Upsert("index_a", "type_a", "id_a", jsonMap, upsertJsonMap); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := documentStore.Get("index_a", "type_a", "id_a")
+	if result["meta"].(map[string]interface{})["acknowledge"] != false {
+		t.Errorf("Expect the upsert to be indexed but get %v", result)
+	}
+
+	result["meta"].(map[string]interface{})["acknowledge"] = true
+	documentStore.Index("index_a", "type_a", "id_a", result)
+	jsonMap["count"] = 2
+	if err := documentStore.Upsert("index_a", "type_a", "id_a", jsonMap, upsertJsonMap); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = documentStore.Get("index_a", "type_a", "id_a")
+	document := Document{"index_a", "type_a", "id_a", result}
+	if count, _ := document.GetFieldFloat64("count"); count != 2 || result["meta"].(map[string]interface{})["acknowledge"] != true {
+		t.Errorf("Expect the merged document but get %v", result)
+	}
+}
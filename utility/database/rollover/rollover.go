@@ -0,0 +1,209 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollover
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var log = logger.GetLogManager().GetLogger("utility")
+
+// The index is named as <alias>-<period> and the alias is used for search.
+// The daily period is like 2016.01.31 and the weekly period is the ISO week like 2016.w05.
+const (
+	Separator = "-"
+
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodDefault = PeriodDaily
+
+	dailyFormat      = "2006.01.02"
+	weeklyYearFormat = "2006"
+	weeklyMarker     = "w"
+)
+
+// Data kinds with their own retention
+const (
+	KindContainerMetrics       = "containerMetrics"
+	KindContainerMetricsRollup = "containerMetricsRollup"
+	KindNodeMetrics            = "nodeMetrics"
+	KindEvent                  = "event"
+	KindAuditLog               = "auditLog"
+	KindBuildLog               = "buildLog"
+	KindAlertHistory           = "alertHistory"
+	KindNotificationDelivery   = "notificationDelivery"
+)
+
+var defaultRetentionInDayMap = map[string]int{
+	KindContainerMetrics:       30,
+	KindContainerMetricsRollup: 365,
+	KindNodeMetrics:            30,
+	KindEvent:                  90,
+	KindAuditLog:               365,
+	KindBuildLog:               365,
+	KindAlertHistory:           365,
+	KindNotificationDelivery:   90,
+}
+
+func GetPeriod() string {
+	period, ok := configuration.LocalConfiguration.GetString("indexRolloverPeriod")
+	if ok == false {
+		return PeriodDefault
+	}
+
+	switch period {
+	case PeriodDaily, PeriodWeekly:
+		return period
+	default:
+		log.Error("Unknown indexRolloverPeriod %s so use the default %s", period, PeriodDefault)
+		return PeriodDefault
+	}
+}
+
+// GetIndexName returns the index of the current period for the timestamp
+func GetIndexName(alias string, timestamp time.Time) string {
+	return getIndexNameWithPeriod(alias, timestamp, GetPeriod())
+}
+
+func getIndexNameWithPeriod(alias string, timestamp time.Time, period string) string {
+	timestamp = timestamp.UTC()
+	switch period {
+	case PeriodWeekly:
+		year, week := timestamp.ISOWeek()
+		return alias + Separator + strconv.Itoa(year) + "." + weeklyMarker + fmt.Sprintf("%02d", week)
+	default:
+		return alias + Separator + timestamp.Format(dailyFormat)
+	}
+}
+
+// ParseIndexName returns the alias and the time range [start, end) of the period of the index.
+// False is returned if the index is not named with period.
+func ParseIndexName(index string) (string, time.Time, time.Time, bool) {
+	position := strings.LastIndex(index, Separator)
+	if position < 0 {
+		return "", time.Time{}, time.Time{}, false
+	}
+	alias := index[:position]
+	periodText := index[position+len(Separator):]
+
+	if start, err := time.Parse(dailyFormat, periodText); err == nil {
+		return alias, start, start.AddDate(0, 0, 1), true
+	}
+
+	splitSlice := strings.Split(periodText, "."+weeklyMarker)
+	if len(splitSlice) != 2 {
+		return "", time.Time{}, time.Time{}, false
+	}
+	year, err := time.Parse(weeklyYearFormat, splitSlice[0])
+	if err != nil {
+		return "", time.Time{}, time.Time{}, false
+	}
+	week, err := strconv.Atoi(splitSlice[1])
+	if err != nil || week < 1 || week > 53 {
+		return "", time.Time{}, time.Time{}, false
+	}
+	start := getISOWeekStart(year.Year(), week)
+	return alias, start, start.AddDate(0, 0, 7), true
+}
+
+func getISOWeekStart(year int, week int) time.Time {
+	// January 4th is always in the first ISO week
+	january4th := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	offset := int(january4th.Weekday()+6) % 7
+	firstMonday := january4th.AddDate(0, 0, -offset)
+	return firstMonday.AddDate(0, 0, (week-1)*7)
+}
+
+// GetRetention returns the retention of the data kind. Zero means keeping forever.
+func GetRetention(kind string) time.Duration {
+	retentionInDay := defaultRetentionInDayMap[kind]
+
+	retentionInDayMap, ok := configuration.LocalConfiguration.GetNative("retentionInDay").(map[string]interface{})
+	if ok {
+		if value, ok := retentionInDayMap[kind]; ok {
+			if number, ok := convertToInt(value); ok {
+				retentionInDay = number
+			} else {
+				log.Error("Invalid retentionInDay %v for %s", value, kind)
+			}
+		}
+	}
+
+	if retentionInDay <= 0 {
+		return 0
+	}
+	return time.Duration(retentionInDay) * 24 * time.Hour
+}
+
+func convertToInt(value interface{}) (int, bool) {
+	switch number := value.(type) {
+	case float64:
+		return int(number), true
+	case int:
+		return number, true
+	case int64:
+		return int(number), true
+	case json.Number:
+		result, err := number.Int64()
+		return int(result), err == nil
+	default:
+		return 0, false
+	}
+}
+
+// GetExpiredIndex returns the indices whose whole period is older than the retention
+func GetExpiredIndex(indexSlice []string, now time.Time, retention time.Duration) []string {
+	expiredIndexSlice := make([]string, 0)
+	if retention <= 0 {
+		return expiredIndexSlice
+	}
+
+	threshold := now.Add(-retention)
+	for _, index := range indexSlice {
+		_, _, end, ok := ParseIndexName(index)
+		if ok && end.Before(threshold) {
+			expiredIndexSlice = append(expiredIndexSlice, index)
+		}
+	}
+	return expiredIndexSlice
+}
+
+// DeleteExpiredIndex deletes the indices older than the retention of the data kind
+func DeleteExpiredIndex(kind string, indexSlice []string, now time.Time, deleteIndex func(index string) error) error {
+	hasError := false
+	errorMessageBuffer := bytes.Buffer{}
+	for _, index := range GetExpiredIndex(indexSlice, now, GetRetention(kind)) {
+		if err := deleteIndex(index); err != nil {
+			log.Error("Fail to delete expired index %s with error %s", index, err)
+			errorMessageBuffer.WriteString("Fail to delete expired index " + index + " with error " + err.Error() + ". ")
+			hasError = true
+		} else {
+			log.Info("Expired index %s is deleted", index)
+		}
+	}
+	if hasError {
+		return errors.New(errorMessageBuffer.String())
+	} else {
+		return nil
+	}
+}
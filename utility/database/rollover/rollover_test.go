@@ -0,0 +1,67 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexName(t *testing.T) {
+	timestamp := time.Date(2016, time.January, 31, 23, 0, 0, 0, time.UTC)
+
+	index := getIndexNameWithPeriod("kubernetes_event", timestamp, PeriodDaily)
+	if index != "kubernetes_event-2016.01.31" {
+		t.Errorf("Unexpected daily index %s", index)
+	}
+	alias, start, end, ok := ParseIndexName(index)
+	if ok == false || alias != "kubernetes_event" || start.Equal(time.Date(2016, time.January, 31, 0, 0, 0, 0, time.UTC)) == false ||
+		end.Sub(start) != 24*time.Hour {
+		t.Errorf("Unexpected daily parsing %s %s %s %v", alias, start, end, ok)
+	}
+
+	index = getIndexNameWithPeriod("indexcontainermetrics_default", timestamp, PeriodWeekly)
+	if index != "indexcontainermetrics_default-2016.w04" {
+		t.Errorf("Unexpected weekly index %s", index)
+	}
+	alias, start, end, ok = ParseIndexName(index)
+	if ok == false || alias != "indexcontainermetrics_default" || start.After(timestamp) || end.Before(timestamp) ||
+		start.Weekday() != time.Monday {
+		t.Errorf("Unexpected weekly parsing %s %s %s %v", alias, start, end, ok)
+	}
+
+	if _, _, _, ok := ParseIndexName("kubernetes_event"); ok {
+		t.Error("The index without period should not be parsed")
+	}
+}
+
+func TestGetExpiredIndex(t *testing.T) {
+	now := time.Date(2016, time.February, 10, 0, 0, 0, 0, time.UTC)
+	indexSlice := []string{
+		"audit_log-2016.01.01",
+		"audit_log-2016.02.09",
+		"audit_log-2016.w01",
+		"audit_log",
+	}
+
+	expiredIndexSlice := GetExpiredIndex(indexSlice, now, 7*24*time.Hour)
+	if len(expiredIndexSlice) != 2 || expiredIndexSlice[0] != "audit_log-2016.01.01" || expiredIndexSlice[1] != "audit_log-2016.w01" {
+		t.Errorf("Unexpected expired indices %v", expiredIndexSlice)
+	}
+
+	if expiredIndexSlice := GetExpiredIndex(indexSlice, now, 0); len(expiredIndexSlice) != 0 {
+		t.Errorf("Expect no expired index but get %v", expiredIndexSlice)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"github.com/cloudawan/cloudone_analysis/utility/logger"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var log = logger.GetLogManager().GetLogger("utility")
+
+// CreateTLSConfig verifies the server certificate with the CA bundle and presents the client certificate.
+// The empty file path is not used. The system CA is used if the CA bundle is empty.
+func CreateTLSConfig(certificateAuthorityPath string, clientCertificatePath string, clientKeyPath string,
+	insecureSkipVerify bool) (*tls.Config, error) {
+	var certificateAuthorityPEM, clientCertificatePEM, clientKeyPEM []byte
+	var err error
+	if certificateAuthorityPath != "" {
+		if certificateAuthorityPEM, err = ioutil.ReadFile(certificateAuthorityPath); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+	if clientCertificatePath != "" || clientKeyPath != "" {
+		if clientCertificatePEM, err = ioutil.ReadFile(clientCertificatePath); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		if clientKeyPEM, err = ioutil.ReadFile(clientKeyPath); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+	return CreateTLSConfigFromPEM(certificateAuthorityPEM, clientCertificatePEM, clientKeyPEM, insecureSkipVerify)
+}
+
+// CreateTLSConfigFromPEM is the same as CreateTLSConfig with the content instead of the file
+func CreateTLSConfigFromPEM(certificateAuthorityPEM []byte, clientCertificatePEM []byte, clientKeyPEM []byte,
+	insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if len(certificateAuthorityPEM) > 0 {
+		certPool := x509.NewCertPool()
+		if certPool.AppendCertsFromPEM(certificateAuthorityPEM) == false {
+			return nil, errors.New("No certificate is found in the CA bundle")
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	if len(clientCertificatePEM) > 0 || len(clientKeyPEM) > 0 {
+		certificate, err := tls.X509KeyPair(clientCertificatePEM, clientKeyPEM)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func CreateHTTPClient(tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+			Proxy:           http.ProxyFromEnvironment,
+		},
+		Timeout: timeout,
+	}
+}
+
+// RequestGet returns the decoded json with the number kept as json.Number like Elastic Search documents
+func RequestGet(client *http.Client, url string, headerMap map[string]string) (interface{}, error) {
+	return request(client, "GET", url, headerMap, time.Time{})
+}
+
+// RequestGetWithDeadline is the same as RequestGet but the request is canceled at the deadline.
+// The zero deadline means no limit other than the timeout of the client.
+func RequestGetWithDeadline(client *http.Client, url string, headerMap map[string]string, deadline time.Time) (interface{}, error) {
+	return request(client, "GET", url, headerMap, deadline)
+}
+
+func RequestDelete(client *http.Client, url string, headerMap map[string]string) (interface{}, error) {
+	return request(client, "DELETE", url, headerMap, time.Time{})
+}
+
+// HealthCheck returns true if the url responds with the status 2xx
+func HealthCheck(client *http.Client, url string, headerMap map[string]string) (bool, error) {
+	response, err := Do(client, "GET", url, headerMap)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+	return response.StatusCode >= 200 && response.StatusCode < 300, nil
+}
+
+// Do sends the request and the caller needs to close the body of the response. The header with the empty value is not sent.
+func Do(client *http.Client, method string, url string, headerMap map[string]string) (*http.Response, error) {
+	request, err := newRequest(method, url, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(request)
+}
+
+func newRequest(method string, url string, headerMap map[string]string) (*http.Request, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	for key, value := range headerMap {
+		if value != "" {
+			request.Header.Set(key, value)
+		}
+	}
+	return request, nil
+}
+
+func request(client *http.Client, method string, url string, headerMap map[string]string, deadline time.Time) (interface{}, error) {
+	request, err := newRequest(method, url, headerMap)
+	if err != nil {
+		return nil, err
+	}
+	// The context is canceled after the body is read
+	if deadline.IsZero() == false {
+		ctx, cancel := context.WithDeadline(request.Context(), deadline)
+		defer cancel()
+		request = request.WithContext(ctx)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		byteSlice, _ := ioutil.ReadAll(response.Body)
+		return nil, errors.New(method + " " + url + " fails with status code " + strconv.Itoa(response.StatusCode) + " body " + string(byteSlice))
+	}
+
+	var result interface{}
+	decoder := json.NewDecoder(response.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
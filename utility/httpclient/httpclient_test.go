@@ -0,0 +1,90 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpclient
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRequestGetWithCertificateAuthority(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer token" {
+			responseWriter.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		responseWriter.Write([]byte(`{"usageCoreNanoSeconds": 12345678901234567}`))
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	file.Close()
+
+	tlsConfig, err := CreateTLSConfig(file.Name(), "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := CreateHTTPClient(tlsConfig, 5*time.Second)
+	result, err := RequestGet(client, server.URL, map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The large counter is not rounded by float64
+	if result.(map[string]interface{})["usageCoreNanoSeconds"] != json.Number("12345678901234567") {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	if _, err := RequestGet(client, server.URL, nil); err == nil {
+		t.Error("Expect unauthorized error")
+	}
+
+	// The server certificate is not signed by the system CA
+	tlsConfig, _ = CreateTLSConfig("", "", "", false)
+	if _, err := RequestGet(CreateHTTPClient(tlsConfig, 5*time.Second), server.URL, nil); err == nil {
+		t.Error("Expect certificate verification error")
+	}
+}
+
+func TestRequestGetWithDeadline(t *testing.T) {
+	blockChannel := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		select {
+		case <-blockChannel:
+		case <-request.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(blockChannel)
+
+	client := CreateHTTPClient(nil, 30*time.Second)
+	start := time.Now()
+	if _, err := RequestGetWithDeadline(client, server.URL, nil, start.Add(100*time.Millisecond)); err == nil {
+		t.Error("Expect deadline error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("The request is not canceled at the deadline but takes %s", time.Since(start))
+	}
+}
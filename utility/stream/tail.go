@@ -0,0 +1,137 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"github.com/cloudawan/cloudone_analysis/utility/configuration"
+	"github.com/cloudawan/cloudone_analysis/utility/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var log = logger.GetLogManager().GetLogger("utility")
+
+const (
+	pollIntervalInSecondDefault = 2
+	// The values buffered for each subscriber before they are dropped
+	DefaultBufferSize = 256
+)
+
+// GetPollInterval returns how often the storage is polled for the new values of the streams
+func GetPollInterval() time.Duration {
+	intervalInSecond, ok := configuration.LocalConfiguration.GetInt("streamPollIntervalInSecond")
+	if ok == false || intervalInSecond <= 0 {
+		intervalInSecond = pollIntervalInSecondDefault
+	}
+	return time.Duration(intervalInSecond) * time.Second
+}
+
+// PollFunction returns the values new since the last poll. The initial poll starts a new session after the tail
+// is idle so the source should only remember where it is now instead of returning the old values.
+type PollFunction func(initial bool) ([]interface{}, error)
+
+// Tail polls the source in the interval while there is any subscriber and delivers each new value to all
+// subscribers. The value is dropped for the subscriber whose buffer is full so a slow client never blocks the others.
+type Tail struct {
+	poll          PollFunction
+	interval      time.Duration
+	lock          sync.Mutex
+	subscriberMap map[*Subscriber]bool
+	running       bool
+}
+
+type Subscriber struct {
+	Channel      chan interface{}
+	droppedCount int64
+}
+
+func CreateTail(poll PollFunction, interval time.Duration) *Tail {
+	return &Tail{
+		poll:          poll,
+		interval:      interval,
+		subscriberMap: make(map[*Subscriber]bool),
+	}
+}
+
+// Subscribe starts polling if this is the first subscriber
+func (tail *Tail) Subscribe(bufferSize int) *Subscriber {
+	subscriber := &Subscriber{make(chan interface{}, bufferSize), 0}
+
+	tail.lock.Lock()
+	defer tail.lock.Unlock()
+
+	tail.subscriberMap[subscriber] = true
+	if tail.running == false {
+		tail.running = true
+		go tail.run()
+	}
+	return subscriber
+}
+
+// Unsubscribe returns the amount of the remaining subscribers. Polling stops after the last one leaves.
+func (tail *Tail) Unsubscribe(subscriber *Subscriber) int {
+	tail.lock.Lock()
+	defer tail.lock.Unlock()
+
+	delete(tail.subscriberMap, subscriber)
+	return len(tail.subscriberMap)
+}
+
+func (tail *Tail) GetSubscriberAmount() int {
+	tail.lock.Lock()
+	defer tail.lock.Unlock()
+
+	return len(tail.subscriberMap)
+}
+
+func (tail *Tail) run() {
+	ticker := time.NewTicker(tail.interval)
+	defer ticker.Stop()
+
+	initial := true
+	for {
+		valueSlice, err := tail.poll(initial)
+		if err != nil {
+			log.Error(err)
+		} else {
+			initial = false
+		}
+
+		tail.lock.Lock()
+		if len(tail.subscriberMap) == 0 {
+			tail.running = false
+			tail.lock.Unlock()
+			return
+		}
+		for subscriber, _ := range tail.subscriberMap {
+			for _, value := range valueSlice {
+				select {
+				case subscriber.Channel <- value:
+				default:
+					atomic.AddInt64(&subscriber.droppedCount, 1)
+				}
+			}
+		}
+		tail.lock.Unlock()
+
+		<-ticker.C
+	}
+}
+
+// TakeDroppedCount returns the amount of the values dropped since the last call
+func (subscriber *Subscriber) TakeDroppedCount() int64 {
+	return atomic.SwapInt64(&subscriber.droppedCount, 0)
+}
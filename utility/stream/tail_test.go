@@ -0,0 +1,77 @@
+// Copyright 2015 CloudAwan LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	lock := sync.Mutex{}
+	initialCount := 0
+	counter := 0
+	tail := CreateTail(func(initial bool) ([]interface{}, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if initial {
+			initialCount++
+			return nil, nil
+		}
+		counter++
+		return []interface{}{counter}, nil
+	}, 10*time.Millisecond)
+
+	fastSubscriber := tail.Subscribe(100)
+	// The buffer of one value is full after the first delivery
+	slowSubscriber := tail.Subscribe(1)
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case value := <-fastSubscriber.Channel:
+			if value != i {
+				t.Errorf("Expect %d but get %v", i, value)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for the value")
+		}
+	}
+	if value := <-slowSubscriber.Channel; value != 1 {
+		t.Errorf("Expect 1 but get %v", value)
+	}
+	if droppedCount := slowSubscriber.TakeDroppedCount(); droppedCount == 0 {
+		t.Error("Expect the values dropped for the slow subscriber")
+	}
+
+	if amount := tail.Unsubscribe(slowSubscriber); amount != 1 {
+		t.Errorf("Expect 1 subscriber left but get %d", amount)
+	}
+	if amount := tail.Unsubscribe(fastSubscriber); amount != 0 {
+		t.Errorf("Expect no subscriber left but get %d", amount)
+	}
+
+	// Wait for the polling to stop and start again with the initial poll
+	time.Sleep(50 * time.Millisecond)
+	subscriber := tail.Subscribe(100)
+	<-subscriber.Channel
+	tail.Unsubscribe(subscriber)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if initialCount != 2 {
+		t.Errorf("Expect 2 initial polls but get %d", initialCount)
+	}
+}